@@ -0,0 +1,158 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kind classifies what went wrong, so the outer layers can decide how to
+// report the error without comparing error strings
+type Kind int
+
+// Error kinds, the zero value is Internal so unclassified errors never
+// expose more than they should
+const (
+	Internal Kind = iota
+	InvalidInput
+	NotFound
+	UpstreamUnavailable
+	UpstreamLayoutChanged
+	CaptchaRequired
+	TooLarge
+	Infected
+	Forbidden
+)
+
+// kindInfo holds mapping of error kind to http response
+type kindInfo struct {
+	name   string
+	status int
+	code   string // stable error code used in api responses
+}
+
+var kinds = map[Kind]kindInfo{
+	Internal:              {"internal", http.StatusInternalServerError, "internal_error"},
+	InvalidInput:          {"invalid input", http.StatusBadRequest, "invalid_input"},
+	NotFound:              {"not found", http.StatusNotFound, "not_found"},
+	UpstreamUnavailable:   {"upstream unavailable", http.StatusServiceUnavailable, "upstream_unavailable"},
+	UpstreamLayoutChanged: {"upstream layout changed", http.StatusBadGateway, "upstream_layout_changed"},
+	CaptchaRequired:       {"captcha required", http.StatusTooManyRequests, "captcha_required"},
+	TooLarge:              {"too large", http.StatusRequestEntityTooLarge, "too_large"},
+	Infected:              {"infected", http.StatusUnprocessableEntity, "infected"},
+	Forbidden:             {"forbidden", http.StatusForbidden, "forbidden"},
+}
+
+func (k Kind) String() string {
+	if info, ok := kinds[k]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// Error is the application error type. Message describes the problem for
+// logs, user facing text is obtained via Message function.
+type Error struct {
+	Kind      Kind
+	Message   string
+	Err       error // wrapped cause, may be nil
+	Retryable bool  // trying again (or trying another source) may succeed
+}
+
+// New creates error of provided kind
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message, Retryable: kind == UpstreamUnavailable}
+}
+
+// Wrap creates error of provided kind that wraps the cause
+func Wrap(kind Kind, err error, message string) *Error {
+	e := New(kind, message)
+	e.Err = err
+	return e
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(msg) == 0 {
+		msg = e.Kind.String()
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns wrapped cause, so errors.Is/As could inspect it
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the same error or kind sentinel (error
+// without message and cause) of the same kind, which makes
+// errors.Is(err, apperror.ErrNotFound) work for all not found errors
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if e == t {
+		return true
+	}
+	return t.Kind == e.Kind && len(t.Message) == 0 && t.Err == nil
+}
+
+// Sentinels that could be used with errors.Is for matching error kinds
+var (
+	ErrInternal              = &Error{Kind: Internal}
+	ErrInvalidInput          = &Error{Kind: InvalidInput}
+	ErrNotFound              = &Error{Kind: NotFound}
+	ErrUpstreamUnavailable   = &Error{Kind: UpstreamUnavailable}
+	ErrUpstreamLayoutChanged = &Error{Kind: UpstreamLayoutChanged}
+	ErrCaptchaRequired       = &Error{Kind: CaptchaRequired}
+	ErrTooLarge              = &Error{Kind: TooLarge}
+	ErrInfected              = &Error{Kind: Infected}
+	ErrForbidden             = &Error{Kind: Forbidden}
+)
+
+// KindOf returns kind of the first application error in the chain or
+// Internal if err is not an application error
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
+
+// IsRetryable reports whether any application error in the chain is retryable
+func IsRetryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Retryable
+	}
+	return false
+}
+
+// Status returns http status code for the error
+func Status(err error) int {
+	return kinds[KindOf(err)].status
+}
+
+// Code returns stable api error code for the error, ex. "not_found"
+func Code(err error) string {
+	return kinds[KindOf(err)].code
+}
+
+// Language returns the first language from Accept-Language header that
+// has translated error messages or DefaultLanguage
+func Language(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		lang := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		lang = strings.ToLower(strings.SplitN(lang, "-", 2)[0])
+		if _, ok := messages[lang]; ok {
+			return lang
+		}
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,88 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_errorsIs(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Wrap(UpstreamUnavailable, cause, "Could not fetch article page")
+	wrapped := fmt.Errorf("fetching 10.1145/2854146: %w", err)
+
+	if !errors.Is(wrapped, ErrUpstreamUnavailable) {
+		t.Errorf("errors.Is(err, ErrUpstreamUnavailable) should be true")
+	}
+	if errors.Is(wrapped, ErrNotFound) {
+		t.Errorf("errors.Is(err, ErrNotFound) should be false")
+	}
+	if !errors.Is(wrapped, cause) {
+		t.Errorf("errors.Is(err, cause) should be true")
+	}
+
+	// errors with message only match themselves or kind sentinel
+	notFound := New(NotFound, "Article with this doi does not exist")
+	if errors.Is(New(NotFound, "other"), notFound) {
+		t.Errorf("errors.Is() should not match different error with message")
+	}
+
+	var e *Error
+	if !errors.As(wrapped, &e) || e.Kind != UpstreamUnavailable || !e.Retryable {
+		t.Errorf("errors.As() = %+v", e)
+	}
+}
+
+func Test_mapping(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{New(InvalidInput, "bad doi"), http.StatusBadRequest, "invalid_input"},
+		{New(NotFound, "missing"), http.StatusNotFound, "not_found"},
+		{New(UpstreamUnavailable, "down"), http.StatusServiceUnavailable, "upstream_unavailable"},
+		{New(UpstreamLayoutChanged, "layout"), http.StatusBadGateway, "upstream_layout_changed"},
+		{New(CaptchaRequired, "captcha"), http.StatusTooManyRequests, "captcha_required"},
+		{New(TooLarge, "big"), http.StatusRequestEntityTooLarge, "too_large"},
+		{New(Infected, "eicar"), http.StatusUnprocessableEntity, "infected"},
+		{New(Forbidden, "viewer"), http.StatusForbidden, "forbidden"},
+		{ErrForbidden, http.StatusForbidden, "forbidden"},
+		{errors.New("plain error"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, test := range tests {
+		if Status(test.err) != test.status || Code(test.err) != test.code {
+			t.Errorf("Status(%v), Code(%v) = %v, %v", test.err, test.err, Status(test.err), Code(test.err))
+			t.Errorf("Output should be: %v, %v", test.status, test.code)
+		}
+		for lang := range messages {
+			if len(Message(test.err, lang)) == 0 {
+				t.Errorf("Message(%v, %v) is empty", test.err, lang)
+			}
+		}
+	}
+}
+
+func Test_Language(t *testing.T) {
+	tests := []struct {
+		header string
+		output string
+	}{
+		{"", "en"},
+		{"sl-SI,sl;q=0.9,en;q=0.8", "sl"},
+		{"de-DE,de;q=0.9", "en"},
+		{"de-DE, sl;q=0.5", "sl"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", test.header)
+		if lang := Language(r); lang != test.output {
+			t.Errorf("Language(%v) = %v", test.header, lang)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package apperror
+
+// DefaultLanguage is used when the client does not accept any of the
+// translated languages
+const DefaultLanguage = "en"
+
+// messages contain user facing error messages per language. Messages never
+// include error details, those are only written to the server log.
+var messages = map[string]map[Kind]string{
+	"en": {
+		Internal:              "GoScience: Internal application error, try again later",
+		InvalidInput:          "Please check if doi string is correct",
+		NotFound:              "Article with this doi does not exist",
+		UpstreamUnavailable:   "Scihub servers are not available, try again later",
+		UpstreamLayoutChanged: "Scihub changed their website again, please inform developer to fix this issue",
+		CaptchaRequired:       "Scihub servers returned captcha, try again later",
+		TooLarge:              "Article is too large to be downloaded",
+		Infected:              "Article was blocked, because the antivirus scanner found a threat in the downloaded file",
+		Forbidden:             "You do not have permission for this action",
+	},
+	"sl": {
+		Internal:              "GoScience: Notranja napaka aplikacije, poskusite znova kasneje",
+		InvalidInput:          "Preverite, ali je doi pravilen",
+		NotFound:              "Članek s tem doi ne obstaja",
+		UpstreamUnavailable:   "Strežniki Scihub niso dosegljivi, poskusite znova kasneje",
+		UpstreamLayoutChanged: "Scihub je ponovno spremenil spletno stran, obvestite razvijalca",
+		CaptchaRequired:       "Strežniki Scihub so vrnili captcho, poskusite znova kasneje",
+		TooLarge:              "Članek je prevelik za prenos",
+		Infected:              "Članek je bil blokiran, ker je protivirusni program v preneseni datoteki našel grožnjo",
+		Forbidden:             "Za to dejanje nimate dovoljenja",
+	},
+}
+
+// Message returns localized user facing message for the error
+func Message(err error, lang string) string {
+	kind := KindOf(err)
+	if msg, ok := messages[lang][kind]; ok {
+		return msg
+	}
+	return messages[DefaultLanguage][kind]
+}
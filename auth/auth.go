@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultUser is the user name of everyone logging in with the shared
+// password from the configuration
+const DefaultUser = "goscience"
+
+// CookieName is the name of authentication cookie
+const CookieName = "GoScience"
+
+// User is account that can log into GoScience
+type User struct {
+	Name     string
+	Password string
+	Admin    bool // admins export and erase data of other users
+}
+
+var (
+	mu    sync.RWMutex
+	users = map[string]User{}
+)
+
+// SetUsers replaces known users. Shared password (if not empty) is added
+// as DefaultUser, so existing single password setups keep working.
+func SetUsers(list []User, sharedPassword string) {
+	m := map[string]User{}
+	if len(sharedPassword) > 0 {
+		m[DefaultUser] = User{Name: DefaultUser, Password: sharedPassword}
+	}
+	for _, u := range list {
+		m[u.Name] = u
+	}
+
+	mu.Lock()
+	users = m
+	mu.Unlock()
+}
+
+// Check reports whether user with provided name and password exists. Empty
+// name means DefaultUser.
+func Check(name, password string) bool {
+	if len(name) == 0 {
+		name = DefaultUser
+	}
+	mu.RLock()
+	u, ok := users[name]
+	mu.RUnlock()
+	return ok && len(password) > 0 && u.Password == password
+}
+
+// IsAdmin reports whether the user is admin
+func IsAdmin(name string) bool {
+	mu.RLock()
+	u, ok := users[name]
+	mu.RUnlock()
+	return ok && u.Admin
+}
+
+// Names returns sorted names of all users
+func Names() []string {
+	mu.RLock()
+	names := []string{}
+	for name := range users {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Remove removes the user, so they can not log in any more. Cookies of
+// the user stop working right away.
+func Remove(name string) {
+	mu.Lock()
+	delete(users, name)
+	mu.Unlock()
+}
+
+// Exists reports whether user exists
+func Exists(name string) bool {
+	mu.RLock()
+	_, ok := users[name]
+	mu.RUnlock()
+	return ok
+}
+
+// CookieValue creates authentication cookie value from user name and
+// hashed password
+func CookieValue(name, password string) (string, error) {
+	if len(name) == 0 {
+		name = DefaultUser
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return name + "|" + string(hash), nil
+}
+
+// VerifyCookie returns user name stored in the authentication cookie and
+// reports whether the hashed password still matches the user password.
+// Cookies created before named users existed contain only the hash and
+// belong to DefaultUser.
+func VerifyCookie(value string) (string, bool) {
+	name, hash := DefaultUser, value
+	if idx := strings.LastIndex(value, "|"); idx != -1 {
+		name, hash = value[:idx], value[idx+1:]
+	}
+
+	mu.RLock()
+	u, ok := users[name]
+	mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(u.Password)); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+type contextKey int
+
+const userKey contextKey = 0
+
+// WithUser returns request carrying authenticated user name
+func WithUser(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, name))
+}
+
+// UserName returns name of authenticated user or empty string when the
+// request passed no authentication middleware
+func UserName(r *http.Request) string {
+	return ContextUser(r.Context())
+}
+
+// ContextUser returns name of authenticated user stored in request context
+func ContextUser(ctx context.Context) string {
+	name, _ := ctx.Value(userKey).(string)
+	return name
+}
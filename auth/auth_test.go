@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_cookies(t *testing.T) {
+	SetUsers([]User{{Name: "ana", Password: "ana-pass"}}, "shared")
+	defer SetUsers(nil, "")
+
+	tests := []struct {
+		name     string
+		password string
+		user     string
+		ok       bool
+	}{
+		{"ana", "ana-pass", "ana", true},
+		{"", "shared", DefaultUser, true},
+		{"ana", "shared", "", false},
+		{"bob", "ana-pass", "", false},
+	}
+
+	for _, test := range tests {
+		if Check(test.name, test.password) != test.ok {
+			t.Errorf("Check(%v, %v) should be %v", test.name, test.password, test.ok)
+		}
+		value, err := CookieValue(test.name, test.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, ok := VerifyCookie(value)
+		if user != test.user || ok != test.ok {
+			t.Errorf("VerifyCookie() for %v = %v, %v", test.name, user, ok)
+			t.Errorf("Output should be: %v, %v", test.user, test.ok)
+		}
+	}
+
+	// cookies created before named users contain only the password hash
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("shared"), bcrypt.MinCost)
+	if user, ok := VerifyCookie(string(legacy)); !ok || user != DefaultUser {
+		t.Errorf("VerifyCookie(legacy) = %v, %v", user, ok)
+	}
+}
+
+func Test_Remove(t *testing.T) {
+	SetUsers([]User{{Name: "ana", Password: "a", Admin: true}, {Name: "bob", Password: "b"}}, "shared")
+	defer SetUsers(nil, "")
+
+	if !IsAdmin("ana") || IsAdmin("bob") || IsAdmin("carl") {
+		t.Errorf("IsAdmin() = %v, %v, %v", IsAdmin("ana"), IsAdmin("bob"), IsAdmin("carl"))
+	}
+	cookie, _ := CookieValue("bob", "b")
+	Remove("bob")
+	if names := Names(); len(names) != 2 || names[0] != "ana" || names[1] != DefaultUser {
+		t.Errorf("Names() = %v", names)
+	}
+	if Check("bob", "b") {
+		t.Errorf("Check() accepted removed user")
+	}
+	if _, ok := VerifyCookie(cookie); ok {
+		t.Errorf("VerifyCookie() accepted cookie of removed user")
+	}
+}
+
+func Test_UserName(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if name := UserName(r); name != "" {
+		t.Errorf("UserName() without middleware = %v", name)
+	}
+	if name := UserName(WithUser(r, "ana")); name != "ana" {
+		t.Errorf("UserName() = %v", name)
+	}
+}
@@ -0,0 +1,226 @@
+package batch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// Item statuses
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusSkipped = "skipped" // article was already in the library
+	StatusFailed  = "failed"
+)
+
+// keep is how long finished jobs are kept in memory by default
+const keep = 24 * time.Hour
+
+// Item is single article of the batch
+type Item struct {
+	Doi       string `json:"doi"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"` // apperror code of failed fetch
+	Retryable bool   `json:"retryable,omitempty"`
+	LibraryID string `json:"libraryId,omitempty"`
+}
+
+// Job is batch of articles fetched one after another in the background
+type Job struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user"`
+	Title      string    `json:"title"`                // description shown to the user, ex. "References of ..."
+	Collection string    `json:"collection,omitempty"` // fetched articles are added to the collection
+	Created    time.Time `json:"created"`
+	Finished   time.Time `json:"finished"`
+	Items      []Item    `json:"items"`
+}
+
+// Done reports whether all articles of the job were processed
+func (j Job) Done() bool {
+	return !j.Finished.IsZero()
+}
+
+// Processed returns number of articles that are not pending
+func (j Job) Processed() int {
+	n := 0
+	for _, item := range j.Items {
+		if item.Status != StatusPending {
+			n++
+		}
+	}
+	return n
+}
+
+// FetchFunc fetches article and saves it to the library of the user. It
+// returns library id of the article and reports whether the article was
+// already in the library.
+type FetchFunc func(user, doi, collection string) (id string, skipped bool, err error)
+
+// Runner runs batch jobs. Articles of all jobs are fetched one at a time,
+// so large batches do not get the server blocked by scihub.
+type Runner struct {
+	// Finished is called with finished job, ex. to notify the user
+	Finished func(job Job)
+	// Keep is how long finished jobs are kept
+	Keep time.Duration
+
+	fetch    FetchFunc
+	delay    time.Duration
+	fetching sync.Mutex // serializes fetches of all jobs
+	mu       sync.Mutex // guards jobs and their items
+	jobs     map[string]*Job
+}
+
+// NewRunner creates runner waiting delay between fetched articles
+func NewRunner(fetch FetchFunc, delay time.Duration) *Runner {
+	return &Runner{fetch: fetch, delay: delay, Keep: keep, jobs: map[string]*Job{}}
+}
+
+// Start starts fetching dois in the background, duplicate dois are
+// fetched once
+func (r *Runner) Start(user, title, collection string, dois []string) (Job, error) {
+	if len(dois) == 0 {
+		return Job{}, apperror.New(apperror.InvalidInput, "No articles selected")
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:         hex.EncodeToString(b),
+		User:       user,
+		Title:      title,
+		Collection: strings.TrimSpace(collection),
+		Created:    time.Now(),
+	}
+	seen := map[string]bool{}
+	for _, doi := range dois {
+		doi = strings.TrimSpace(doi)
+		if len(doi) == 0 || seen[strings.ToLower(doi)] {
+			continue
+		}
+		seen[strings.ToLower(doi)] = true
+		job.Items = append(job.Items, Item{Doi: doi, Status: StatusPending})
+	}
+
+	r.Purge(time.Now().Add(-r.Keep))
+	r.mu.Lock()
+	r.jobs[job.ID] = job
+	snapshot := copyJob(job)
+	r.mu.Unlock()
+
+	go r.run(job)
+	return snapshot, nil
+}
+
+// run fetches articles of the job
+func (r *Runner) run(job *Job) {
+	for i := range job.Items {
+		r.fetching.Lock()
+		r.mu.Lock()
+		_, ok := r.jobs[job.ID]
+		r.mu.Unlock()
+		if !ok {
+			// job was removed together with data of its user
+			r.fetching.Unlock()
+			return
+		}
+		id, skipped, err := r.fetch(job.User, job.Items[i].Doi, job.Collection)
+		if !skipped {
+			time.Sleep(r.delay)
+		}
+		r.fetching.Unlock()
+
+		r.mu.Lock()
+		item := &job.Items[i]
+		item.LibraryID = id
+		switch {
+		case err != nil:
+			item.Status = StatusFailed
+			item.Error = apperror.Code(err)
+			item.Retryable = apperror.IsRetryable(err)
+		case skipped:
+			item.Status = StatusSkipped
+		default:
+			item.Status = StatusDone
+		}
+		r.mu.Unlock()
+	}
+	r.mu.Lock()
+	job.Finished = time.Now()
+	snapshot := copyJob(job)
+	r.mu.Unlock()
+	if r.Finished != nil {
+		r.Finished(snapshot)
+	}
+}
+
+// Get returns job of the user
+func (r *Runner) Get(user, id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || job.User != user {
+		return Job{}, false
+	}
+	return copyJob(job), true
+}
+
+// List returns jobs of the user, the newest first
+func (r *Runner) List(user string) []Job {
+	r.mu.Lock()
+	list := []Job{}
+	for _, job := range r.jobs {
+		if job.User == user {
+			list = append(list, copyJob(job))
+		}
+	}
+	r.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	return list
+}
+
+// Purge removes jobs finished before the time, it returns number of
+// removed jobs
+func (r *Runner) Purge(before time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed := 0
+	for id, job := range r.jobs {
+		if job.Done() && job.Finished.Before(before) {
+			delete(r.jobs, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// RemoveUser removes all jobs of the user, running jobs stop before
+// fetching the next article
+func (r *Runner) RemoveUser(user string) {
+	// waiting for the current fetch, so nothing is saved for the user
+	// after RemoveUser returns
+	r.fetching.Lock()
+	defer r.fetching.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, job := range r.jobs {
+		if job.User == user {
+			delete(r.jobs, id)
+		}
+	}
+}
+
+// copyJob returns copy of the job that is safe to use while the job runs
+func copyJob(job *Job) Job {
+	c := *job
+	c.Items = append([]Item{}, job.Items...)
+	return c
+}
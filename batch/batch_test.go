@@ -0,0 +1,119 @@
+package batch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+func Test_Runner(t *testing.T) {
+	fetch := func(user, doi, collection string) (string, bool, error) {
+		switch doi {
+		case "10.1000/missing":
+			return "", false, apperror.New(apperror.NotFound, "missing")
+		case "10.1000/saved":
+			return "saved-id", true, nil
+		}
+		return "id-" + doi, false, nil
+	}
+	r := NewRunner(fetch, 0)
+	finished := make(chan Job, 1)
+	r.Finished = func(job Job) { finished <- job }
+
+	if _, err := r.Start("ana", "empty", "", nil); err == nil {
+		t.Errorf("Start() accepted empty batch")
+	}
+	job, err := r.Start("ana", "References", "Cited", []string{"10.1000/a", "10.1000/missing", " 10.1000/A", "10.1000/saved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Items) != 3 {
+		t.Errorf("Start() = %v items, duplicate dois should be removed", len(job.Items))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !job.Done() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		job, _ = r.Get("ana", job.ID)
+	}
+	if !job.Done() || job.Processed() != 3 {
+		t.Fatalf("job did not finish: %+v", job)
+	}
+
+	expected := []Item{
+		{Doi: "10.1000/a", Status: StatusDone, LibraryID: "id-10.1000/a"},
+		{Doi: "10.1000/missing", Status: StatusFailed, Error: "not_found"},
+		{Doi: "10.1000/saved", Status: StatusSkipped, LibraryID: "saved-id"},
+	}
+	for i, item := range job.Items {
+		if item != expected[i] {
+			t.Errorf("job item = %+v", item)
+			t.Errorf("Output should be: %+v", expected[i])
+		}
+	}
+
+	select {
+	case f := <-finished:
+		if f.ID != job.ID || !f.Done() {
+			t.Errorf("Finished called with %+v", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Finished was not called")
+	}
+
+	if _, ok := r.Get("bob", job.ID); ok {
+		t.Errorf("Get() returned job of another user")
+	}
+	if list := r.List("ana"); len(list) != 1 || list[0].ID != job.ID {
+		t.Errorf("List() = %v", list)
+	}
+}
+
+func Test_RemoveUser(t *testing.T) {
+	fetched := make(chan string, 10)
+	release := make(chan bool)
+	fetch := func(user, doi, collection string) (string, bool, error) {
+		fetched <- doi
+		<-release
+		return "id-" + doi, false, nil
+	}
+	r := NewRunner(fetch, 0)
+	job, err := r.Start("ana", "Slow", "", []string{"10.1000/a", "10.1000/b", "10.1000/c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-fetched
+
+	// RemoveUser waits for the running fetch
+	removed := make(chan bool)
+	go func() {
+		r.RemoveUser("ana")
+		close(removed)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-removed
+	if _, ok := r.Get("ana", job.ID); ok {
+		t.Errorf("Get() returned job of removed user")
+	}
+	before := len(fetched)
+	time.Sleep(50 * time.Millisecond)
+	if len(fetched) != before {
+		t.Errorf("articles of removed user were fetched after RemoveUser()")
+	}
+
+	other, _ := r.Start("bob", "Other", "", []string{"10.1000/d"})
+	deadline := time.Now().Add(5 * time.Second)
+	for !other.Done() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		other, _ = r.Get("bob", other.ID)
+	}
+	if n := r.Purge(time.Now().Add(-time.Hour)); n != 0 {
+		t.Errorf("Purge() of recent jobs = %v", n)
+	}
+	if n := r.Purge(time.Now().Add(time.Second)); n != 1 {
+		t.Errorf("Purge() = %v", n)
+		t.Errorf("Output should be: %v", 1)
+	}
+}
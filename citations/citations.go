@@ -0,0 +1,197 @@
+package citations
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/greatdanton/goScience/metadata"
+)
+
+// maxCiting limits number of displayed citing works, highly cited
+// articles are cited by thousands of works
+const maxCiting = 100
+
+// maxGraphNodes limits number of nodes drawn on each side of the graph
+const maxGraphNodes = 60
+
+// Node is work in citation graph
+type Node struct {
+	Doi       string `json:"doi,omitempty"`
+	Title     string `json:"title"`
+	Year      int    `json:"year,omitempty"`
+	Author    string `json:"author,omitempty"` // first author
+	InLibrary bool   `json:"inLibrary"`
+}
+
+// Graph is citation neighborhood of the article: works it cites and
+// works citing it
+type Graph struct {
+	Article    Node   `json:"article"`
+	Journal    string `json:"journal,omitempty"`
+	References []Node `json:"references"`
+	CitedBy    []Node `json:"citedBy"`
+	// CitedByTotal is number of all citing works, only the most recent
+	// are listed
+	CitedByTotal int `json:"citedByTotal"`
+	// CitedByUnavailable is set when the citations service failed
+	CitedByUnavailable bool `json:"citedByUnavailable,omitempty"`
+}
+
+// Build looks up article, its references and citing works on metadata
+// services. Failure of the citations service is reported in the graph,
+// so the references are still displayed. inLibrary reports whether work
+// is saved in the library, nil when the library is disabled.
+func Build(doi string, inLibrary func(doi string) bool) (Graph, error) {
+	work, err := metadata.Lookup(doi)
+	if err != nil {
+		return Graph{}, err
+	}
+	g := Graph{Article: node(work), Journal: work.Journal, References: []Node{}, CitedBy: []Node{}}
+	if len(g.Article.Doi) == 0 {
+		g.Article.Doi = doi
+	}
+
+	// references deposited with doi only need their titles looked up
+	missing := []string{}
+	for _, ref := range work.References {
+		n := Node{Doi: ref.Doi, Title: ref.Title, Year: ref.Year, Author: ref.Author}
+		if len(n.Title) == 0 {
+			n.Title = ref.Text
+			if len(n.Doi) > 0 {
+				missing = append(missing, n.Doi)
+			}
+		}
+		g.References = append(g.References, n)
+	}
+	if len(missing) > 0 {
+		works, err := lookup(missing)
+		if err != nil {
+			fmt.Printf("Could not look up references: %v\n", err)
+		}
+		for i, n := range g.References {
+			if w, ok := works[strings.ToLower(n.Doi)]; ok {
+				g.References[i] = node(w)
+			}
+		}
+	}
+
+	citing, err := metadata.Citing(g.Article.Doi)
+	if err != nil {
+		fmt.Printf("Could not look up citing works: %v\n", err)
+		g.CitedByUnavailable = true
+	}
+	g.CitedByTotal = len(citing)
+	if len(citing) > maxCiting {
+		citing = citing[:maxCiting]
+	}
+	dois := []string{}
+	for _, c := range citing {
+		dois = append(dois, c.Doi)
+	}
+	works, err := lookup(dois)
+	if err != nil {
+		fmt.Printf("Could not look up citing works: %v\n", err)
+	}
+	for _, c := range citing {
+		n := Node{Doi: c.Doi, Title: c.Doi}
+		if w, ok := works[strings.ToLower(c.Doi)]; ok {
+			n = node(w)
+		}
+		g.CitedBy = append(g.CitedBy, n)
+	}
+
+	if inLibrary != nil {
+		g.Article.InLibrary = inLibrary(g.Article.Doi)
+		for _, list := range [][]Node{g.References, g.CitedBy} {
+			for i := range list {
+				list[i].InLibrary = len(list[i].Doi) > 0 && inLibrary(list[i].Doi)
+			}
+		}
+	}
+	return g, nil
+}
+
+// lookup returns works by lowercase doi
+func lookup(dois []string) (map[string]metadata.Work, error) {
+	works := map[string]metadata.Work{}
+	if len(dois) == 0 {
+		return works, nil
+	}
+	list, err := metadata.LookupMany(dois)
+	for _, w := range list {
+		works[strings.ToLower(w.Doi)] = w
+	}
+	return works, err
+}
+
+func node(w metadata.Work) Node {
+	n := Node{Doi: w.Doi, Title: w.Title, Year: w.Year}
+	if len(w.Authors) > 0 {
+		n.Author = w.Authors[0]
+	}
+	if len(n.Title) == 0 {
+		n.Title = w.Doi
+	}
+	return n
+}
+
+// SVG draws the article in the middle, references on the left and citing
+// works on the right. Nodes link to their own graph, works saved in the
+// library are green.
+func (g Graph) SVG() string {
+	const width, height, radius = 640.0, 420.0, 180.0
+	cx, cy := width/2, height/2
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="citation-graph" viewBox="0 0 %v %v">`, width, height)
+
+	side := func(nodes []Node, from, to float64) {
+		if len(nodes) > maxGraphNodes {
+			nodes = nodes[:maxGraphNodes]
+		}
+		for i, n := range nodes {
+			angle := (from + to) / 2
+			if len(nodes) > 1 {
+				angle = from + (to-from)*float64(i)/float64(len(nodes)-1)
+			}
+			x := cx + radius*math.Cos(angle*math.Pi/180)
+			y := cy - radius*math.Sin(angle*math.Pi/180)
+			fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ccc" />`, cx, cy, x, y)
+			graphNode(&b, n, x, y, 5, nodeColor(n))
+		}
+	}
+	// references on the left half, citing works on the right half
+	side(g.References, 100, 260)
+	side(g.CitedBy, 80, -80)
+	graphNode(&b, g.Article, cx, cy, 9, "#1f5fbf")
+
+	fmt.Fprintf(&b, `<text x="10" y="20">References (%v)</text>`, len(g.References))
+	fmt.Fprintf(&b, `<text x="%v" y="20" text-anchor="end">Cited by (%v)</text>`, width-10, g.CitedByTotal)
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+func nodeColor(n Node) string {
+	if n.InLibrary {
+		return "#2a8a2a"
+	}
+	return "#999"
+}
+
+// graphNode draws node circle with tooltip, nodes with doi link to their
+// graph
+func graphNode(b *strings.Builder, n Node, x, y, r float64, color string) {
+	label := n.Title
+	if n.Year > 0 {
+		label = fmt.Sprintf("%v (%v)", label, n.Year)
+	}
+	if len(n.Doi) > 0 {
+		fmt.Fprintf(b, `<a href="%v">`, html.EscapeString("/article?doi="+url.QueryEscape(n.Doi)))
+	}
+	fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="%v" fill="%v"><title>%v</title></circle>`, x, y, r, color, html.EscapeString(label))
+	if len(n.Doi) > 0 {
+		b.WriteString(`</a>`)
+	}
+}
@@ -0,0 +1,123 @@
+package citations
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/greatdanton/goScience/metadata"
+)
+
+// fakeServices serves both Crossref and OpenCitations apis
+func fakeServices(citations bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.EscapedPath(); {
+		case path == "/works/10.1145%2F2854146":
+			w.Write([]byte(`{"message": {"DOI": "10.1145/2854146", "title": ["Why Google stores <i>billions</i> of lines"],
+				"container-title": ["Communications of the ACM"], "issued": {"date-parts": [[2016]]},
+				"author": [{"given": "Rachel", "family": "Potvin"}],
+				"reference": [
+					{"DOI": "10.1145/1294261.1294281", "article-title": "Bigtable", "year": "2008"},
+					{"DOI": "10.1000/untitled"},
+					{"unstructured": "Perry D. Parallel changes. TOSEM 2001."}
+				]}}`))
+		case path == "/works":
+			filter := r.URL.Query().Get("filter")
+			items := []string{}
+			if strings.Contains(filter, "doi:10.1000/untitled") {
+				items = append(items, `{"DOI": "10.1000/untitled", "title": ["Found title"], "issued": {"date-parts": [[2010]]}}`)
+			}
+			if strings.Contains(filter, "doi:10.1000/citing") {
+				items = append(items, `{"DOI": "10.1000/citing", "title": ["Citing work"], "issued": {"date-parts": [[2020]]}}`)
+			}
+			w.Write([]byte(`{"message": {"items": [` + strings.Join(items, ",") + `]}}`))
+		case strings.HasPrefix(path, "/citations/") && citations:
+			w.Write([]byte(`[{"citing": "10.1000/citing", "creation": "2020-01"}, {"citing": "10.1000/unknown", "creation": "2019"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func Test_Build(t *testing.T) {
+	server := fakeServices(true)
+	defer server.Close()
+	metadata.ServiceURL, metadata.CitationsURL = server.URL, server.URL
+	defer func() { metadata.ServiceURL, metadata.CitationsURL = metadata.DefaultURL, metadata.DefaultCitationsURL }()
+
+	saved := func(doi string) bool { return doi == "10.1000/citing" || doi == "10.1145/2854146" }
+	g, err := Build("10.1145/2854146", saved)
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+
+	expected := Graph{
+		Article: Node{Doi: "10.1145/2854146", Title: "Why Google stores billions of lines", Year: 2016, Author: "Rachel Potvin", InLibrary: true},
+		References: []Node{
+			{Doi: "10.1145/1294261.1294281", Title: "Bigtable", Year: 2008},
+			{Doi: "10.1000/untitled", Title: "Found title", Year: 2010},
+			{Title: "Perry D. Parallel changes. TOSEM 2001."},
+		},
+		CitedBy: []Node{
+			{Doi: "10.1000/citing", Title: "Citing work", Year: 2020, InLibrary: true},
+			{Doi: "10.1000/unknown", Title: "10.1000/unknown"},
+		},
+	}
+	if g.Article != expected.Article {
+		t.Errorf("Build() article = %+v", g.Article)
+		t.Errorf("Output should be: %+v", expected.Article)
+	}
+	for i, list := range [][]Node{g.References, g.CitedBy} {
+		want := [][]Node{expected.References, expected.CitedBy}[i]
+		if len(list) != len(want) {
+			t.Errorf("Build() = %+v", list)
+			t.Errorf("Output should be: %+v", want)
+			continue
+		}
+		for j := range list {
+			if list[j] != want[j] {
+				t.Errorf("Build() node = %+v", list[j])
+				t.Errorf("Output should be: %+v", want[j])
+			}
+		}
+	}
+	if g.CitedByTotal != 2 || g.CitedByUnavailable {
+		t.Errorf("Build() cited by = %v, %v", g.CitedByTotal, g.CitedByUnavailable)
+	}
+
+	svg := g.SVG()
+	for _, str := range []string{
+		`<a href="/article?doi=10.1000%2Fciting"><circle`,
+		`fill="#2a8a2a"><title>Citing work (2020)</title>`,
+		`<title>Perry D. Parallel changes. TOSEM 2001.</title>`,
+		`References (3)`,
+		`Cited by (2)`,
+	} {
+		if !strings.Contains(svg, str) {
+			t.Errorf("SVG() does not contain %v:\n%v", str, svg)
+		}
+	}
+	if strings.Count(svg, "<circle") != 6 {
+		t.Errorf("SVG() has %v nodes, should have 6", strings.Count(svg, "<circle"))
+	}
+}
+
+func Test_BuildWithoutCitations(t *testing.T) {
+	server := fakeServices(false)
+	defer server.Close()
+	metadata.ServiceURL, metadata.CitationsURL = server.URL, server.URL
+	defer func() { metadata.ServiceURL, metadata.CitationsURL = metadata.DefaultURL, metadata.DefaultCitationsURL }()
+
+	g, err := Build("10.1145/2854146", nil)
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	if !g.CitedByUnavailable || len(g.CitedBy) != 0 || len(g.References) != 3 {
+		t.Errorf("Build() = %+v", g)
+	}
+
+	if _, err := Build("10.1000/missing", nil); err == nil {
+		t.Errorf("Build() of unknown work should return error")
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultUserAgent is sent with every outbound request when no user agent
+// is set in the configuration
+const DefaultUserAgent = "GoScience"
+
+// DefaultTimeout is used when the configuration does not specify request timeout
+const DefaultTimeout = 30 * time.Second
+
+// Config holds settings of the outbound http client used for fetching
+// articles, captchas and metadata. All timeouts are in seconds, zero values
+// fall back to sensible defaults.
+type Config struct {
+	Timeout             int    // overall request timeout
+	ConnectTimeout      int    // tcp dial timeout
+	TLSHandshakeTimeout int    // tls handshake timeout
+	UserAgent           string // User-Agent header sent to upstream servers
+	Proxy               string // outbound proxy url: http://, https:// or socks5://
+	CABundle            string // path to PEM file with additional trusted certificates
+	MaxIdleConns        int    // max idle connections across all hosts
+	MaxIdleConnsPerHost int    // max idle connections per host
+	MaxConnsPerHost     int    // max connections per host (0 means no limit)
+}
+
+// New creates http client from provided configuration or returns an error
+// if proxy url or CA bundle are not valid
+func New(conf Config) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   seconds(conf.ConnectTimeout, 10*time.Second),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: seconds(conf.TLSHandshakeTimeout, 10*time.Second),
+		MaxIdleConns:        conf.MaxIdleConns,
+		MaxIdleConnsPerHost: conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     conf.MaxConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if transport.MaxIdleConns == 0 {
+		transport.MaxIdleConns = 100
+	}
+
+	if len(conf.Proxy) > 0 {
+		proxyURL, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse proxy url: %v", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("Unsupported proxy scheme: %v", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if len(conf.CABundle) > 0 {
+		pool, err := loadCABundle(conf.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	userAgent := conf.UserAgent
+	if len(userAgent) == 0 {
+		userAgent = DefaultUserAgent
+	}
+
+	client := &http.Client{
+		Transport: &userAgentTransport{userAgent: userAgent, next: transport},
+		Timeout:   seconds(conf.Timeout, DefaultTimeout),
+	}
+	return client, nil
+}
+
+// loadCABundle appends certificates from PEM file to the system cert pool,
+// so the corporate CAs are trusted alongside the public ones
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read CA bundle: %v", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %v does not contain any valid certificate", path)
+	}
+	return pool, nil
+}
+
+// seconds turns configured number of seconds into duration or returns
+// fallback if value is not set
+func seconds(value int, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return time.Duration(value) * time.Second
+}
+
+// userAgentTransport sets User-Agent header on every outgoing request
+// that does not set its own
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if len(r.Header.Get("User-Agent")) == 0 {
+		r = r.Clone(r.Context())
+		r.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(r)
+}
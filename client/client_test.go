@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_userAgent(t *testing.T) {
+	tests := []struct {
+		conf   Config
+		output string
+	}{
+		{Config{}, DefaultUserAgent},
+		{Config{UserAgent: "LabProxy/1.0"}, "LabProxy/1.0"},
+	}
+
+	for _, test := range tests {
+		var got string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("User-Agent")
+		}))
+
+		c, err := New(test.conf)
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+		resp, err := c.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get() returned error: %v", err)
+		}
+		resp.Body.Close()
+		server.Close()
+
+		if got != test.output {
+			t.Errorf("User-Agent = %v", got)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
+
+// requests sent through http proxy contain absolute url of the upstream server
+func Test_proxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	c, err := New(Config{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	resp, err := c.Get("http://sci-hub.example/10.1145/2854146")
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if requested != "http://sci-hub.example/10.1145/2854146" {
+		t.Errorf("proxy received request for %v", requested)
+	}
+}
+
+func Test_invalidConfig(t *testing.T) {
+	tests := []Config{
+		{Proxy: "ftp://proxy.example:21"},
+		{CABundle: "testdata/does-not-exist.pem"},
+	}
+
+	for _, test := range tests {
+		if _, err := New(test); err == nil {
+			t.Errorf("New(%+v) should return an error", test)
+		}
+	}
+}
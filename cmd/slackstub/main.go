@@ -0,0 +1,89 @@
+// slackstub stands in for a chat server with Slack compatible slash
+// commands. It sends signed command to GoScience, prints the immediate
+// response and waits for the delayed message posted to its response url.
+//
+//	go run ./cmd/slackstub -secret secret /paper 10.1145/2854146
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/slack"
+)
+
+func main() {
+	target := flag.String("url", "http://localhost:8080/slack/command", "GoScience slash command endpoint")
+	secret := flag.String("secret", "", "signing secret from GoScience configuration")
+	listen := flag.String("listen", "127.0.0.1:0", "address receiving delayed responses")
+	user := flag.String("user", "stub", "chat user name sent with the command")
+	wait := flag.Duration("wait", 2*time.Minute, "how long to wait for delayed response")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("usage: slackstub [flags] /paper|/cite <doi>")
+		os.Exit(2)
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	posted := make(chan slack.Message, 1)
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := slack.Message{}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posted <- msg
+	}))
+
+	form := url.Values{
+		"command":      {flag.Arg(0)},
+		"text":         {strings.Join(flag.Args()[1:], " ")},
+		"user_id":      {"U0STUB"},
+		"user_name":    {*user},
+		"channel_id":   {"C0STUB"},
+		"team_id":      {"T0STUB"},
+		"response_url": {"http://" + ln.Addr().String() + "/response"},
+	}
+	body := form.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest("POST", *target, strings.NewReader(body))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", slack.Sign(*secret, timestamp, []byte(body)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	reply, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	fmt.Printf("%v %v\n", resp.Status, strings.TrimSpace(string(reply)))
+	if resp.StatusCode != http.StatusOK {
+		os.Exit(1)
+	}
+
+	select {
+	case msg := <-posted:
+		fmt.Printf("[%v] %v\n", msg.ResponseType, msg.Text)
+	case <-time.After(*wait):
+		fmt.Println("no delayed response was posted")
+		os.Exit(1)
+	}
+}
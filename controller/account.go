@@ -0,0 +1,361 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/downloadlog"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/team"
+)
+
+var adminTemplate = template.Must(template.New("admin.html").Funcs(templateFuncs).ParseFiles("templates/admin.html"))
+
+var errAdminOnly = apperror.New(apperror.Forbidden, "Only admins could manage data of other users")
+
+// adminUser is user listed on the admin page
+type adminUser struct {
+	Name     string
+	Admin    bool
+	Articles int
+}
+
+// adminPage is used for populating admin.html template
+type adminPage struct {
+	Users       []adminUser
+	Erased      map[string]time.Time
+	Shared      string // user of the shared password, its account can not be deleted
+	Unconfirmed string // user whose deletion was not confirmed
+}
+
+// Admin lists users, so admins could export and erase their data
+func Admin(w http.ResponseWriter, r *http.Request) {
+	if !auth.IsAdmin(auth.UserName(r)) {
+		libraryError(w, r, errAdminOnly)
+		return
+	}
+	page := adminPage{Shared: auth.DefaultUser, Unconfirmed: r.FormValue("unconfirmed")}
+	for _, name := range auth.Names() {
+		u := adminUser{Name: name, Admin: auth.IsAdmin(name)}
+		if global.Library != nil {
+			items, err := global.Library.List(name, library.Query{})
+			if err != nil {
+				fmt.Println(err)
+			}
+			u.Articles = len(items)
+		}
+		page.Users = append(page.Users, u)
+	}
+	if global.Erased != nil {
+		var err error
+		if page.Erased, err = global.Erased.Erased(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := adminTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// accountUser returns user whose data the request manages, admins could
+// select other users
+func accountUser(r *http.Request) (string, error) {
+	user := auth.UserName(r)
+	if other := r.FormValue("user"); len(other) > 0 && other != user {
+		if !auth.IsAdmin(user) {
+			return "", errAdminOnly
+		}
+		return other, nil
+	}
+	return user, nil
+}
+
+// ExportData sends zip archive with download history, library metadata,
+// notes and settings of the user
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	user, err := accountUser(r)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	data, err := exportData(user)
+	if err != nil {
+		libraryError(w, r, apperror.Wrap(apperror.Internal, err, "Could not export data"))
+		return
+	}
+	name := fmt.Sprintf("goscience-%v-%v.zip", user, time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Write(data)
+	log.Printf("Exported data of %v for %v", user, auth.UserName(r))
+}
+
+// DeleteAccount erases all data of the user and deletes their account.
+// The form has to repeat the user name to confirm. Data of the shared
+// password user is erased, but the account stays.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, err := accountUser(r)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if r.FormValue("confirm") != user {
+		if user != auth.UserName(r) {
+			http.Redirect(w, r, "/admin?unconfirmed="+url.QueryEscape(user), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/settings?delete=unconfirmed", http.StatusSeeOther)
+		return
+	}
+	if err := eraseData(user); err != nil {
+		if apperror.KindOf(err) != apperror.InvalidInput {
+			err = apperror.Wrap(apperror.Internal, err, "Could not erase all data, please try again")
+		}
+		libraryError(w, r, err)
+		return
+	}
+	if user != auth.DefaultUser {
+		auth.Remove(user)
+		if global.Erased != nil {
+			if err := global.Erased.MarkErased(user); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+	log.Printf("Erased data of %v for %v", user, auth.UserName(r))
+
+	if user != auth.UserName(r) {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: auth.CookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// exportData returns zip archive with json files of all data stored for
+// the user and notes as markdown
+func exportData(user string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+	add := func(name string, v interface{}) error {
+		f, err := create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	entries, err := global.DownloadLog.Entries()
+	if err != nil {
+		return nil, err
+	}
+	history := []downloadlog.Entry{}
+	for _, e := range entries {
+		if e.User == user {
+			history = append(history, e)
+		}
+	}
+	if err := add("history.json", history); err != nil {
+		return nil, err
+	}
+
+	if global.Library != nil {
+		items, err := global.Library.List(user, library.Query{})
+		if err != nil {
+			return nil, err
+		}
+		if err := add("library.json", items); err != nil {
+			return nil, err
+		}
+		f, err := create("notes.md")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if len(item.Note) > 0 {
+				fmt.Fprintf(f, "# %v\n\n%v\n\n%v\n\n", item.Title, item.Doi, item.Note)
+			}
+		}
+	}
+
+	if global.Teams != nil {
+		teams, err := global.Teams.List(user)
+		if err != nil {
+			return nil, err
+		}
+		if err := add("teams.json", teams); err != nil {
+			return nil, err
+		}
+	}
+	if global.Shares != nil {
+		links, err := global.Shares.List(user, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := add("shares.json", links); err != nil {
+			return nil, err
+		}
+	}
+	if global.Watch != nil {
+		watches, err := global.Watch.Store.List(user)
+		if err != nil {
+			return nil, err
+		}
+		found, err := global.Watch.Store.Found(user)
+		if err != nil {
+			return nil, err
+		}
+		if err := add("watches.json", watches); err != nil {
+			return nil, err
+		}
+		if err := add("found.json", found); err != nil {
+			return nil, err
+		}
+	}
+	if global.Webhooks != nil {
+		subs, err := global.Webhooks.Store.List(user)
+		if err != nil {
+			return nil, err
+		}
+		// secrets sign webhook payloads, they are not needed by the user
+		for i := range subs {
+			subs[i].Secret = ""
+		}
+		if err := add("webhooks.json", subs); err != nil {
+			return nil, err
+		}
+	}
+	if global.Tokens != nil {
+		list, err := global.Tokens.List(user)
+		if err != nil {
+			return nil, err
+		}
+		if err := add("tokens.json", list); err != nil {
+			return nil, err
+		}
+	}
+	if global.Mail != nil {
+		settings, err := global.Mail.Store.Get(user)
+		if err != nil {
+			return nil, err
+		}
+		if err := add("mail.json", settings); err != nil {
+			return nil, err
+		}
+	}
+	if global.Batch != nil {
+		if err := add("jobs.json", global.Batch.List(user)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// eraseData removes everything stored for the user. Erasing stops at the
+// first error, every step could be repeated, so the request could be sent
+// again. Teams owned by the user are handed over to their editors first,
+// so nothing is erased when a team could not get a new owner.
+func eraseData(user string) error {
+	if len(user) == 0 {
+		return apperror.New(apperror.Internal, "erased user is not set")
+	}
+	if global.Teams != nil {
+		deleted, err := global.Teams.RemoveUser(user)
+		if err != nil {
+			return err
+		}
+		for _, id := range deleted {
+			if err := deleteLibrary(team.Library(id)); err != nil {
+				return err
+			}
+		}
+	}
+	// running batch jobs would save articles to the erased library
+	if global.Batch != nil {
+		global.Batch.RemoveUser(user)
+	}
+	if global.Library != nil {
+		if err := deleteLibrary(user); err != nil {
+			return err
+		}
+	}
+	if global.Shares != nil {
+		if err := global.Shares.RemoveUser(user); err != nil {
+			return err
+		}
+	}
+	if global.Watch != nil {
+		if err := global.Watch.Store.RemoveUser(user); err != nil {
+			return err
+		}
+	}
+	if global.Webhooks != nil {
+		subs, err := global.Webhooks.Store.List(user)
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if err := global.Webhooks.Store.Delete(user, sub.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if global.Tokens != nil {
+		list, err := global.Tokens.List(user)
+		if err != nil {
+			return err
+		}
+		for _, t := range list {
+			if err := global.Tokens.Revoke(user, t.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if global.Mail != nil {
+		if err := global.Mail.Store.Delete(user); err != nil {
+			return err
+		}
+	}
+	_, err := global.DownloadLog.Remove(func(e downloadlog.Entry) bool { return e.User == user })
+	return err
+}
+
+// deleteLibrary removes library of the user or the team together with
+// its search index
+func deleteLibrary(user string) error {
+	if global.Search != nil {
+		if err := global.Search.RemoveUser(user); err != nil {
+			return err
+		}
+	}
+	if err := global.Library.DeleteUser(user); err != nil && err != library.ErrNotFound {
+		return err
+	}
+	return nil
+}
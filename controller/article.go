@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/citations"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+)
+
+var articleTemplate = template.Must(template.New("article.html").Funcs(templateFuncs).ParseFiles("templates/article.html"))
+
+// articlePage is used for populating article.html template
+type articlePage struct {
+	citations.Graph
+	SVG     template.HTML
+	Library bool
+}
+
+// Article displays article with its references and works citing it, so
+// related articles could be fetched with one click
+func Article(w http.ResponseWriter, r *http.Request) {
+	found, ok := doi.Extract(r.FormValue("doi"))
+	if !ok {
+		renderDownloadError(w, r, r.FormValue("doi"), ErrDoiNotFound)
+		return
+	}
+
+	var inLibrary func(string) bool
+	if global.Library != nil {
+		user := auth.UserName(r)
+		inLibrary = func(doi string) bool {
+			_, err := global.Library.Get(user, library.ItemID(doi))
+			return err == nil
+		}
+	}
+	graph, err := citations.Build(found, inLibrary)
+	if err != nil {
+		renderDownloadError(w, r, found, err)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(graph); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	page := articlePage{Graph: graph, SVG: template.HTML(graph.SVG()), Library: global.Library != nil}
+	if err := articleTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
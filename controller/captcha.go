@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
-	"net/url"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/parse"
 )
 
 var captchaTemplate = template.Must(template.ParseFiles("templates/captchaForm.html"))
@@ -20,18 +23,18 @@ func Captcha(w http.ResponseWriter, r *http.Request) {
 		ArticleDoi := r.Form.Get("articleDoi")
 		ArticleURL := r.Form.Get("articleURL")
 
-		form := url.Values{
-			"answer": {answer},
-			"id":     {captchaID},
-		}
+		captcha := parse.Captcha{ID: captchaID, ArticleDoi: ArticleDoi, ArticleURL: ArticleURL}
+		form := captcha.Form(answer)
 
 		// post captcha message to scihub servers
 		body := bytes.NewBufferString(form.Encode())
-		response, err := http.Post(ArticleURL, "application/x-www-form-urlencoded", body)
+		response, err := global.HTTPClient.Post(ArticleURL, "application/x-www-form-urlencoded", body)
 		if err != nil {
-			fmt.Println(err)
+			err = apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not post captcha answer")
+			renderDownloadError(w, r, ArticleDoi, err)
 			return
 		}
+		response.Body.Close()
 
 		// TODO: if status code != 200, display server message to the client
 		if response.StatusCode != http.StatusOK {
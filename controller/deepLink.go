@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/doi"
+)
+
+// ErrDoiNotFound is returned when deep link does not contain doi
+var ErrDoiNotFound = apperror.New(apperror.InvalidInput, "Could not find doi in the link")
+
+// Go fetches article from deep link, ex. /go?url=<publisher page>. It is
+// used by the bookmarklet, which also sends doi found in page metadata.
+func Go(w http.ResponseWriter, r *http.Request) {
+	fetchDeepLink(w, r)
+}
+
+// APIFetch is deep link for browser extension, errors are always returned
+// as json
+func APIFetch(w http.ResponseWriter, r *http.Request) {
+	r.Header.Set("Accept", "application/json")
+	fetchDeepLink(w, r)
+}
+
+// APIDoi returns doi detected in the url without fetching the article, so
+// the extension could show whether the page is supported
+func APIDoi(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	body := struct {
+		Doi   string `json:"doi"`
+		Found bool   `json:"found"`
+	}{}
+	body.Doi, body.Found = deepLinkDoi(r)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// fetchDeepLink downloads article with doi extracted from request
+// parameters. Save=on saves the article to the library only when the
+// parameters are posted, links opened with GET just download it.
+func fetchDeepLink(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	found, ok := deepLinkDoi(r)
+	if !ok {
+		renderDownloadError(w, r, deepLinkInput(r), ErrDoiNotFound)
+		return
+	}
+	// error page displays doi in the form
+	r.Form.Set("doi", found)
+	downloadArticle(w, r, template.HTMLEscapeString(found))
+}
+
+// deepLinkDoi returns doi from deep link parameters. Doi from page
+// metadata is preferred over doi extracted from the url.
+func deepLinkDoi(r *http.Request) (string, bool) {
+	for _, key := range []string{"doi", "id", "url"} {
+		if found, ok := doi.Extract(r.Form.Get(key)); ok {
+			return found, true
+		}
+	}
+	return "", false
+}
+
+// deepLinkInput returns first non empty deep link parameter
+func deepLinkInput(r *http.Request) string {
+	for _, key := range []string{"doi", "id", "url"} {
+		if value := r.Form.Get(key); len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// bookmarklet returns javascript link that opens current page in
+// GoScience running on base url
+func bookmarklet(base string) template.URL {
+	js := `javascript:(function(){` +
+		`var m=document.querySelector('meta[name="citation_doi"],meta[name="dc.identifier"],meta[name="DC.identifier"],meta[name="prism.doi"]');` +
+		`location.href='` + template.JSEscapeString(base) + `/go?url='+encodeURIComponent(location.href)+(m?'&doi='+encodeURIComponent(m.content):'');` +
+		`})()`
+	return template.URL(js)
+}
@@ -2,12 +2,19 @@ package controller
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/downloadlog"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
 	"github.com/greatdanton/goScience/parse"
 )
 
@@ -20,13 +27,30 @@ var templateDownload = template.Must(template.ParseFiles("templates/download.htm
 type downloadForm struct {
 	Doi      string
 	LabelDoi string
+	Library  bool // library is enabled, display save option
+	Save     bool
+	Mail     bool // mail is configured, display send to email option
+	Email    bool
+}
+
+// captchaForm is used for populating captchaForm.html template, Save
+// is passed along so the article is saved after the captcha is solved
+type captchaForm struct {
+	parse.Captcha
+	Save  bool
+	Email bool
 }
 
 // DownloadArticle handles client article download requests
 func DownloadArticle(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		err := templateDownload.Execute(w, nil)
+		// deep link, ex. /?id=10.1145/2854146 or /?id=<publisher url>
+		if len(r.URL.Query().Get("id")) > 0 {
+			fetchDeepLink(w, r)
+			return
+		}
+		err := templateDownload.Execute(w, downloadForm{Library: global.Library != nil, Mail: global.Mail != nil})
 		if err != nil {
 			log.Println(err)
 		}
@@ -38,14 +62,21 @@ func DownloadArticle(w http.ResponseWriter, r *http.Request) {
 }
 
 func downloadArticle(w http.ResponseWriter, r *http.Request, doi string) {
+	user := auth.UserName(r)
 	article := parse.Article{}
-	err := article.GetPdf(doi)
+	var err error
+	// articles saved by team members are served without contacting scihub
+	t, teamItem, fromTeam := teamArticle(user, doi)
+	if fromTeam {
+		article, err = storedArticle(user, t, teamItem)
+	} else {
+		err = article.GetPdf(doi)
+		logDownload(user, article, err)
+	}
 	if err != nil {
-		fmt.Println("################## GetPdf error")
-		fmt.Println(err)
 		// server returned captcha, display captcha image & relevant template
-		if err == parse.ErrCaptchaPresent {
-			captcha := article.Captcha
+		if errors.Is(err, parse.ErrCaptchaPresent) && !wantsJSON(r) {
+			captcha := captchaForm{Captcha: article.Captcha, Save: saveRequested(r), Email: mailRequested(r)}
 			err = captchaTemplate.Execute(w, captcha)
 			if err != nil {
 				fmt.Println(err)
@@ -55,18 +86,79 @@ func downloadArticle(w http.ResponseWriter, r *http.Request, doi string) {
 		}
 
 		// display error message to the end user
-		msg := fmt.Sprintf("%v", err)
-		doi := r.Form.Get("doi")
-		data := downloadForm{Doi: doi, LabelDoi: msg}
-		err := templateDownload.Execute(w, data)
+		renderDownloadError(w, r, r.Form.Get("doi"), err)
+		return
+	}
+	libraryID := ""
+	if saveRequested(r) {
+		var item library.Item
+		if fromTeam {
+			item, err = saveFromTeam(user, t, teamItem, article.PdfStream)
+		} else {
+			item, err = saveToLibrary(user, article)
+		}
 		if err != nil {
-			fmt.Println(err)
+			// saving failure should not prevent the download
+			fmt.Printf("Could not save article to library: %v\n", err)
+		} else {
+			libraryID = item.ID
+			w.Header().Set("X-Library-ID", item.ID)
 		}
+	}
+	if mailRequested(r) {
+		mailDownload(w, r, article, libraryID)
 		return
 	}
+
 	pdfName := article.Name
 	pdf := article.PdfStream
 	// opens up a browser popup for pdf download
 	w.Header().Set("Content-Disposition", "attachment; filename="+pdfName)
+	w.Header().Set("X-Content-SHA256", article.SHA256)
+	if !article.Integrity.Valid() {
+		w.Header().Set("X-Integrity-Problems", strings.Join(article.Integrity.Problems, "; "))
+	}
+	if article.Sanitization.Changed() {
+		w.Header().Set("X-Sanitized", strings.Join(article.Sanitization.Removed, "; "))
+	}
+	if article.MetadataEmbedded {
+		w.Header().Set("X-Metadata-Embedded", "true")
+	}
 	http.ServeContent(w, r, pdfName, time.Now(), bytes.NewReader(pdf))
 }
+
+// saveRequested reports whether user asked for the article to be saved
+// in the library. Only posted forms save, so a link followed with the
+// cookie could not add articles to the library.
+func saveRequested(r *http.Request) bool {
+	return global.Library != nil && r.Method == "POST" && r.Form.Get("save") == "on"
+}
+
+// logDownload records download attempt of the user in the download log
+func logDownload(user string, article parse.Article, err error) {
+	logDownloadVia(user, "", article, err)
+}
+
+// logDownloadVia records download attempt requested over another channel
+// than the web interface
+func logDownloadVia(user, via string, article parse.Article, err error) {
+	entry := downloadlog.Entry{
+		User:      user,
+		Via:       via,
+		Doi:       article.Doi,
+		Source:    article.Source,
+		Size:      len(article.PdfStream),
+		SHA256:    article.SHA256,
+		Status:    "ok",
+		Scan:      article.ScanResult,
+		Sanitized: article.Sanitization.Removed,
+	}
+	if err != nil {
+		entry.Status = apperror.Code(err)
+		entry.Error = err.Error()
+	}
+	if err := global.DownloadLog.Append(entry); err != nil {
+		fmt.Println(err)
+	}
+	emitDownload(user, article, err)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/global"
+)
+
+// apiError is json representation of application error returned to api
+// clients
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+// wantsJSON reports whether client prefers json response over html page
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeJSONError writes application error as json object with matching
+// http status code
+func writeJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	body := struct {
+		Error apiError `json:"error"`
+	}{apiError{
+		Code:      apperror.Code(err),
+		Message:   apperror.Message(err, apperror.Language(r)),
+		Retryable: apperror.IsRetryable(err),
+	}}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(apperror.Status(err))
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// renderDownloadError displays localized error message in download form
+// with http status code matching the error kind
+func renderDownloadError(w http.ResponseWriter, r *http.Request, doi string, err error) {
+	// error details are only logged, user sees generic localized message
+	fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+	if wantsJSON(r) {
+		writeJSONError(w, r, err)
+		return
+	}
+
+	data := downloadForm{
+		Doi:      doi,
+		LabelDoi: apperror.Message(err, apperror.Language(r)),
+		Library:  global.Library != nil,
+		Save:     r.Form.Get("save") == "on",
+		Mail:     global.Mail != nil,
+		Email:    r.Form.Get("email") == "on",
+	}
+	w.WriteHeader(apperror.Status(err))
+	if err := templateDownload.Execute(w, data); err != nil {
+		fmt.Println(err)
+	}
+}
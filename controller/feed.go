@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/dav"
+	"github.com/greatdanton/goScience/feed"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+)
+
+// feedRoot is path of article feeds
+const feedRoot = "/feed"
+
+// Feed serves Atom feeds of articles newly added to the library of the
+// authenticated user, for the whole library or a single collection.
+// Enclosures link to pdfs under the feed path, so feed readers download
+// them with the same credentials as the feed.
+func Feed(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == feedRoot:
+		articleFeed(w, r, user, "")
+	case path == feedRoot+"/collection":
+		name := r.URL.Query().Get("name")
+		if len(name) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		articleFeed(w, r, user, name)
+	case strings.HasPrefix(path, feedRoot+"/file/"):
+		feedFile(w, r, user, strings.TrimPrefix(path, feedRoot+"/file/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// feedURL returns url of the feed of the collection, empty collection is
+// the whole library
+func feedURL(base, collection string) string {
+	if len(collection) == 0 {
+		return base + feedRoot
+	}
+	return base + feedRoot + "/collection?name=" + url.QueryEscape(collection)
+}
+
+// articleFeed writes feed of the most recently added articles, feed is
+// updated when the newest article was added
+func articleFeed(w http.ResponseWriter, r *http.Request, user, collection string) {
+	items, err := global.Library.List(user, library.Query{Collection: collection, Desc: true})
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if len(items) > maxRecentArticles {
+		items = items[:maxRecentArticles]
+	}
+
+	base := baseURL(r)
+	id, title, page := "urn:goscience:"+user+":feed", "GoScience: "+user, base+"/library"
+	if len(collection) > 0 {
+		id += ":collection:" + collection
+		title += " - " + collection
+		page += "?collection=" + url.QueryEscape(collection)
+	}
+	updated := time.Time{}
+	if len(items) > 0 {
+		updated = items[0].Added
+	}
+	f := feed.New(id, title, feedURL(base, collection), page, updated)
+	for _, item := range items {
+		f.Add(item, base+"/library/article?id="+item.ID, base+feedRoot+"/file/"+item.ID+"/"+url.PathEscape(dav.FileName(item)))
+	}
+	w.Header().Set("Content-Type", feed.ContentType)
+	if err := f.Write(w); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// feedFile serves pdf of the enclosure, the path is "<id>/<file name>"
+func feedFile(w http.ResponseWriter, r *http.Request, user, path string) {
+	id := strings.SplitN(path, "/", 2)[0]
+	item, err := global.Library.Get(user, id)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	http.ServeContent(w, r, dav.FileName(item), item.Added, bytes.NewReader(pdf))
+}
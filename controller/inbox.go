@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/inbox"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/mail"
+	"github.com/greatdanton/goScience/parse"
+)
+
+// inboxDelay is pause between articles fetched for single mail request,
+// so scihub does not block us
+const inboxDelay = 3 * time.Second
+
+// HandleMailRequest fetches articles requested by mail and replies with
+// the articles attached and status of every requested identifier.
+// Downloads are recorded in the download log with the sender address.
+func HandleMailRequest(req inbox.Request) {
+	if global.Mail == nil {
+		return
+	}
+	// never answer our own messages, replies could loop forever
+	if from, err := netmail.ParseAddress(global.Mail.Config.From); err == nil && strings.EqualFold(from.Address, req.From) {
+		return
+	}
+	config := global.Inbox.Config
+	user := config.User
+	if len(user) == 0 {
+		user = auth.DefaultUser
+	}
+	via := "email:" + req.From
+	fmt.Printf("Mail request from %v: %v\n", req.From, req.Identifiers)
+
+	subject := req.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	msg := mail.Message{
+		To:      req.From,
+		Subject: subject,
+		Headers: map[string]string{"Auto-Submitted": "auto-replied"},
+	}
+	if len(req.MessageID) > 0 {
+		msg.Headers["In-Reply-To"] = req.MessageID
+		msg.Headers["References"] = req.MessageID
+	}
+	var body strings.Builder
+	if len(req.Identifiers) == 0 {
+		body.WriteString("No doi or arXiv identifier was found in your message.\n")
+	}
+	size := 0
+	for i, doi := range req.Identifiers {
+		if i > 0 {
+			time.Sleep(inboxDelay)
+		}
+		item, err := fetchVia(user, via, doi, config.Save)
+		if err != nil {
+			fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+			fmt.Fprintf(&body, "%v: %v\n", doi, apperror.Message(err, apperror.DefaultLanguage))
+			continue
+		}
+		if size+len(item.Data) <= global.Mail.MaxAttachment() {
+			size += len(item.Data)
+			msg.Attachments = append(msg.Attachments, mail.Attachment{Name: item.FileName, ContentType: "application/pdf", Data: item.Data})
+			fmt.Fprintf(&body, "%v: attached\n", doi)
+			continue
+		}
+		if len(item.LibraryID) == 0 {
+			fmt.Fprintf(&body, "%v: article is too large to be mailed\n", doi)
+			continue
+		}
+		fmt.Fprintf(&body, "%v: %v\n", doi, signedLink(mailBase(nil), user, item.LibraryID))
+	}
+	if req.Truncated {
+		fmt.Fprintf(&body, "\nOnly the first %v identifiers were handled.\n", len(req.Identifiers))
+	}
+	msg.Body = body.String()
+	if err := global.Mail.Send(msg); err != nil {
+		fmt.Printf("Could not reply to mail request from %v: %v\n", req.From, err)
+	}
+}
+
+// fetchVia returns article from the library of the user or fetches it
+// from scihub. Fetched article is saved to the library when save is set,
+// only saved articles could be sent as links.
+func fetchVia(user, via, doi string, save bool) (mailItem, error) {
+	if global.Library != nil {
+		if saved, err := global.Library.Get(user, library.ItemID(doi)); err == nil {
+			data, err := global.Library.File(saved)
+			return mailItem{Title: saved.Title, FileName: saved.FileName, LibraryID: saved.ID, Data: data}, err
+		}
+	}
+	if t, teamItem, ok := teamArticle(user, doi); ok {
+		article, err := storedArticle(user, t, teamItem)
+		if err != nil {
+			return mailItem{}, err
+		}
+		item := mailItem{Title: teamItem.Title, FileName: teamItem.FileName, Data: article.PdfStream}
+		if save {
+			saved, err := saveFromTeam(user, t, teamItem, article.PdfStream)
+			if err != nil {
+				fmt.Printf("Could not save article to library: %v\n", err)
+			}
+			item.LibraryID = saved.ID
+		}
+		return item, nil
+	}
+
+	article := parse.Article{}
+	err := article.GetPdf(doi)
+	logDownloadVia(user, via, article, err)
+	if err != nil {
+		return mailItem{}, err
+	}
+	item := mailItem{Title: article.Name, FileName: article.Name, Data: article.PdfStream}
+	if save && global.Library != nil {
+		saved, err := saveToLibrary(user, article)
+		if err != nil {
+			fmt.Printf("Could not save article to library: %v\n", err)
+		}
+		item.LibraryID = saved.ID
+	}
+	return item, nil
+}
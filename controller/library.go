@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/parse"
+)
+
+var templateFuncs = template.FuncMap{"join": strings.Join, "stateLabel": stateLabel}
+
+var libraryTemplate = template.Must(template.New("library.html").Funcs(templateFuncs).ParseFiles("templates/library.html"))
+var libraryArticleTemplate = template.Must(template.New("libraryArticle.html").Funcs(templateFuncs).ParseFiles("templates/libraryArticle.html"))
+
+// libraryPage is used for populating library.html template
+type libraryPage struct {
+	Items       []library.Item
+	Query       library.Query
+	Tags        []string
+	Collections []string
+	NewWorks    int // works found by watches that the user has not seen
+	States      []string
+	FeedURL     string // feed of the selected collection or the whole library
+}
+
+// libraryArticlePage is used for populating libraryArticle.html template
+type libraryArticlePage struct {
+	library.Item
+	Teams  []teamVisibility // teams of the user and whether they see the article
+	States []string
+}
+
+// Library displays articles saved in the library of the current user
+func Library(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	q := r.URL.Query()
+	query := library.Query{
+		Tag:        q.Get("tag"),
+		Collection: q.Get("collection"),
+		Author:     q.Get("author"),
+		Journal:    q.Get("journal"),
+		State:      q.Get("state"),
+		Sort:       q.Get("sort"),
+		Desc:       q.Get("order") == "desc",
+	}
+	query.Year, _ = strconv.Atoi(q.Get("year"))
+
+	page := libraryPage{Query: query, States: library.States, FeedURL: feedURL(baseURL(r), query.Collection)}
+	var err error
+	if page.Items, err = global.Library.List(user, query); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if page.Tags, err = global.Library.Tags(user); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if page.Collections, err = global.Library.Collections(user); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if global.Watch != nil {
+		page.NewWorks = global.Watch.Store.Unseen(user)
+	}
+	if err := libraryTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// LibraryArticle displays details of saved article and handles editing of
+// its tags, collections and note
+func LibraryArticle(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	item, err := global.Library.Get(user, r.FormValue("id"))
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		page := libraryArticlePage{Item: item, Teams: articleTeams(user, item.ID), States: library.States}
+		if err := libraryArticleTemplate.Execute(w, page); err != nil {
+			fmt.Println(err)
+		}
+	case "POST":
+		item.Tags = library.SplitList(r.FormValue("tags"))
+		item.Collections = library.SplitList(r.FormValue("collections"))
+		item.Note = strings.TrimSpace(r.FormValue("note"))
+		if err := global.Library.Update(user, item); err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		if global.Search != nil {
+			if err := global.Search.SetTags(user, item.ID, item.Tags); err != nil {
+				fmt.Println(err)
+			}
+		}
+		http.Redirect(w, r, "/library/article?id="+item.ID, http.StatusSeeOther)
+	}
+}
+
+// LibraryDownload serves pdf stored in the library without contacting
+// scihub servers
+func LibraryDownload(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	item, err := global.Library.Get(auth.UserName(r), r.FormValue("id"))
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+item.FileName)
+	w.Header().Set("X-Content-SHA256", item.SHA256)
+	http.ServeContent(w, r, item.FileName, item.Added, bytes.NewReader(pdf))
+}
+
+// LibraryDelete removes article from the library of the current user
+func LibraryDelete(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, id := auth.UserName(r), r.FormValue("id")
+	if err := global.Library.Delete(user, id); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if global.Search != nil {
+		if err := global.Search.Remove(user, id); err != nil {
+			fmt.Println(err)
+		}
+	}
+	http.Redirect(w, r, "/library", http.StatusSeeOther)
+}
+
+// saveToLibrary stores downloaded article in the library of the user.
+// Metadata is looked up on Crossref, when the lookup fails the article is
+// saved with the scihub file name as title.
+func saveToLibrary(user string, article parse.Article) (library.Item, error) {
+	item := library.Item{Doi: article.Doi, Title: article.Name, FileName: article.Name}
+	work, err := article.LookupMetadata()
+	if err != nil {
+		fmt.Printf("Metadata lookup failed: %v\n", err)
+	} else {
+		item.Title = work.Title
+		item.Authors = work.Authors
+		item.Journal = work.Journal
+		item.Year = work.Year
+		item.Abstract = work.Abstract
+	}
+	item, err = global.Library.Save(user, item, article.PdfStream)
+	if err != nil {
+		return item, err
+	}
+	indexItem(user, item, article.PdfStream)
+	return item, nil
+}
+
+// libraryError logs the error and displays its localized message
+func libraryError(w http.ResponseWriter, r *http.Request, err error) {
+	fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+	if wantsJSON(r) {
+		writeJSONError(w, r, err)
+		return
+	}
+	http.Error(w, apperror.Message(err, apperror.Language(r)), apperror.Status(err))
+}
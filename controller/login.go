@@ -6,13 +6,13 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/greatdanton/goScience/global"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/greatdanton/goScience/auth"
 )
 
 var templateLogin = template.Must(template.ParseFiles("templates/login.html"))
 
 type loginForm struct {
+	Username   string
 	Password   string
 	ErrorLabel string
 }
@@ -39,18 +39,20 @@ func renderLogin(w http.ResponseWriter, r *http.Request, form loginForm) {
 
 func userLogin(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
+	username := r.Form.Get("username")
 	password := r.Form.Get("password")
-	if password != global.PASSWORD {
+	if !auth.Check(username, password) {
 		data := loginForm{}
+		data.Username = username
 		data.Password = password
-		data.ErrorLabel = "Wrong password"
+		data.ErrorLabel = "Wrong username or password"
 		renderLogin(w, r, data)
 		return
 	}
 
-	// password is okay, create cookie with hashed password
+	// password is okay, create cookie with user name and hashed password
 	// explicitly creating cookie from user inputted password
-	cookie, err := createCookie(password)
+	cookie, err := createCookie(username, password)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -59,22 +61,11 @@ func userLogin(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func createCookie(password string) (http.Cookie, error) {
+func createCookie(username, password string) (http.Cookie, error) {
 	// expires in one week
 	expiration := time.Now().Add(7 * 24 * time.Hour)
 
-	passHash, err := hashPassword(password)
-	cookie := http.Cookie{Name: "GoScience", Value: passHash, Expires: expiration, Path: "/", HttpOnly: true}
+	value, err := auth.CookieValue(username, password)
+	cookie := http.Cookie{Name: auth.CookieName, Value: value, Expires: expiration, Path: "/", HttpOnly: true}
 	return cookie, err
 }
-
-func hashPassword(password string) (string, error) {
-	passwordBytes := []byte(password)
-	hashedPassword, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-
-	pass := string(hashedPassword)
-	return pass, nil
-}
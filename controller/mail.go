@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/batch"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/mail"
+	"github.com/greatdanton/goScience/parse"
+	"github.com/greatdanton/goScience/watch"
+)
+
+// mailLinkValidity is how long links to articles too large to be
+// attached work
+const mailLinkValidity = 7 * 24 * time.Hour
+
+// ErrNoEmail is returned when the user did not set email address
+var ErrNoEmail = apperror.New(apperror.InvalidInput, "User has no email address")
+
+// mailItem is article sent by mail, articles without library id can not
+// be sent as links
+type mailItem struct {
+	Title     string
+	FileName  string
+	LibraryID string
+	Data      []byte
+}
+
+// SettingsMail stores mail settings of the current user
+func SettingsMail(w http.ResponseWriter, r *http.Request) {
+	if global.Mail == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	settings := mail.Settings{
+		Email:       r.FormValue("email"),
+		NotifyJobs:  r.FormValue("notifyJobs") == "on",
+		NotifyWatch: r.FormValue("notifyWatch") == "on",
+	}
+	if err := global.Mail.Store.Set(auth.UserName(r), settings); err != nil {
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		http.Redirect(w, r, "/settings?mail=invalid", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// mailRequested reports whether user asked for the article to be sent to
+// their email, only posted forms send mail like saveRequested
+func mailRequested(r *http.Request) bool {
+	return global.Mail != nil && r.Method == "POST" && r.Form.Get("email") == "on"
+}
+
+// mailDownload sends downloaded article to the current user instead of
+// the browser. Articles too large to be attached are saved to the
+// library and sent as a link.
+func mailDownload(w http.ResponseWriter, r *http.Request, article parse.Article, libraryID string) {
+	user := auth.UserName(r)
+	if len(libraryID) == 0 && len(article.PdfStream) > global.Mail.MaxAttachment() {
+		item, err := saveToLibrary(user, article)
+		if err != nil {
+			fmt.Printf("Could not save article to library: %v\n", err)
+		}
+		libraryID = item.ID
+	}
+	item := mailItem{Title: article.Name, FileName: article.Name, LibraryID: libraryID, Data: article.PdfStream}
+	if len(libraryID) > 0 {
+		if saved, err := global.Library.Get(user, libraryID); err == nil {
+			item.Title = saved.Title
+		}
+	}
+
+	to, err := mailArticles(user, mailBase(r), "Article: "+item.Title, []mailItem{item})
+	if wantsJSON(r) {
+		if err != nil {
+			fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+			writeJSONError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(map[string]string{"sent": to}); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	form := downloadForm{Library: global.Library != nil, Mail: true, LabelDoi: "Article was sent to " + to}
+	if err != nil {
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		form.Doi, form.Email, form.LabelDoi = r.Form.Get("doi"), true, mailErrorLabel(err)
+		w.WriteHeader(apperror.Status(err))
+	}
+	if err := templateDownload.Execute(w, form); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// MailBatch sends articles fetched by the batch to the current user
+func MailBatch(w http.ResponseWriter, r *http.Request) {
+	if global.Mail == nil || global.Batch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := auth.UserName(r)
+	job, ok := global.Batch.Get(user, r.FormValue("id"))
+	if !ok {
+		libraryError(w, r, apperror.New(apperror.NotFound, "Batch does not exist"))
+		return
+	}
+
+	items := []mailItem{}
+	for _, ji := range job.Items {
+		if len(ji.LibraryID) == 0 {
+			continue
+		}
+		saved, err := global.Library.Get(user, ji.LibraryID)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		items = append(items, mailItem{Title: saved.Title, FileName: saved.FileName, LibraryID: saved.ID})
+	}
+	if len(items) == 0 {
+		libraryError(w, r, apperror.New(apperror.InvalidInput, "Batch has no fetched articles"))
+		return
+	}
+	if _, err := mailArticles(user, mailBase(r), job.Title, items); err != nil {
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		http.Redirect(w, r, "/batch?id="+job.ID+"&mail="+apperror.Code(err), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/batch?id="+job.ID+"&mail=sent", http.StatusSeeOther)
+}
+
+// mailArticles sends articles to the user. Articles are attached until
+// their total size reaches the attachment limit, the rest are sent as
+// signed links. It returns address the mail was sent to.
+func mailArticles(user, base, subject string, items []mailItem) (string, error) {
+	settings, err := global.Mail.Store.Get(user)
+	if err != nil {
+		return "", err
+	}
+	if len(settings.Email) == 0 {
+		return "", ErrNoEmail
+	}
+
+	msg := mail.Message{To: settings.Email, Subject: subject}
+	var body strings.Builder
+	body.WriteString("Articles requested from GoScience:\n\n")
+	size, links := 0, 0
+	for _, item := range items {
+		if item.Data == nil && len(item.LibraryID) > 0 {
+			saved, err := global.Library.Get(user, item.LibraryID)
+			if err == nil {
+				item.Data, err = global.Library.File(saved)
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		if size+len(item.Data) <= global.Mail.MaxAttachment() {
+			size += len(item.Data)
+			msg.Attachments = append(msg.Attachments, mail.Attachment{Name: item.FileName, ContentType: "application/pdf", Data: item.Data})
+			fmt.Fprintf(&body, "%v (attached)\n", item.Title)
+			continue
+		}
+		if len(item.LibraryID) == 0 {
+			return "", apperror.New(apperror.TooLarge, "Article is too large to be mailed")
+		}
+		fmt.Fprintf(&body, "%v\n%v\n", item.Title, signedLink(base, user, item.LibraryID))
+		links++
+	}
+	if links > 0 {
+		fmt.Fprintf(&body, "\nLinks are valid for %v days.\n", int(mailLinkValidity.Hours()/24))
+	}
+	msg.Body = body.String()
+	return settings.Email, global.Mail.Send(msg)
+}
+
+// signedLink returns link to article in the library of the user, which
+// works without logging in until it expires
+func signedLink(base, user, id string) string {
+	expires := time.Now().Add(mailLinkValidity)
+	values := url.Values{
+		"user":    {user},
+		"id":      {id},
+		"expires": {strconv.FormatInt(expires.Unix(), 10)},
+		"sig":     {global.Mail.Store.Sign(user, id, expires)},
+	}
+	return base + "/mail/file?" + values.Encode()
+}
+
+// MailFile serves article linked in a mail, signature replaces login
+func MailFile(w http.ResponseWriter, r *http.Request) {
+	if global.Mail == nil || global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, id := r.FormValue("user"), r.FormValue("id")
+	expires, _ := strconv.ParseInt(r.FormValue("expires"), 10, 64)
+	if !global.Mail.Store.Verify(user, id, expires, r.FormValue("sig")) {
+		http.Error(w, "Link is not valid or has expired", http.StatusForbidden)
+		return
+	}
+	item, err := global.Library.Get(user, id)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+item.FileName)
+	http.ServeContent(w, r, item.FileName, item.Added, bytes.NewReader(pdf))
+}
+
+// NotifyBatch mails summary of finished batch to its user
+func NotifyBatch(job batch.Job) {
+	if global.Mail == nil {
+		return
+	}
+	settings, err := global.Mail.Store.Get(job.User)
+	if err != nil || !settings.NotifyJobs || len(settings.Email) == 0 {
+		return
+	}
+	counts := map[string]int{}
+	failed := []string{}
+	for _, item := range job.Items {
+		counts[item.Status]++
+		if item.Status == batch.StatusFailed {
+			failed = append(failed, fmt.Sprintf("%v (%v)", item.Doi, item.Error))
+		}
+	}
+	subject := "Batch finished: " + job.Title
+	if counts[batch.StatusDone]+counts[batch.StatusSkipped] == 0 {
+		subject = "Batch failed: " + job.Title
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%v of %v articles were fetched, %v were already in the library, %v failed.\n",
+		counts[batch.StatusDone], len(job.Items), counts[batch.StatusSkipped], counts[batch.StatusFailed])
+	if len(failed) > 0 {
+		fmt.Fprintf(&body, "\nFailed:\n%v\n", strings.Join(failed, "\n"))
+	}
+	fmt.Fprintf(&body, "\n%v/batch?id=%v\n", mailBase(nil), job.ID)
+	if err := global.Mail.Send(mail.Message{To: settings.Email, Subject: subject, Body: body.String()}); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// NotifyWatch mails new works found by the watch to its user
+func NotifyWatch(item watch.Watch, found []watch.Found) {
+	if global.Mail == nil {
+		return
+	}
+	settings, err := global.Mail.Store.Get(item.User)
+	if err != nil || !settings.NotifyWatch || len(settings.Email) == 0 {
+		return
+	}
+	var body strings.Builder
+	for _, f := range found {
+		fmt.Fprintf(&body, "%v\n", f.Title)
+		if len(f.Authors) > 0 {
+			fmt.Fprintf(&body, "%v\n", strings.Join(f.Authors, ", "))
+		}
+		fmt.Fprintf(&body, "https://doi.org/%v\n\n", f.Doi)
+	}
+	if item.AutoFetch {
+		body.WriteString("The articles are being fetched into your library.\n")
+	}
+	fmt.Fprintf(&body, "%v/new\n", mailBase(nil))
+	msg := mail.Message{
+		To:      settings.Email,
+		Subject: fmt.Sprintf("New in %v: %v works", item.Name, len(found)),
+		Body:    body.String(),
+	}
+	if err := global.Mail.Send(msg); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// mailBase returns url of GoScience used in mailed links, the configured
+// url is preferred over the url of the request
+func mailBase(r *http.Request) string {
+	if len(global.Mail.Config.BaseURL) > 0 || r == nil {
+		return strings.TrimRight(global.Mail.Config.BaseURL, "/")
+	}
+	return baseURL(r)
+}
+
+// mailErrorLabel returns message displayed when the article could not be
+// mailed
+func mailErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, ErrNoEmail):
+		return "Add your email address in settings first"
+	case apperror.KindOf(err) == apperror.TooLarge:
+		return "Article is too large to be mailed"
+	}
+	return "Could not send the article to your email, try again later"
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/dav"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/opds"
+)
+
+// maxRecentArticles limits number of articles in recently added feed
+const maxRecentArticles = 50
+
+// OPDS serves catalog of the library of the authenticated user for
+// e-reader applications. Catalog is organized as navigation feeds
+// (collections, tags) that lead to acquisition feeds with links to pdfs.
+func OPDS(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	q := r.URL.Query()
+
+	switch {
+	case path == opds.Root:
+		opdsRoot(w, r, user)
+	case path == opds.Root+"/recent":
+		opdsArticles(w, r, user, "recent", "Recently added", library.Query{Desc: true}, maxRecentArticles)
+	case path == opds.Root+"/all":
+		opdsArticles(w, r, user, "all", "All articles", library.Query{Sort: library.SortTitle}, 0)
+	case path == opds.Root+"/collections":
+		opdsGroups(w, r, user, "collection", "Collections")
+	case path == opds.Root+"/tags":
+		opdsGroups(w, r, user, "tag", "Tags")
+	case path == opds.Root+"/collection":
+		name := q.Get("name")
+		opdsArticles(w, r, user, "collection?name="+url.QueryEscape(name), name, library.Query{Collection: name, Sort: library.SortTitle}, 0)
+	case path == opds.Root+"/tag":
+		name := q.Get("name")
+		opdsArticles(w, r, user, "tag?name="+url.QueryEscape(name), name, library.Query{Tag: name, Sort: library.SortTitle}, 0)
+	case path == opds.Root+"/search":
+		opdsSearch(w, r, user)
+	case path == opds.Root+"/opensearch.xml":
+		w.Header().Set("Content-Type", opds.OpenSearchType)
+		if err := opds.NewOpenSearch(opds.Root + "/search?q={searchTerms}").Write(w); err != nil {
+			fmt.Println(err)
+		}
+	case strings.HasPrefix(path, opds.Root+"/download/"):
+		opdsDownload(w, r, user, strings.TrimPrefix(path, opds.Root+"/download/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// opdsRoot displays start of the catalog
+func opdsRoot(w http.ResponseWriter, r *http.Request, user string) {
+	f := opds.NewFeed("urn:goscience:"+user, "GoScience library", opds.Root, opds.NavigationType, time.Now())
+	f.Links = append(f.Links, opds.Link{Rel: opds.RelSearch, Href: opds.Root + "/opensearch.xml", Type: opds.OpenSearchType})
+	f.Navigation("urn:goscience:"+user+":recent", "Recently added", "Articles saved most recently", opds.Root+"/recent", opds.AcquisitionType)
+	f.Entries[0].Links[0].Rel = opds.RelNew
+	f.Navigation("urn:goscience:"+user+":collections", "Collections", "Articles by collection", opds.Root+"/collections", opds.NavigationType)
+	f.Navigation("urn:goscience:"+user+":tags", "Tags", "Articles by tag", opds.Root+"/tags", opds.NavigationType)
+	f.Navigation("urn:goscience:"+user+":all", "All articles", "Every article in the library", opds.Root+"/all", opds.AcquisitionType)
+	writeFeed(w, f)
+}
+
+// opdsGroups displays navigation feed of collections or tags
+func opdsGroups(w http.ResponseWriter, r *http.Request, user, kind, title string) {
+	var names []string
+	var err error
+	if kind == "tag" {
+		names, err = global.Library.Tags(user)
+	} else {
+		names, err = global.Library.Collections(user)
+	}
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	f := opds.NewFeed("urn:goscience:"+user+":"+kind+"s", title, opds.Root+"/"+kind+"s", opds.NavigationType, time.Now())
+	f.Links = append(f.Links, opds.Link{Rel: opds.RelUp, Href: opds.Root, Type: opds.NavigationType})
+	for _, name := range names {
+		f.Navigation("urn:goscience:"+user+":"+kind+":"+name, name, "", opds.Root+"/"+kind+"?name="+url.QueryEscape(name), opds.AcquisitionType)
+	}
+	writeFeed(w, f)
+}
+
+// opdsArticles displays acquisition feed of articles matching the query,
+// limit 0 displays all articles
+func opdsArticles(w http.ResponseWriter, r *http.Request, user, path, title string, query library.Query, limit int) {
+	items, err := global.Library.List(user, query)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	writeFeed(w, acquisitionFeed(user, path, title, items))
+}
+
+// opdsSearch displays acquisition feed of full-text search results
+func opdsSearch(w http.ResponseWriter, r *http.Request, user string) {
+	if global.Search == nil {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query().Get("q")
+	results, err := global.Search.Search(user, query, maxSearchResults)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	items := []library.Item{}
+	for _, result := range results {
+		item, err := global.Library.Get(user, result.ID)
+		if err != nil {
+			// index could be behind the library for a moment
+			continue
+		}
+		items = append(items, item)
+	}
+	writeFeed(w, acquisitionFeed(user, "search?q="+url.QueryEscape(query), "Search: "+query, items))
+}
+
+// opdsDownload serves pdf of the acquisition link, the path is
+// "<id>/<file name>" so readers save the file under readable name
+func opdsDownload(w http.ResponseWriter, r *http.Request, user, path string) {
+	id := strings.SplitN(path, "/", 2)[0]
+	item, err := global.Library.Get(user, id)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	http.ServeContent(w, r, dav.FileName(item), item.Added, bytes.NewReader(pdf))
+}
+
+// acquisitionFeed creates feed of library articles, feed is updated when
+// the newest article was added
+func acquisitionFeed(user, path, title string, items []library.Item) *opds.Feed {
+	updated := time.Time{}
+	for _, item := range items {
+		if item.Added.After(updated) {
+			updated = item.Added
+		}
+	}
+	f := opds.NewFeed("urn:goscience:"+user+":"+path, title, opds.Root+"/"+path, opds.AcquisitionType, updated)
+	f.Links = append(f.Links, opds.Link{Rel: opds.RelUp, Href: opds.Root, Type: opds.NavigationType})
+	for _, item := range items {
+		href := opds.Root + "/download/" + item.ID + "/" + url.PathEscape(dav.FileName(item))
+		f.Publication(item, href)
+	}
+	return f
+}
+
+// writeFeed writes catalog feed with its content type
+func writeFeed(w http.ResponseWriter, f *opds.Feed) {
+	kind := opds.NavigationType
+	if len(f.Links) > 0 {
+		kind = f.Links[0].Type
+	}
+	w.Header().Set("Content-Type", kind)
+	if err := f.Write(w); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+)
+
+var readingTemplate = template.Must(template.New("reading.html").Funcs(templateFuncs).ParseFiles("templates/reading.html"))
+
+// queueRow is article of the reading queue with positions it could be
+// moved to, 0 when it is already first or last
+type queueRow struct {
+	library.Item
+	Up   int
+	Down int
+}
+
+// ReadingQueue displays articles the current user is reading or wants to
+// read in reading order and moves them within the queue
+func ReadingQueue(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	if r.Method == "POST" {
+		position, _ := strconv.Atoi(r.FormValue("position"))
+		if err := global.Library.MoveInQueue(user, r.FormValue("id"), position); err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/reading", http.StatusSeeOther)
+		return
+	}
+	queue, err := global.Library.Queue(user)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	rows := []queueRow{}
+	for i, item := range queue {
+		row := queueRow{Item: item}
+		if i > 0 {
+			row.Up = i
+		}
+		if i < len(queue)-1 {
+			row.Down = i + 2
+		}
+		rows = append(rows, row)
+	}
+	if err := readingTemplate.Execute(w, rows); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// ReadingState changes reading state of library article, the user is
+// sent back to the page the state was changed on
+func ReadingState(w http.ResponseWriter, r *http.Request) {
+	if global.Library == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	item, err := global.Library.SetState(auth.UserName(r), r.FormValue("id"), r.FormValue("state"))
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	next := r.FormValue("next")
+	// only local pages, so the form could not redirect elsewhere
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/library/article?id=" + item.ID
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// stateLabel returns readable name of reading state
+func stateLabel(state string) string {
+	switch state {
+	case library.StateToRead:
+		return "to read"
+	case library.StateReading:
+		return "reading"
+	case library.StateRead:
+		return "read"
+	}
+	return ""
+}
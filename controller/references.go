@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/batch"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/parse"
+	"github.com/greatdanton/goScience/pdf"
+	"github.com/greatdanton/goScience/references"
+)
+
+// maxUploadSize limits size of uploaded pdf files
+const maxUploadSize = 100 << 20
+
+// resolveWorkers is number of concurrent metadata service requests used
+// for resolving citations without doi
+const resolveWorkers = 4
+
+var referencesTemplate = template.Must(template.New("references.html").Funcs(templateFuncs).ParseFiles("templates/references.html"))
+var batchTemplate = template.Must(template.New("batch.html").Funcs(templateFuncs).ParseFiles("templates/batch.html"))
+
+// referencesPage is used for populating references.html template
+type referencesPage struct {
+	Source     string // title or file name of the citing article
+	Extracted  bool   // pdf was processed, checklist is displayed
+	References []reference
+	Unresolved bool // metadata service failed, some citations were not resolved
+	Library    bool
+	Collection string
+	ErrorLabel string
+}
+
+// reference is checklist row
+type reference struct {
+	references.Reference
+	InLibrary bool
+}
+
+// References extracts reference list from uploaded pdf or article saved
+// in the library and displays checklist of cited articles, which could be
+// fetched in a batch
+func References(w http.ResponseWriter, r *http.Request) {
+	page := referencesPage{Library: global.Batch != nil}
+	user := auth.UserName(r)
+
+	var data []byte
+	switch {
+	case r.Method == "POST":
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		file, header, err := r.FormFile("pdf")
+		if err != nil {
+			renderReferencesError(w, r, page, apperror.Wrap(apperror.InvalidInput, err, "Could not read uploaded pdf"))
+			return
+		}
+		defer file.Close()
+		if data, err = ioutil.ReadAll(file); err != nil {
+			renderReferencesError(w, r, page, apperror.Wrap(apperror.TooLarge, err, "Could not read uploaded pdf"))
+			return
+		}
+		page.Source = header.Filename
+	case len(r.FormValue("id")) > 0 && global.Library != nil:
+		item, err := global.Library.Get(user, r.FormValue("id"))
+		if err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		if data, err = global.Library.File(item); err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		page.Source = item.Title
+	default:
+		if err := referencesTemplate.Execute(w, page); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	text, err := pdf.Text(data)
+	if err != nil {
+		renderReferencesError(w, r, page, apperror.Wrap(apperror.InvalidInput, err, "Could not read pdf text"))
+		return
+	}
+	list := references.Extract(text)
+	if err := references.Resolve(list, resolveWorkers); err != nil {
+		fmt.Printf("Could not resolve citations: %v\n", err)
+		page.Unresolved = true
+	}
+
+	page.Extracted = true
+	page.Collection = "Cited by " + page.Source
+	for _, ref := range list {
+		row := reference{Reference: ref}
+		if global.Library != nil && len(ref.Doi) > 0 {
+			_, err := global.Library.Get(user, library.ItemID(ref.Doi))
+			row.InLibrary = err == nil
+		}
+		page.References = append(page.References, row)
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	if err := referencesTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// renderReferencesError displays upload form with localized error message
+func renderReferencesError(w http.ResponseWriter, r *http.Request, page referencesPage, err error) {
+	fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+	if wantsJSON(r) {
+		writeJSONError(w, r, err)
+		return
+	}
+	page.ErrorLabel = apperror.Message(err, apperror.Language(r))
+	w.WriteHeader(apperror.Status(err))
+	if err := referencesTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// BatchFetch starts fetching articles selected in the checklist into the
+// library of the current user
+func BatchFetch(w http.ResponseWriter, r *http.Request) {
+	if global.Batch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	job, err := global.Batch.Start(auth.UserName(r), r.Form.Get("title"), r.Form.Get("collection"), r.Form["doi"])
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/batch?id="+job.ID, http.StatusSeeOther)
+}
+
+// Batch displays progress of batch fetch, the page reloads itself until
+// all articles are processed
+func Batch(w http.ResponseWriter, r *http.Request) {
+	if global.Batch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	job, ok := global.Batch.Get(auth.UserName(r), r.FormValue("id"))
+	if !ok {
+		libraryError(w, r, apperror.New(apperror.NotFound, "Batch does not exist"))
+		return
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(job); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	page := batchPage{Job: job, Mail: global.Mail != nil, MailStatus: r.FormValue("mail")}
+	if err := batchTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// batchPage is used for populating batch.html template
+type batchPage struct {
+	batch.Job
+	Mail       bool   // mail is configured, display send to email option
+	MailStatus string // "sent" or error code of the last send
+}
+
+// FetchToLibrary fetches article and saves it to the library of the user,
+// articles that are already saved are not fetched again. Article is added
+// to the collection when it is set.
+func FetchToLibrary(user, doi, collection string) (string, bool, error) {
+	item, err := global.Library.Get(user, library.ItemID(doi))
+	skipped := err == nil
+	if !skipped {
+		if t, teamItem, ok := teamArticle(user, doi); ok {
+			// saved by a team member, copied instead of fetched again
+			article, err := storedArticle(user, t, teamItem)
+			if err != nil {
+				return "", false, err
+			}
+			if item, err = saveFromTeam(user, t, teamItem, article.PdfStream); err != nil {
+				return "", false, err
+			}
+		} else {
+			article := parse.Article{}
+			err := article.GetPdf(doi)
+			logDownload(user, article, err)
+			if err != nil {
+				return "", false, err
+			}
+			if item, err = saveToLibrary(user, article); err != nil {
+				return "", false, err
+			}
+		}
+	}
+
+	if len(collection) > 0 {
+		item.Collections = append(item.Collections, collection)
+		if err := global.Library.Update(user, item); err != nil {
+			return item.ID, skipped, err
+		}
+	}
+	return item.ID, skipped, nil
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/pdf"
+	"github.com/greatdanton/goScience/search"
+)
+
+// maxSearchResults limits number of displayed search results
+const maxSearchResults = 50
+
+var searchTemplate = template.Must(template.New("search.html").Funcs(templateFuncs).ParseFiles("templates/search.html"))
+
+// searchPage is used for populating search.html template
+type searchPage struct {
+	Query   string
+	Results []search.Result
+}
+
+// Search handles full-text search across articles in the library of the
+// current user. Json clients get results as json object.
+func Search(w http.ResponseWriter, r *http.Request) {
+	if global.Search == nil {
+		http.NotFound(w, r)
+		return
+	}
+	page := searchPage{Query: r.URL.Query().Get("q")}
+	if len(page.Query) > 0 {
+		results, err := global.Search.Search(auth.UserName(r), page.Query, maxSearchResults)
+		if err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		page.Results = results
+	}
+
+	if wantsJSON(r) {
+		body := struct {
+			Query   string          `json:"query"`
+			Results []search.Result `json:"results"`
+		}{page.Query, page.Results}
+		if body.Results == nil {
+			body.Results = []search.Result{}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	if err := searchTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// indexItem extracts text of library article and adds it to the search
+// index. Articles without extractable text are indexed by metadata only.
+func indexItem(user string, item library.Item, data []byte) {
+	if global.Search == nil {
+		return
+	}
+	text, err := pdf.Text(data)
+	if err != nil {
+		fmt.Printf("Could not extract text of %v: %v\n", item.Doi, err)
+	}
+	doc := search.Document{
+		ID:      item.ID,
+		Title:   item.Title,
+		Authors: item.Authors,
+		Year:    item.Year,
+		Tags:    item.Tags,
+		Text:    text,
+	}
+	if err := global.Search.Add(user, doc); err != nil {
+		fmt.Printf("Could not index %v: %v\n", item.Doi, err)
+	}
+}
+
+// IndexLibrary adds library articles that are missing in the search index,
+// so articles saved before the search was enabled could be found
+func IndexLibrary() {
+	if global.Library == nil || global.Search == nil {
+		return
+	}
+	users, err := global.Library.Users()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, user := range users {
+		items, err := global.Library.List(user, library.Query{})
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		for _, item := range items {
+			if global.Search.Has(user, item.ID) {
+				continue
+			}
+			data, err := global.Library.File(item)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			indexItem(user, item, data)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/mail"
+	"github.com/greatdanton/goScience/opds"
+	"github.com/greatdanton/goScience/tokens"
+)
+
+var settingsTemplate = template.Must(template.New("settings.html").Funcs(templateFuncs).ParseFiles("templates/settings.html"))
+
+// settingsPage is used for populating settings.html template
+type settingsPage struct {
+	User          string
+	Bookmarklet   template.URL
+	TokensEnabled bool
+	Tokens        []tokens.Token
+	NewToken      string // value of just created token, displayed only once
+	BaseURL       string
+	OPDSURL       string
+	FeedURL       string
+	WebDAVURL     string
+	MailEnabled   bool
+	Mail          mail.Settings
+	MailError     bool // submitted email address was not valid
+	Admin         bool
+	Shared        bool // user of the shared password, its account can not be deleted
+	DeleteError   bool // account deletion was not confirmed
+}
+
+// Settings displays the bookmarklet, lists api tokens of the current user
+// and creates new tokens. Tokens are used by e-readers, webdav clients and
+// browser extension instead of password.
+func Settings(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserName(r)
+	page := settingsPage{
+		User:          user,
+		Bookmarklet:   bookmarklet(baseURL(r)),
+		TokensEnabled: global.Tokens != nil,
+		BaseURL:       baseURL(r),
+		OPDSURL:       baseURL(r) + opds.Root,
+		FeedURL:       feedURL(baseURL(r), ""),
+		WebDAVURL:     baseURL(r) + "/dav/",
+		MailEnabled:   global.Mail != nil,
+		MailError:     r.FormValue("mail") == "invalid",
+		Admin:         auth.IsAdmin(user),
+		Shared:        user == auth.DefaultUser,
+		DeleteError:   r.FormValue("delete") == "unconfirmed",
+	}
+	if global.Mail != nil {
+		var err error
+		if page.Mail, err = global.Mail.Store.Get(user); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if global.Tokens == nil {
+		if err := settingsTemplate.Execute(w, page); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	if r.Method == "POST" {
+		value, _, err := global.Tokens.Create(user, r.FormValue("name"))
+		if err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		page.NewToken = value
+	}
+
+	var err error
+	if page.Tokens, err = global.Tokens.List(user); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if err := settingsTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// RevokeToken deletes api token of the current user
+func RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if global.Tokens == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := global.Tokens.Revoke(auth.UserName(r), r.FormValue("id")); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// baseURL returns scheme and host the request was sent to
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/share"
+)
+
+var sharesTemplate = template.Must(template.New("shares.html").Funcs(templateFuncs).ParseFiles("templates/shares.html"))
+
+// shareValidity is link lifetime offered in the form
+type shareValidity struct {
+	Hours int
+	Label string
+}
+
+var shareValidities = []shareValidity{{1, "1 hour"}, {24, "1 day"}, {7 * 24, "7 days"}, {30 * 24, "30 days"}}
+
+// shareLink is share link with its url, the url is displayed only for
+// links that still work
+type shareLink struct {
+	share.Link
+	URL    string `json:",omitempty"`
+	Active bool
+}
+
+// sharesPage is used for populating shares.html template
+type sharesPage struct {
+	Links      []shareLink
+	Item       library.Item // article the list is limited to
+	Created    string       // id of the link created by the last request
+	Validities []shareValidity
+	ErrorLabel string
+}
+
+// Shares lists share links of the current user and creates new links to
+// library articles. Articles are selected by library id or by doi, so
+// links could be created from the article page.
+func Shares(w http.ResponseWriter, r *http.Request) {
+	if global.Shares == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	page := sharesPage{Created: r.FormValue("created"), Validities: shareValidities}
+	id := r.FormValue("id")
+	if found, ok := doi.Extract(r.FormValue("doi")); ok && len(id) == 0 {
+		id = library.ItemID(found)
+	}
+	if len(id) > 0 {
+		item, err := global.Library.Get(user, id)
+		if err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		page.Item = item
+	}
+
+	if r.Method == "POST" {
+		if len(page.Item.ID) == 0 {
+			libraryError(w, r, apperror.New(apperror.InvalidInput, "Article to share is not selected"))
+			return
+		}
+		hours, _ := strconv.Atoi(r.FormValue("hours"))
+		link, err := global.Shares.Create(user, page.Item.ID, page.Item.Title, time.Duration(hours)*time.Hour, r.FormValue("single") == "on")
+		if err == nil {
+			if wantsJSON(r) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				if err := json.NewEncoder(w).Encode(shareLink{Link: link, URL: shareURL(baseURL(r), link), Active: true}); err != nil {
+					fmt.Println(err)
+				}
+				return
+			}
+			http.Redirect(w, r, "/shares?id="+page.Item.ID+"&created="+link.ID, http.StatusSeeOther)
+			return
+		}
+		if wantsJSON(r) {
+			libraryError(w, r, err)
+			return
+		}
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		page.ErrorLabel = "Please choose how long the link works"
+		w.WriteHeader(apperror.Status(err))
+	}
+
+	links, err := global.Shares.List(user, page.Item.ID)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	for _, link := range links {
+		sl := shareLink{Link: link, Active: link.Active()}
+		if sl.Active {
+			sl.URL = shareURL(baseURL(r), link)
+		}
+		page.Links = append(page.Links, sl)
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(page.Links); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	if err := sharesTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// ShareRevoke stops share link of the current user from working
+func ShareRevoke(w http.ResponseWriter, r *http.Request) {
+	if global.Shares == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := auth.UserName(r)
+	link, err := global.Shares.Get(user, r.FormValue("id"))
+	if err == nil {
+		err = global.Shares.Revoke(user, link.ID)
+	}
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/shares?id="+link.ItemID, http.StatusSeeOther)
+}
+
+// shareURL returns public url of the link
+func shareURL(base string, link share.Link) string {
+	return base + "/s?" + url.Values{"id": {link.ID}, "sig": {global.Shares.Sign(link)}}.Encode()
+}
+
+// Shared serves article of share link, signature replaces login. Every
+// attempt with a genuine link is recorded in the download log. The use is
+// counted only after the file was read, so failed reads do not consume
+// single use links. HEAD requests of link previews do not use the link.
+func Shared(w http.ResponseWriter, r *http.Request) {
+	if global.Shares == nil {
+		http.NotFound(w, r)
+		return
+	}
+	id, sig := r.FormValue("id"), r.FormValue("sig")
+	link, err := global.Shares.Check(id, sig)
+	if err != nil && len(link.User) == 0 {
+		// unknown links and forged signatures have no owner to log them for
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		// links that stopped working still name the article
+		item, _ := global.Library.Get(link.User, link.ItemID)
+		logShare(link, item, nil, err)
+		http.Error(w, "Link is not valid or has expired", http.StatusForbidden)
+		return
+	}
+	item, err := global.Library.Get(link.User, link.ItemID)
+	if err != nil {
+		logShare(link, item, nil, err)
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	if err != nil {
+		logShare(link, item, pdf, err)
+		libraryError(w, r, err)
+		return
+	}
+	if r.Method != "HEAD" {
+		rangeRequest := len(r.Header.Get("Range")) > 0
+		if link.Counted(rangeRequest) {
+			// single use links send the whole file
+			r.Header.Del("Range")
+			if link, err = global.Shares.Use(id, sig); err != nil {
+				// the link was used up by a concurrent request
+				logShare(link, item, nil, err)
+				http.Error(w, "Link is not valid or has expired", http.StatusForbidden)
+				return
+			}
+		}
+		logShare(link, item, pdf, nil)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+item.FileName)
+	w.Header().Set("X-Content-SHA256", item.SHA256)
+	http.ServeContent(w, r, item.FileName, item.Added, bytes.NewReader(pdf))
+}
+
+// logShare records download over share link in the download log, the
+// owner of the link is recorded as user
+func logShare(link share.Link, item library.Item, pdf []byte, err error) {
+	logStored(link.User, "share:"+link.ID, item, pdf, err)
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/metadata"
+	"github.com/greatdanton/goScience/slack"
+)
+
+// maxCommandSize limits size of slash command request
+const maxCommandSize = 64 << 10
+
+// SlackCommand answers /paper and /cite slash commands. The chat server
+// expects response within 3 seconds, so the command is acknowledged right
+// away and the result is posted to the response url when it is ready.
+func SlackCommand(w http.ResponseWriter, r *http.Request) {
+	if global.Slack == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCommandSize))
+	if err != nil {
+		http.Error(w, "Could not read request", http.StatusBadRequest)
+		return
+	}
+	cmd, err := global.Slack.Verify(r.Header, body)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	dois := doi.FindAll(cmd.Text)
+	name := strings.TrimPrefix(cmd.Command, "/")
+	switch {
+	case name != "paper" && name != "cite":
+		slackRespond(w, "Unknown command "+cmd.Command)
+	case len(dois) == 0:
+		slackRespond(w, fmt.Sprintf("Usage: %v <doi, doi.org link or arXiv id>", cmd.Command))
+	case name == "paper":
+		go slackPaper(cmd, dois[0], slackBase(r))
+		slackRespond(w, "Fetching "+dois[0]+", the link will be posted when it is ready")
+	default:
+		go slackCite(cmd, dois[0])
+		slackRespond(w, "Looking up "+dois[0])
+	}
+}
+
+// slackRespond acknowledges the command with message visible only to
+// the user who sent it
+func slackRespond(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(slack.Message{ResponseType: slack.Ephemeral, Text: text}); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// slackPaper fetches the article into the library and posts download
+// link with formatted citation to the channel
+func slackPaper(cmd slack.Command, doi, base string) {
+	user := slackUser()
+	item, err := fetchVia(user, "slack:"+cmd.UserName, doi, true)
+	if err == nil && len(item.LibraryID) == 0 {
+		err = apperror.New(apperror.Internal, "Article could not be saved to the library")
+	}
+	if err != nil {
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		slackPost(cmd, slack.Message{ResponseType: slack.Ephemeral, Text: doi + ": " + apperror.Message(err, apperror.DefaultLanguage)})
+		return
+	}
+
+	expires := global.Slack.LinkExpires()
+	values := url.Values{
+		"user":    {user},
+		"id":      {item.LibraryID},
+		"expires": {strconv.FormatInt(expires.Unix(), 10)},
+		"sig":     {global.Slack.SignLink(user, item.LibraryID, expires)},
+	}
+	text := fmt.Sprintf("<%v/slack/file?%v|%v> (link works for %v days)\n%v",
+		base, values.Encode(), item.FileName, global.Slack.Config.LinkValidity, slackCitation(doi, item.Title))
+	slackPost(cmd, slack.Message{ResponseType: slack.InChannel, Text: text})
+}
+
+// slackCite posts formatted citation of the work to the channel
+func slackCite(cmd slack.Command, doi string) {
+	work, err := metadata.Lookup(doi)
+	if err != nil {
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		slackPost(cmd, slack.Message{ResponseType: slack.Ephemeral, Text: doi + ": metadata of the work is not available"})
+		return
+	}
+	slackPost(cmd, slack.Message{ResponseType: slack.InChannel, Text: work.Cite()})
+}
+
+// slackCitation returns citation of the work, title and doi are used when
+// metadata service does not know it
+func slackCitation(doi, title string) string {
+	work, err := metadata.Lookup(doi)
+	if err != nil {
+		fmt.Printf("Metadata lookup failed: %v\n", err)
+		return metadata.Work{Doi: doi, Title: title}.Cite()
+	}
+	return work.Cite()
+}
+
+func slackPost(cmd slack.Command, msg slack.Message) {
+	if err := global.Slack.Post(cmd, msg); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// slackUser returns user whose library commands save articles to
+func slackUser() string {
+	if len(global.Slack.Config.User) > 0 {
+		return global.Slack.Config.User
+	}
+	return auth.DefaultUser
+}
+
+// slackBase returns url of GoScience used in posted links, the configured
+// url is preferred over the url of the request
+func slackBase(r *http.Request) string {
+	if len(global.Slack.Config.BaseURL) > 0 {
+		return strings.TrimRight(global.Slack.Config.BaseURL, "/")
+	}
+	return baseURL(r)
+}
+
+// SlackFile serves article linked in the chat, signature replaces login
+func SlackFile(w http.ResponseWriter, r *http.Request) {
+	if global.Slack == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, id := r.FormValue("user"), r.FormValue("id")
+	expires, _ := strconv.ParseInt(r.FormValue("expires"), 10, 64)
+	if !global.Slack.VerifyLink(user, id, expires, r.FormValue("sig")) {
+		http.Error(w, "Link is not valid or has expired", http.StatusForbidden)
+		return
+	}
+	item, err := global.Library.Get(user, id)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+item.FileName)
+	http.ServeContent(w, r, item.FileName, item.Added, bytes.NewReader(pdf))
+}
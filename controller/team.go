@@ -0,0 +1,420 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/downloadlog"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/parse"
+	"github.com/greatdanton/goScience/team"
+)
+
+var teamsTemplate = template.Must(template.New("teams.html").Funcs(templateFuncs).ParseFiles("templates/teams.html"))
+var teamTemplate = template.Must(template.New("team.html").Funcs(templateFuncs).ParseFiles("templates/team.html"))
+var teamArticleTemplate = template.Must(template.New("teamArticle.html").Funcs(templateFuncs).ParseFiles("templates/teamArticle.html"))
+
+// teamPage is used for populating team.html template
+type teamPage struct {
+	Team        team.Team
+	Role        string
+	CanEdit     bool
+	IsOwner     bool
+	Items       []library.Item
+	Collection  string
+	Collections []string
+	Roles       []string
+	ErrorLabel  string
+}
+
+// teamArticlePage is used for populating teamArticle.html template
+type teamArticlePage struct {
+	library.Item
+	Team    team.Team
+	CanEdit bool
+	Saved   bool // article is already in the library of the user
+}
+
+// teamVisibility tells in which teams article of the user is visible, it
+// is displayed on the library article page
+type teamVisibility struct {
+	team.Team
+	Shared  bool
+	CanEdit bool
+}
+
+// Teams lists teams of the current user and creates new teams
+func Teams(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	if r.Method == "POST" {
+		t, err := global.Teams.Create(user, r.FormValue("name"))
+		if err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/team?id="+t.ID, http.StatusSeeOther)
+		return
+	}
+	teams, err := global.Teams.List(user)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	page := struct {
+		Teams []team.Team
+		User  string
+	}{teams, user}
+	if err := teamsTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Team displays team library and its members, articles could be filtered
+// by collection
+func Team(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	t, err := global.Teams.Get(user, r.FormValue("id"))
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	page := teamPage{
+		Team:       t,
+		Role:       t.Role(user),
+		CanEdit:    t.CanEdit(user),
+		IsOwner:    t.Owner == user,
+		Collection: r.FormValue("collection"),
+		Roles:      []string{team.RoleViewer, team.RoleEditor},
+		ErrorLabel: r.FormValue("error"),
+	}
+	if page.Items, err = global.Library.List(t.Library(), library.Query{Collection: page.Collection, Sort: library.SortTitle}); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if page.Collections, err = global.Library.Collections(t.Library()); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if err := teamTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// TeamMembers adds, changes or removes team member, only the owner
+// manages members. Empty role removes the member.
+func TeamMembers(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.FormValue("id")
+	member, role := strings.TrimSpace(r.FormValue("user")), r.FormValue("role")
+	if len(role) > 0 && !auth.Exists(member) {
+		http.Redirect(w, r, "/team?id="+id+"&error=User+does+not+exist", http.StatusSeeOther)
+		return
+	}
+	if err := global.Teams.SetMember(auth.UserName(r), id, member, role); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/team?id="+id, http.StatusSeeOther)
+}
+
+// TeamDelete removes team of the current user together with articles
+// in its library, copies in libraries of members stay
+func TeamDelete(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.FormValue("id")
+	if err := global.Teams.Delete(auth.UserName(r), id); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	items, err := global.Library.List(team.Library(id), library.Query{})
+	if err != nil {
+		fmt.Println(err)
+	}
+	for _, item := range items {
+		if err := global.Library.Delete(team.Library(id), item.ID); err != nil {
+			fmt.Println(err)
+		}
+	}
+	http.Redirect(w, r, "/teams", http.StatusSeeOther)
+}
+
+// teamItem returns team and article of its library selected by the
+// request, the current user has to be team member
+func teamItem(r *http.Request) (team.Team, library.Item, error) {
+	t, err := global.Teams.Get(auth.UserName(r), r.FormValue("team"))
+	if err != nil {
+		return t, library.Item{}, err
+	}
+	item, err := global.Library.Get(t.Library(), r.FormValue("id"))
+	return t, item, err
+}
+
+// TeamArticle displays article of team library, editors could change its
+// tags, collections and note
+func TeamArticle(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	t, item, err := teamItem(r)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		_, err := global.Library.Get(user, item.ID)
+		page := teamArticlePage{Item: item, Team: t, CanEdit: t.CanEdit(user), Saved: err == nil}
+		if err := teamArticleTemplate.Execute(w, page); err != nil {
+			fmt.Println(err)
+		}
+	case "POST":
+		if !t.CanEdit(user) {
+			libraryError(w, r, apperror.ErrForbidden)
+			return
+		}
+		item.Tags = library.SplitList(r.FormValue("tags"))
+		item.Collections = library.SplitList(r.FormValue("collections"))
+		item.Note = strings.TrimSpace(r.FormValue("note"))
+		if err := global.Library.Update(t.Library(), item); err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/team/article?team="+t.ID+"&id="+item.ID, http.StatusSeeOther)
+	}
+}
+
+// TeamArticleRemove removes article from team library, libraries of
+// members keep their copies
+func TeamArticleRemove(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	t, item, err := teamItem(r)
+	if err == nil && !t.CanEdit(auth.UserName(r)) {
+		err = apperror.ErrForbidden
+	}
+	if err == nil {
+		err = global.Library.Delete(t.Library(), item.ID)
+	}
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/team?id="+t.ID, http.StatusSeeOther)
+}
+
+// TeamDownload serves pdf stored in team library to any team member
+func TeamDownload(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	t, item, err := teamItem(r)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	pdf, err := global.Library.File(item)
+	logStored(auth.UserName(r), "team:"+t.ID, item, pdf, err)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+item.FileName)
+	w.Header().Set("X-Content-SHA256", item.SHA256)
+	http.ServeContent(w, r, item.FileName, item.Added, bytes.NewReader(pdf))
+}
+
+// TeamSave copies article of team library into the library of the current
+// user
+func TeamSave(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	t, item, err := teamItem(r)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	saved, err := saveFromTeam(auth.UserName(r), t, item, nil)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/library/article?id="+saved.ID, http.StatusSeeOther)
+}
+
+// TeamShare makes article from the library of the current user visible
+// to the team or removes it from the team library. Only editors change
+// what the team sees.
+func TeamShare(w http.ResponseWriter, r *http.Request) {
+	if global.Teams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, id := auth.UserName(r), r.FormValue("id")
+	t, err := global.Teams.Get(user, r.FormValue("team"))
+	if err == nil && !t.CanEdit(user) {
+		err = apperror.ErrForbidden
+	}
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+
+	if r.FormValue("action") == "remove" {
+		err = global.Library.Delete(t.Library(), id)
+	} else {
+		var item library.Item
+		item, err = global.Library.Copy(user, t.Library(), id)
+		if err == nil {
+			if len(item.AddedBy) == 0 {
+				item.AddedBy = user
+			}
+			if collection := strings.TrimSpace(r.FormValue("collection")); len(collection) > 0 {
+				item.Collections = append(item.Collections, collection)
+			}
+			err = global.Library.Update(t.Library(), item)
+		}
+	}
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/library/article?id="+id, http.StatusSeeOther)
+}
+
+// articleTeams returns teams of the user and whether the article is
+// visible in their libraries
+func articleTeams(user, id string) []teamVisibility {
+	if global.Teams == nil {
+		return nil
+	}
+	teams, err := global.Teams.List(user)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	list := []teamVisibility{}
+	for _, t := range teams {
+		_, err := global.Library.Get(t.Library(), id)
+		list = append(list, teamVisibility{Team: t, Shared: err == nil, CanEdit: t.CanEdit(user)})
+	}
+	return list
+}
+
+// teamArticle looks up article in libraries of teams the user is member
+// of, so articles saved by other members are not fetched from scihub
+// again
+func teamArticle(user, input string) (team.Team, library.Item, bool) {
+	if global.Teams == nil {
+		return team.Team{}, library.Item{}, false
+	}
+	found, ok := doi.Extract(input)
+	if !ok {
+		return team.Team{}, library.Item{}, false
+	}
+	teams, err := global.Teams.List(user)
+	if err != nil {
+		fmt.Println(err)
+	}
+	for _, t := range teams {
+		if item, err := global.Library.Get(t.Library(), library.ItemID(found)); err == nil {
+			return t, item, true
+		}
+	}
+	return team.Team{}, library.Item{}, false
+}
+
+// storedArticle returns article of team library as if it was downloaded,
+// the download is recorded in the download log
+func storedArticle(user string, t team.Team, item library.Item) (parse.Article, error) {
+	pdf, err := global.Library.File(item)
+	logStored(user, "team:"+t.ID, item, pdf, err)
+	article := parse.Article{Doi: item.Doi, Name: item.FileName, PdfStream: pdf, SHA256: item.SHA256}
+	return article, err
+}
+
+// saveFromTeam copies article of team library into the library of the
+// user and adds it to the search index. The file is read when pdf is nil.
+func saveFromTeam(user string, t team.Team, item library.Item, pdf []byte) (library.Item, error) {
+	saved, err := global.Library.Copy(t.Library(), user, item.ID)
+	if err != nil {
+		return saved, err
+	}
+	if pdf == nil {
+		if pdf, err = global.Library.File(saved); err != nil {
+			fmt.Println(err)
+			return saved, nil
+		}
+	}
+	indexItem(user, saved, pdf)
+	return saved, nil
+}
+
+// logStored records download of article stored in the library in the
+// download log, via names the team or share link the article came from
+func logStored(user, via string, item library.Item, pdf []byte, err error) {
+	entry := downloadlog.Entry{
+		User:   user,
+		Doi:    item.Doi,
+		Via:    via,
+		Size:   len(pdf),
+		SHA256: item.SHA256,
+		Status: "ok",
+	}
+	if err != nil {
+		entry.SHA256 = ""
+		entry.Status = apperror.Code(err)
+		entry.Error = err.Error()
+	}
+	if err := global.DownloadLog.Append(entry); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/metadata"
+	"github.com/greatdanton/goScience/watch"
+)
+
+// maxWatchWorks limits number of works returned by a single poll of a watch
+const maxWatchWorks = 50
+
+var watchTemplate = template.Must(template.New("watch.html").Funcs(templateFuncs).ParseFiles("templates/watch.html"))
+var newWorksTemplate = template.Must(template.New("new.html").Funcs(templateFuncs).ParseFiles("templates/new.html"))
+
+// watchPage is used for populating watch.html template
+type watchPage struct {
+	Watches    []watch.Watch
+	ErrorLabel string
+}
+
+// newWork is row of new.html template
+type newWork struct {
+	watch.Found
+	InLibrary bool
+}
+
+// Watchlist lists watches of the current user and creates new watches
+func Watchlist(w http.ResponseWriter, r *http.Request) {
+	if global.Watch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	page := watchPage{}
+	if r.Method == "POST" {
+		_, err := global.Watch.Store.Add(watch.Watch{
+			User:      user,
+			Kind:      r.FormValue("kind"),
+			Value:     r.FormValue("value"),
+			Name:      r.FormValue("name"),
+			AutoFetch: r.FormValue("autofetch") == "on",
+		})
+		if err == nil {
+			http.Redirect(w, r, "/watch", http.StatusSeeOther)
+			return
+		}
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		page.ErrorLabel = "Please check the issn, orcid or search query"
+		w.WriteHeader(apperror.Status(err))
+	}
+
+	var err error
+	if page.Watches, err = global.Watch.Store.List(user); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if err := watchTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// WatchDelete removes watch of the current user
+func WatchDelete(w http.ResponseWriter, r *http.Request) {
+	if global.Watch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := global.Watch.Store.Delete(auth.UserName(r), r.FormValue("id")); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/watch", http.StatusSeeOther)
+}
+
+// WatchCheck polls watch right away instead of waiting for the scheduler
+func WatchCheck(w http.ResponseWriter, r *http.Request) {
+	if global.Watch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, id := auth.UserName(r), r.FormValue("id")
+	watches, err := global.Watch.Store.List(user)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	for _, item := range watches {
+		if item.ID == id {
+			if _, err := global.Watch.Check(item); err != nil {
+				fmt.Println(err)
+			}
+			http.Redirect(w, r, "/new", http.StatusSeeOther)
+			return
+		}
+	}
+	libraryError(w, r, watch.ErrNotFound)
+}
+
+// NewWorks displays works found by watches of the current user, the
+// newest first. POST marks all works as seen.
+func NewWorks(w http.ResponseWriter, r *http.Request) {
+	if global.Watch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	if r.Method == "POST" {
+		if err := global.Watch.Store.MarkSeen(user); err != nil {
+			libraryError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/new", http.StatusSeeOther)
+		return
+	}
+
+	found, err := global.Watch.Store.Found(user)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(found); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	works := []newWork{}
+	for _, f := range found {
+		_, err := global.Library.Get(user, library.ItemID(f.Doi))
+		works = append(works, newWork{Found: f, InLibrary: err == nil})
+	}
+	if err := newWorksTemplate.Execute(w, works); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// AutoFetchWatch fetches new works of the watch into the library of its
+// user, articles are added to collection named after the watch
+func AutoFetchWatch(item watch.Watch, dois []string) {
+	if global.Batch == nil {
+		return
+	}
+	if _, err := global.Batch.Start(item.User, "New in "+item.Name, item.Name, dois); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// PollWatch asks metadata service for works of the watch registered since
+// the date
+func PollWatch(item watch.Watch, since time.Time) ([]watch.Found, error) {
+	q := metadata.WorksQuery{Since: since, Rows: maxWatchWorks}
+	switch item.Kind {
+	case watch.KindISSN:
+		q.ISSN = item.Value
+	case watch.KindORCID:
+		q.ORCID = item.Value
+	default:
+		q.Text = item.Value
+	}
+	works, err := metadata.Works(q)
+	found := []watch.Found{}
+	for _, work := range works {
+		found = append(found, watch.Found{Doi: work.Doi, Title: work.Title, Authors: work.Authors, Journal: work.Journal, Year: work.Year})
+	}
+	return found, err
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/greatdanton/goScience/dav"
+	"github.com/greatdanton/goScience/global"
+)
+
+// WebDAV returns handler exposing library of the authenticated user as
+// webdav share under prefix. Uploaded articles are added to the search
+// index like articles saved from the download page.
+func WebDAV(prefix string, write bool) http.Handler {
+	fs := &dav.FileSystem{
+		Library: global.Library,
+		Write:   write,
+		Saved:   indexItem,
+		Deleted: func(user, id string) {
+			if global.Search == nil {
+				return
+			}
+			if err := global.Search.Remove(user, id); err != nil {
+				fmt.Println(err)
+			}
+		},
+	}
+	return dav.Handler(prefix, fs)
+}
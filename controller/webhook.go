@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/batch"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/parse"
+	"github.com/greatdanton/goScience/webhook"
+)
+
+var webhooksTemplate = template.Must(template.New("webhooks.html").Funcs(templateFuncs).ParseFiles("templates/webhooks.html"))
+var webhookLogTemplate = template.Must(template.New("webhookLog.html").Funcs(templateFuncs).ParseFiles("templates/webhookLog.html"))
+
+// webhooksPage is used for populating webhooks.html template
+type webhooksPage struct {
+	Subscriptions []webhook.Subscription
+	Events        []string
+	TestStatus    string // result of the last test delivery
+	ErrorLabel    string
+}
+
+// webhookLogPage is used for populating webhookLog.html template
+type webhookLogPage struct {
+	Subscription webhook.Subscription
+	Deliveries   []webhook.Delivery
+}
+
+// articleEvent is data of article.downloaded and captcha.required events
+type articleEvent struct {
+	Doi    string `json:"doi"`
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source,omitempty"`
+	Size   int    `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// sourceEvent is data of source.unhealthy event
+type sourceEvent struct {
+	Source   string `json:"source"`
+	Failures int    `json:"failures"`
+	Error    string `json:"error"` // apperror code of the last failure
+}
+
+// Webhooks lists webhook subscriptions of the current user and creates
+// new subscriptions
+func Webhooks(w http.ResponseWriter, r *http.Request) {
+	if global.Webhooks == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user := auth.UserName(r)
+	page := webhooksPage{Events: webhook.Events, TestStatus: r.FormValue("test")}
+	if r.Method == "POST" {
+		r.ParseForm()
+		_, err := global.Webhooks.Store.Subscribe(user, r.Form.Get("url"), r.Form["event"])
+		if err == nil {
+			http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+			return
+		}
+		fmt.Printf("%v: %v\n", apperror.KindOf(err), err)
+		page.ErrorLabel = "Please check the url and select at least one event"
+		w.WriteHeader(apperror.Status(err))
+	}
+
+	var err error
+	if page.Subscriptions, err = global.Webhooks.Store.List(user); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if err := webhooksTemplate.Execute(w, page); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// WebhookDelete removes webhook subscription of the current user
+func WebhookDelete(w http.ResponseWriter, r *http.Request) {
+	if global.Webhooks == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := global.Webhooks.Store.Delete(auth.UserName(r), r.FormValue("id")); err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// WebhookTest posts test event to the subscription right away
+func WebhookTest(w http.ResponseWriter, r *http.Request) {
+	if global.Webhooks == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	delivery, err := global.Webhooks.Test(auth.UserName(r), r.FormValue("id"))
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(delivery); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	status := "delivered"
+	if !delivery.Delivered {
+		status = "failed: " + delivery.Error
+	}
+	http.Redirect(w, r, "/webhooks?test="+template.URLQueryEscaper(status), http.StatusSeeOther)
+}
+
+// WebhookLog displays recent deliveries of the subscription
+func WebhookLog(w http.ResponseWriter, r *http.Request) {
+	if global.Webhooks == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, id := auth.UserName(r), r.FormValue("id")
+	sub, err := global.Webhooks.Store.Get(user, id)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	deliveries, err := global.Webhooks.Store.Deliveries(user, id)
+	if err != nil {
+		libraryError(w, r, err)
+		return
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	if err := webhookLogTemplate.Execute(w, webhookLogPage{Subscription: sub, Deliveries: deliveries}); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// emit sends event to webhooks of the user, empty user sends it to
+// webhooks of all users
+func emit(user, event string, data interface{}) {
+	if global.Webhooks == nil {
+		return
+	}
+	if err := global.Webhooks.Emit(user, event, data); err != nil {
+		fmt.Printf("Could not emit %v event: %v\n", event, err)
+	}
+}
+
+// emitDownload sends article.downloaded or captcha.required event for
+// download attempt of the user
+func emitDownload(user string, article parse.Article, err error) {
+	data := articleEvent{Doi: article.Doi, Source: article.Source}
+	switch {
+	case err == nil:
+		data.Name, data.Size, data.SHA256 = article.Name, len(article.PdfStream), article.SHA256
+		emit(user, webhook.ArticleDownloaded, data)
+	case errors.Is(err, parse.ErrCaptchaPresent):
+		emit(user, webhook.CaptchaRequired, data)
+	}
+}
+
+// BatchFinished notifies the user about finished batch by mail and
+// webhooks. Batch failed when no article was fetched.
+func BatchFinished(job batch.Job) {
+	NotifyBatch(job)
+	event := webhook.JobFailed
+	for _, item := range job.Items {
+		if item.Status == batch.StatusDone || item.Status == batch.StatusSkipped {
+			event = webhook.JobCompleted
+			break
+		}
+	}
+	emit(job.User, event, job)
+}
+
+// SourceUnhealthy sends source.unhealthy event to webhooks of all users
+func SourceUnhealthy(source string, failures int, err error) {
+	fmt.Printf("Source %v failed %v times in a row: %v\n", source, failures, err)
+	emit("", webhook.SourceUnhealthy, sourceEvent{Source: source, Failures: failures, Error: apperror.Code(err)})
+}
@@ -0,0 +1,497 @@
+package dav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/pdf"
+)
+
+// Config enables webdav share of the library
+type Config struct {
+	Enabled bool
+	Write   bool // allow uploads, deletes and moves between collections
+}
+
+// writeMethods are webdav methods that modify the library
+var writeMethods = map[string]bool{
+	"PUT": true, "DELETE": true, "MKCOL": true, "COPY": true,
+	"MOVE": true, "PROPPATCH": true, "LOCK": true, "UNLOCK": true,
+}
+
+// FileSystem exposes user library as webdav file system. Root folder
+// contains articles without collection and every collection is a folder.
+// Articles are named "Author Year - Title.pdf".
+type FileSystem struct {
+	Library *library.Store
+	Write   bool // allow uploads, deletes and moves between collections
+	// Saved and Deleted are called after uploaded article is stored or
+	// article is deleted, ex. to update the search index
+	Saved   func(user string, item library.Item, data []byte)
+	Deleted func(user, id string)
+
+	mu      sync.Mutex
+	folders map[string]map[string]bool // empty folders created by users
+}
+
+// Handler returns webdav handler serving the file system under prefix.
+// Requests have to be authenticated, user name is read from the request
+// context. Modifying requests are rejected when writing is disabled.
+func Handler(prefix string, fs *FileSystem) http.Handler {
+	h := &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				fmt.Printf("webdav %v %v: %v\n", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fs.Write && writeMethods[r.Method] {
+			http.Error(w, "Library is read-only", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// entry is a file or folder of the file system
+type entry struct {
+	name  string
+	item  library.Item
+	isDir bool
+}
+
+// split splits cleaned path into folder (collection) and file name, both
+// are empty for root
+func split(name string) (string, string, error) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		return "", "", nil
+	case len(parts) == 1:
+		return "", parts[0], nil
+	case len(parts) == 2:
+		return parts[0], parts[1], nil
+	}
+	return "", "", os.ErrNotExist
+}
+
+// list returns entries of the folder, root folder also lists collections
+func (fs *FileSystem) list(user, folder string) ([]entry, error) {
+	items, err := fs.Library.List(user, library.Query{Collection: folder, Sort: library.SortTitle})
+	if err != nil {
+		return nil, err
+	}
+	entries := []entry{}
+	used := map[string]bool{}
+	for _, item := range items {
+		if len(folder) == 0 && len(item.Collections) > 0 {
+			continue
+		}
+		name := FileName(item)
+		if used[strings.ToLower(name)] {
+			name = strings.TrimSuffix(name, ".pdf") + " (" + item.ID[:6] + ").pdf"
+		}
+		used[strings.ToLower(name)] = true
+		entries = append(entries, entry{name: name, item: item})
+	}
+	if len(folder) > 0 {
+		return entries, nil
+	}
+
+	collections, err := fs.Library.Collections(user)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	for name := range fs.folders[user] {
+		collections = append(collections, name)
+	}
+	fs.mu.Unlock()
+	seen := map[string]bool{}
+	for _, name := range collections {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			entries = append(entries, entry{name: name, isDir: true})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].isDir && !entries[j].isDir })
+	return entries, nil
+}
+
+// find returns entry with the path
+func (fs *FileSystem) find(ctx context.Context, name string) (string, entry, error) {
+	user := auth.ContextUser(ctx)
+	if len(user) == 0 {
+		return "", entry{}, os.ErrPermission
+	}
+	folder, file, err := split(name)
+	if err != nil {
+		return user, entry{}, err
+	}
+	if len(file) == 0 {
+		return user, entry{name: "/", isDir: true}, nil
+	}
+	entries, err := fs.list(user, folder)
+	if err != nil {
+		return user, entry{}, err
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.name, file) {
+			return user, e, nil
+		}
+	}
+	return user, entry{}, os.ErrNotExist
+}
+
+// Stat returns file info of file or folder
+func (fs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	_, e, err := fs.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{e}, nil
+}
+
+// OpenFile opens article or folder for reading, or creates uploaded file
+func (fs *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		return fs.create(ctx, name)
+	}
+	user, e, err := fs.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if e.isDir {
+		folder := ""
+		if e.name != "/" {
+			folder = e.name
+		}
+		entries, err := fs.list(user, folder)
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{entry: e, entries: entries}, nil
+	}
+	data, err := fs.Library.File(e.item)
+	if err != nil {
+		return nil, err
+	}
+	return &readFile{entry: e, Reader: bytes.NewReader(data)}, nil
+}
+
+// create returns file that stores uploaded pdf in the library on close
+func (fs *FileSystem) create(ctx context.Context, name string) (webdav.File, error) {
+	user := auth.ContextUser(ctx)
+	if !fs.Write || len(user) == 0 {
+		return nil, os.ErrPermission
+	}
+	folder, file, err := split(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(path.Ext(file), ".pdf") {
+		// reference managers and file browsers create lock and temporary
+		// files, only pdf files are stored
+		return nil, os.ErrPermission
+	}
+	return &uploadFile{fs: fs, user: user, folder: folder, name: file}, nil
+}
+
+// Mkdir creates empty collection folder, it is kept until the server is
+// restarted or an article is stored in it
+func (fs *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	user := auth.ContextUser(ctx)
+	if !fs.Write || len(user) == 0 {
+		return os.ErrPermission
+	}
+	folder, file, err := split(name)
+	if err != nil || len(folder) > 0 || len(file) == 0 {
+		return os.ErrPermission
+	}
+	if _, _, err := fs.find(ctx, name); err == nil {
+		return os.ErrExist
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.folders == nil {
+		fs.folders = map[string]map[string]bool{}
+	}
+	if fs.folders[user] == nil {
+		fs.folders[user] = map[string]bool{}
+	}
+	fs.folders[user][file] = true
+	return nil
+}
+
+// RemoveAll removes article from the folder collection, articles in root
+// folder are deleted from the library. Removing a folder removes the
+// collection from all its articles.
+func (fs *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	user, e, err := fs.find(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !fs.Write {
+		return os.ErrPermission
+	}
+	folder, file, _ := split(name)
+	if e.isDir {
+		if len(file) == 0 {
+			return os.ErrPermission
+		}
+		fs.forgetFolder(user, file)
+		items, err := fs.Library.List(user, library.Query{Collection: file})
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := fs.setCollection(user, item, file, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(folder) == 0 {
+		if err := fs.Library.Delete(user, e.item.ID); err != nil {
+			return err
+		}
+		if fs.Deleted != nil {
+			fs.Deleted(user, e.item.ID)
+		}
+		return nil
+	}
+	return fs.setCollection(user, e.item, folder, "")
+}
+
+// Rename moves article between collections. Names are generated from
+// metadata, so renaming within a folder is not supported.
+func (fs *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	user, e, err := fs.find(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if !fs.Write || e.isDir {
+		return os.ErrPermission
+	}
+	oldFolder, _, _ := split(oldName)
+	newFolder, _, err := split(newName)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(oldFolder, newFolder) {
+		return os.ErrPermission
+	}
+	fs.forgetFolder(user, newFolder)
+	return fs.setCollection(user, e.item, oldFolder, newFolder)
+}
+
+// setCollection replaces collection from with collection to, empty names
+// mean root folder
+func (fs *FileSystem) setCollection(user string, item library.Item, from, to string) error {
+	collections := []string{}
+	for _, c := range item.Collections {
+		if !strings.EqualFold(c, from) {
+			collections = append(collections, c)
+		}
+	}
+	if len(to) > 0 {
+		collections = append(collections, to)
+	}
+	item.Collections = collections
+	return fs.Library.Update(user, item)
+}
+
+// forgetFolder removes created empty folder, it is listed as collection
+// once it contains articles
+func (fs *FileSystem) forgetFolder(user, name string) {
+	fs.mu.Lock()
+	delete(fs.folders[user], name)
+	fs.mu.Unlock()
+}
+
+// FileName returns file name of the article: "Family Year - Title.pdf"
+func FileName(item library.Item) string {
+	parts := []string{}
+	if len(item.Authors) > 0 {
+		fields := strings.Fields(item.Authors[0])
+		if len(fields) > 0 {
+			parts = append(parts, fields[len(fields)-1])
+		}
+	}
+	if item.Year > 0 {
+		parts = append(parts, fmt.Sprint(item.Year))
+	}
+
+	title := item.Title
+	if len(title) == 0 {
+		title = item.ID
+	}
+	title = strings.TrimSuffix(title, ".pdf")
+	if runes := []rune(title); len(runes) > 100 {
+		title = strings.TrimSpace(string(runes[:100]))
+	}
+	name := title
+	if len(parts) > 0 {
+		name = strings.Join(parts, " ") + " - " + title
+	}
+	return cleanName(name) + ".pdf"
+}
+
+// cleanName replaces characters that are not allowed in file names
+func cleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ', strings.ContainsRune(`/\:*?"<>|`, r):
+			return ' '
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// fileInfo implements os.FileInfo and optional webdav interfaces, so
+// content type and etag do not require reading the file
+type fileInfo struct {
+	entry
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return int64(fi.item.Size) }
+func (fi fileInfo) ModTime() time.Time { return fi.item.Added }
+func (fi fileInfo) IsDir() bool        { return fi.isDir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ContentType implements webdav.ContentTyper
+func (fi fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.isDir {
+		return "", webdav.ErrNotImplemented
+	}
+	return "application/pdf", nil
+}
+
+// ETag implements webdav.ETager, stored files are content addressed
+func (fi fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.isDir {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.item.SHA256 + `"`, nil
+}
+
+// readFile is opened article
+type readFile struct {
+	entry
+	*bytes.Reader
+}
+
+func (f *readFile) Close() error                             { return nil }
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *readFile) Stat() (os.FileInfo, error)               { return fileInfo{f.entry}, nil }
+func (f *readFile) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+
+// dirFile is opened folder
+type dirFile struct {
+	entry
+	entries []entry
+	pos     int
+}
+
+func (f *dirFile) Close() error                                 { return nil }
+func (f *dirFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (f *dirFile) Stat() (os.FileInfo, error)                   { return fileInfo{f.entry}, nil }
+func (f *dirFile) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+
+func (f *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos := []os.FileInfo{}
+	for f.pos < len(f.entries) && (count <= 0 || len(infos) < count) {
+		infos = append(infos, fileInfo{f.entries[f.pos]})
+		f.pos++
+	}
+	if count > 0 && len(infos) == 0 {
+		return nil, io.EOF
+	}
+	return infos, nil
+}
+
+// uploadFile buffers uploaded pdf and stores it in the library on close
+type uploadFile struct {
+	fs     *FileSystem
+	user   string
+	folder string
+	name   string
+	buf    bytes.Buffer
+}
+
+func (f *uploadFile) Write(p []byte) (int, error) {
+	if f.buf.Len()+len(p) > pdf.DefaultMaxSize {
+		return 0, fmt.Errorf("file is larger than %d bytes", pdf.DefaultMaxSize)
+	}
+	return f.buf.Write(p)
+}
+
+func (f *uploadFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *uploadFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (f *uploadFile) Readdir(count int) ([]os.FileInfo, error)     { return nil, os.ErrInvalid }
+
+func (f *uploadFile) Stat() (os.FileInfo, error) {
+	return fileInfo{entry{name: f.name, item: library.Item{Size: f.buf.Len(), Added: time.Now()}}}, nil
+}
+
+// Close validates uploaded pdf and saves it to the library
+func (f *uploadFile) Close() error {
+	data := f.buf.Bytes()
+	if report := pdf.Validate(data, pdf.Limits{}); !report.Valid() {
+		return report.Err()
+	}
+
+	item := library.Item{Title: strings.TrimSuffix(f.name, path.Ext(f.name)), FileName: f.name}
+	if len(f.folder) > 0 {
+		item.Collections = []string{f.folder}
+	}
+	item, err := f.fs.Library.Save(f.user, item, data)
+	if err != nil {
+		return err
+	}
+	// saving an existing article keeps its collections, add the folder
+	if len(f.folder) > 0 {
+		found := false
+		for _, c := range item.Collections {
+			found = found || strings.EqualFold(c, f.folder)
+		}
+		if !found {
+			if err := f.fs.setCollection(f.user, item, "", f.folder); err != nil {
+				return err
+			}
+		}
+		f.fs.forgetFolder(f.user, f.folder)
+	}
+	if f.fs.Saved != nil {
+		f.fs.Saved(f.user, item, data)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package dav
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/storage"
+)
+
+// testServer serves library of user ana over webdav
+func testServer(t *testing.T, write bool) (*httptest.Server, *library.Store) {
+	dir := t.TempDir()
+	files, err := storage.NewLocal(filepath.Join(dir, "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := library.Open(filepath.Join(dir, "library.db"), files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	h := Handler("/dav", &FileSystem{Library: store, Write: write})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, auth.WithUser(r, "ana"))
+	}))
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+func request(t *testing.T, method, url string, body []byte, headers ...string) (int, string) {
+	req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+// listing returns names of folder entries from PROPFIND response
+func listing(t *testing.T, url string) []string {
+	status, body := request(t, "PROPFIND", url, nil, "Depth", "1")
+	if status != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND %v = %v %v", url, status, body)
+	}
+	names := []string{}
+	for _, part := range strings.Split(body, "<D:displayname>")[1:] {
+		names = append(names, part[:strings.Index(part, "<")])
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Test_FileName(t *testing.T) {
+	tests := []struct {
+		item   library.Item
+		output string
+	}{
+		{library.Item{Title: "Why Google stores billions of lines of code", Authors: []string{"Rachel Potvin"}, Year: 2016}, "Potvin 2016 - Why Google stores billions of lines of code.pdf"},
+		{library.Item{Title: "Quantum optics: a/b test?", Year: 2010}, "2010 - Quantum optics a b test.pdf"},
+		{library.Item{Title: "upload.pdf"}, "upload.pdf"},
+		{library.Item{ID: "4d718a0a89634e64"}, "4d718a0a89634e64.pdf"},
+	}
+	for _, test := range tests {
+		name := FileName(test.item)
+		if name != test.output {
+			t.Errorf("FileName(%+v) = %v", test.item, name)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
+
+func Test_ReadOnly(t *testing.T) {
+	server, store := testServer(t, false)
+	article, err := ioutil.ReadFile("../parse/testdata/article.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Save("ana", library.Item{Doi: "10.1/a", Title: "Unfiled", Year: 2010}, article)
+	filed, _ := store.Save("ana", library.Item{Doi: "10.1/b", Title: "Filed", Authors: []string{"Li Jiang"}}, []byte("%PDF-1.4 filed"))
+	filed.Collections = []string{"Thesis"}
+	store.Update("ana", filed)
+
+	if names := strings.Join(listing(t, server.URL+"/dav/"), ","); names != ",2010 - Unfiled.pdf,Thesis" {
+		t.Errorf("root listing = %v", names)
+	}
+	if names := strings.Join(listing(t, server.URL+"/dav/Thesis/"), ","); names != "Jiang - Filed.pdf,Thesis" {
+		t.Errorf("collection listing = %v", names)
+	}
+	status, body := request(t, "GET", server.URL+"/dav/Thesis/Jiang%20-%20Filed.pdf", nil)
+	if status != http.StatusOK || body != "%PDF-1.4 filed" {
+		t.Errorf("GET = %v %v", status, body)
+	}
+	for _, method := range []string{"PUT", "DELETE", "MKCOL", "MOVE"} {
+		if status, _ := request(t, method, server.URL+"/dav/2010%20-%20Unfiled.pdf", article); status != http.StatusForbidden {
+			t.Errorf("%v on read-only library = %v", method, status)
+		}
+	}
+}
+
+func Test_Write(t *testing.T) {
+	server, store := testServer(t, true)
+	article, err := ioutil.ReadFile("../parse/testdata/article.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := request(t, "MKCOL", server.URL+"/dav/Reading", nil); status != http.StatusCreated {
+		t.Errorf("MKCOL = %v", status)
+	}
+	if status, body := request(t, "PUT", server.URL+"/dav/Reading/upload.pdf", article); status != http.StatusCreated {
+		t.Fatalf("PUT = %v %v", status, body)
+	}
+	if status, _ := request(t, "PUT", server.URL+"/dav/Reading/broken.pdf", []byte("<html>")); status < 400 {
+		t.Errorf("PUT of broken pdf = %v", status)
+	}
+	if status, _ := request(t, "PUT", server.URL+"/dav/.DS_Store", []byte("x")); status < 400 {
+		t.Errorf("PUT of non pdf file = %v", status)
+	}
+	items, _ := store.List("ana", library.Query{Collection: "Reading"})
+	if len(items) != 1 || items[0].Title != "upload" {
+		t.Fatalf("uploaded items = %+v", items)
+	}
+
+	// moving between folders changes collections
+	status, _ := request(t, "MOVE", server.URL+"/dav/Reading/upload.pdf", nil, "Destination", server.URL+"/dav/Done/upload.pdf")
+	if status >= 400 {
+		t.Errorf("MOVE = %v", status)
+	}
+	if names := strings.Join(listing(t, server.URL+"/dav/"), ","); names != ",Done" {
+		t.Errorf("root listing after move = %v", names)
+	}
+
+	// deleting from a folder removes the collection, deleting from root
+	// removes the article
+	request(t, "DELETE", server.URL+"/dav/Done/upload.pdf", nil)
+	if names := strings.Join(listing(t, server.URL+"/dav/"), ","); names != ",upload.pdf" {
+		t.Errorf("root listing after delete = %v", names)
+	}
+	request(t, "DELETE", server.URL+"/dav/upload.pdf", nil)
+	if items, _ := store.List("ana", library.Query{}); len(items) != 0 {
+		t.Errorf("library after delete = %+v", items)
+	}
+}
@@ -0,0 +1,196 @@
+package doi
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Pattern extracts doi from urls of a single publisher. Publishers that
+// put doi into the url are handled by generic pattern, patterns are
+// needed for urls that contain only part of the doi, ex. nature.com
+// article ids without the 10.1038/ prefix.
+type Pattern struct {
+	Host   string // host or its parent domain, empty matches every host
+	Regexp string // matched against path and query, first group is used when present
+	Prefix string // prepended to the match
+}
+
+// DefaultPatterns are used when no patterns are configured
+var DefaultPatterns = []Pattern{
+	{Host: "arxiv.org", Regexp: `/(?:abs|pdf)/(\d{4}\.\d{4,5})`, Prefix: "10.48550/arXiv."},
+	{Host: "nature.com", Regexp: `/articles/([a-z0-9.-]+)`, Prefix: "10.1038/"},
+	{Host: "biorxiv.org", Regexp: `/content/(?:10\.1101/)?(\d{4}\.\d{2}\.\d{2}\.\d+)`, Prefix: "10.1101/"},
+	{Host: "medrxiv.org", Regexp: `/content/(?:10\.1101/)?(\d{4}\.\d{2}\.\d{2}\.\d+)`, Prefix: "10.1101/"},
+}
+
+// generic matches doi anywhere in the url, doi suffix could contain
+// almost any character, so the match ends on url delimiters
+var generic = regexp.MustCompile(`10\.\d{4,9}/[^\s?#&"'<>]+`)
+
+// trailing are url parts publishers append to doi in landing page urls
+var trailing = []string{"/abstract", "/full", "/pdf", "/epdf", "/pdfdirect", "/summary", "/references", ".pdf", "/"}
+
+type compiled struct {
+	Pattern
+	re *regexp.Regexp
+}
+
+var (
+	mu       sync.RWMutex
+	patterns = mustCompile(DefaultPatterns)
+)
+
+// SetPatterns replaces publisher patterns, patterns are tried in order
+// before the generic doi pattern
+func SetPatterns(list []Pattern) error {
+	c, err := compile(list)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	patterns = c
+	mu.Unlock()
+	return nil
+}
+
+func compile(list []Pattern) ([]compiled, error) {
+	c := []compiled{}
+	for _, p := range list {
+		re, err := regexp.Compile(p.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid doi pattern %q: %v", p.Regexp, err)
+		}
+		c = append(c, compiled{Pattern: p, re: re})
+	}
+	return c, nil
+}
+
+func mustCompile(list []Pattern) []compiled {
+	c, err := compile(list)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Extract returns doi found in doi string, doi.org link or publisher
+// page url and reports whether doi was found
+func Extract(str string) (string, bool) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return "", false
+	}
+	u, err := url.Parse(str)
+	if err != nil || len(u.Host) == 0 {
+		// not an url, only the generic pattern applies
+		return match(generic, unescape(str), "")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	path := unescape(u.EscapedPath())
+	if len(u.RawQuery) > 0 {
+		path += "?" + unescape(u.RawQuery)
+	}
+
+	mu.RLock()
+	list := patterns
+	mu.RUnlock()
+	for _, p := range list {
+		if len(p.Host) > 0 && host != p.Host && !strings.HasSuffix(host, "."+p.Host) {
+			continue
+		}
+		if doi, ok := match(p.re, path, p.Prefix); ok {
+			return doi, true
+		}
+	}
+	return match(generic, path, "")
+}
+
+// arxiv matches arXiv identifiers in citations, ex. "arXiv:1706.03762"
+var arxiv = regexp.MustCompile(`(?i)arxiv:\s*(\d{4}\.\d{4,5})`)
+
+// Find returns first doi found in free text, such as citation from
+// reference list. Citations of arXiv preprints get arXiv doi.
+func Find(text string) (string, bool) {
+	if doi, ok := match(generic, text, ""); ok {
+		return doi, true
+	}
+	return match(arxiv, text, "10.48550/arXiv.")
+}
+
+// FindAll returns dois of all doi strings, doi links, publisher page urls
+// and arXiv ids in free text, such as mail body. Duplicates are removed.
+func FindAll(text string) []string {
+	list := []string{}
+	seen := map[string]bool{}
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		field = strings.Trim(field, "<>()[]\"',;")
+		var doi string
+		var ok bool
+		switch {
+		case strings.HasPrefix(field, "http://") || strings.HasPrefix(field, "https://"):
+			doi, ok = Extract(field)
+		case strings.EqualFold(field, "arxiv:") && i+1 < len(fields):
+			// "arXiv: 1706.03762"
+			doi, ok = match(arxiv, field+fields[i+1], "10.48550/arXiv.")
+		default:
+			doi, ok = Find(field)
+		}
+		if ok && !seen[strings.ToLower(doi)] {
+			seen[strings.ToLower(doi)] = true
+			list = append(list, doi)
+		}
+	}
+	return list
+}
+
+// Valid reports whether string looks like doi
+func Valid(str string) bool {
+	doi, ok := match(generic, str, "")
+	return ok && doi == strings.TrimSpace(str)
+}
+
+// match returns first group (or whole match) with prefix and publisher
+// suffixes removed
+func match(re *regexp.Regexp, str, prefix string) (string, bool) {
+	m := re.FindStringSubmatch(str)
+	if m == nil {
+		return "", false
+	}
+	doi := m[0]
+	if len(m) > 1 {
+		doi = m[1]
+	}
+	for removed := true; removed; {
+		removed = false
+		for _, suffix := range trailing {
+			if strings.HasSuffix(doi, suffix) {
+				doi = strings.TrimSuffix(doi, suffix)
+				removed = true
+			}
+		}
+		// punctuation of the surrounding sentence, closing bracket is
+		// part of the doi only when it is balanced
+		if strings.HasSuffix(doi, ")") && strings.Count(doi, "(") < strings.Count(doi, ")") ||
+			strings.HasSuffix(doi, ".") || strings.HasSuffix(doi, ",") || strings.HasSuffix(doi, ";") {
+			doi = doi[:len(doi)-1]
+			removed = true
+		}
+	}
+	if len(doi) == 0 {
+		return "", false
+	}
+	return prefix + doi, true
+}
+
+// unescape decodes percent encoded url part, invalid encoding is kept
+func unescape(str string) string {
+	if s, err := url.PathUnescape(str); err == nil {
+		return s
+	}
+	return str
+}
@@ -0,0 +1,128 @@
+package doi
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Extract(t *testing.T) {
+	tests := []struct {
+		input string
+		doi   string
+		found bool
+	}{
+		{"10.1080/09500340.2010.500105", "10.1080/09500340.2010.500105", true},
+		{" 10.1080/09500340.2010.500105 ", "10.1080/09500340.2010.500105", true},
+		{"https://doi.org/10.1145/2854146", "10.1145/2854146", true},
+		{"http://dx.doi.org/10.1080/09500340.2010.500105", "10.1080/09500340.2010.500105", true},
+		{"https://onlinelibrary.wiley.com/doi/full/10.1002/anie.201915678", "10.1002/anie.201915678", true},
+		{"https://onlinelibrary.wiley.com/doi/10.1002/anie.201915678/abstract", "10.1002/anie.201915678", true},
+		{"https://link.springer.com/content/pdf/10.1007/s00220-019-03323-5.pdf", "10.1007/s00220-019-03323-5", true},
+		{"https://www.tandfonline.com/doi/abs/10.1080/09500340.2010.500105?journalCode=tmop20", "10.1080/09500340.2010.500105", true},
+		{"https://journals.aps.org/prl/abstract/10.1103/PhysRevLett.116.061102", "10.1103/PhysRevLett.116.061102", true},
+		{"https://www.sciencedirect.com/science/article/pii/S0370269312008581?via%3Dihub&doi=10.1016%2Fj.physletb.2012.08.021", "10.1016/j.physletb.2012.08.021", true},
+		{"https://pubs.acs.org/doi/10.1021/acs.chemrev.9b00%3C1", "10.1021/acs.chemrev.9b00", true},
+		{"https://www.nature.com/articles/s41586-020-2649-2", "10.1038/s41586-020-2649-2", true},
+		{"https://www.nature.com/articles/nature14539.pdf", "10.1038/nature14539", true},
+		{"https://arxiv.org/abs/1706.03762v5", "10.48550/arXiv.1706.03762", true},
+		{"https://www.biorxiv.org/content/10.1101/2020.03.22.002386v4.full", "10.1101/2020.03.22.002386", true},
+		{"https://www.nature.com/", "", false},
+		{"https://example.org/blog/post", "", false},
+		{"not a doi", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		doi, found := Extract(test.input)
+		if doi != test.doi || found != test.found {
+			t.Errorf("Extract(%v) = %v, %v", test.input, doi, found)
+			t.Errorf("Output should be: %v, %v", test.doi, test.found)
+		}
+	}
+}
+
+func Test_SetPatterns(t *testing.T) {
+	defer SetPatterns(DefaultPatterns)
+
+	if err := SetPatterns([]Pattern{{Regexp: "("}}); err == nil {
+		t.Errorf("SetPatterns() accepted invalid regexp")
+	}
+	err := SetPatterns([]Pattern{{Host: "journals.example.org", Regexp: `/article/(\d+)`, Prefix: "10.5555/ex."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input string
+		doi   string
+	}{
+		{"https://journals.example.org/article/1234", "10.5555/ex.1234"},
+		{"https://www.journals.example.org/article/1234", "10.5555/ex.1234"},
+		{"https://other.example.org/article/1234", ""},
+		// generic pattern still applies
+		{"https://other.example.org/doi/10.5555/abc", "10.5555/abc"},
+	}
+	for _, test := range tests {
+		if doi, _ := Extract(test.input); doi != test.doi {
+			t.Errorf("Extract(%v) = %v", test.input, doi)
+			t.Errorf("Output should be: %v", test.doi)
+		}
+	}
+}
+
+func Test_Valid(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+	}{
+		{"10.1145/2854146", true},
+		{"10.1038/nature14539", true},
+		{"https://doi.org/10.1145/2854146", false},
+		{"1145/2854146", false},
+	}
+	for _, test := range tests {
+		if valid := Valid(test.input); valid != test.valid {
+			t.Errorf("Valid(%v) = %v", test.input, valid)
+			t.Errorf("Output should be: %v", test.valid)
+		}
+	}
+}
+
+func Test_Find(t *testing.T) {
+	tests := []struct {
+		input string
+		doi   string
+		found bool
+	}{
+		{"[1] R. Potvin, J. Levenberg, Commun. ACM 59 (2016) 78. doi:10.1145/2854146.", "10.1145/2854146", true},
+		{"Lancet 395, 497 (2020), https://doi.org/10.1016/S0140-6736(20)30183-5.", "10.1016/S0140-6736(20)30183-5", true},
+		{"(see https://doi.org/10.1145/2854146)", "10.1145/2854146", true},
+		{"A. Vaswani et al., Attention is all you need, arXiv:1706.03762 (2017).", "10.48550/arXiv.1706.03762", true},
+		{"J. Smith, Some journal 12 (1999) 1-10.", "", false},
+	}
+	for _, test := range tests {
+		doi, found := Find(test.input)
+		if doi != test.doi || found != test.found {
+			t.Errorf("Find(%v) = %v, %v", test.input, doi, found)
+			t.Errorf("Output should be: %v, %v", test.doi, test.found)
+		}
+	}
+}
+
+func Test_FindAll(t *testing.T) {
+	tests := []struct {
+		input  string
+		output []string
+	}{
+		{"Please send 10.1145/2854146 and\nhttps://doi.org/10.1016/S0140-6736(20)30183-5.", []string{"10.1145/2854146", "10.1016/S0140-6736(20)30183-5"}},
+		{"<https://www.nature.com/articles/s41586-020-2649-2> (arXiv:1706.03762), arXiv: 2001.08361", []string{"10.1038/s41586-020-2649-2", "10.48550/arXiv.1706.03762", "10.48550/arXiv.2001.08361"}},
+		{"doi:10.1145/2854146, DOI:10.1145/2854146", []string{"10.1145/2854146"}},
+		{"Thanks, see you on 10.5.", []string{}},
+	}
+	for _, test := range tests {
+		output := FindAll(test.input)
+		if strings.Join(output, " ") != strings.Join(test.output, " ") {
+			t.Errorf("FindAll(%v) = %v", test.input, output)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
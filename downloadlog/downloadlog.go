@@ -0,0 +1,223 @@
+package downloadlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// Entry is a single record of the download log
+type Entry struct {
+	Time      time.Time
+	Doi       string
+	User      string   `json:",omitempty"`
+	Via       string   `json:",omitempty"` // channel of the request, ex. "email:ana@example.org"
+	Source    string   `json:",omitempty"` // scihub mirror the pdf was fetched from
+	Size      int      `json:",omitempty"`
+	SHA256    string   `json:",omitempty"`
+	Status    string   // "ok" or api error code, ex. "not_found"
+	Error     string   `json:",omitempty"`
+	Scan      string   `json:",omitempty"` // antivirus scan result
+	Sanitized []string `json:",omitempty"` // removed active content
+}
+
+// Log is append only download log stored as json lines file. When keys
+// are set, every line is sealed and base64 encoded.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	keys *encrypt.Keyring
+}
+
+// Open opens download log at path, the file is created if it does not exist.
+// Nil keys leave the log unencrypted.
+func Open(path string, keys *encrypt.Keyring) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open download log: %v", err)
+	}
+	file.Close()
+	return &Log{path: path, keys: keys}, nil
+}
+
+// Append writes entry at the end of the log. Calling Append on nil log
+// does nothing, so the log could be disabled in configuration.
+func (l *Log) Append(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if line, err = l.seal(line); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Entries returns all entries in the order they were written
+func (l *Log) Entries() ([]Entry, error) {
+	entries := []Entry{}
+	if l == nil {
+		return entries, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		e := Entry{}
+		line, err := l.open(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("Could not decrypt download log entry: %v", err)
+		}
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("Broken download log entry: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// logLabel labels sealed log lines, lines have no key of their own
+const logLabel = "downloadlog"
+
+// seal encrypts log line, lines are left as they are without keys
+func (l *Log) seal(line []byte) ([]byte, error) {
+	if l.keys == nil {
+		return line, nil
+	}
+	sealed, err := l.keys.Seal(line, logLabel)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// open decrypts log line, json lines written before encryption was
+// enabled are returned as they are
+func (l *Log) open(line []byte) ([]byte, error) {
+	if bytes.HasPrefix(line, []byte("{")) {
+		return line, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, err
+	}
+	return l.keys.Open(sealed, logLabel)
+}
+
+// Reseal rewrites the log so all lines are sealed with the primary key,
+// it returns number of changed lines
+func (l *Log) Reseal() (int, error) {
+	if l == nil || l.keys == nil {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	var out bytes.Buffer
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte("{")) {
+			if line, err = base64.StdEncoding.DecodeString(string(line)); err != nil {
+				return 0, err
+			}
+		}
+		resealed, ok, err := l.keys.Reseal(line, logLabel)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			changed++
+		}
+		out.WriteString(base64.StdEncoding.EncodeToString(resealed) + "\n")
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	return changed, os.Rename(tmp, l.path)
+}
+
+// Remove rewrites the log without entries for which drop returns true, ex.
+// entries older than retention period or entries of an erased user. It
+// returns number of removed entries.
+func (l *Log) Remove(drop func(e Entry) bool) (int, error) {
+	if l == nil {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var out bytes.Buffer
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		opened, err := l.open(line)
+		if err != nil {
+			return 0, fmt.Errorf("Could not decrypt download log entry: %v", err)
+		}
+		e := Entry{}
+		if err := json.Unmarshal(opened, &e); err != nil {
+			return 0, fmt.Errorf("Broken download log entry: %v", err)
+		}
+		if drop(e) {
+			removed++
+			continue
+		}
+		// kept lines are written as they were, sealed or not
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmp, l.path)
+}
@@ -0,0 +1,62 @@
+package downloadlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+func Test_Remove(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, bytes.Repeat([]byte{7}, 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	for _, k := range []*encrypt.Keyring{nil, keys} {
+		l, err := Open(filepath.Join(dir, "downloads.log"), k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Remove(func(e Entry) bool { return true }); err != nil {
+			t.Fatal(err)
+		}
+		l.Append(Entry{Time: now.Add(-48 * time.Hour), Doi: "10.1/old", User: "ana"})
+		l.Append(Entry{Time: now, Doi: "10.1/ana", User: "ana"})
+		l.Append(Entry{Time: now, Doi: "10.1/bob", User: "bob"})
+
+		tests := []struct {
+			drop    func(e Entry) bool
+			removed int
+			left    []string
+		}{
+			{func(e Entry) bool { return e.Time.Before(now.Add(-24 * time.Hour)) }, 1, []string{"10.1/ana", "10.1/bob"}},
+			{func(e Entry) bool { return e.User == "carl" }, 0, []string{"10.1/ana", "10.1/bob"}},
+			{func(e Entry) bool { return e.User == "ana" }, 1, []string{"10.1/bob"}},
+		}
+		for _, test := range tests {
+			removed, err := l.Remove(test.drop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := l.Entries()
+			left := []string{}
+			for _, e := range entries {
+				left = append(left, e.Doi)
+			}
+			if removed != test.removed || len(left) != len(test.left) || left[0] != test.left[0] {
+				t.Errorf("Remove() = %v, %v (encrypted: %v)", removed, left, k != nil)
+				t.Errorf("Output should be: %v, %v", test.removed, test.left)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// encryptionBucket keeps id of the key every sealed bucket was sealed
+	// with and the sealed key of Name
+	encryptionBucket = []byte("encryption")
+	namesKey         = []byte("names")
+)
+
+const namesLabel = "encryption/names"
+
+// SealBucket makes sure values of the top level bucket and its nested
+// buckets are sealed with the primary key. Label of every value is the
+// path of its buckets and its key joined with "/", ex. "share/links/<id>".
+// The key the bucket was sealed with is recorded, so values are checked
+// again only after the key is rotated. When the bucket is sealed the first
+// time, keys of values and nested buckets that reveal what is stored are
+// replaced with their Name when rename returns true. Empty values are not
+// sealed. Nil keyring returns an error for buckets that were already sealed.
+func (k *Keyring) SealBucket(tx *bolt.Tx, name string, rename func(path string, key []byte) bool) error {
+	enc, err := tx.CreateBucketIfNotExists(encryptionBucket)
+	if err != nil {
+		return err
+	}
+	sealed := string(enc.Get([]byte(name)))
+	if k == nil {
+		if len(sealed) > 0 {
+			return fmt.Errorf("Data in %v bucket is encrypted, but encryption key is not configured", name)
+		}
+		return nil
+	}
+	if err := k.loadNames(enc); err != nil {
+		return err
+	}
+	if sealed == k.ID() {
+		return nil
+	}
+	if len(sealed) > 0 {
+		// keys were renamed when the bucket was sealed the first time
+		rename = nil
+	}
+	if b := tx.Bucket([]byte(name)); b != nil {
+		if err := k.sealBucket(b, name, rename); err != nil {
+			return err
+		}
+	}
+	return enc.Put([]byte(name), []byte(k.ID()))
+}
+
+// BucketSealed reports whether the top level bucket was sealed with any
+// key
+func BucketSealed(tx *bolt.Tx, name string) bool {
+	enc := tx.Bucket(encryptionBucket)
+	return enc != nil && enc.Get([]byte(name)) != nil
+}
+
+// loadNames reads key of Name from the encryption bucket, random key is
+// generated on the first start. The key is sealed again after the master
+// key is rotated.
+func (k *Keyring) loadNames(enc *bolt.Bucket) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	stored := enc.Get(namesKey)
+	if stored == nil {
+		if k.names == nil {
+			k.names = make([]byte, keySize)
+			if _, err := rand.Read(k.names); err != nil {
+				k.names = nil
+				return err
+			}
+		}
+		sealed, err := k.Seal(k.names, namesLabel)
+		if err != nil {
+			return err
+		}
+		return enc.Put(namesKey, sealed)
+	}
+
+	names, err := k.Open(stored, namesLabel)
+	if err != nil {
+		return fmt.Errorf("Could not open names key: %v", err)
+	}
+	if k.names != nil && !bytes.Equal(k.names, names) {
+		return fmt.Errorf("Database was encrypted with other names key")
+	}
+	k.names = names
+	resealed, changed, err := k.Reseal(stored, namesLabel)
+	if err != nil || !changed {
+		return err
+	}
+	return enc.Put(namesKey, resealed)
+}
+
+// sealBucket seals values of the bucket and its nested buckets, path is
+// the label of the bucket
+func (k *Keyring) sealBucket(b *bolt.Bucket, path string, rename func(path string, key []byte) bool) error {
+	type entry struct {
+		key    []byte
+		value  []byte
+		bucket bool
+	}
+	// bucket can not be changed while iterating over it
+	entries := []entry{}
+	err := b.ForEach(func(key, value []byte) error {
+		entries = append(entries, entry{
+			key:    append([]byte{}, key...),
+			value:  append([]byte{}, value...),
+			bucket: b.Bucket(key) != nil,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		key := e.key
+		if rename != nil && rename(path, e.key) {
+			name, err := k.Name(string(e.key))
+			if err != nil {
+				return err
+			}
+			key = []byte(name)
+		}
+		moved := !bytes.Equal(key, e.key)
+
+		if e.bucket {
+			nested := b.Bucket(e.key)
+			if moved {
+				dst, err := b.CreateBucket(key)
+				if err != nil {
+					return err
+				}
+				if err := copyBucket(nested, dst); err != nil {
+					return err
+				}
+				if err := b.DeleteBucket(e.key); err != nil {
+					return err
+				}
+				nested = dst
+			}
+			if err := k.sealBucket(nested, path+"/"+string(key), rename); err != nil {
+				return err
+			}
+			continue
+		}
+
+		label := path + "/" + string(key)
+		data := e.value
+		switch {
+		case len(e.value) == 0:
+		case moved:
+			plain, err := k.Open(e.value, path+"/"+string(e.key))
+			if err != nil {
+				return err
+			}
+			if data, err = k.Seal(plain, label); err != nil {
+				return err
+			}
+		default:
+			resealed, changed, err := k.Reseal(e.value, label)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			data = resealed
+		}
+		if moved {
+			if err := b.Delete(e.key); err != nil {
+				return err
+			}
+		}
+		if err := b.Put(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBucket copies values and nested buckets of src into dst
+func copyBucket(src, dst *bolt.Bucket) error {
+	return src.ForEach(func(key, value []byte) error {
+		if nested := src.Bucket(key); nested != nil {
+			copied, err := dst.CreateBucket(key)
+			if err != nil {
+				return err
+			}
+			return copyBucket(nested, copied)
+		}
+		return dst.Put(key, value)
+	})
+}
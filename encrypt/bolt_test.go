@@ -0,0 +1,124 @@
+package encrypt
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func Test_SealBucket(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// notes of users written before encryption was enabled
+	db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket([]byte("notes"))
+		b.Put([]byte("secret"), []byte("signing key"))
+		b.Put([]byte("empty"), []byte{})
+		users, _ := b.CreateBucket([]byte("users"))
+		users.Put([]byte("ana"), []byte("read gravitational waves"))
+		return nil
+	})
+
+	oldKey := writeKey(t, 1, false)
+	k, _ := New(Config{KeyFile: oldKey})
+	if _, err := k.Name("ana"); err != ErrNamesNotLoaded {
+		t.Errorf("Name() before SealBucket = %v", err)
+	}
+	rename := func(path string, key []byte) bool {
+		return path == "notes/users"
+	}
+	if err := db.Update(func(tx *bolt.Tx) error { return k.SealBucket(tx, "notes", rename) }); err != nil {
+		t.Fatal(err)
+	}
+	ana, err := k.Name("ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob, _ := k.Name("bob"); len(ana) != 32 || ana == bob {
+		t.Errorf("Name(ana) = %v", ana)
+	}
+
+	read := func(k *Keyring, path ...string) (string, error) {
+		out := []byte{}
+		err := db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(path[0]))
+			for _, name := range path[1 : len(path)-1] {
+				b = b.Bucket([]byte(name))
+			}
+			data := b.Get([]byte(path[len(path)-1]))
+			if len(data) > 0 && !Sealed(data) {
+				t.Errorf("%v is not sealed", path)
+			}
+			var err error
+			out, err = k.Open(data, strings.Join(path, "/"))
+			return err
+		})
+		return string(out), err
+	}
+	tests := []struct {
+		path []string
+		out  string
+	}{
+		{[]string{"notes", "secret"}, "signing key"},
+		{[]string{"notes", "empty"}, ""},
+		{[]string{"notes", "users", ana}, "read gravitational waves"},
+	}
+	for _, test := range tests {
+		if out, err := read(k, test.path...); out != test.out || err != nil {
+			t.Errorf("%v = %q, %v", test.path, out, err)
+			t.Errorf("Output should be: %q", test.out)
+		}
+	}
+
+	// rotated key reseals values, names stay the same
+	rotated, _ := New(Config{KeyFile: writeKey(t, 2, false), OldKeyFiles: []string{oldKey}})
+	if err := db.Update(func(tx *bolt.Tx) error { return rotated.SealBucket(tx, "notes", rename) }); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := New(Config{KeyFile: writeKey(t, 2, false)})
+	if err := db.Update(func(tx *bolt.Tx) error { return current.SealBucket(tx, "notes", nil) }); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := current.Name("ana"); name != ana {
+		t.Errorf("Name() changed after key rotation")
+	}
+	if out, err := read(current, "notes", "users", ana); out != "read gravitational waves" || err != nil {
+		t.Errorf("value after key rotation = %q, %v", out, err)
+	}
+
+	var disabled *Keyring
+	if err := db.Update(func(tx *bolt.Tx) error { return disabled.SealBucket(tx, "notes", nil) }); err == nil {
+		t.Errorf("SealBucket() without key accepted sealed bucket")
+	}
+	db.View(func(tx *bolt.Tx) error {
+		if !BucketSealed(tx, "notes") || BucketSealed(tx, "other") {
+			t.Errorf("BucketSealed() = %v, %v", BucketSealed(tx, "notes"), BucketSealed(tx, "other"))
+		}
+		return nil
+	})
+}
+
+func Test_Marshal(t *testing.T) {
+	k, _ := New(Config{KeyFile: writeKey(t, 1, false)})
+	type note struct{ Text string }
+	data, err := k.Marshal(note{"secret"}, "notes/1")
+	if err != nil || bytes.Contains(data, []byte("secret")) {
+		t.Fatalf("Marshal() = %q, %v", data, err)
+	}
+	out := note{}
+	if err := k.Unmarshal(data, "notes/1", &out); err != nil || out.Text != "secret" {
+		t.Errorf("Unmarshal() = %+v, %v", out, err)
+	}
+	if err := k.Unmarshal(data, "notes/2", &out); err != ErrBroken {
+		t.Errorf("Unmarshal() with other label = %v", err)
+	}
+	if err := k.Unmarshal([]byte(`{"Text": "plain"}`), "notes/3", &out); err != nil || out.Text != "plain" {
+		t.Errorf("Unmarshal() of plaintext = %+v, %v", out, err)
+	}
+}
@@ -0,0 +1,352 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic starts every sealed envelope, data without it is treated as
+// plaintext written before encryption was enabled
+var magic = []byte("GSE1")
+
+const (
+	keySize   = 32
+	idSize    = 8
+	nonceSize = 12
+	tagSize   = 16
+	// header is magic, id of the key encrypting the data key, nonce and
+	// the encrypted data key
+	headerSize = len("GSE1") + idSize + nonceSize + keySize + tagSize
+)
+
+var (
+	// ErrUnknownKey is returned when data was sealed with a key that is
+	// not configured
+	ErrUnknownKey = errors.New("Data was encrypted with unknown key")
+	// ErrBroken is returned when sealed data was changed or truncated
+	ErrBroken = errors.New("Encrypted data is broken")
+	// ErrNamesNotLoaded is returned by Name before SealBucket loaded the
+	// names key from the database
+	ErrNamesNotLoaded = errors.New("Names key was not loaded from the database")
+)
+
+// Config holds key used for encryption and old keys that are still used
+// for decryption after the key was rotated. Keys are read from files with
+// 32 random bytes (raw or hex) or derived from passphrases.
+type Config struct {
+	KeyFile        string
+	Passphrase     string
+	SaltFile       string // salt of passphrase keys, created when missing
+	OldKeyFiles    []string
+	OldPassphrases []string
+}
+
+// Enabled reports whether a key is configured
+func (c Config) Enabled() bool {
+	return len(c.KeyFile) > 0 || len(c.Passphrase) > 0
+}
+
+// key is master key, it encrypts data keys only
+type key struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+func newKey(secret []byte) (key, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return key{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return key{}, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("goscience key id"))
+	return key{id: mac.Sum(nil)[:idSize], aead: aead}, nil
+}
+
+// Keyring seals data with envelope encryption: every envelope has its own
+// random data key, which is encrypted with the master key. Rotating the
+// master key only re-encrypts data keys. Nil keyring leaves data as it is,
+// so encryption could be disabled in configuration.
+type Keyring struct {
+	primary key
+	keys    map[string]key
+
+	mu    sync.Mutex
+	names []byte // key of Name, loaded from the database by SealBucket
+}
+
+// New loads keys from configuration. Data is sealed with the key file,
+// or with the passphrase when no key file is set. Other keys only open
+// data sealed before the key was rotated.
+func New(conf Config) (*Keyring, error) {
+	if !conf.Enabled() {
+		return nil, fmt.Errorf("Encryption key is not configured")
+	}
+	secrets := [][]byte{}
+	for _, file := range append([]string{conf.KeyFile}, conf.OldKeyFiles...) {
+		if len(file) == 0 {
+			continue
+		}
+		secret, err := readKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	files := len(secrets)
+	passphrases := []string{}
+	for _, passphrase := range append([]string{conf.Passphrase}, conf.OldPassphrases...) {
+		if len(passphrase) > 0 {
+			passphrases = append(passphrases, passphrase)
+		}
+	}
+	if len(passphrases) > 0 {
+		salt, err := readSalt(conf.SaltFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, passphrase := range passphrases {
+			secret, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, keySize)
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(conf.KeyFile) == 0 {
+		// passphrase is the primary key, move it before old key files
+		secrets = append(append([][]byte{secrets[files]}, secrets[:files]...), secrets[files+1:]...)
+	}
+
+	k := &Keyring{keys: map[string]key{}}
+	for i, secret := range secrets {
+		mk, err := newKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			k.primary = mk
+		}
+		k.keys[string(mk.id)] = mk
+	}
+	return k, nil
+}
+
+// readKeyFile reads 32 byte key stored raw or hex encoded
+func readKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read encryption key: %v", err)
+	}
+	if text := strings.TrimSpace(string(data)); len(text) == 2*keySize {
+		if secret, err := hex.DecodeString(text); err == nil {
+			return secret, nil
+		}
+	}
+	if len(data) != keySize {
+		return nil, fmt.Errorf("Encryption key %v has to be 32 bytes or 64 hex characters", path)
+	}
+	return data, nil
+}
+
+// readSalt reads passphrase salt, new random salt is written when the file
+// does not exist
+func readSalt(path string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("Salt file of encryption passphrase is not set")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(salt)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("Could not write encryption salt: %v", err)
+	}
+	return salt, nil
+}
+
+// ID returns hex encoded id of the primary key, empty for nil keyring
+func (k *Keyring) ID() string {
+	if k == nil {
+		return ""
+	}
+	return hex.EncodeToString(k.primary.id)
+}
+
+// Sealed reports whether data is encrypted envelope
+func Sealed(data []byte) bool {
+	return len(data) >= headerSize && bytes.HasPrefix(data, magic)
+}
+
+// Seal encrypts data with new data key. Label names where the data is
+// stored (database key or file name), the envelope opens only with the
+// same label, so sealed values could not be swapped between entries.
+func (k *Keyring) Seal(data []byte, label string) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+	dataKey := make([]byte, keySize)
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dk, err := newKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header, err := k.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return dk.aead.Seal(out, nonce, data, dataAAD(label)), nil
+}
+
+// dataAAD returns additional data authenticated with sealed data
+func dataAAD(label string) []byte {
+	return append(append([]byte{}, magic...), label...)
+}
+
+// wrap returns envelope header with data key encrypted by primary key
+func (k *Keyring) wrap(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append(append(append([]byte{}, magic...), k.primary.id...), nonce...)
+	return k.primary.aead.Seal(header, nonce, dataKey, header[:len(magic)+idSize]), nil
+}
+
+// unwrap returns data key of the envelope
+func (k *Keyring) unwrap(data []byte) ([]byte, error) {
+	id := data[len(magic) : len(magic)+idSize]
+	mk, ok := k.keys[string(id)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	nonce := data[len(magic)+idSize : len(magic)+idSize+nonceSize]
+	dataKey, err := mk.aead.Open(nil, nonce, data[len(magic)+idSize+nonceSize:headerSize], data[:len(magic)+idSize])
+	if err != nil {
+		return nil, ErrBroken
+	}
+	return dataKey, nil
+}
+
+// Open decrypts data sealed with the same label, plaintext is returned as
+// it is
+func (k *Keyring) Open(data []byte, label string) ([]byte, error) {
+	if !Sealed(data) {
+		return data, nil
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	dataKey, err := k.unwrap(data)
+	if err != nil {
+		return nil, err
+	}
+	dk, err := newKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize+nonceSize+tagSize {
+		return nil, ErrBroken
+	}
+	nonce := data[headerSize : headerSize+nonceSize]
+	plain, err := dk.aead.Open(nil, nonce, data[headerSize+nonceSize:], dataAAD(label))
+	if err != nil {
+		return nil, ErrBroken
+	}
+	return plain, nil
+}
+
+// Reseal makes sure data is sealed with the primary key. Data key of data
+// sealed with an old key is encrypted again, the data itself is not.
+// Plaintext is sealed with the label. It reports whether the data was
+// changed.
+func (k *Keyring) Reseal(data []byte, label string) ([]byte, bool, error) {
+	if k == nil {
+		return data, false, nil
+	}
+	if !Sealed(data) {
+		sealed, err := k.Seal(data, label)
+		return sealed, err == nil, err
+	}
+	if bytes.Equal(data[len(magic):len(magic)+idSize], k.primary.id) {
+		return data, false, nil
+	}
+	dataKey, err := k.unwrap(data)
+	if err != nil {
+		return nil, false, err
+	}
+	header, err := k.wrap(dataKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(header, data[headerSize:]...), true, nil
+}
+
+// Marshal encodes value as json and seals it with the label
+func (k *Keyring) Marshal(v interface{}, label string) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return k.Seal(data, label)
+}
+
+// Unmarshal opens data sealed with the label and decodes json into v
+func (k *Keyring) Unmarshal(data []byte, label string, v interface{}) error {
+	data, err := k.Open(data, label)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Name returns name under which the value is stored, so database keys and
+// file names do not reveal user names, dois or checksums of stored
+// articles. Names are keyed hashes, the key is random and kept sealed in
+// the database, so rotating the master key does not change them. Nil
+// keyring returns the value as it is.
+func (k *Keyring) Name(value string) (string, error) {
+	if k == nil {
+		return value, nil
+	}
+	k.mu.Lock()
+	names := k.names
+	k.mu.Unlock()
+	if names == nil {
+		return "", ErrNamesNotLoaded
+	}
+	mac := hmac.New(sha256.New, names)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
@@ -0,0 +1,126 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// writeKey writes key file with repeated byte
+func writeKey(t *testing.T, b byte, hexEncoded bool) string {
+	path := filepath.Join(t.TempDir(), "key")
+	secret := bytes.Repeat([]byte{b}, keySize)
+	data := secret
+	if hexEncoded {
+		data = []byte(hex.EncodeToString(secret) + "\n")
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_Seal(t *testing.T) {
+	k, err := New(Config{KeyFile: writeKey(t, 1, true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte("%PDF-1.4 secret article")
+	sealed, err := k.Seal(plain, "a.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Sealed(sealed) || bytes.Contains(sealed, []byte("secret")) {
+		t.Errorf("Seal() = %q", sealed)
+	}
+	again, _ := k.Seal(plain, "a.pdf")
+	if bytes.Equal(sealed, again) {
+		t.Errorf("Seal() returned the same envelope twice")
+	}
+
+	tests := []struct {
+		data  []byte
+		label string
+		out   []byte
+		err   error
+	}{
+		{sealed, "a.pdf", plain, nil},
+		{plain, "a.pdf", plain, nil}, // written before encryption was enabled
+		{append(append([]byte{}, sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1), "a.pdf", nil, ErrBroken},
+		{sealed[:headerSize+3], "a.pdf", nil, ErrBroken},
+		{sealed, "b.pdf", nil, ErrBroken}, // moved to other entry
+	}
+	for _, test := range tests {
+		out, err := k.Open(test.data, test.label)
+		if !bytes.Equal(out, test.out) || err != test.err {
+			t.Errorf("Open(%q, %v) = %q, %v", test.data, test.label, out, err)
+			t.Errorf("Output should be: %q, %v", test.out, test.err)
+		}
+	}
+
+	other, _ := New(Config{KeyFile: writeKey(t, 2, false)})
+	if _, err := other.Open(sealed, "a.pdf"); err != ErrUnknownKey {
+		t.Errorf("Open() with other key = %v", err)
+	}
+	var disabled *Keyring
+	if out, _ := disabled.Seal(plain, "a.pdf"); !bytes.Equal(out, plain) {
+		t.Errorf("nil keyring changed data")
+	}
+}
+
+func Test_Reseal(t *testing.T) {
+	oldKey, newKey := writeKey(t, 1, false), writeKey(t, 2, false)
+	old, _ := New(Config{KeyFile: oldKey})
+	plain := []byte("download history")
+	sealed, _ := old.Seal(plain, "log")
+
+	rotated, err := New(Config{KeyFile: newKey, OldKeyFiles: []string{oldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resealed, changed, err := rotated.Reseal(sealed, "log")
+	if !changed || err != nil {
+		t.Fatalf("Reseal() = %v, %v", changed, err)
+	}
+	if !bytes.Equal(resealed[headerSize:], sealed[headerSize:]) {
+		t.Errorf("Reseal() encrypted the data again instead of the data key")
+	}
+	current, _ := New(Config{KeyFile: newKey})
+	if out, err := current.Open(resealed, "log"); !bytes.Equal(out, plain) || err != nil {
+		t.Errorf("Open() after Reseal() = %q, %v", out, err)
+	}
+	if _, changed, _ := rotated.Reseal(resealed, "log"); changed {
+		t.Errorf("Reseal() changed data sealed with the primary key")
+	}
+	if out, changed, _ := rotated.Reseal(plain, "log"); !changed || !Sealed(out) {
+		t.Errorf("Reseal() did not seal plaintext")
+	}
+}
+
+func Test_Passphrase(t *testing.T) {
+	salt := filepath.Join(t.TempDir(), "salt")
+	k, err := New(Config{Passphrase: "correct horse", SaltFile: salt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := k.Seal([]byte("note"), "note")
+
+	// the same passphrase and salt derive the same key
+	k, _ = New(Config{Passphrase: "correct horse", SaltFile: salt})
+	if out, err := k.Open(sealed, "note"); string(out) != "note" || err != nil {
+		t.Errorf("Open() = %q, %v", out, err)
+	}
+	// passphrase becomes an old key when key file is set
+	k, _ = New(Config{KeyFile: writeKey(t, 3, false), OldPassphrases: []string{"correct horse"}, SaltFile: salt})
+	if out, err := k.Open(sealed, "note"); string(out) != "note" || err != nil {
+		t.Errorf("Open() with old passphrase = %q, %v", out, err)
+	}
+	if _, err := New(Config{Passphrase: "correct horse"}); err == nil {
+		t.Errorf("New() accepted passphrase without salt file")
+	}
+	if _, err := New(Config{KeyFile: salt}); err == nil {
+		t.Errorf("New() accepted key of wrong size")
+	}
+}
@@ -0,0 +1,112 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/greatdanton/goScience/library"
+)
+
+// ContentType is content type of Atom feeds
+const ContentType = "application/atom+xml; charset=utf-8"
+
+// Feed is Atom feed of newly added library articles for feed readers
+type Feed struct {
+	XMLName xml.Name  `xml:"feed"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated time.Time `xml:"updated"`
+	Author  Author    `xml:"author"`
+	Links   []Link    `xml:"link"`
+	Entries []Entry   `xml:"entry"`
+}
+
+// Entry is library article
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    time.Time  `xml:"updated"`
+	Published  time.Time  `xml:"published"`
+	Authors    []Author   `xml:"author"`
+	Categories []Category `xml:"category"`
+	Summary    *Text      `xml:"summary,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+// Author of feed or article
+type Author struct {
+	Name string `xml:"name"`
+}
+
+// Category is article tag
+type Category struct {
+	Term string `xml:"term,attr"`
+}
+
+// Text is Atom text construct
+type Text struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Link is Atom link, enclosure links have the length of the file set
+type Link struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int    `xml:"length,attr,omitempty"`
+}
+
+// New creates feed with the self link and the link to the library page.
+// Urls have to be absolute, feed readers fetch them without the context
+// of the feed.
+func New(id, title, self, page string, updated time.Time) *Feed {
+	return &Feed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		ID:      id,
+		Title:   title,
+		Updated: updated.UTC(),
+		Author:  Author{Name: "GoScience"},
+		Links: []Link{
+			{Rel: "self", Href: self, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: page, Type: "text/html"},
+		},
+	}
+}
+
+// Add adds library article with link to its page and pdf enclosure
+func (f *Feed) Add(item library.Item, page, enclosure string) {
+	e := Entry{
+		ID:         "urn:goscience:" + item.ID,
+		Title:      item.Title,
+		Updated:    item.Added.UTC(),
+		Published:  item.Added.UTC(),
+		Categories: []Category{},
+		Links: []Link{
+			{Rel: "alternate", Href: page, Type: "text/html"},
+			{Rel: "enclosure", Href: enclosure, Type: "application/pdf", Length: item.Size},
+		},
+	}
+	for _, author := range item.Authors {
+		e.Authors = append(e.Authors, Author{Name: author})
+	}
+	for _, tag := range item.Tags {
+		e.Categories = append(e.Categories, Category{Term: tag})
+	}
+	if len(item.Abstract) > 0 {
+		e.Summary = &Text{Type: "text", Body: item.Abstract}
+	}
+	f.Entries = append(f.Entries, e)
+}
+
+// Write writes feed as xml document
+func (f *Feed) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(f)
+}
@@ -0,0 +1,56 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greatdanton/goScience/library"
+)
+
+func Test_Feed(t *testing.T) {
+	added := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := New("urn:goscience:ana:feed", "GoScience: ana", "https://gs.example.org/feed", "https://gs.example.org/library", added)
+	f.Add(library.Item{
+		ID:       "4d718a0a89634e64",
+		Title:    "Why Google stores billions of lines of code <in a single repository>",
+		Authors:  []string{"Rachel Potvin", "Josh Levenberg"},
+		Tags:     []string{"engineering"},
+		Abstract: "Early Google employees & a shared codebase",
+		Size:     2048,
+		Added:    added,
+	}, "https://gs.example.org/library/article?id=4d718a0a89634e64", "https://gs.example.org/feed/file/4d718a0a89634e64/Potvin.pdf")
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, str := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<link rel="self" href="https://gs.example.org/feed" type="application/atom+xml"></link>`,
+		`<id>urn:goscience:4d718a0a89634e64</id>`,
+		`<title>Why Google stores billions of lines of code &lt;in a single repository&gt;</title>`,
+		`<published>2020-05-01T12:00:00Z</published>`,
+		`<name>Josh Levenberg</name>`,
+		`<category term="engineering"></category>`,
+		`<summary type="text">Early Google employees &amp; a shared codebase</summary>`,
+		`<link rel="alternate" href="https://gs.example.org/library/article?id=4d718a0a89634e64" type="text/html"></link>`,
+		`<link rel="enclosure" href="https://gs.example.org/feed/file/4d718a0a89634e64/Potvin.pdf" type="application/pdf" length="2048"></link>`,
+	} {
+		if !strings.Contains(out, str) {
+			t.Errorf("feed does not contain %v:\n%v", str, out)
+		}
+	}
+
+	parsed := struct {
+		Entries []struct {
+			Title string `xml:"title"`
+		} `xml:"entry"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil || len(parsed.Entries) != 1 {
+		t.Errorf("xml.Unmarshal() = %v, %+v", err, parsed)
+	}
+}
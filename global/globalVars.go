@@ -1,5 +1,23 @@
 package global
 
+import (
+	"net/http"
+
+	"github.com/greatdanton/goScience/batch"
+	"github.com/greatdanton/goScience/downloadlog"
+	"github.com/greatdanton/goScience/inbox"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/mail"
+	"github.com/greatdanton/goScience/retention"
+	"github.com/greatdanton/goScience/search"
+	"github.com/greatdanton/goScience/share"
+	"github.com/greatdanton/goScience/slack"
+	"github.com/greatdanton/goScience/team"
+	"github.com/greatdanton/goScience/tokens"
+	"github.com/greatdanton/goScience/watch"
+	"github.com/greatdanton/goScience/webhook"
+)
+
 // PASSWORD contains password read from the configuration json file
 // Password is used to prevent bots from wasting our bandwith
 var PASSWORD string
@@ -7,3 +25,61 @@ var PASSWORD string
 // ScihubURL contains url set in the main function, that is used
 // across whole application as an entry point for downloading content
 var ScihubURL string
+
+// ScihubMirrors are tried in order when ScihubURL is not available or
+// returns broken pdf
+var ScihubMirrors []string
+
+// HTTPClient is shared outbound http client used for fetching articles,
+// captchas and metadata. It is replaced in the main function with client
+// built from the configuration.
+var HTTPClient = http.DefaultClient
+
+// DownloadLog records every download attempt, nil when the log is disabled
+var DownloadLog *downloadlog.Log
+
+// Library stores articles saved by users, nil when the library is disabled
+var Library *library.Store
+
+// Search is full-text index of library articles, nil when the library is
+// disabled
+var Search *search.Index
+
+// Tokens stores api tokens, nil when the library is disabled
+var Tokens *tokens.Store
+
+// Batch fetches articles into the library in the background, nil when the
+// library is disabled
+var Batch *batch.Runner
+
+// Watch polls metadata service for new works of user watchlists, nil when
+// the library is disabled
+var Watch *watch.Scheduler
+
+// Mail sends articles and notifications to users, nil when mail is not
+// configured or the library is disabled
+var Mail *mail.Mailer
+
+// Webhooks posts events to webhook subscriptions of users, nil when the
+// library is disabled
+var Webhooks *webhook.Dispatcher
+
+// Inbox receives article requests by mail, nil when email requests are
+// not configured
+var Inbox *inbox.Inbox
+
+// Slack answers chat slash commands, nil when the signing secret is not
+// set or the library is disabled
+var Slack *slack.App
+
+// Shares keeps share links to library articles, nil when the library is
+// disabled
+var Shares *share.Store
+
+// Teams keeps teams sharing library articles, nil when the library is
+// disabled
+var Teams *team.Store
+
+// Erased keeps users whose accounts were deleted, nil when the library is
+// disabled
+var Erased *retention.Store
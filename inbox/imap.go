@@ -0,0 +1,181 @@
+package inbox
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapTimeout limits single IMAP session
+const imapTimeout = 2 * time.Minute
+
+// imapConn is minimal IMAP4rev1 client, only commands needed for reading
+// unseen messages are supported
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is untagged response line with literals it contained
+type imapResponse struct {
+	Line     string
+	Literals [][]byte
+}
+
+func dialIMAP(config IMAPConfig) (*imapConn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if config.TLS {
+		host, _, _ := net.SplitHostPort(config.Address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", config.Address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", config.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.Line, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP server refused connection: %v", greeting.Line)
+	}
+	return c, nil
+}
+
+// readResponse reads response line, literals {n} are read together with
+// the rest of the line
+func (c *imapConn) readResponse() (imapResponse, error) {
+	resp := imapResponse{}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		resp.Line += line
+		if !strings.HasSuffix(line, "}") || strings.LastIndex(line, "{") < 0 {
+			return resp, nil
+		}
+		size, err := strconv.Atoi(line[strings.LastIndex(line, "{")+1 : len(line)-1])
+		if err != nil {
+			return resp, nil
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.Literals = append(resp.Literals, literal)
+	}
+}
+
+// command sends command and returns untagged responses, error is returned
+// when the command did not complete with OK
+func (c *imapConn) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%03d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, tag+" "+format+"\r\n", args...); err != nil {
+		return nil, err
+	}
+	responses := []imapResponse{}
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(resp.Line, tag+" ") {
+			status := strings.TrimPrefix(resp.Line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("IMAP command failed: %v", status)
+			}
+			return responses, nil
+		}
+		responses = append(responses, resp)
+	}
+}
+
+// quote returns IMAP quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", "").Replace(s) + `"`
+}
+
+// Poll reads unseen messages from the mailbox and delivers them. Messages
+// are marked as seen when they were handled, rejected messages included,
+// so they are not read again.
+func (in *Inbox) Poll() error {
+	config := in.Config.IMAP
+	c, err := dialIMAP(config)
+	if err != nil {
+		return fmt.Errorf("Could not connect to IMAP server: %v", err)
+	}
+	defer c.conn.Close()
+	if _, err := c.command("LOGIN %v %v", quote(config.Username), quote(config.Password)); err != nil {
+		return err
+	}
+	defer c.command("LOGOUT")
+	if _, err := c.command("SELECT %v", quote(config.Mailbox)); err != nil {
+		return err
+	}
+
+	responses, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+	uids := []string{}
+	for _, resp := range responses {
+		if strings.HasPrefix(resp.Line, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(resp.Line, "* SEARCH"))...)
+		}
+	}
+
+	for _, uid := range uids {
+		if _, err := strconv.Atoi(uid); err != nil {
+			continue
+		}
+		responses, err := c.command("UID FETCH %v BODY.PEEK[]", uid)
+		if err != nil {
+			return err
+		}
+		var raw []byte
+		for _, resp := range responses {
+			if len(resp.Literals) > 0 {
+				raw = resp.Literals[0]
+			}
+		}
+		req, err := in.Deliver(raw)
+		if err == ErrQueueFull {
+			// message stays unseen and is read again by the next poll
+			fmt.Println(err)
+			return nil
+		}
+		if err != nil {
+			fmt.Printf("Ignoring mail request from %v: %v\n", req.From, err)
+		}
+		if _, err := c.command(`UID STORE %v +FLAGS (\Seen)`, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunIMAP polls the mailbox in configured interval, it never returns
+func (in *Inbox) RunIMAP() {
+	for {
+		if err := in.Poll(); err != nil {
+			fmt.Println(err)
+		}
+		time.Sleep(time.Duration(in.Config.IMAP.Interval) * time.Minute)
+	}
+}
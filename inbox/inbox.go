@@ -0,0 +1,326 @@
+package inbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/doi"
+)
+
+// maxIdentifiers limits number of articles requested by single message
+const maxIdentifiers = 10
+
+// queueSize is number of requests waiting for the worker
+const queueSize = 100
+
+// Config is email-in section of the configuration
+type Config struct {
+	Allow  []string // sender addresses or "@domain" allowed to send requests
+	User   string   // user the articles are fetched for, defaults to the shared password user
+	Save   bool     // save fetched articles to the library of the user
+	Listen string   // address of local SMTP/LMTP listener, ex. "127.0.0.1:2525", port alone listens on loopback
+	// authserv-id of mail servers whose Authentication-Results headers are
+	// trusted, the servers must remove headers with their id from incoming mail
+	TrustedRelays []string
+	IMAP          IMAPConfig
+}
+
+// IMAPConfig is mailbox polled for requests
+type IMAPConfig struct {
+	Address  string // ex. "imap.example.org:993"
+	TLS      bool   // connect with tls, plain connections send password in clear text
+	Username string
+	Password string
+	Mailbox  string // defaults to INBOX
+	Interval int    // minutes between polls, defaults to 5
+}
+
+// Request is article request received by mail
+type Request struct {
+	From        string // sender address
+	Envelope    string // envelope sender, MAIL FROM of the listener or Return-Path of the mailbox
+	Subject     string
+	MessageID   string
+	Identifiers []string // dois found in the subject and the body
+	Truncated   bool     // message contained more than maxIdentifiers
+	Received    time.Time
+	authResults []string // Authentication-Results headers of the message
+}
+
+var (
+	// ErrNotAllowed is returned for messages from senders not on the allow list
+	ErrNotAllowed = errors.New("Sender is not allowed to request articles")
+	// ErrNotVerified is returned for messages whose From does not match the
+	// envelope sender and was not authenticated by a trusted relay
+	ErrNotVerified = errors.New("Sender could not be verified")
+	// ErrAutomatic is returned for auto replies and mailing list messages,
+	// answering them could start mail loops
+	ErrAutomatic = errors.New("Message was sent automatically")
+	// ErrQueueFull is returned when too many requests are waiting
+	ErrQueueFull = errors.New("Too many requests are waiting")
+)
+
+// Inbox checks incoming messages and passes requests to the handler one
+// at a time
+type Inbox struct {
+	Config Config
+	handle func(Request)
+	queue  chan Request
+}
+
+// New creates inbox passing requests to handle
+func New(config Config, handle func(Request)) *Inbox {
+	if len(config.IMAP.Mailbox) == 0 {
+		config.IMAP.Mailbox = "INBOX"
+	}
+	if config.IMAP.Interval <= 0 {
+		config.IMAP.Interval = 5
+	}
+	return &Inbox{Config: config, handle: handle, queue: make(chan Request, queueSize)}
+}
+
+// Run passes queued requests to the handler, it never returns
+func (in *Inbox) Run() {
+	for req := range in.queue {
+		in.handle(req)
+	}
+}
+
+// Deliver parses raw message read from the mailbox and queues request of
+// allowed sender, envelope sender is taken from Return-Path
+func (in *Inbox) Deliver(raw []byte) (Request, error) {
+	req, err := Parse(raw)
+	if err != nil {
+		return req, err
+	}
+	return req, in.enqueue(req)
+}
+
+// enqueue queues request of verified and allowed sender
+func (in *Inbox) enqueue(req Request) error {
+	if !Verified(req, in.Config.TrustedRelays) {
+		return ErrNotVerified
+	}
+	if !Allowed(in.Config.Allow, req.From) {
+		return ErrNotAllowed
+	}
+	select {
+	case in.queue <- req:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Verified reports whether sender in the From header could be trusted. It
+// has to match the envelope sender, or DKIM or SPF of its domain has to
+// pass according to Authentication-Results added by a trusted relay.
+func Verified(req Request, trusted []string) bool {
+	from := strings.ToLower(req.From)
+	if len(from) > 0 && from == strings.ToLower(req.Envelope) {
+		return true
+	}
+	domain := from[strings.LastIndex(from, "@")+1:]
+	for _, header := range req.authResults {
+		if authenticated(header, trusted, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// comments are removed from Authentication-Results before reading it
+var comments = regexp.MustCompile(`\([^)]*\)`)
+
+// authenticated reports whether Authentication-Results header was added
+// by trusted relay and contains dkim pass with signing domain or spf pass
+// with envelope domain equal to domain
+func authenticated(header string, trusted []string, domain string) bool {
+	results := strings.Split(strings.ToLower(comments.ReplaceAllString(header, " ")), ";")
+	id := strings.Fields(results[0])
+	if len(id) == 0 || !Allowed(trusted, id[0]) {
+		return false
+	}
+	for _, result := range results[1:] {
+		fields := strings.Fields(result)
+		if len(fields) == 0 {
+			continue
+		}
+		property := ""
+		switch fields[0] {
+		case "dkim=pass":
+			property = "header.d="
+		case "spf=pass":
+			property = "smtp.mailfrom="
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, property) {
+				value := strings.TrimPrefix(field, property)
+				if value[strings.LastIndex(value, "@")+1:] == domain {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// envelopeAddress returns address of Return-Path or MAIL FROM argument,
+// null sender <> is returned as empty address
+func envelopeAddress(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(fields[0], "<"), ">")
+}
+
+// Allowed reports whether address matches allow list entry, entries are
+// addresses or domains starting with "@"
+func Allowed(allow []string, address string) bool {
+	address = strings.ToLower(address)
+	for _, entry := range allow {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 0 {
+			continue
+		}
+		if address == entry || strings.HasPrefix(entry, "@") && strings.HasSuffix(address, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads sender and identifiers of the message. Identifiers are
+// searched in the subject and in the text parts, html is used when the
+// message has no text part.
+func Parse(raw []byte) (Request, error) {
+	req := Request{Received: time.Now()}
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return req, fmt.Errorf("Could not parse message: %v", err)
+	}
+	from, err := netmail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return req, fmt.Errorf("Could not parse sender: %v", err)
+	}
+	req.From = from.Address
+	req.Envelope = envelopeAddress(msg.Header.Get("Return-Path"))
+	req.authResults = msg.Header["Authentication-Results"]
+	req.MessageID = strings.TrimSpace(msg.Header.Get("Message-Id"))
+	req.Subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		req.Subject = msg.Header.Get("Subject")
+	}
+
+	auto := strings.ToLower(msg.Header.Get("Auto-Submitted"))
+	precedence := strings.ToLower(msg.Header.Get("Precedence"))
+	if auto != "" && auto != "no" || precedence == "bulk" || precedence == "list" || precedence == "junk" {
+		return req, ErrAutomatic
+	}
+
+	text, html := []string{}, []string{}
+	if err := readParts(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, &text, &html); err != nil {
+		return req, fmt.Errorf("Could not read message body: %v", err)
+	}
+	body := strings.Join(text, "\n")
+	if len(text) == 0 {
+		body = stripTags(strings.Join(html, "\n"))
+	}
+	req.Identifiers = doi.FindAll(req.Subject + "\n" + body)
+	if len(req.Identifiers) > maxIdentifiers {
+		req.Identifiers = req.Identifiers[:maxIdentifiers]
+		req.Truncated = true
+	}
+	return req, nil
+}
+
+// readParts collects decoded text and html parts of the message body,
+// attachments are skipped
+func readParts(contentType, encoding string, body io.Reader, text, html *[]string) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextRawPart keeps transfer encoding, so it is decoded the same
+			// way as single part messages
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+			if err := readParts(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, text, html); err != nil {
+				return err
+			}
+		}
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, newlineRemover{body})
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if mediaType == "text/html" {
+		*html = append(*html, string(data))
+	} else {
+		*text = append(*text, string(data))
+	}
+	return nil
+}
+
+var (
+	tags  = regexp.MustCompile(`<[^>]*>`)
+	hrefs = regexp.MustCompile(`(?i)href="([^"]*)"`)
+)
+
+// stripTags replaces html tags with spaces, link targets are kept as text
+func stripTags(html string) string {
+	html = hrefs.ReplaceAllString(html, "> $1 <")
+	return tags.ReplaceAllString(html, " ")
+}
+
+// newlineRemover drops line breaks of base64 encoded parts
+type newlineRemover struct {
+	r io.Reader
+}
+
+func (n newlineRemover) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	j := 0
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
@@ -0,0 +1,313 @@
+package inbox
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		raw         string
+		from        string
+		identifiers []string
+		err         error
+	}{
+		{
+			"From: Ana <ana@lab.org>\r\nSubject: 10.1000/xyz123\r\n\r\nThanks\r\n",
+			"ana@lab.org",
+			[]string{"10.1000/xyz123"},
+			nil,
+		},
+		{
+			"From: ana@lab.org\r\nSubject: articles\r\n\r\nPlease send https://doi.org/10.1000/a1 and\r\n(10.1000/b2), arXiv: 1706.03762\r\n",
+			"ana@lab.org",
+			[]string{"10.1000/a1", "10.1000/b2", "10.48550/arXiv.1706.03762"},
+			nil,
+		},
+		{
+			"From: ana@lab.org\r\nSubject: =?utf-8?q?=C4=8Dlanek?=\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n10.1000/=\r\nqp1\r\n" +
+				"--b\r\nContent-Type: text/html\r\n\r\n<p>10.1000/html</p>\r\n" +
+				"--b--\r\n",
+			"ana@lab.org",
+			[]string{"10.1000/qp1"},
+			nil,
+		},
+		{
+			"From: ana@lab.org\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/html\r\nContent-Transfer-Encoding: base64\r\n\r\nPGEgaHJlZj0iaHR0cHM6Ly9k\r\nb2kub3JnLzEwLjEwMDAvYjY0Ij5hcnRpY2xlPC9hPg==\r\n" +
+				"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=refs.txt\r\n\r\n10.1000/attached\r\n" +
+				"--b--\r\n",
+			"ana@lab.org",
+			[]string{"10.1000/b64"},
+			nil,
+		},
+		{
+			"From: mailer-daemon@lab.org\r\nAuto-Submitted: auto-replied\r\nSubject: Re: 10.1000/xyz123\r\n\r\n",
+			"mailer-daemon@lab.org",
+			nil,
+			ErrAutomatic,
+		},
+		{
+			"From: list@lab.org\r\nPrecedence: bulk\r\n\r\n10.1000/xyz123\r\n",
+			"list@lab.org",
+			nil,
+			ErrAutomatic,
+		},
+	}
+	for _, test := range tests {
+		req, err := Parse([]byte(test.raw))
+		if req.From != test.from || err != test.err || !reflect.DeepEqual(req.Identifiers, test.identifiers) {
+			t.Errorf("Parse(%q) = %v %v %v", test.raw, req.From, req.Identifiers, err)
+			t.Errorf("Output should be: %v %v %v", test.from, test.identifiers, test.err)
+		}
+	}
+
+	many := "From: ana@lab.org\r\n\r\n"
+	for i := 0; i < maxIdentifiers+5; i++ {
+		many += fmt.Sprintf("10.1000/%v\r\n", i)
+	}
+	if req, _ := Parse([]byte(many)); len(req.Identifiers) != maxIdentifiers || !req.Truncated {
+		t.Errorf("Parse() = %v identifiers, truncated: %v", len(req.Identifiers), req.Truncated)
+	}
+	if _, err := Parse([]byte("Subject: no sender\r\n\r\n")); err == nil {
+		t.Errorf("Parse() accepted message without sender")
+	}
+}
+
+func Test_Allowed(t *testing.T) {
+	allow := []string{"ana@lab.org", " @Uni.edu ", ""}
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"ana@lab.org", true},
+		{"Ana@Lab.org", true},
+		{"bob@lab.org", false},
+		{"bob@uni.edu", true},
+		{"bob@notuni.edu", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if allowed := Allowed(allow, test.address); allowed != test.allowed {
+			t.Errorf("Allowed(%v) = %v", test.address, allowed)
+			t.Errorf("Output should be: %v", test.allowed)
+		}
+	}
+}
+
+func Test_Verified(t *testing.T) {
+	trusted := []string{"mx.goscience.org"}
+	tests := []struct {
+		raw      string
+		verified bool
+	}{
+		{"Return-Path: <Ana@lab.org>\r\nFrom: ana@lab.org\r\n\r\n", true},
+		{"Return-Path: <eve@example.org>\r\nFrom: ana@lab.org\r\n\r\n", false},
+		{"Return-Path: <>\r\nFrom: ana@lab.org\r\n\r\n", false},
+		{"From: ana@lab.org\r\n\r\n", false},
+		{
+			"Return-Path: <bounces@list.org>\r\nAuthentication-Results: mx.goscience.org;\r\n dkim=pass (2048-bit key) header.d=lab.org header.s=s1;\r\n spf=fail smtp.mailfrom=list.org\r\nFrom: ana@lab.org\r\n\r\n",
+			true,
+		},
+		{
+			"Authentication-Results: MX.goscience.org 1; spf=pass smtp.mailfrom=ana@lab.org\r\nFrom: ana@lab.org\r\n\r\n",
+			true,
+		},
+		// signature of other domain
+		{"Authentication-Results: mx.goscience.org; dkim=pass header.d=example.org\r\nFrom: ana@lab.org\r\n\r\n", false},
+		{"Authentication-Results: mx.goscience.org; dkim=fail header.d=lab.org\r\nFrom: ana@lab.org\r\n\r\n", false},
+		// results of servers that are not trusted could be added by the sender
+		{"Authentication-Results: mx.example.org; dkim=pass header.d=lab.org\r\nFrom: ana@lab.org\r\n\r\n", false},
+	}
+	for _, test := range tests {
+		req, err := Parse([]byte(test.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verified := Verified(req, trusted); verified != test.verified {
+			t.Errorf("Verified(%q) = %v", test.raw, verified)
+			t.Errorf("Output should be: %v", test.verified)
+		}
+	}
+}
+
+func Test_listenAddress(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{":2525", "127.0.0.1:2525"},
+		{"0.0.0.0:2525", "0.0.0.0:2525"},
+		{"[::1]:2525", "[::1]:2525"},
+	}
+	for _, test := range tests {
+		if addr := listenAddress(test.addr); addr != test.expected {
+			t.Errorf("listenAddress(%v) = %v", test.addr, addr)
+			t.Errorf("Output should be: %v", test.expected)
+		}
+	}
+}
+
+// receive returns request handled by the inbox
+func receive(t *testing.T, handled chan Request) Request {
+	select {
+	case req := <-handled:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not handled")
+	}
+	return Request{}
+}
+
+func Test_Listen(t *testing.T) {
+	handled := make(chan Request, 10)
+	in := New(Config{Allow: []string{"@lab.org"}}, func(req Request) { handled <- req })
+	go in.Run()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go in.serve(ln)
+
+	msg := "From: ana@lab.org\r\nSubject: request\r\n\r\n.10.1000/dot\r\n"
+	if err := smtp.SendMail(ln.Addr().String(), nil, "ana@lab.org", []string{"articles@goscience.org"}, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	if req := receive(t, handled); !reflect.DeepEqual(req.Identifiers, []string{"10.1000/dot"}) {
+		t.Errorf("received request = %+v", req)
+	}
+
+	// not allowed senders are accepted, but not handled
+	msg = "From: eve@example.org\r\n\r\n10.1000/eve\r\n"
+	if err := smtp.SendMail(ln.Addr().String(), nil, "eve@example.org", []string{"articles@goscience.org"}, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-handled:
+		t.Errorf("handled request of not allowed sender: %+v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// allowed From with other envelope sender is forged, Return-Path in
+	// the message is ignored
+	msg = "Return-Path: <ana@lab.org>\r\nFrom: ana@lab.org\r\n\r\n10.1000/forged\r\n"
+	if err := smtp.SendMail(ln.Addr().String(), nil, "eve@example.org", []string{"articles@goscience.org"}, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-handled:
+		t.Errorf("handled request with forged sender: %+v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// LMTP replies once per recipient
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	commands := "LHLO client\r\nMAIL FROM:<ana@lab.org>\r\nRCPT TO:<a@goscience.org>\r\nRCPT TO:<b@goscience.org>\r\nDATA\r\n" +
+		"From: ana@lab.org\r\n\r\n10.1000/lmtp\r\n.\r\nQUIT\r\n"
+	conn.Write([]byte(commands))
+	replies := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		replies = append(replies, strings.TrimSpace(line))
+	}
+	expected := []string{"220", "250-goscience", "250", "250", "250", "250", "354", "250", "250", "221"}
+	if len(replies) != len(expected) {
+		t.Fatalf("LMTP replies = %v", replies)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(replies[i], expected[i]) {
+			t.Errorf("LMTP replies = %v", replies)
+			t.Errorf("Output should be: %v", expected)
+			break
+		}
+	}
+	receive(t, handled)
+}
+
+// fakeIMAP serves scripted IMAP session with two unseen messages
+func fakeIMAP(ln net.Listener, stored chan string) {
+	messages := map[string]string{
+		"7": "Return-Path: <ana@lab.org>\r\nFrom: ana@lab.org\r\nSubject: 10.1000/imap\r\n\r\n",
+		"9": "From: eve@example.org\r\nSubject: 10.1000/eve\r\n\r\n",
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "* OK IMAP4rev1 ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		tag, cmd := fields[0], strings.Join(fields[1:], " ")
+		switch {
+		case cmd == `LOGIN "ana" "p\"w"`:
+		case strings.HasPrefix(cmd, "LOGIN"):
+			fmt.Fprintf(conn, "%v NO invalid credentials\r\n", tag)
+			continue
+		case cmd == `SELECT "INBOX"`:
+			fmt.Fprintf(conn, "* 2 EXISTS\r\n")
+		case cmd == "UID SEARCH UNSEEN":
+			fmt.Fprintf(conn, "* SEARCH 7 9\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH"):
+			msg := messages[fields[3]]
+			fmt.Fprintf(conn, "* 1 FETCH (UID %v BODY[] {%v}\r\n%v)\r\n", fields[3], len(msg), msg)
+		case strings.HasPrefix(cmd, "UID STORE"):
+			stored <- fields[3]
+		case cmd == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%v OK\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%v OK done\r\n", tag)
+	}
+}
+
+func Test_Poll(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	stored := make(chan string, 10)
+	go fakeIMAP(ln, stored)
+
+	handled := make(chan Request, 10)
+	config := Config{Allow: []string{"ana@lab.org"}, IMAP: IMAPConfig{Address: ln.Addr().String(), Username: "ana", Password: `p"w`}}
+	in := New(config, func(req Request) { handled <- req })
+	go in.Run()
+	if err := in.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if req := receive(t, handled); !reflect.DeepEqual(req.Identifiers, []string{"10.1000/imap"}) {
+		t.Errorf("received request = %+v", req)
+	}
+	// rejected messages are marked as seen too
+	close(stored)
+	seen := []string{}
+	for uid := range stored {
+		seen = append(seen, uid)
+	}
+	if !reflect.DeepEqual(seen, []string{"7", "9"}) {
+		t.Errorf("seen messages = %v", seen)
+	}
+}
@@ -0,0 +1,172 @@
+package inbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxMessageSize limits size of received messages
+const maxMessageSize = 25 << 20
+
+// listenerTimeout closes idle connections
+const listenerTimeout = 5 * time.Minute
+
+// Listen accepts messages over SMTP or LMTP on addr, so local mail server
+// could deliver requests directly. Address without host listens on
+// loopback only. It never returns unless address could not be used.
+func (in *Inbox) Listen(addr string) error {
+	ln, err := net.Listen("tcp", listenAddress(addr))
+	if err != nil {
+		return err
+	}
+	return in.serve(ln)
+}
+
+// listenAddress binds address without host to loopback, anyone able to
+// connect to the listener could claim any envelope sender
+func listenAddress(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || len(host) > 0 {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+func (in *Inbox) serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go in.session(conn)
+	}
+}
+
+// session handles single SMTP or LMTP connection. LMTP server replies to
+// DATA once per recipient, otherwise the protocols are the same for
+// commands supported here.
+func (in *Inbox) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	lmtp, from, recipients := false, false, 0
+	sender := ""
+	reply("220 goscience ready")
+	for {
+		conn.SetDeadline(time.Now().Add(listenerTimeout))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "LHLO"):
+			lmtp = true
+			reply("250-goscience")
+			reply(fmt.Sprintf("250 SIZE %v", maxMessageSize))
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-goscience")
+			reply(fmt.Sprintf("250 SIZE %v", maxMessageSize))
+		case strings.HasPrefix(cmd, "HELO"):
+			reply("250 goscience")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			from, recipients = true, 0
+			sender = envelopeAddress(line[len("MAIL FROM:"):])
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if !from {
+				reply("503 MAIL first")
+				continue
+			}
+			recipients++
+			reply("250 ok")
+		case cmd == "DATA":
+			if recipients == 0 {
+				reply("503 RCPT first")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			raw, tooLarge, err := readData(r)
+			if err != nil {
+				return
+			}
+			status := "552 message is too large"
+			if !tooLarge {
+				status = in.deliverStatus(raw, sender)
+			}
+			replies := 1
+			if lmtp {
+				replies = recipients
+			}
+			for i := 0; i < replies; i++ {
+				reply(status)
+			}
+			from, recipients = false, 0
+		case cmd == "RSET":
+			from, recipients = false, 0
+			reply("250 ok")
+		case cmd == "NOOP":
+			reply("250 ok")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// deliverStatus delivers message received from sender and returns reply
+// for the server. Messages of not allowed senders are accepted and dropped,
+// rejecting them would send bounces to addresses that could be forged.
+func (in *Inbox) deliverStatus(raw []byte, sender string) string {
+	req, err := Parse(raw)
+	if err == nil {
+		// Return-Path of the message could be forged, MAIL FROM is used
+		req.Envelope = sender
+		err = in.enqueue(req)
+	}
+	switch err {
+	case nil:
+		return "250 ok"
+	case ErrQueueFull:
+		return "451 try again later"
+	case ErrNotAllowed, ErrNotVerified, ErrAutomatic:
+		fmt.Printf("Ignoring mail request from %v: %v\n", req.From, err)
+		return "250 ok"
+	}
+	fmt.Println(err)
+	return "554 message could not be parsed"
+}
+
+// readData reads message until line with single dot and removes dot
+// stuffing. Data over maxMessageSize is read and dropped.
+func readData(r *bufio.Reader) ([]byte, bool, error) {
+	var data bytes.Buffer
+	tooLarge := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, false, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return data.Bytes(), tooLarge, nil
+		}
+		if tooLarge {
+			continue
+		}
+		if data.Len()+len(line) > maxMessageSize {
+			tooLarge = true
+			data.Reset()
+			continue
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
@@ -0,0 +1,608 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+	"github.com/greatdanton/goScience/storage"
+)
+
+// ErrNotFound is returned when the article is not in the library
+var ErrNotFound = apperror.New(apperror.NotFound, "Article is not in the library")
+
+var (
+	usersBucket      = []byte("users")
+	articlesBucket   = []byte("articles")
+	userKey          = []byte("user") // name of the user in its bucket
+	encryptionBucket = []byte("encryption")
+)
+
+// Item is article saved in user library
+type Item struct {
+	ID          string
+	Doi         string
+	Title       string
+	Authors     []string
+	Journal     string
+	Year        int
+	Abstract    string
+	FileName    string
+	SHA256      string // checksum of stored pdf, file name is derived from it
+	Size        int
+	Tags        []string
+	Collections []string
+	Note        string
+	Added       time.Time
+	AddedBy     string `json:",omitempty"` // member who added article to team library
+	State       string `json:",omitempty"` // one of State* reading states
+	Queue       int    `json:",omitempty"` // position in reading queue, 0 when not queued
+}
+
+// Store keeps library items in embedded database and pdf files in file
+// storage. Files are content addressed, so the same article saved by
+// multiple users is stored only once. When keys are set, items and user
+// names are encrypted and buckets of users, items and files are named
+// with keyed hashes of their names, ids and checksums.
+type Store struct {
+	db    *bolt.DB
+	files storage.Storage
+	keys  *encrypt.Keyring
+
+	// fileMu makes checking whether a file exists and saving the item that
+	// references it atomic with checking that the file is unused and
+	// deleting it
+	fileMu sync.Mutex
+}
+
+// Open opens (or creates) library database, pdf files are kept in the
+// storage. Nil keys leave items unencrypted. Items stored before the keys
+// were set are encrypted and renamed when the library is opened, files
+// are moved by RenameFiles.
+func Open(dbPath string, files storage.Storage, keys *encrypt.Keyring) (*Store, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Could not open library database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(encryptionBucket); err != nil {
+			return err
+		}
+		users, err := tx.CreateBucketIfNotExists(usersBucket)
+		if err != nil {
+			return err
+		}
+		if keys != nil && !encrypt.BucketSealed(tx, string(usersBucket)) {
+			// names of users are kept in their buckets before the buckets
+			// are renamed
+			err := users.ForEach(func(k, v []byte) error {
+				if u := users.Bucket(k); u != nil && u.Get(userKey) == nil {
+					return u.Put(userKey, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return keys.SealBucket(tx, string(usersBucket), func(path string, key []byte) bool {
+			return path == string(usersBucket) || strings.HasSuffix(path, "/"+string(articlesBucket))
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, files: files, keys: keys}, nil
+}
+
+// Close closes library database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// DB returns underlying database, so other packages could keep their data
+// in the same file
+func (s *Store) DB() *bolt.DB {
+	return s.db
+}
+
+// ItemID returns library id of article with provided doi
+func ItemID(doi string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(doi))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Save stores pdf and article metadata in user library. When the article
+// is already saved, its metadata and file are replaced, while tags,
+// collections and note are kept. The replaced file is removed when no other
+// item references it.
+func (s *Store) Save(user string, item Item, pdf []byte) (Item, error) {
+	sum := sha256.Sum256(pdf)
+	item.SHA256 = hex.EncodeToString(sum[:])
+	item.Size = len(pdf)
+	if len(item.ID) == 0 {
+		if len(item.Doi) > 0 {
+			item.ID = ItemID(item.Doi)
+		} else {
+			item.ID = item.SHA256[:16]
+		}
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := s.writeFile(item.SHA256, pdf); err != nil {
+		return Item{}, err
+	}
+
+	replaced := ""
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, true)
+		if err != nil {
+			return err
+		}
+		if old, err := s.getItem(b, item.ID); err == nil {
+			if old.SHA256 != item.SHA256 {
+				replaced = old.SHA256
+			}
+			item.Tags = old.Tags
+			item.Collections = old.Collections
+			item.Note = old.Note
+			item.Added = old.Added
+			item.State, item.Queue = old.State, old.Queue
+		}
+		if item.Added.IsZero() {
+			item.Added = time.Now()
+		}
+		return s.putItem(b, item)
+	})
+	if err != nil || len(replaced) == 0 {
+		return item, err
+	}
+	// file of the previous version is removed when no other item uses it
+	used, err := s.fileUsed(replaced)
+	if err != nil || used {
+		return item, err
+	}
+	return item, s.deleteFile(replaced)
+}
+
+// Get returns item from user library
+func (s *Store) Get(user, id string) (Item, error) {
+	item := Item{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		item, err = s.getItem(b, id)
+		return err
+	})
+	return item, err
+}
+
+// Copy saves item from the library of one user to the library of another
+// user, the stored file is shared. Tags, collections and note stay with
+// the original, while an already copied item keeps its own.
+func (s *Store) Copy(from, to, id string) (Item, error) {
+	item := Item{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		src, err := s.userBucket(tx, from, false)
+		if err != nil {
+			return err
+		}
+		if item, err = s.getItem(src, id); err != nil {
+			return err
+		}
+		dst, err := s.userBucket(tx, to, true)
+		if err != nil {
+			return err
+		}
+		item.Tags, item.Collections, item.Note, item.AddedBy = nil, nil, "", ""
+		item.State, item.Queue = "", 0
+		item.Added = time.Now()
+		if old, err := s.getItem(dst, id); err == nil {
+			item.Tags, item.Collections, item.Note = old.Tags, old.Collections, old.Note
+			item.Added, item.AddedBy = old.Added, old.AddedBy
+			item.State, item.Queue = old.State, old.Queue
+		}
+		return s.putItem(dst, item)
+	})
+	return item, err
+}
+
+// Update replaces metadata of existing item, stored file and reading
+// state stay the same
+func (s *Store) Update(user string, item Item) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		old, err := s.getItem(b, item.ID)
+		if err != nil {
+			return err
+		}
+		item.SHA256, item.Size, item.Added = old.SHA256, old.Size, old.Added
+		item.State, item.Queue = old.State, old.Queue
+		item.Tags = normalize(item.Tags)
+		item.Collections = normalize(item.Collections)
+		return s.putItem(b, item)
+	})
+}
+
+// Delete removes item from user library. The file is removed when no other
+// item references it.
+func (s *Store) Delete(user, id string) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	item := Item{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		item, err = s.getItem(b, id)
+		if err != nil {
+			return err
+		}
+		key, err := s.itemKey(id)
+		if err != nil {
+			return err
+		}
+		return b.Delete(key)
+	})
+	if err != nil {
+		return err
+	}
+
+	used, err := s.fileUsed(item.SHA256)
+	if err != nil || used {
+		return err
+	}
+	return s.deleteFile(item.SHA256)
+}
+
+// DeleteUser removes the whole library of the user. Files are removed
+// when no other user references them.
+func (s *Store) DeleteUser(user string) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	files := map[string]bool{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		err = b.ForEach(func(k, v []byte) error {
+			item, err := s.decodeItem(b, k, v)
+			if err == nil {
+				files[item.SHA256] = true
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		key, err := s.keys.Name(user)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(usersBucket).DeleteBucket([]byte(key))
+	})
+	if err != nil {
+		return err
+	}
+
+	for sha := range files {
+		used, err := s.fileUsed(sha)
+		if err != nil {
+			return err
+		}
+		if used {
+			continue
+		}
+		if err := s.deleteFile(sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// File returns stored pdf of the item
+func (s *Store) File(item Item) ([]byte, error) {
+	key, err := s.fileKey(item.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.files.Get(key)
+	if err == storage.ErrNotFound && s.keys != nil {
+		// file was not renamed yet
+		data, err = s.files.Get(legacyFileKey(item.SHA256))
+	}
+	if err != nil {
+		return nil, apperror.Wrap(apperror.Internal, err, "Could not read library file")
+	}
+	return data, nil
+}
+
+// Users returns names of users that have anything stored in the library
+func (s *Store) Users() ([]string, error) {
+	users := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(usersBucket)
+		return b.ForEach(func(k, v []byte) error {
+			name := b.Bucket(k).Get(userKey)
+			if name == nil {
+				users = append(users, string(k))
+				return nil
+			}
+			name, err := s.keys.Open(name, userLabel(k)+"/"+string(userKey))
+			if err != nil {
+				return err
+			}
+			users = append(users, string(name))
+			return nil
+		})
+	})
+	return users, err
+}
+
+// fileUsed reports whether any item of any user references the file
+func (s *Store) fileUsed(sha string) (bool, error) {
+	files, err := s.checksums()
+	return files[sha], err
+}
+
+// checksums returns checksums of files referenced by items of all users
+func (s *Store) checksums() (map[string]bool, error) {
+	files := map[string]bool{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+		return users.ForEach(func(user, v []byte) error {
+			b := articles{users.Bucket(user).Bucket(articlesBucket), userLabel(user)}
+			return b.ForEach(func(k, v []byte) error {
+				if item, err := s.decodeItem(b, k, v); err == nil {
+					files[item.SHA256] = true
+				}
+				return nil
+			})
+		})
+	})
+	return files, err
+}
+
+// SealedKey returns id of the key all library files were sealed with,
+// empty when the files were never resealed
+func (s *Store) SealedKey() (string, error) {
+	id := ""
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id = string(tx.Bucket(encryptionBucket).Get([]byte("files")))
+		return nil
+	})
+	return id, err
+}
+
+// SetSealedKey records id of the key all library files are sealed with
+func (s *Store) SetSealedKey(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(encryptionBucket).Put([]byte("files"), []byte(id))
+	})
+}
+
+// fileKey returns storage key of file with the checksum, the name is a
+// keyed hash of the checksum when encryption is enabled, so the stored
+// files could not be matched with known articles
+func (s *Store) fileKey(sha string) (string, error) {
+	name, err := s.keys.Name(sha)
+	return name + ".pdf", err
+}
+
+// legacyFileKey returns storage key of file stored before encryption was
+// enabled
+func legacyFileKey(sha string) string {
+	return sha + ".pdf"
+}
+
+// writeFile stores the file, existing files are not rewritten since their
+// content is identified by the checksum
+func (s *Store) writeFile(sha string, data []byte) error {
+	key, err := s.fileKey(sha)
+	if err != nil {
+		return err
+	}
+	exists, err := s.files.Exists(key)
+	if err != nil || exists {
+		return err
+	}
+	return s.files.Put(key, data)
+}
+
+// deleteFile removes the file together with its copy stored before
+// encryption was enabled
+func (s *Store) deleteFile(sha string) error {
+	key, err := s.fileKey(sha)
+	if err != nil {
+		return err
+	}
+	if err := s.files.Delete(key); err != nil {
+		return err
+	}
+	if s.keys != nil {
+		return s.files.Delete(legacyFileKey(sha))
+	}
+	return nil
+}
+
+// RenameFiles moves files stored under their checksum before encryption
+// was enabled to their encrypted names, it returns number of moved files
+func (s *Store) RenameFiles() (int, error) {
+	if s.keys == nil {
+		return 0, nil
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	files, err := s.checksums()
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for sha := range files {
+		data, err := s.files.Get(legacyFileKey(sha))
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		key, err := s.fileKey(sha)
+		if err != nil {
+			return moved, err
+		}
+		if err := s.files.Put(key, data); err != nil {
+			return moved, err
+		}
+		if err := s.files.Delete(legacyFileKey(sha)); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// FileKeys returns storage keys of all files referenced by library items,
+// keys of files that were not renamed yet are included when encryption
+// is enabled
+func (s *Store) FileKeys() ([]string, error) {
+	files, err := s.checksums()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for sha := range files {
+		key, err := s.fileKey(sha)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		if s.keys != nil {
+			keys = append(keys, legacyFileKey(sha))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// articles is the articles bucket of one user, label is used for sealing
+// its items
+type articles struct {
+	*bolt.Bucket
+	label string
+}
+
+// userLabel returns label of the bucket of the user stored under the key
+func userLabel(key []byte) string {
+	return string(usersBucket) + "/" + string(key)
+}
+
+// userBucket returns articles bucket of the user
+func (s *Store) userBucket(tx *bolt.Tx, user string, create bool) (articles, error) {
+	if len(user) == 0 {
+		return articles{}, apperror.New(apperror.Internal, "library user is not set")
+	}
+	name, err := s.keys.Name(user)
+	if err != nil {
+		return articles{}, err
+	}
+	key := []byte(name)
+	users := tx.Bucket(usersBucket)
+	if !create {
+		u := users.Bucket(key)
+		if u == nil {
+			return articles{}, ErrNotFound
+		}
+		return articles{u.Bucket(articlesBucket), userLabel(key)}, nil
+	}
+
+	u, err := users.CreateBucketIfNotExists(key)
+	if err != nil {
+		return articles{}, err
+	}
+	if u.Get(userKey) == nil {
+		name, err := s.keys.Seal([]byte(user), userLabel(key)+"/"+string(userKey))
+		if err != nil {
+			return articles{}, err
+		}
+		if err := u.Put(userKey, name); err != nil {
+			return articles{}, err
+		}
+	}
+	b, err := u.CreateBucketIfNotExists(articlesBucket)
+	return articles{b, userLabel(key)}, err
+}
+
+// itemKey returns database key of the item with the id
+func (s *Store) itemKey(id string) ([]byte, error) {
+	key, err := s.keys.Name(id)
+	return []byte(key), err
+}
+
+func (s *Store) getItem(b articles, id string) (Item, error) {
+	key, err := s.itemKey(id)
+	if err != nil {
+		return Item{}, err
+	}
+	data := b.Get(key)
+	if data == nil {
+		return Item{}, ErrNotFound
+	}
+	return s.decodeItem(b, key, data)
+}
+
+// decodeItem decrypts and unmarshals item stored under the key
+func (s *Store) decodeItem(b articles, key, data []byte) (Item, error) {
+	item := Item{}
+	err := s.keys.Unmarshal(data, b.label+"/"+string(articlesBucket)+"/"+string(key), &item)
+	return item, err
+}
+
+func (s *Store) putItem(b articles, item Item) error {
+	key, err := s.itemKey(item.ID)
+	if err != nil {
+		return err
+	}
+	data, err := s.keys.Marshal(item, b.label+"/"+string(articlesBucket)+"/"+string(key))
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// normalize trims values, removes empty ones and duplicates and sorts
+// the rest
+func normalize(values []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 || seen[strings.ToLower(v)] {
+			continue
+		}
+		seen[strings.ToLower(v)] = true
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SplitList splits comma separated user input into values
+func SplitList(str string) []string {
+	return normalize(strings.Split(str, ","))
+}
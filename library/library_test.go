@@ -0,0 +1,431 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+	"github.com/greatdanton/goScience/storage"
+)
+
+// openTestStore opens library in temporary directory
+func openTestStore(t *testing.T) *Store {
+	dir := t.TempDir()
+	files, err := storage.NewLocal(filepath.Join(dir, "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(filepath.Join(dir, "library.db"), files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+var testItems = []Item{
+	{Doi: "10.1145/2854146", Title: "Why Google stores billions of lines of code", Authors: []string{"Rachel Potvin", "Josh Levenberg"}, Journal: "Communications of the ACM", Year: 2016},
+	{Doi: "10.1080/09500340.2010.500105", Title: "Quantum optics", Authors: []string{"Li Jiang"}, Journal: "Journal of Modern Optics", Year: 2010},
+	{Doi: "10.1103/PhysRevLett.116.061102", Title: "Observation of gravitational waves", Authors: []string{"B. P. Abbott"}, Journal: "Physical Review Letters", Year: 2016},
+}
+
+func Test_Store(t *testing.T) {
+	s := openTestStore(t)
+	for i, item := range testItems {
+		saved, err := s.Save("ana", item, []byte("%PDF-1.4 "+item.Doi))
+		if err != nil {
+			t.Fatalf("Save() returned error: %v", err)
+		}
+		saved.Tags = []string{"to-read", " gravity ", "to-read"}[:i+1]
+		saved.Collections = []string{"thesis"}
+		saved.Note = "note " + item.Doi
+		if err := s.Update("ana", saved); err != nil {
+			t.Fatalf("Update() returned error: %v", err)
+		}
+	}
+
+	// saving the same article again keeps user data
+	saved, err := s.Save("ana", testItems[0], []byte("%PDF-1.4 new version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Note != "note 10.1145/2854146" || saved.ID != ItemID("10.1145/2854146") {
+		t.Errorf("Save() = %+v, should keep the note", saved)
+	}
+	data, err := s.File(saved)
+	if err != nil || string(data) != "%PDF-1.4 new version" {
+		t.Errorf("File() = %s, %v", data, err)
+	}
+
+	google, optics, waves := testItems[0].Doi, testItems[1].Doi, testItems[2].Doi
+	tests := []struct {
+		query  Query
+		output []string // dois
+	}{
+		{Query{}, []string{google, optics, waves}},
+		{Query{Sort: SortYear, Desc: true}, []string{google, waves, optics}},
+		{Query{Sort: SortAuthor}, []string{waves, optics, google}},
+		{Query{Year: 2016, Sort: SortTitle}, []string{waves, google}},
+		{Query{Tag: "GRAVITY"}, []string{optics, waves}},
+		{Query{Author: "potvin"}, []string{google}},
+		{Query{Journal: "optics", Collection: "thesis"}, []string{optics}},
+		{Query{Collection: "missing"}, []string{}},
+	}
+	for _, test := range tests {
+		items, err := s.List("ana", test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dois := []string{}
+		for _, item := range items {
+			dois = append(dois, item.Doi)
+		}
+		if strings.Join(dois, " ") != strings.Join(test.output, " ") {
+			t.Errorf("List(%+v) = %v", test.query, dois)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+
+	// libraries are per user
+	if items, _ := s.List("bob", Query{}); len(items) != 0 {
+		t.Errorf("List(bob) = %v, should be empty", items)
+	}
+	if _, err := s.Get("bob", saved.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("Get(bob) = %v, should return not found", err)
+	}
+
+	tags, _ := s.Tags("ana")
+	if strings.Join(tags, ",") != "gravity,to-read" {
+		t.Errorf("Tags() = %v", tags)
+	}
+}
+
+func Test_Delete(t *testing.T) {
+	s := openTestStore(t)
+	pdf := []byte("%PDF-1.4 shared article")
+	ana, _ := s.Save("ana", testItems[0], pdf)
+	bob, _ := s.Save("bob", testItems[0], pdf)
+
+	// file is shared by both users and is removed together with the last item
+	if err := s.Delete("ana", ana.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.File(bob); err != nil {
+		t.Errorf("File() of other user should still exist: %v", err)
+	}
+	if err := s.Delete("bob", bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.File(bob); err == nil {
+		t.Errorf("File() should be removed with the last item")
+	}
+}
+
+func Test_Save_replaced(t *testing.T) {
+	s := openTestStore(t)
+	first, _ := s.Save("ana", testItems[0], []byte("%PDF-1.4 first version"))
+	s.Save("bob", testItems[1], []byte("%PDF-1.4 first version"))
+	second, err := s.Save("ana", testItems[0], []byte("%PDF-1.4 second version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.File(second); err != nil || string(data) != "%PDF-1.4 second version" {
+		t.Errorf("File() = %s, %v", data, err)
+	}
+	// previous file is kept while other item references it
+	if _, err := s.File(first); err != nil {
+		t.Errorf("File() of previous version used by bob: %v", err)
+	}
+
+	third, _ := s.Save("ana", testItems[0], []byte("%PDF-1.4 third version"))
+	if _, err := s.File(second); err == nil {
+		t.Errorf("File() of replaced version should be removed")
+	}
+	if _, err := s.File(third); err != nil {
+		t.Errorf("File() = %v", err)
+	}
+}
+
+// blockingStorage stops in Delete until release is closed
+type blockingStorage struct {
+	storage.Storage
+	deleting chan bool
+	release  chan bool
+}
+
+func (b *blockingStorage) Delete(key string) error {
+	b.deleting <- true
+	<-b.release
+	return b.Storage.Delete(key)
+}
+
+func Test_Delete_concurrentSave(t *testing.T) {
+	s := openTestStore(t)
+	files := &blockingStorage{Storage: s.files, deleting: make(chan bool), release: make(chan bool)}
+	s.files = files
+	pdf := []byte("%PDF-1.4 shared article")
+	ana, _ := s.Save("ana", testItems[0], pdf)
+
+	deleted := make(chan error)
+	go func() { deleted <- s.Delete("ana", ana.ID) }()
+	<-files.deleting
+
+	// the file is still stored, but it is about to be deleted, so saving
+	// the same article has to wait and write the file again
+	saved := make(chan error)
+	go func() {
+		_, err := s.Save("bob", testItems[0], pdf)
+		saved <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(files.release)
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-saved; err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := s.Get("bob", ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.File(bob); err != nil {
+		t.Errorf("File() saved during Delete() = %v", err)
+		t.Errorf("Output should be: %v", nil)
+	}
+}
+
+func Test_DeleteUser(t *testing.T) {
+	s := openTestStore(t)
+	shared := []byte("%PDF-1.4 shared article")
+	own := []byte("%PDF-1.4 own article")
+	ana, _ := s.Save("ana", testItems[0], shared)
+	anaOwn, _ := s.Save("ana", testItems[1], own)
+	bob, _ := s.Save("bob", testItems[0], shared)
+
+	if err := s.DeleteUser("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUser("ana"); err != ErrNotFound {
+		t.Errorf("DeleteUser() of missing user = %v", err)
+	}
+	if _, err := s.Get("ana", ana.ID); err != ErrNotFound {
+		t.Errorf("Get() after DeleteUser() = %v", err)
+	}
+	if users, _ := s.Users(); len(users) != 1 || users[0] != "bob" {
+		t.Errorf("Users() = %v, should be only bob", users)
+	}
+	if _, err := s.File(anaOwn); err == nil {
+		t.Errorf("File() only used by deleted user should be removed")
+	}
+	if _, err := s.File(bob); err != nil {
+		t.Errorf("File() of other user should still exist: %v", err)
+	}
+}
+
+func Test_Copy(t *testing.T) {
+	s := openTestStore(t)
+	saved, _ := s.Save("ana", testItems[0], []byte("%PDF-1.4 copied article"))
+	saved.Tags, saved.Note = []string{"private"}, "my note"
+	s.Update("ana", saved)
+
+	copied, err := s.Copy("ana", "team:lab", saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.SHA256 != saved.SHA256 || copied.Title != saved.Title || len(copied.Tags) > 0 || copied.Note != "" {
+		t.Errorf("Copy() = %+v, should copy metadata without personal data", copied)
+	}
+	copied.Collections, copied.AddedBy = []string{"reading"}, "ana"
+	s.Update("team:lab", copied)
+
+	// copying again keeps collections of the copy
+	again, _ := s.Copy("ana", "team:lab", saved.ID)
+	if len(again.Collections) != 1 || again.AddedBy != "ana" {
+		t.Errorf("Copy() = %+v, should keep collections of the copy", again)
+	}
+	if _, err := s.Copy("bob", "team:lab", saved.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("Copy() from empty library = %v", err)
+	}
+
+	// file stays while the copy references it
+	s.Delete("ana", saved.ID)
+	if data, err := s.File(again); err != nil || string(data) != "%PDF-1.4 copied article" {
+		t.Errorf("File() = %s, %v", data, err)
+	}
+}
+
+func Test_Queue(t *testing.T) {
+	s := openTestStore(t)
+	ids := []string{}
+	for _, item := range testItems {
+		saved, err := s.Save("ana", item, []byte("%PDF-1.4 "+item.Doi))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, saved.ID)
+	}
+	if _, err := s.SetState("ana", ids[0], "skimmed"); apperror.KindOf(err) != apperror.InvalidInput {
+		t.Errorf("SetState() accepted unknown state: %v", err)
+	}
+
+	queue := func() string {
+		items, err := s.Queue("ana")
+		if err != nil {
+			t.Fatal(err)
+		}
+		order := []string{}
+		for _, item := range items {
+			order = append(order, item.ID)
+		}
+		return strings.Join(order, ",")
+	}
+	tests := []struct {
+		id       string
+		state    string
+		position int // moves the item when set
+		queue    []string
+	}{
+		{ids[0], StateToRead, 0, []string{ids[0]}},
+		{ids[1], StateToRead, 0, []string{ids[0], ids[1]}},
+		{ids[2], StateReading, 0, []string{ids[0], ids[1], ids[2]}},
+		{ids[2], "", 1, []string{ids[2], ids[0], ids[1]}},
+		{ids[0], StateReading, 0, []string{ids[2], ids[0], ids[1]}}, // keeps position
+		{ids[0], "", 9, []string{ids[2], ids[1], ids[0]}},
+		{ids[2], StateRead, 0, []string{ids[1], ids[0]}},
+		{ids[2], StateToRead, 0, []string{ids[1], ids[0], ids[2]}}, // back at the end
+		{ids[1], StateRead, 0, []string{ids[0], ids[2]}},
+	}
+	for _, test := range tests {
+		if len(test.state) > 0 {
+			if _, err := s.SetState("ana", test.id, test.state); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.position > 0 {
+			if err := s.MoveInQueue("ana", test.id, test.position); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if order := queue(); order != strings.Join(test.queue, ",") {
+			t.Errorf("Queue() after %v %v %v = %v", test.id, test.state, test.position, order)
+			t.Errorf("Output should be: %v", strings.Join(test.queue, ","))
+		}
+	}
+	if err := s.MoveInQueue("ana", ids[1], 1); apperror.KindOf(err) != apperror.InvalidInput {
+		t.Errorf("MoveInQueue() moved item that is not queued: %v", err)
+	}
+
+	// reading state is kept when metadata is changed or article saved again
+	item, _ := s.Get("ana", ids[0])
+	item.Note = "chapter 2"
+	s.Update("ana", Item{ID: item.ID, Title: item.Title, Note: item.Note})
+	s.Save("ana", testItems[0], []byte("%PDF-1.4 "+testItems[0].Doi))
+	if item, _ = s.Get("ana", ids[0]); item.State != StateReading || item.Queue == 0 {
+		t.Errorf("reading state was lost: %v %v", item.State, item.Queue)
+	}
+	read, _ := s.List("ana", Query{State: StateRead})
+	none, _ := s.List("ana", Query{State: StateNone})
+	if len(read) != 1 || read[0].ID != ids[1] || len(none) != 0 {
+		t.Errorf("List() by state = %v, %v", read, none)
+	}
+}
+
+func Test_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("cd", 32)), 0600)
+	keys, err := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := storage.NewLocal(filepath.Join(dir, "files"))
+
+	// item saved before encryption was enabled
+	s, _ := Open(filepath.Join(dir, "library.db"), files, nil)
+	old, _ := s.Save("ana", testItems[1], []byte("%PDF-1.4 old"))
+	s.Close()
+
+	s, err = Open(filepath.Join(dir, "library.db"), files, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	item, _ := s.Save("ana", testItems[0], []byte("%PDF-1.4 new"))
+	ana, _ := keys.Name("ana")
+	raw := func(id string) []byte {
+		var data []byte
+		key, _ := keys.Name(id)
+		s.DB().View(func(tx *bolt.Tx) error {
+			u := tx.Bucket(usersBucket).Bucket([]byte(ana))
+			if u != nil {
+				data = append(data, u.Bucket(articlesBucket).Get([]byte(key))...)
+			}
+			return nil
+		})
+		return data
+	}
+	for _, id := range []string{item.ID, old.ID} {
+		if data := raw(id); !encrypt.Sealed(data) || bytes.Contains(data, []byte("Google")) {
+			t.Errorf("item %v was stored unencrypted: %q", id, data)
+		}
+	}
+	s.DB().View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			if string(k) == "ana" {
+				t.Errorf("user bucket was not renamed")
+			}
+			return tx.Bucket(usersBucket).Bucket(k).Bucket(articlesBucket).ForEach(func(k, v []byte) error {
+				if string(k) == old.ID || string(k) == item.ID {
+					t.Errorf("item key %v was not renamed", string(k))
+				}
+				return nil
+			})
+		})
+	})
+	if users, err := s.Users(); len(users) != 1 || users[0] != "ana" || err != nil {
+		t.Errorf("Users() = %v, %v", users, err)
+	}
+	if got, err := s.Get("ana", old.ID); got.Title != testItems[1].Title || err != nil {
+		t.Errorf("Get() of item saved before encryption = %v, %v", got.Title, err)
+	}
+	if list, _ := s.List("ana", Query{Year: 2016}); len(list) != 1 || list[0].ID != item.ID {
+		t.Errorf("List() of encrypted items = %v", list)
+	}
+
+	// files are named with keyed hash of their checksum
+	if ok, _ := files.Exists(old.SHA256 + ".pdf"); !ok {
+		t.Fatalf("file saved before encryption is missing")
+	}
+	if ok, _ := files.Exists(item.SHA256 + ".pdf"); ok {
+		t.Errorf("file was stored under its checksum")
+	}
+	if data, err := s.File(old); string(data) != "%PDF-1.4 old" || err != nil {
+		t.Errorf("File() before renaming = %q, %v", data, err)
+	}
+	if moved, err := s.RenameFiles(); moved != 1 || err != nil {
+		t.Errorf("RenameFiles() = %v, %v", moved, err)
+		t.Errorf("Output should be: 1, <nil>")
+	}
+	if ok, _ := files.Exists(old.SHA256 + ".pdf"); ok {
+		t.Errorf("RenameFiles() kept the old file")
+	}
+	if data, err := s.File(old); string(data) != "%PDF-1.4 old" || err != nil {
+		t.Errorf("File() after renaming = %q, %v", data, err)
+	}
+	s.Close()
+
+	// encrypted library could not be opened without the key
+	if _, err := Open(filepath.Join(dir, "library.db"), files, nil); err == nil {
+		t.Errorf("Open() of encrypted library without key should fail")
+	}
+}
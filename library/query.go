@@ -0,0 +1,166 @@
+package library
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Sort orders supported by List
+const (
+	SortAdded   = "added"
+	SortTitle   = "title"
+	SortYear    = "year"
+	SortJournal = "journal"
+	SortAuthor  = "author"
+)
+
+// Query filters and sorts library items. Empty fields do not filter.
+type Query struct {
+	Tag        string
+	Collection string
+	Author     string // case insensitive substring of any author
+	Journal    string // case insensitive substring of journal name
+	Year       int
+	State      string // reading state, StateNone matches items without state
+	Sort       string // one of Sort* constants, defaults to SortAdded
+	Desc       bool
+}
+
+// match reports whether item satisfies query filters
+func (q Query) match(item Item) bool {
+	if len(q.Tag) > 0 && !containsFold(item.Tags, q.Tag) {
+		return false
+	}
+	if len(q.Collection) > 0 && !containsFold(item.Collections, q.Collection) {
+		return false
+	}
+	if len(q.State) > 0 && item.State != q.State && (q.State != StateNone || len(item.State) > 0) {
+		return false
+	}
+	if q.Year > 0 && item.Year != q.Year {
+		return false
+	}
+	if len(q.Journal) > 0 && !strings.Contains(strings.ToLower(item.Journal), strings.ToLower(q.Journal)) {
+		return false
+	}
+	if len(q.Author) > 0 {
+		author := strings.ToLower(q.Author)
+		found := false
+		for _, a := range item.Authors {
+			if strings.Contains(strings.ToLower(a), author) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns user library items matching the query
+func (s *Store) List(user string, q Query) ([]Item, error) {
+	items, err := s.all(user)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Item{}
+	for _, item := range items {
+		if q.match(item) {
+			list = append(list, item)
+		}
+	}
+
+	// items with equal sort keys stay ordered by the time they were added
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Added.Before(list[j].Added) })
+	less := func(a, b Item) bool { return a.Added.Before(b.Added) }
+	switch q.Sort {
+	case SortTitle:
+		less = func(a, b Item) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case SortYear:
+		less = func(a, b Item) bool { return a.Year < b.Year }
+	case SortJournal:
+		less = func(a, b Item) bool { return strings.ToLower(a.Journal) < strings.ToLower(b.Journal) }
+	case SortAuthor:
+		less = func(a, b Item) bool { return strings.ToLower(firstAuthor(a)) < strings.ToLower(firstAuthor(b)) }
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if q.Desc {
+			return less(list[j], list[i])
+		}
+		return less(list[i], list[j])
+	})
+	return list, nil
+}
+
+// Collections returns sorted names of all collections in user library
+func (s *Store) Collections(user string) ([]string, error) {
+	items, err := s.all(user)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Collections...)
+	}
+	return normalize(names), nil
+}
+
+// Tags returns sorted names of all tags in user library
+func (s *Store) Tags(user string) ([]string, error) {
+	items, err := s.all(user)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, item := range items {
+		tags = append(tags, item.Tags...)
+	}
+	return normalize(tags), nil
+}
+
+// all returns all items of the user, users without library have no items
+func (s *Store) all(user string) ([]Item, error) {
+	items := []Item{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			item, err := s.decodeItem(b, k, v)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return items, nil
+	}
+	return items, err
+}
+
+func firstAuthor(item Item) string {
+	if len(item.Authors) == 0 {
+		return ""
+	}
+	// sort by family name, which is the last word of the author name
+	fields := strings.Fields(item.Authors[0])
+	return fields[len(fields)-1]
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
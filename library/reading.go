@@ -0,0 +1,147 @@
+package library
+
+import (
+	"errors"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// Reading states of library items. Items to read and items being read are
+// kept in the reading queue.
+const (
+	StateToRead  = "to-read"
+	StateReading = "reading"
+	StateRead    = "read"
+	// StateNone is used in queries for items without reading state
+	StateNone = "none"
+)
+
+// States lists reading states in the order they are displayed
+var States = []string{StateToRead, StateReading, StateRead}
+
+// queued reports whether items in the state belong to the reading queue
+func queued(state string) bool {
+	return state == StateToRead || state == StateReading
+}
+
+// SetState changes reading state of the item, empty state clears it.
+// Items entering the reading queue are put at its end, finished items
+// leave it.
+func (s *Store) SetState(user, id, state string) (Item, error) {
+	if state != "" && state != StateToRead && state != StateReading && state != StateRead {
+		return Item{}, apperror.New(apperror.InvalidInput, "Unknown reading state: "+state)
+	}
+	item := Item{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		if item, err = s.getItem(b, id); err != nil {
+			return err
+		}
+		item.State = state
+		if !queued(state) {
+			item.Queue = 0
+		} else if item.Queue == 0 {
+			queue, err := s.queueItems(b)
+			if err != nil {
+				return err
+			}
+			item.Queue = 1
+			if len(queue) > 0 {
+				item.Queue = queue[len(queue)-1].Queue + 1
+			}
+		}
+		return s.putItem(b, item)
+	})
+	return item, err
+}
+
+// Queue returns items of the reading queue in reading order
+func (s *Store) Queue(user string) ([]Item, error) {
+	queue := []Item{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		queue, err = s.queueItems(b)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return []Item{}, nil
+	}
+	return queue, err
+}
+
+// MoveInQueue moves queued item to the position (starting with 1) and
+// renumbers the queue, positions out of range move the item to the start
+// or the end
+func (s *Store) MoveInQueue(user, id string, position int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.userBucket(tx, user, false)
+		if err != nil {
+			return err
+		}
+		queue, err := s.queueItems(b)
+		if err != nil {
+			return err
+		}
+		from := -1
+		for i, item := range queue {
+			if item.ID == id {
+				from = i
+			}
+		}
+		if from < 0 {
+			return apperror.New(apperror.InvalidInput, "Article is not in the reading queue")
+		}
+		item := queue[from]
+		queue = append(queue[:from], queue[from+1:]...)
+		to := position - 1
+		if to < 0 {
+			to = 0
+		}
+		if to > len(queue) {
+			to = len(queue)
+		}
+		queue = append(queue[:to], append([]Item{item}, queue[to:]...)...)
+		for i, item := range queue {
+			if item.Queue == i+1 {
+				continue
+			}
+			item.Queue = i + 1
+			if err := s.putItem(b, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// queueItems returns queued items of the bucket sorted by position, items
+// with equal positions stay ordered by the time they were added
+func (s *Store) queueItems(b articles) ([]Item, error) {
+	queue := []Item{}
+	err := b.ForEach(func(k, v []byte) error {
+		item, err := s.decodeItem(b, k, v)
+		if err != nil {
+			return err
+		}
+		if item.Queue > 0 {
+			queue = append(queue, item)
+		}
+		return nil
+	})
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Queue == queue[j].Queue {
+			return queue[i].Added.Before(queue[j].Added)
+		}
+		return queue[i].Queue < queue[j].Queue
+	})
+	return queue, err
+}
@@ -0,0 +1,211 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// Config is mail section of the configuration
+type Config struct {
+	Host          string
+	Port          int  // defaults to 587
+	StartTLS      bool // upgrade connection with STARTTLS, required by most providers
+	Username      string
+	Password      string
+	From          string // sender address, ex. "GoScience <goscience@example.org>"
+	MaxAttachment int    // MB, larger articles are sent as links, defaults to 10
+	BaseURL       string // public url of GoScience used in mailed links
+}
+
+// Attachment is file attached to the message
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is plain text mail
+type Message struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+	Headers     map[string]string // additional headers, ex. In-Reply-To
+}
+
+// Mailer sends mails over SMTP
+type Mailer struct {
+	Config Config
+	Store  *Store
+}
+
+// NewMailer creates mailer from the configuration, store keeps mail
+// settings of users
+func NewMailer(config Config, store *Store) *Mailer {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.MaxAttachment <= 0 {
+		config.MaxAttachment = 10
+	}
+	return &Mailer{Config: config, Store: store}
+}
+
+// MaxAttachment returns size of the largest attachment in bytes
+func (m *Mailer) MaxAttachment() int {
+	return m.Config.MaxAttachment << 20
+}
+
+// Send delivers the message. Authentication is used when user name is
+// set, net/smtp refuses to send password over unencrypted connection to
+// other hosts than localhost.
+func (m *Mailer) Send(msg Message) error {
+	if _, err := netmail.ParseAddress(msg.To); err != nil || strings.ContainsAny(msg.To, "\r\n") {
+		return apperror.New(apperror.InvalidInput, "Invalid email address: "+msg.To)
+	}
+	data, err := compose(m.Config.From, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.Config.Host, strconv.Itoa(m.Config.Port))
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Mail server is not available")
+	}
+	defer c.Close()
+	if m.Config.StartTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: m.Config.Host}); err != nil {
+			return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not start tls")
+		}
+	}
+	if len(m.Config.Username) > 0 {
+		auth := smtp.PlainAuth("", m.Config.Username, m.Config.Password, m.Config.Host)
+		if err := c.Auth(auth); err != nil {
+			return apperror.Wrap(apperror.UpstreamUnavailable, err, "Mail server authentication failed")
+		}
+	}
+
+	from, err := netmail.ParseAddress(m.Config.From)
+	if err != nil {
+		return fmt.Errorf("Invalid sender address: %v", err)
+	}
+	to, _ := netmail.ParseAddress(msg.To)
+	if err := c.Mail(from.Address); err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Mail server rejected sender")
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Mail server rejected recipient")
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not send mail")
+	}
+	if _, err := wc.Write(data); err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not send mail")
+	}
+	if err := wc.Close(); err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not send mail")
+	}
+	return c.Quit()
+}
+
+// compose creates MIME message, messages with attachments are
+// multipart/mixed
+func compose(from string, msg Message) ([]byte, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	domain := "goscience"
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		domain = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%v: %v\r\n", key, value)
+	}
+	header("From", from)
+	header("To", msg.To)
+	// Q encoding also replaces line breaks, so titles can not inject headers
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(b)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	keys := []string{}
+	for key := range msg.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		header(textproto.CanonicalMIMEHeaderKey(key), strings.NewReplacer("\r", "", "\n", "").Replace(msg.Headers[key]))
+	}
+
+	if len(msg.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "base64")
+		buf.WriteString("\r\n")
+		writeBase64(&buf, []byte(msg.Body))
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, []byte(msg.Body))
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if len(contentType) == 0 {
+			contentType = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data in base64 lines of 76 characters
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
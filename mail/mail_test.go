@@ -0,0 +1,243 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// catcher is local SMTP server storing received mails, like the mail
+// catchers used in development
+type catcher struct {
+	ln    net.Listener
+	mails chan []byte
+}
+
+func newCatcher(t *testing.T) *catcher {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &catcher{ln: ln, mails: make(chan []byte, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go c.serve(conn)
+		}
+	}()
+	return c
+}
+
+func (c *catcher) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 catcher ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 catcher")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var data bytes.Buffer
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			c.mails <- data.Bytes()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (c *catcher) port() int {
+	return c.ln.Addr().(*net.TCPAddr).Port
+}
+
+func Test_Send(t *testing.T) {
+	c := newCatcher(t)
+	defer c.ln.Close()
+	m := NewMailer(Config{Host: "127.0.0.1", Port: c.port(), From: "GoScience <goscience@example.org>"}, nil)
+
+	pdf := []byte("%PDF-1.4 article")
+	err := m.Send(Message{
+		To:          "ana@example.org",
+		Subject:     "Article: Čebele\r\nBcc: eve@example.org",
+		Body:        "Requested article is attached.",
+		Attachments: []Attachment{{Name: "čebele.pdf", ContentType: "application/pdf", Data: pdf}},
+		Headers:     map[string]string{"in-reply-to": "<1@example.org>\r\nBcc: eve@example.org"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	select {
+	case data = <-c.mails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("catcher did not receive mail")
+	}
+	msg, err := netmail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Header["Bcc"]) > 0 {
+		t.Errorf("subject injected header: %v", msg.Header)
+	}
+	if msg.Header.Get("In-Reply-To") != "<1@example.org>Bcc: eve@example.org" {
+		t.Errorf("In-Reply-To = %q", msg.Header.Get("In-Reply-To"))
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Article: Čebele\r\nBcc: eve@example.org" {
+		t.Errorf("Subject = %q", subject)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %v", mediaType)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	expected := []struct {
+		name string
+		data string
+	}{
+		{"", "Requested article is attached."},
+		{"čebele.pdf", string(pdf)},
+	}
+	for _, e := range expected {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, _ := ioutil.ReadAll(part)
+		decoded, _ := base64.StdEncoding.DecodeString(strings.Replace(string(encoded), "\r\n", "", -1))
+		if part.FileName() != e.name || string(decoded) != e.data {
+			t.Errorf("part = %v %q", part.FileName(), decoded)
+			t.Errorf("Output should be: %v %q", e.name, e.data)
+		}
+	}
+
+	if err := m.Send(Message{To: "not an address"}); err == nil {
+		t.Errorf("Send() accepted invalid address")
+	}
+}
+
+func Test_Store(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings, _ := s.Get("ana"); settings.Email != "" {
+		t.Errorf("Get() = %v, user without settings", settings)
+	}
+	if err := s.Set("ana", Settings{Email: "not an address"}); err == nil {
+		t.Errorf("Set() accepted invalid address")
+	}
+	if err := s.Set("ana", Settings{Email: " Ana <ana@example.org> ", NotifyJobs: true}); err != nil {
+		t.Fatal(err)
+	}
+	if settings, _ := s.Get("ana"); settings != (Settings{Email: "ana@example.org", NotifyJobs: true}) {
+		t.Errorf("Get() = %v", settings)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	sig := s.Sign("ana", "item", expires)
+	tests := []struct {
+		user    string
+		id      string
+		expires int64
+		valid   bool
+	}{
+		{"ana", "item", expires.Unix(), true},
+		{"bob", "item", expires.Unix(), false},
+		{"ana", "other", expires.Unix(), false},
+		{"ana", "item", expires.Unix() + 1, false},
+	}
+	for _, test := range tests {
+		if valid := s.Verify(test.user, test.id, test.expires, sig); valid != test.valid {
+			t.Errorf("Verify(%v, %v, %v) = %v", test.user, test.id, test.expires, valid)
+			t.Errorf("Output should be: %v", test.valid)
+		}
+	}
+	expired := time.Now().Add(-time.Minute)
+	if s.Verify("ana", "item", expired.Unix(), s.Sign("ana", "item", expired)) {
+		t.Errorf("Verify() accepted expired link")
+	}
+
+	// signing key survives restart
+	reopened, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Verify("ana", "item", expires.Unix(), sig) {
+		t.Errorf("signature is not valid after reopening the store")
+	}
+
+	// settings are encrypted and stored under hashed user names
+	keyFile := filepath.Join(dir, "key")
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600)
+	keys, _ := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	encrypted, err := Open(db, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !encrypted.Verify("ana", "item", expires.Unix(), sig) {
+		t.Errorf("signature is not valid after encryption was enabled")
+	}
+	if settings, _ := encrypted.Get("ana"); settings.Email != "ana@example.org" {
+		t.Errorf("Get() of encrypted settings = %v", settings)
+	}
+	ana, _ := keys.Name("ana")
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(mailBucket)
+		data := b.Bucket(usersBucket).Get([]byte(ana))
+		if b.Bucket(usersBucket).Get([]byte("ana")) != nil || !encrypt.Sealed(data) || !encrypt.Sealed(b.Get(secretKey)) {
+			t.Errorf("mail bucket was not encrypted")
+		}
+		return nil
+	})
+}
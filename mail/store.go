@@ -0,0 +1,153 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+var (
+	mailBucket  = []byte("mail")
+	usersBucket = []byte("users")
+	secretKey   = []byte("secret")
+)
+
+// Settings are mail settings of the user
+type Settings struct {
+	Email       string
+	NotifyJobs  bool // mail when batch fetch finishes
+	NotifyWatch bool // mail when watches find new works
+}
+
+// Store keeps mail settings of users and the key signing mailed links.
+// When keys are set, both are encrypted and settings are stored under
+// keyed hashes of user names.
+type Store struct {
+	db     *bolt.DB
+	keys   *encrypt.Keyring
+	secret []byte
+}
+
+// Open creates mail bucket in the database, signing key is generated
+// on the first start. Nil keys leave settings unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	s := &Store{db: db, keys: keys}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(mailBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := b.CreateBucketIfNotExists(usersBucket); err != nil {
+			return err
+		}
+		err = keys.SealBucket(tx, string(mailBucket), func(path string, key []byte) bool {
+			return path == label(usersBucket)
+		})
+		if err != nil {
+			return err
+		}
+		if secret := b.Get(secretKey); secret != nil {
+			s.secret, err = keys.Open(append([]byte{}, secret...), label(secretKey))
+			return err
+		}
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return err
+		}
+		sealed, err := keys.Seal(s.secret, label(secretKey))
+		if err != nil {
+			return err
+		}
+		return b.Put(secretKey, sealed)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create mail bucket: %v", err)
+	}
+	return s, nil
+}
+
+// Get returns mail settings of the user, users without settings get
+// empty settings
+func (s *Store) Get(user string) (Settings, error) {
+	settings := Settings{}
+	key, err := s.keys.Name(user)
+	if err != nil {
+		return settings, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(mailBucket).Bucket(usersBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		return s.keys.Unmarshal(data, label(usersBucket, key), &settings)
+	})
+	return settings, err
+}
+
+// Set stores mail settings of the user, empty address disables mails
+func (s *Store) Set(user string, settings Settings) error {
+	settings.Email = strings.TrimSpace(settings.Email)
+	if len(settings.Email) > 0 {
+		addr, err := netmail.ParseAddress(settings.Email)
+		if err != nil {
+			return apperror.Wrap(apperror.InvalidInput, err, "Invalid email address: "+settings.Email)
+		}
+		settings.Email = addr.Address
+	}
+	key, err := s.keys.Name(user)
+	if err != nil {
+		return err
+	}
+	data, err := s.keys.Marshal(settings, label(usersBucket, key))
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(mailBucket).Bucket(usersBucket).Put([]byte(key), data)
+	})
+}
+
+// Delete removes mail settings of the user
+func (s *Store) Delete(user string) error {
+	key, err := s.keys.Name(user)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(mailBucket).Bucket(usersBucket).Delete([]byte(key))
+	})
+}
+
+// label returns path of the value in the mail bucket, values are sealed
+// with it, ex. "mail/users/<user>"
+func label(name []byte, path ...string) string {
+	return strings.Join(append([]string{string(mailBucket), string(name)}, path...), "/")
+}
+
+// Sign returns signature of link to article of the user valid until
+// expires
+func (s *Store) Sign(user, id string, expires time.Time) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%v\n%v\n%v", user, id, expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature matches the link and the link did
+// not expire
+func (s *Store) Verify(user, id string, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	expected := s.Sign(user, id, time.Unix(expires, 0))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -6,18 +6,63 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/batch"
+	"github.com/greatdanton/goScience/client"
 	"github.com/greatdanton/goScience/controller"
+	"github.com/greatdanton/goScience/dav"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/downloadlog"
+	"github.com/greatdanton/goScience/encrypt"
 	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/inbox"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/mail"
+	"github.com/greatdanton/goScience/metadata"
+	"github.com/greatdanton/goScience/parse"
+	"github.com/greatdanton/goScience/retention"
+	"github.com/greatdanton/goScience/scan"
+	"github.com/greatdanton/goScience/search"
+	"github.com/greatdanton/goScience/share"
+	"github.com/greatdanton/goScience/slack"
+	"github.com/greatdanton/goScience/storage"
+	"github.com/greatdanton/goScience/team"
+	"github.com/greatdanton/goScience/tokens"
+	"github.com/greatdanton/goScience/watch"
+	"github.com/greatdanton/goScience/webhook"
 )
 
 // Configuration struct created for reading config from file
 type Configuration struct {
-	Port      string
-	Password  string
-	ScihubURL string
+	Port          string
+	Password      string
+	Users         []auth.User
+	ScihubURL     string
+	ScihubMirrors []string
+	RulesFile     string
+	HTTPClient    client.Config
+	Validation    parse.ValidationConfig
+	Sanitize      bool
+	EmbedMetadata bool
+	Scan          scan.Config
+	DownloadLog   string
+	DataDir       string // library database and files, library is disabled when empty
+	Storage       storage.Config
+	Encryption    encrypt.Config // library and download log are encrypted when a key is set
+	MetadataURL   string
+	CitationsURL  string // "off" disables looking up citing works
+	WebDAV        dav.Config
+	DOIPatterns   []doi.Pattern // publisher url patterns tried before the built-in ones
+	Watch         watch.Config
+	Mail          mail.Config // mail is disabled when host is empty
+	Inbox         inbox.Config
+	Slack         slack.Config // slash commands are disabled when signing secret is empty
+	Retention     retention.Config
 }
 
 // main function
@@ -27,14 +72,284 @@ func main() {
 		fmt.Println(err)
 		return
 	}
+	// outbound client shared by article, captcha and metadata fetching, it
+	// is set before any background job could make a request
+	httpClient, err := client.New(config.HTTPClient)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	global.HTTPClient = httpClient
+
 	PORT := config.Port
 	global.PASSWORD = config.Password
+	auth.SetUsers(config.Users, config.Password)
 	global.ScihubURL = config.ScihubURL
+	global.ScihubMirrors = config.ScihubMirrors
+	switch config.Validation.Mode {
+	case "":
+	case parse.ValidationReject, parse.ValidationFlag:
+		parse.Validation = config.Validation
+	default:
+		fmt.Printf("Unknown validation mode: %v\n", config.Validation.Mode)
+		return
+	}
+	parse.Sanitize = config.Sanitize
+	parse.EmbedMetadata = config.EmbedMetadata
+	parse.SourceUnhealthy = controller.SourceUnhealthy
+
+	// antivirus scanning is enabled when clamd address is set
+	if len(config.Scan.Address) > 0 {
+		scanner, err := scan.New(config.Scan)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := scanner.Ping(); err != nil {
+			log.Printf("Antivirus scanner is not reachable: %v", err)
+		}
+		parse.Scanner = scanner
+	}
+
+	// encryption at rest of library and download log
+	var keys *encrypt.Keyring
+	if config.Encryption.Enabled() {
+		if len(config.Encryption.SaltFile) == 0 {
+			config.Encryption.SaltFile = filepath.Join(config.DataDir, "encryption.salt")
+		}
+		keys, err = encrypt.New(config.Encryption)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if len(config.DownloadLog) > 0 {
+		downloadLog, err := downloadlog.Open(config.DownloadLog, keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.DownloadLog = downloadLog
+	}
+
+	if len(config.MetadataURL) > 0 {
+		metadata.ServiceURL = config.MetadataURL
+	}
+	switch config.CitationsURL {
+	case "":
+	case "off":
+		metadata.CitationsURL = ""
+	default:
+		metadata.CitationsURL = config.CitationsURL
+	}
+
+	if keys != nil && len(config.DataDir) == 0 {
+		go resealData(nil, nil, keys)
+	}
+
+	if len(config.DataDir) > 0 {
+		localFiles := filepath.Join(config.DataDir, "files")
+		files, err := storage.New(config.Storage, localFiles, global.HTTPClient)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if keys != nil {
+			files = storage.NewEncrypted(files, keys)
+		}
+		store, err := library.Open(filepath.Join(config.DataDir, "library.db"), files, keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer store.Close()
+		global.Library = store
+		go func() {
+			if config.Storage.Type == "s3" {
+				migrateFiles(store, files, localFiles, keys)
+			}
+			if keys != nil {
+				resealData(store, files.(*storage.Encrypted), keys)
+			}
+		}()
+
+		index, err := search.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Search = index
+		go controller.IndexLibrary()
+
+		tokenStore, err := tokens.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Tokens = tokenStore
+
+		shareStore, err := share.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Shares = shareStore
+
+		teamStore, err := team.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Teams = teamStore
+
+		erased, err := retention.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Erased = erased
+		lockErased(erased, config.Users)
+
+		if len(config.Mail.Host) > 0 {
+			mailStore, err := mail.Open(store.DB(), keys)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			global.Mail = mail.NewMailer(config.Mail, mailStore)
+		}
+
+		webhookStore, err := webhook.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Webhooks = webhook.NewDispatcher(webhookStore, global.HTTPClient)
+		go global.Webhooks.Run(time.Minute)
+
+		// pause between batch fetched articles, so scihub does not block us
+		global.Batch = batch.NewRunner(controller.FetchToLibrary, 3*time.Second)
+		global.Batch.Finished = controller.BatchFinished
+		if config.Retention.Jobs > 0 {
+			global.Batch.Keep = time.Duration(config.Retention.Jobs) * 24 * time.Hour
+		}
+
+		watchStore, err := watch.Open(store.DB(), keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		global.Watch = watch.NewScheduler(watchStore, config.Watch, controller.PollWatch)
+		global.Watch.AutoFetch = controller.AutoFetchWatch
+		global.Watch.Notify = controller.NotifyWatch
+		go global.Watch.Run(10 * time.Minute)
+
+		if len(config.Slack.SigningSecret) > 0 {
+			global.Slack = slack.New(config.Slack, global.HTTPClient)
+		}
+
+		// replies to email requests are sent by the mailer
+		if global.Mail != nil && (len(config.Inbox.IMAP.Address) > 0 || len(config.Inbox.Listen) > 0) {
+			global.Inbox = inbox.New(config.Inbox, controller.HandleMailRequest)
+			go global.Inbox.Run()
+			if len(config.Inbox.IMAP.Address) > 0 {
+				go global.Inbox.RunIMAP()
+			}
+			if len(config.Inbox.Listen) > 0 {
+				go func() {
+					if err := global.Inbox.Listen(config.Inbox.Listen); err != nil {
+						fmt.Printf("Could not listen for email requests: %v\n", err)
+					}
+				}()
+			}
+		}
+	}
+
+	startPurger(config.Retention)
+
+	if len(config.DOIPatterns) > 0 {
+		if err := doi.SetPatterns(append(config.DOIPatterns, doi.DefaultPatterns...)); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// scraping rules, built-in rules are used when rules file is not set
+	if len(config.RulesFile) > 0 {
+		if err := parse.LoadRules(config.RulesFile); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
 	// handling download section
 	http.HandleFunc("/", authMiddleware(controller.DownloadArticle))
 	http.HandleFunc("/login", loginMiddleware(controller.Login))
 	http.HandleFunc("/captcha", authMiddleware(controller.Captcha))
+	http.HandleFunc("/go", authMiddleware(controller.Go))
+	http.HandleFunc("/article", authMiddleware(controller.Article))
+
+	// personal library
+	http.HandleFunc("/library", authMiddleware(controller.Library))
+	http.HandleFunc("/library/article", authMiddleware(controller.LibraryArticle))
+	http.HandleFunc("/library/download", authMiddleware(controller.LibraryDownload))
+	http.HandleFunc("/library/delete", authMiddleware(controller.LibraryDelete))
+	http.HandleFunc("/library/state", authMiddleware(controller.ReadingState))
+	http.HandleFunc("/reading", authMiddleware(controller.ReadingQueue))
+	http.HandleFunc("/search", authMiddleware(controller.Search))
+	http.HandleFunc("/references", authMiddleware(controller.References))
+	http.HandleFunc("/references/fetch", authMiddleware(controller.BatchFetch))
+	http.HandleFunc("/batch", authMiddleware(controller.Batch))
+	http.HandleFunc("/batch/mail", authMiddleware(controller.MailBatch))
+	// signed links in mails and share links work without login
+	http.HandleFunc("/mail/file", controller.MailFile)
+	http.HandleFunc("/s", controller.Shared)
+	// slash commands are authenticated by signature of the chat server
+	http.HandleFunc("/slack/command", controller.SlackCommand)
+	http.HandleFunc("/slack/file", controller.SlackFile)
+	http.HandleFunc("/shares", authMiddleware(controller.Shares))
+	http.HandleFunc("/shares/revoke", authMiddleware(controller.ShareRevoke))
+	http.HandleFunc("/teams", authMiddleware(controller.Teams))
+	http.HandleFunc("/team", authMiddleware(controller.Team))
+	http.HandleFunc("/team/members", authMiddleware(controller.TeamMembers))
+	http.HandleFunc("/team/delete", authMiddleware(controller.TeamDelete))
+	http.HandleFunc("/team/article", authMiddleware(controller.TeamArticle))
+	http.HandleFunc("/team/article/remove", authMiddleware(controller.TeamArticleRemove))
+	http.HandleFunc("/team/download", authMiddleware(controller.TeamDownload))
+	http.HandleFunc("/team/save", authMiddleware(controller.TeamSave))
+	http.HandleFunc("/team/share", authMiddleware(controller.TeamShare))
+	http.HandleFunc("/watch", authMiddleware(controller.Watchlist))
+	http.HandleFunc("/watch/delete", authMiddleware(controller.WatchDelete))
+	http.HandleFunc("/watch/check", authMiddleware(controller.WatchCheck))
+	http.HandleFunc("/new", authMiddleware(controller.NewWorks))
+	if config.WebDAV.Enabled && global.Library != nil {
+		http.Handle("/dav/", basicAuthMiddleware(controller.WebDAV("/dav", config.WebDAV.Write)))
+	}
+	if global.Library != nil {
+		http.Handle("/opds", basicAuthMiddleware(http.HandlerFunc(controller.OPDS)))
+		http.Handle("/opds/", basicAuthMiddleware(http.HandlerFunc(controller.OPDS)))
+		http.Handle("/feed", basicAuthMiddleware(http.HandlerFunc(controller.Feed)))
+		http.Handle("/feed/", basicAuthMiddleware(http.HandlerFunc(controller.Feed)))
+	}
+
+	// export and erasure of user data
+	http.HandleFunc("/account/export", authMiddleware(controller.ExportData))
+	http.HandleFunc("/account/delete", authMiddleware(controller.DeleteAccount))
+	http.HandleFunc("/admin", authMiddleware(controller.Admin))
+
+	// api tokens for e-readers and webdav clients
+	http.HandleFunc("/settings", authMiddleware(controller.Settings))
+	http.HandleFunc("/settings/revoke", authMiddleware(controller.RevokeToken))
+	http.HandleFunc("/settings/mail", authMiddleware(controller.SettingsMail))
+	http.HandleFunc("/webhooks", authMiddleware(controller.Webhooks))
+	http.HandleFunc("/webhooks/delete", authMiddleware(controller.WebhookDelete))
+	http.HandleFunc("/webhooks/test", authMiddleware(controller.WebhookTest))
+	http.HandleFunc("/webhooks/log", authMiddleware(controller.WebhookLog))
+	if global.Tokens != nil {
+		http.Handle("/api/fetch", apiMiddleware(http.HandlerFunc(controller.APIFetch)))
+		http.Handle("/api/doi", apiMiddleware(http.HandlerFunc(controller.APIDoi)))
+	}
 
 	// serving css & public stuff
 	http.Handle("/public/", http.StripPrefix("/public/", http.FileServer(http.Dir("./public"))))
@@ -52,40 +367,105 @@ func main() {
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// check if cookie with hashed password exist
-		cookie, err := r.Cookie("GoScience")
+		cookie, err := r.Cookie(auth.CookieName)
 		if err != nil { // cookie does not exist
-			fmt.Println(err)
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		// check if password in cookie is the same as server set password
-		passHash := cookie.Value
-		err = bcrypt.CompareHashAndPassword([]byte(passHash), []byte(global.PASSWORD))
-		if err != nil {
-			fmt.Println(err)
+		// check if password in cookie is the same as user password
+		name, ok := auth.VerifyCookie(cookie.Value)
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		// password is correct, serve the request
-		next.ServeHTTP(w, r)
+		// password is correct, serve the request as authenticated user
+		next.ServeHTTP(w, auth.WithUser(r, name))
+	})
+}
+
+// basicAuthMiddleware authenticates webdav and opds clients, which do not
+// support login form, with http basic authentication or api token. Token
+// is sent as bearer token or as basic authentication password. Browsers
+// that are already logged in are authenticated with the cookie.
+func basicAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := tokenUser(r); ok {
+			next.ServeHTTP(w, auth.WithUser(r, name))
+			return
+		}
+		if name, password, ok := r.BasicAuth(); ok && auth.Check(name, password) {
+			if len(name) == 0 {
+				name = auth.DefaultUser
+			}
+			next.ServeHTTP(w, auth.WithUser(r, name))
+			return
+		}
+		if cookie, err := r.Cookie(auth.CookieName); err == nil {
+			if name, ok := auth.VerifyCookie(cookie.Value); ok {
+				next.ServeHTTP(w, auth.WithUser(r, name))
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="GoScience"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// apiMiddleware allows cross origin requests from browser extension and
+// authenticates them with api token only. Cookies are not accepted, so
+// other web pages can not fetch articles in the name of logged in user.
+func apiMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		h.Set("Access-Control-Expose-Headers", "Content-Disposition, X-Content-SHA256, X-Library-ID, X-Integrity-Problems, X-Sanitized, X-Metadata-Embedded")
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		name, ok := tokenUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, auth.WithUser(r, name))
 	})
 }
 
+// tokenUser returns user of api token sent as bearer token or as basic
+// authentication password. Tokens of users removed from the configuration
+// are rejected, like their cookies.
+func tokenUser(r *http.Request) (string, bool) {
+	if global.Tokens == nil {
+		return "", false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	name, ok := global.Tokens.Verify(token)
+	if !ok || !auth.Exists(name) {
+		return "", false
+	}
+	return name, true
+}
+
 // loginMiddleware checks if user is already authenticated (and redirects him/her to main download page).
 func loginMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("GoScience")
+		cookie, err := r.Cookie(auth.CookieName)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		passHash := cookie.Value
-		err = bcrypt.CompareHashAndPassword([]byte(passHash), []byte(global.PASSWORD))
-		if err != nil {
-			fmt.Println(err)
+		if _, ok := auth.VerifyCookie(cookie.Value); !ok {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -95,6 +475,114 @@ func loginMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+// migrateFiles copies library files that were stored on the local disk
+// before object storage was configured
+func migrateFiles(store *library.Store, files storage.Storage, dir string, keys *encrypt.Keyring) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	fileKeys, err := store.FileKeys()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	local, err := storage.NewLocal(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	copied, err := storage.Copy(storage.NewEncrypted(local, keys), files, fileKeys)
+	if err != nil {
+		fmt.Printf("Could not copy library files to object storage: %v\n", err)
+	}
+	if copied > 0 {
+		log.Printf("Copied %v library files to object storage", copied)
+	}
+}
+
+// resealData encrypts data written before encryption was enabled or
+// sealed with a rotated key. Database is resealed when it is opened,
+// library files are renamed and resealed once for every key, the download
+// log is checked on every start.
+func resealData(store *library.Store, files *storage.Encrypted, keys *encrypt.Keyring) {
+	if changed, err := global.DownloadLog.Reseal(); err != nil {
+		fmt.Printf("Could not encrypt download log: %v\n", err)
+	} else if changed > 0 {
+		log.Printf("Encrypted %v download log entries", changed)
+	}
+	if store == nil {
+		return
+	}
+	if sealed, err := store.SealedKey(); err != nil || sealed == keys.ID() {
+		return
+	}
+	moved, err := store.RenameFiles()
+	if err != nil {
+		fmt.Printf("Could not rename library files: %v\n", err)
+		return
+	}
+	fileKeys, err := store.FileKeys()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	changed, err := files.Reseal(fileKeys)
+	if err != nil {
+		fmt.Printf("Could not encrypt library files: %v\n", err)
+		return
+	}
+	if err := store.SetSealedKey(keys.ID()); err != nil {
+		fmt.Println(err)
+		return
+	}
+	log.Printf("Renamed %v and encrypted %v library files with key %v", moved, changed, keys.ID())
+}
+
+// startPurger removes records older than their retention period in the
+// background
+func startPurger(config retention.Config) {
+	purger := retention.NewPurger(config)
+	purger.Add("download log entries", config.DownloadLog, func(before time.Time) (int, error) {
+		return global.DownloadLog.Remove(func(e downloadlog.Entry) bool { return e.Time.Before(before) })
+	})
+	if global.Library != nil {
+		purger.Add("batch jobs", config.Jobs, func(before time.Time) (int, error) {
+			return global.Batch.Purge(before), nil
+		})
+		purger.Add("webhook deliveries", config.WebhookDeliveries, global.Webhooks.Store.PurgeDeliveries)
+		purger.Add("found works", config.Watch, global.Watch.Store.PurgeFound)
+		purger.Add("share links", config.ShareLinks, global.Shares.Purge)
+	}
+	if !purger.Empty() {
+		go purger.Run()
+	}
+}
+
+// lockErased keeps deleted accounts from logging in. Records of accounts
+// that were removed from the configuration are dropped, so the name could
+// be used again.
+func lockErased(store *retention.Store, users []auth.User) {
+	erased, err := store.Erased()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	configured := map[string]bool{}
+	for _, u := range users {
+		configured[u.Name] = true
+	}
+	for name := range erased {
+		if !configured[name] {
+			if err := store.Forget(name); err != nil {
+				fmt.Println(err)
+			}
+			continue
+		}
+		auth.Remove(name)
+		log.Printf("Account %v was deleted, remove it from the configuration", name)
+	}
+}
+
 // ReadConfiguration reads from "conf.json" file and returns Configuration struct
 // which is used in main func
 func ReadConfiguration() (Configuration, error) {
@@ -114,5 +602,12 @@ func ReadConfiguration() (Configuration, error) {
 		return Configuration{}, fmt.Errorf("ScihubURL is not present in configuration")
 	}
 
+	// team libraries are stored as library users "team:<id>"
+	for _, u := range config.Users {
+		if strings.Contains(u.Name, ":") {
+			return Configuration{}, fmt.Errorf("User name %q could not contain ':'", u.Name)
+		}
+	}
+
 	return config, nil
 }
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/auth"
+	"github.com/greatdanton/goScience/controller"
+	"github.com/greatdanton/goScience/downloadlog"
+	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/library"
+	"github.com/greatdanton/goScience/share"
+	"github.com/greatdanton/goScience/slack"
+	"github.com/greatdanton/goScience/storage"
+	"github.com/greatdanton/goScience/team"
+	"github.com/greatdanton/goScience/tokens"
+	"github.com/greatdanton/goScience/webhook"
+)
+
+func Test_tokenUser(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := tokens.Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Tokens = store
+	defer func() { global.Tokens = nil }()
+	auth.SetUsers([]auth.User{{Name: "ana", Password: "a"}, {Name: "bob", Password: "b"}}, "")
+
+	anaToken, _, _ := store.Create("ana", "Tablet")
+	bobToken, _, _ := store.Create("bob", "Tablet")
+	revoked, token, _ := store.Create("ana", "Phone")
+	store.Revoke("ana", token.ID)
+	auth.Remove("bob")
+
+	tests := []struct {
+		token string
+		user  string
+		ok    bool
+	}{
+		{anaToken, "ana", true},
+		{bobToken, "", false}, // user removed from the configuration
+		{revoked, "", false},
+		{"gs_unknown", "", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/opds", nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		user, ok := tokenUser(r)
+		if user != test.user || ok != test.ok {
+			t.Errorf("tokenUser(%v) = %v, %v", test.token, user, ok)
+			t.Errorf("Output should be: %v, %v", test.user, test.ok)
+		}
+	}
+
+	// the same applies to the api used by the browser extension
+	handler := apiMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.UserName(r)))
+	}))
+	for token, status := range map[string]int{anaToken: http.StatusOK, bobToken: http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/fetch", nil)
+		r.SetBasicAuth("", token)
+		handler.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("apiMiddleware() with token of %q = %v", w.Body.String(), w.Code)
+			t.Errorf("Output should be: %v", status)
+		}
+	}
+}
+
+// testUsers are configured by openTestLibrary, ana is admin
+var testUsers = []auth.User{{Name: "ana", Password: "a", Admin: true}, {Name: "bob", Password: "b"}, {Name: "cid", Password: "c"}, {Name: "dan", Password: "d"}}
+
+// openTestLibrary enables library with shares, teams, tokens, webhooks and
+// download log in temporary directory and configures testUsers
+func openTestLibrary(t *testing.T) *library.Store {
+	dir := t.TempDir()
+	files, err := storage.NewLocal(filepath.Join(dir, "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := library.Open(filepath.Join(dir, "library.db"), files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := share.Open(store.DB(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teams, err := team.Open(store.DB(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenStore, err := tokens.Open(store.DB(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhookStore, err := webhook.Open(store.DB(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloadLog, err := downloadlog.Open(filepath.Join(dir, "downloads.log"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Library, global.Shares, global.Teams, global.Tokens = store, shares, teams, tokenStore
+	global.Webhooks, global.DownloadLog = webhook.NewDispatcher(webhookStore, nil), downloadLog
+	t.Cleanup(func() {
+		global.Library, global.Shares, global.Teams, global.Tokens = nil, nil, nil, nil
+		global.Webhooks, global.DownloadLog, global.Slack = nil, nil, nil
+		store.Close()
+	})
+	auth.SetUsers(testUsers, "")
+	return store
+}
+
+// testCookies caches cookies of testUsers, hashing passwords is slow
+var testCookies = map[string]string{}
+
+// cookieOf returns authentication cookie value of the test user
+func cookieOf(t *testing.T, user string) string {
+	if value, ok := testCookies[user]; ok {
+		return value
+	}
+	for _, u := range testUsers {
+		if u.Name == user {
+			value, err := auth.CookieValue(u.Name, u.Password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testCookies[user] = value
+			return value
+		}
+	}
+	t.Fatalf("unknown test user %v", user)
+	return ""
+}
+
+// serve sends form through the handler as request with the cookie, empty
+// cookie is not sent. Form of GET requests is sent in the query.
+func serve(handler http.Handler, method, target, cookie string, form url.Values) *httptest.ResponseRecorder {
+	body := form.Encode()
+	if method == "GET" && len(body) > 0 {
+		target, body = target+"?"+body, ""
+	}
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(cookie) > 0 {
+		r.AddCookie(&http.Cookie{Name: auth.CookieName, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func Test_authMiddleware(t *testing.T) {
+	store := openTestLibrary(t)
+	item, err := store.Save("ana", library.Item{Doi: "10.1000/ana", Title: "Ana"}, []byte("%PDF-1.4 ana"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := cookieOf(t, "cid")
+	auth.Remove("cid")
+	bob := cookieOf(t, "bob")
+
+	handler := authMiddleware(controller.LibraryDownload)
+	tests := []struct {
+		name   string
+		cookie string
+		status int
+	}{
+		{"owner", cookieOf(t, "ana"), http.StatusOK},
+		{"other user", bob, http.StatusNotFound},
+		{"no cookie", "", http.StatusSeeOther},
+		{"cookie of other user renamed", "ana" + bob[strings.LastIndex(bob, "|"):], http.StatusSeeOther},
+		{"removed user", removed, http.StatusSeeOther},
+	}
+	for _, test := range tests {
+		w := serve(handler, "GET", "/library/download?id="+item.ID, test.cookie, nil)
+		if w.Code != test.status {
+			t.Errorf("authMiddleware(LibraryDownload) with %v = %v", test.name, w.Code)
+			t.Errorf("Output should be: %v", test.status)
+		}
+	}
+}
+
+func Test_teamPermissions(t *testing.T) {
+	store := openTestLibrary(t)
+	lab, err := global.Teams.Create("ana", "Lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Teams.SetMember("ana", lab.ID, "bob", team.RoleViewer)
+	global.Teams.SetMember("ana", lab.ID, "cid", team.RoleEditor)
+	item, _ := store.Save("ana", library.Item{Doi: "10.1000/lab", Title: "Lab"}, []byte("%PDF-1.4 lab"))
+	if _, err := store.Copy("ana", lab.Library(), item.ID); err != nil {
+		t.Fatal(err)
+	}
+	own, _ := store.Save("bob", library.Item{Doi: "10.1000/bob", Title: "Bob"}, []byte("%PDF-1.4 bob"))
+
+	form := url.Values{"team": {lab.ID}, "id": {item.ID}}
+	tests := []struct {
+		handler http.HandlerFunc
+		method  string
+		user    string
+		form    url.Values
+		status  int
+	}{
+		{controller.TeamDownload, "GET", "bob", form, http.StatusOK},
+		{controller.TeamDownload, "GET", "dan", form, http.StatusNotFound},
+		{controller.TeamArticle, "POST", "bob", form, http.StatusForbidden},
+		{controller.TeamArticleRemove, "POST", "bob", form, http.StatusForbidden},
+		{controller.TeamArticleRemove, "POST", "dan", form, http.StatusNotFound},
+		{controller.TeamShare, "POST", "bob", url.Values{"team": {lab.ID}, "id": {own.ID}}, http.StatusForbidden},
+		{controller.TeamShare, "POST", "cid", url.Values{"team": {lab.ID}, "id": {own.ID}}, http.StatusNotFound},
+		{controller.TeamArticle, "POST", "cid", form, http.StatusSeeOther},
+		{controller.TeamArticleRemove, "POST", "cid", form, http.StatusSeeOther},
+	}
+	for i, test := range tests {
+		w := serve(authMiddleware(test.handler), test.method, "/team", cookieOf(t, test.user), test.form)
+		if w.Code != test.status {
+			t.Errorf("test %v: %v by %v = %v", i, test.method, test.user, w.Code)
+			t.Errorf("Output should be: %v", test.status)
+		}
+	}
+	if _, err := store.Get(lab.Library(), item.ID); err != library.ErrNotFound {
+		t.Errorf("article removed by editor is still in team library: %v", err)
+	}
+	if _, err := store.Get("ana", item.ID); err != nil {
+		t.Errorf("article of member was removed with the team copy: %v", err)
+	}
+}
+
+func Test_Shared(t *testing.T) {
+	store := openTestLibrary(t)
+	item, _ := store.Save("ana", library.Item{Doi: "10.1000/shared", Title: "Shared"}, []byte("%PDF-1.4 shared"))
+	single, err := global.Shares.Create("ana", item.ID, item.Title, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := global.Shares.Create("ana", item.ID, item.Title, time.Millisecond, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	link := func(l share.Link, sig string) string {
+		return "/s?" + url.Values{"id": {l.ID}, "sig": {sig}}.Encode()
+	}
+
+	handler := http.HandlerFunc(controller.Shared)
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{"GET", link(share.Link{ID: "unknown"}, "sig"), http.StatusNotFound},
+		{"GET", link(single, "forged"), http.StatusNotFound},
+		{"GET", link(expired, global.Shares.Sign(expired)), http.StatusForbidden},
+		// link previews do not use single use links
+		{"HEAD", link(single, global.Shares.Sign(single)), http.StatusOK},
+		{"GET", link(single, global.Shares.Sign(single)), http.StatusOK},
+		{"GET", link(single, global.Shares.Sign(single)), http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := serve(handler, test.method, test.target, "", nil)
+		if w.Code != test.status {
+			t.Errorf("Shared(%v %v) = %v", test.method, test.target, w.Code)
+			t.Errorf("Output should be: %v", test.status)
+		}
+	}
+
+	// unknown links are not logged, refused genuine links are logged
+	// with the owner
+	entries, err := global.DownloadLog.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := []string{}
+	for _, e := range entries {
+		if e.User != "ana" {
+			t.Errorf("share download logged for user %q", e.User)
+		}
+		statuses = append(statuses, e.Status)
+	}
+	if len(statuses) != 3 || statuses[1] != "ok" {
+		t.Errorf("logged share downloads = %v", statuses)
+	}
+}
+
+func Test_DeleteAccount(t *testing.T) {
+	store := openTestLibrary(t)
+	store.Save("bob", library.Item{Doi: "10.1000/bob", Title: "Bob"}, []byte("%PDF-1.4 bob"))
+	cid, _ := store.Save("cid", library.Item{Doi: "10.1000/cid", Title: "Cid"}, []byte("%PDF-1.4 cid"))
+	token, _, _ := global.Tokens.Create("bob", "Tablet")
+
+	handler := authMiddleware(controller.DeleteAccount)
+	tests := []struct {
+		user     string
+		form     url.Values
+		status   int
+		location string
+	}{
+		// only admins erase accounts of other users
+		{"bob", url.Values{"user": {"cid"}, "confirm": {"cid"}}, http.StatusForbidden, ""},
+		{"bob", url.Values{"confirm": {"ana"}}, http.StatusSeeOther, "/settings?delete=unconfirmed"},
+		{"bob", url.Values{"confirm": {"bob"}}, http.StatusSeeOther, "/login"},
+		{"ana", url.Values{"user": {"cid"}, "confirm": {"cid"}}, http.StatusSeeOther, "/admin"},
+	}
+	for i, test := range tests {
+		w := serve(handler, "POST", "/account/delete", cookieOf(t, test.user), test.form)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("test %v: DeleteAccount() by %v = %v %v", i, test.user, w.Code, w.Header().Get("Location"))
+			t.Errorf("Output should be: %v %v", test.status, test.location)
+		}
+		if i == 0 {
+			// data of cid is kept after the refused request
+			if _, err := store.Get("cid", cid.ID); err != nil {
+				t.Errorf("refused request erased library of cid: %v", err)
+			}
+		}
+	}
+
+	// erased users could not log in or use their tokens
+	for _, user := range []string{"bob", "cid"} {
+		if auth.Exists(user) {
+			t.Errorf("account of %v was not removed", user)
+		}
+		if w := serve(authMiddleware(controller.LibraryDownload), "GET", "/library/download", cookieOf(t, user), nil); w.Code != http.StatusSeeOther {
+			t.Errorf("cookie of erased %v = %v", user, w.Code)
+		}
+	}
+	r := httptest.NewRequest("GET", "/opds", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, ok := tokenUser(r); ok {
+		t.Errorf("token of erased user was accepted")
+	}
+	if _, err := store.Get("cid", cid.ID); err != library.ErrNotFound {
+		t.Errorf("library of erased user = %v", err)
+	}
+}
+
+func Test_SlackCommand(t *testing.T) {
+	store := openTestLibrary(t)
+	global.Slack = slack.New(slack.Config{SigningSecret: "secret"}, nil)
+	body := "command=%2Fweather&text=today"
+	now := fmt.Sprint(time.Now().Unix())
+	old := fmt.Sprint(time.Now().Add(-time.Hour).Unix())
+
+	tests := []struct {
+		timestamp string
+		signature string
+		status    int
+	}{
+		{now, slack.Sign("secret", now, []byte(body)), http.StatusOK},
+		{now, slack.Sign("other", now, []byte(body)), http.StatusUnauthorized},
+		{now, "", http.StatusUnauthorized},
+		{old, slack.Sign("secret", old, []byte(body)), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/slack/command", strings.NewReader(body))
+		r.Header.Set("X-Slack-Request-Timestamp", test.timestamp)
+		r.Header.Set("X-Slack-Signature", test.signature)
+		w := httptest.NewRecorder()
+		controller.SlackCommand(w, r)
+		if w.Code != test.status {
+			t.Errorf("SlackCommand(%v, %v) = %v", test.timestamp, test.signature, w.Code)
+			t.Errorf("Output should be: %v", test.status)
+		}
+	}
+
+	// download links posted to the chat are signed for the user
+	item, _ := store.Save("ana", library.Item{Doi: "10.1000/chat", Title: "Chat"}, []byte("%PDF-1.4 chat"))
+	expires := global.Slack.LinkExpires()
+	sig := global.Slack.SignLink("ana", item.ID, expires)
+	for user, status := range map[string]int{"ana": http.StatusOK, "bob": http.StatusForbidden} {
+		target := "/slack/file?" + url.Values{"user": {user}, "id": {item.ID}, "expires": {fmt.Sprint(expires.Unix())}, "sig": {sig}}.Encode()
+		w := serve(http.HandlerFunc(controller.SlackFile), "GET", target, "", nil)
+		if w.Code != status {
+			t.Errorf("SlackFile() for %v = %v", user, w.Code)
+			t.Errorf("Output should be: %v", status)
+		}
+	}
+}
+
+func Test_WebhookTest(t *testing.T) {
+	openTestLibrary(t)
+	received := make(chan bool, 1)
+	var sub webhook.Subscription
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r.Header.Get(webhook.SignatureHeader) == "sha256="+webhook.Sign(sub.Secret, body)
+	}))
+	defer receiver.Close()
+	sub, err := global.Webhooks.Store.Subscribe("ana", receiver.URL, []string{webhook.ArticleDownloaded})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := authMiddleware(controller.WebhookTest)
+	form := url.Values{"id": {sub.ID}}
+	if w := serve(handler, "POST", "/webhooks/test", cookieOf(t, "bob"), form); w.Code != http.StatusNotFound {
+		t.Errorf("WebhookTest() of other user = %v", w.Code)
+	}
+	if w := serve(authMiddleware(controller.WebhookDelete), "POST", "/webhooks/delete", cookieOf(t, "bob"), form); w.Code != http.StatusNotFound {
+		t.Errorf("WebhookDelete() of other user = %v", w.Code)
+	}
+	if w := serve(handler, "POST", "/webhooks/test", cookieOf(t, "ana"), form); w.Code != http.StatusSeeOther {
+		t.Errorf("WebhookTest() = %v", w.Code)
+	}
+	select {
+	case valid := <-received:
+		if !valid {
+			t.Errorf("test delivery signature does not match the subscription secret")
+		}
+	default:
+		t.Errorf("test delivery was not received")
+	}
+}
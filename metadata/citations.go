@@ -0,0 +1,62 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/global"
+)
+
+// DefaultCitationsURL is the OpenCitations COCI api used when the
+// configuration does not set citations service url
+const DefaultCitationsURL = "https://opencitations.net/index/coci/api/v1"
+
+// CitationsURL is the base url of OpenCitations compatible service that
+// knows which works cite a doi, set in the main function. Empty url
+// disables looking up citing works.
+var CitationsURL = DefaultCitationsURL
+
+// Citation is a work citing another work
+type Citation struct {
+	Doi     string
+	Created string // publication date of the citing work, ex. "2019-05-10"
+}
+
+// Citing returns works citing the doi, the most recently published
+// first. Citations are not known when CitationsURL is empty.
+func Citing(work string) ([]Citation, error) {
+	list := []Citation{}
+	if len(CitationsURL) == 0 {
+		return list, nil
+	}
+	resp, err := global.HTTPClient.Get(strings.TrimRight(CitationsURL, "/") + "/citations/" + url.PathEscape(work))
+	if err != nil {
+		return list, apperror.Wrap(apperror.UpstreamUnavailable, err, "Citations service is not available")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return list, apperror.New(apperror.UpstreamUnavailable, fmt.Sprintf("Citations service status code: %v", resp.Status))
+	}
+
+	body := []struct {
+		Citing   string `json:"citing"`
+		Creation string `json:"creation"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return list, apperror.Wrap(apperror.UpstreamLayoutChanged, err, "Could not parse citations")
+	}
+	for _, c := range body {
+		// newer indexes list several identifiers, ex. "omid:br/06 doi:10.1/x"
+		if found, ok := doi.Find(c.Citing); ok {
+			list = append(list, Citation{Doi: found, Created: c.Creation})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Created > list[j].Created })
+	return list, nil
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCitedAuthors is number of authors listed before "et al."
+const maxCitedAuthors = 3
+
+// Cite formats the work as APA style reference, ex. "Potvin, R., &
+// Levenberg, J. (2016). Why Google stores billions of lines of code in a
+// single repository. Communications of the ACM, 59(7), 78-87.
+// https://doi.org/10.1145/2854146". Missing parts are left out.
+func (w Work) Cite() string {
+	parts := []string{}
+	authors := []string{}
+	for i, name := range w.Authors {
+		if i == maxCitedAuthors {
+			break
+		}
+		authors = append(authors, citedName(name))
+	}
+	switch {
+	case len(w.Authors) > maxCitedAuthors:
+		parts = append(parts, strings.Join(authors, ", ")+", et al.")
+	case len(authors) > 1:
+		parts = append(parts, strings.Join(authors[:len(authors)-1], ", ")+", & "+authors[len(authors)-1])
+	case len(authors) == 1:
+		parts = append(parts, authors[0])
+	}
+	if w.Year > 0 {
+		parts = append(parts, fmt.Sprintf("(%v).", w.Year))
+	} else {
+		parts = append(parts, "(n.d.).")
+	}
+	if len(w.Title) > 0 {
+		parts = append(parts, strings.TrimRight(w.Title, ".")+".")
+	}
+
+	source := w.Journal
+	if len(w.Volume) > 0 {
+		source += ", " + w.Volume
+		if len(w.Issue) > 0 {
+			source += "(" + w.Issue + ")"
+		}
+	}
+	if len(w.Pages) > 0 {
+		source += ", " + w.Pages
+	}
+	if source = strings.TrimPrefix(source, ", "); len(source) > 0 {
+		parts = append(parts, source+".")
+	}
+	if len(w.Doi) > 0 {
+		parts = append(parts, "https://doi.org/"+w.Doi)
+	}
+	return strings.Join(parts, " ")
+}
+
+// citedName converts "Given Family" into "Family, G.", names without given
+// name (ex. consortia) are kept as they are
+func citedName(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return name
+	}
+	initials := []string{}
+	for _, given := range fields[:len(fields)-1] {
+		r, _ := utf8.DecodeRuneInString(given)
+		initials = append(initials, string(r)+".")
+	}
+	return fields[len(fields)-1] + ", " + strings.Join(initials, " ")
+}
@@ -0,0 +1,300 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/global"
+)
+
+// DefaultURL is the Crossref REST api used when the configuration does
+// not set metadata service url
+const DefaultURL = "https://api.crossref.org"
+
+// ServiceURL is the base url of Crossref compatible metadata service, set
+// in the main function
+var ServiceURL = DefaultURL
+
+// Work contains bibliographic metadata of a single work
+type Work struct {
+	Doi       string
+	Title     string
+	Authors   []string // "Given Family"
+	Journal   string
+	Publisher string
+	Year      int
+	Volume    string
+	Issue     string
+	Pages     string
+	ISSN      []string
+	Abstract  string
+	URL       string
+	// References are works cited by this work, available when the
+	// publisher deposited them with Crossref
+	References []Reference
+}
+
+// Reference is cited work from Crossref reference list, only the
+// unstructured citation is known for some references
+type Reference struct {
+	Doi    string
+	Title  string
+	Year   int
+	Author string // first author
+	Text   string // unstructured citation
+}
+
+// crossrefWork is part of Crossref work message we are interested in
+type crossrefWork struct {
+	DOI            string   `json:"DOI"`
+	Title          []string `json:"title"`
+	ContainerTitle []string `json:"container-title"`
+	Publisher      string   `json:"publisher"`
+	Volume         string   `json:"volume"`
+	Issue          string   `json:"issue"`
+	Page           string   `json:"page"`
+	ISSN           []string `json:"ISSN"`
+	Abstract       string   `json:"abstract"`
+	URL            string   `json:"URL"`
+	Author         []struct {
+		Given  string `json:"given"`
+		Family string `json:"family"`
+		Name   string `json:"name"`
+	} `json:"author"`
+	Issued    crossrefDate `json:"issued"`
+	Published crossrefDate `json:"published"`
+	Reference []struct {
+		DOI          string `json:"DOI"`
+		ArticleTitle string `json:"article-title"`
+		VolumeTitle  string `json:"volume-title"`
+		Year         string `json:"year"`
+		Author       string `json:"author"`
+		Unstructured string `json:"unstructured"`
+	} `json:"reference"`
+}
+
+type crossrefDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+func (d crossrefDate) year() int {
+	if len(d.DateParts) > 0 && len(d.DateParts[0]) > 0 {
+		return d.DateParts[0][0]
+	}
+	return 0
+}
+
+// Lookup fetches metadata of the work with provided doi
+func Lookup(doi string) (Work, error) {
+	message := crossrefWork{}
+	err := get("/works/"+url.PathEscape(doi), &message)
+	if err != nil {
+		return Work{}, err
+	}
+	return message.work(), nil
+}
+
+// maxFilterDois is number of dois looked up in a single request, Crossref
+// limits length of the filter
+const maxFilterDois = 50
+
+// LookupMany fetches metadata of multiple works, works unknown to the
+// metadata service are left out
+func LookupMany(dois []string) ([]Work, error) {
+	works := []Work{}
+	for start := 0; start < len(dois); start += maxFilterDois {
+		end := start + maxFilterDois
+		if end > len(dois) {
+			end = len(dois)
+		}
+		filter := []string{}
+		for _, doi := range dois[start:end] {
+			filter = append(filter, "doi:"+doi)
+		}
+		message := struct {
+			Items []crossrefWork `json:"items"`
+		}{}
+		q := url.Values{"filter": {strings.Join(filter, ",")}, "rows": {strconv.Itoa(end - start)}}
+		if err := get("/works?"+q.Encode(), &message); err != nil {
+			return works, err
+		}
+		for _, item := range message.Items {
+			works = append(works, item.work())
+		}
+	}
+	return works, nil
+}
+
+// WorksQuery selects recently registered works of a journal, an author
+// or matching a search text
+type WorksQuery struct {
+	ISSN  string // journal
+	ORCID string // author
+	Text  string // bibliographic search
+	Since time.Time
+	Rows  int
+}
+
+// Works returns works matching the query registered since the query date,
+// the newest first. Text queries are sorted by relevance.
+func Works(q WorksQuery) ([]Work, error) {
+	path := "/works"
+	if len(q.ISSN) > 0 {
+		path = "/journals/" + url.PathEscape(q.ISSN) + "/works"
+	}
+	filter := []string{}
+	if !q.Since.IsZero() {
+		filter = append(filter, "from-created-date:"+q.Since.UTC().Format("2006-01-02"))
+	}
+	if len(q.ORCID) > 0 {
+		filter = append(filter, "orcid:"+q.ORCID)
+	}
+	values := url.Values{"rows": {strconv.Itoa(q.Rows)}}
+	if len(filter) > 0 {
+		values.Set("filter", strings.Join(filter, ","))
+	}
+	if len(q.Text) > 0 {
+		values.Set("query.bibliographic", q.Text)
+	} else {
+		values.Set("sort", "created")
+		values.Set("order", "desc")
+	}
+
+	message := struct {
+		Items []crossrefWork `json:"items"`
+	}{}
+	if err := get(path+"?"+values.Encode(), &message); err != nil {
+		return nil, err
+	}
+	works := []Work{}
+	for _, item := range message.Items {
+		works = append(works, item.work())
+	}
+	return works, nil
+}
+
+// Resolve finds the work cited by unstructured citation string, ex.
+// "R. Potvin, J. Levenberg, Why Google stores billions of lines of code
+// in a single repository, Commun. ACM 59 (2016)". Search results are
+// ranked by relevance only, so the best result is accepted when its title
+// appears in the citation.
+func Resolve(citation string) (Work, error) {
+	message := struct {
+		Items []crossrefWork `json:"items"`
+	}{}
+	q := url.Values{"query.bibliographic": {citation}, "rows": {"1"}}
+	if err := get("/works?"+q.Encode(), &message); err != nil {
+		return Work{}, err
+	}
+	if len(message.Items) == 0 {
+		return Work{}, ErrNotResolved
+	}
+	w := message.Items[0].work()
+	title := normalize(w.Title)
+	if len(title) == 0 || !strings.Contains(normalize(citation), title) {
+		return Work{}, ErrNotResolved
+	}
+	return w, nil
+}
+
+// ErrNotResolved is returned when citation does not match any work
+var ErrNotResolved = apperror.New(apperror.NotFound, "Citation does not match any known work")
+
+var nonAlphanumeric = regexp.MustCompile(`[^\pL\pN]+`)
+
+// normalize lowercases text and replaces punctuation with single space,
+// so titles could be compared with citations
+func normalize(s string) string {
+	s = nonAlphanumeric.ReplaceAllString(strings.ToLower(s), " ")
+	return strings.TrimSpace(s)
+}
+
+// work converts Crossref message into Work
+func (c crossrefWork) work() Work {
+	w := Work{
+		Doi:       c.DOI,
+		Title:     cleanText(first(c.Title)),
+		Journal:   cleanText(first(c.ContainerTitle)),
+		Publisher: c.Publisher,
+		Volume:    c.Volume,
+		Issue:     c.Issue,
+		Pages:     c.Page,
+		ISSN:      c.ISSN,
+		Abstract:  cleanText(c.Abstract),
+		URL:       c.URL,
+		Year:      c.Issued.year(),
+	}
+	if w.Year == 0 {
+		w.Year = c.Published.year()
+	}
+	for _, ref := range c.Reference {
+		r := Reference{
+			Doi:    ref.DOI,
+			Title:  cleanText(ref.ArticleTitle),
+			Author: ref.Author,
+			Text:   cleanText(ref.Unstructured),
+		}
+		if len(r.Title) == 0 {
+			r.Title = cleanText(ref.VolumeTitle)
+		}
+		r.Year, _ = strconv.Atoi(strings.TrimRight(ref.Year, "abcdefghijklmnopqrstuvwxyz"))
+		w.References = append(w.References, r)
+	}
+	for _, a := range c.Author {
+		name := strings.TrimSpace(a.Given + " " + a.Family)
+		if len(name) == 0 {
+			name = a.Name
+		}
+		if len(name) > 0 {
+			w.Authors = append(w.Authors, name)
+		}
+	}
+	return w
+}
+
+// get fetches Crossref api path and decodes "message" part of the response
+func get(path string, message interface{}) error {
+	resp, err := global.HTTPClient.Get(strings.TrimRight(ServiceURL, "/") + path)
+	if err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Metadata service is not available")
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return apperror.New(apperror.NotFound, "Metadata service does not know this work")
+	case resp.StatusCode != http.StatusOK:
+		return apperror.New(apperror.UpstreamUnavailable, fmt.Sprintf("Metadata service status code: %v", resp.Status))
+	}
+
+	body := struct {
+		Message interface{} `json:"message"`
+	}{message}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return apperror.Wrap(apperror.UpstreamLayoutChanged, err, "Could not parse metadata")
+	}
+	return nil
+}
+
+func first(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0]
+}
+
+var tags = regexp.MustCompile(`<[^>]+>`)
+
+// cleanText removes jats xml tags (used in abstracts and titles) and
+// collapses white space
+func cleanText(s string) string {
+	s = tags.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(s), " ")
+}
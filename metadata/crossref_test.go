@@ -0,0 +1,231 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// fakeCrossref serves saved Crossref responses from testdata directory
+func fakeCrossref(t *testing.T) *httptest.Server {
+	work, err := ioutil.ReadFile("testdata/work.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	works, err := ioutil.ReadFile("testdata/works.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/works/10.1145%2F2854146":
+			w.Write(work)
+		case "/works":
+			if filter := r.URL.Query().Get("filter"); len(filter) > 0 {
+				if strings.Contains(filter, "doi:10.1145/2854146") {
+					w.Write(works)
+					return
+				}
+				w.Write([]byte(`{"message": {"items": []}}`))
+				return
+			}
+			// search always returns the same work, like Crossref returns
+			// the best match even for unrelated citations
+			w.Write(works)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ServiceURL = server.URL
+	return server
+}
+
+func Test_Lookup(t *testing.T) {
+	server := fakeCrossref(t)
+	defer server.Close()
+	defer func() { ServiceURL = DefaultURL }()
+
+	w, err := Lookup("10.1145/2854146")
+	if err != nil {
+		t.Fatalf("Lookup() returned error: %v", err)
+	}
+	if w.Title != "Why Google stores billions of lines of code in a single repository" ||
+		w.Journal != "Communications of the ACM" || w.Year != 2016 ||
+		strings.Join(w.Authors, ", ") != "Rachel Potvin, Josh Levenberg" ||
+		w.Abstract != "Google's monolithic repository provides a common source of truth." {
+		t.Errorf("Lookup() = %+v", w)
+	}
+	expected := []Reference{
+		{Doi: "10.1145/1294261.1294281", Title: "Bigtable: A distributed storage system for structured data", Year: 2008, Author: "Chang F."},
+		{Text: "Perry, D.E., Siy, H.P., and Votta, L.G. Parallel changes in large-scale software development. ACM TOSEM 10, 3 (2001)."},
+		{Title: "Software Engineering at Google", Year: 2017},
+	}
+	if len(w.References) != len(expected) {
+		t.Fatalf("Lookup() references = %+v", w.References)
+	}
+	for i, ref := range w.References {
+		if ref != expected[i] {
+			t.Errorf("Lookup() reference = %+v", ref)
+			t.Errorf("Output should be: %+v", expected[i])
+		}
+	}
+
+	_, err = Lookup("10.1000/missing")
+	if !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("Lookup(missing) = %v, should return not found error", err)
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	server := fakeCrossref(t)
+	defer server.Close()
+	defer func() { ServiceURL = DefaultURL }()
+
+	tests := []struct {
+		citation string
+		doi      string
+	}{
+		{"[12] R. Potvin, J. Levenberg, Why Google stores billions of lines of code in a single repository, Commun. ACM 59 (7) (2016) 78-87.", "10.1145/2854146"},
+		{"Potvin R, Levenberg J (2016) Why Google Stores Billions of Lines of Code in a Single Repository. Commun ACM 59:78", "10.1145/2854146"},
+		{"J. Smith, Monorepos considered harmful, Proc. ICSE (2018).", ""},
+	}
+	for _, test := range tests {
+		w, err := Resolve(test.citation)
+		if w.Doi != test.doi {
+			t.Errorf("Resolve(%v) = %v, %v", test.citation, w.Doi, err)
+			t.Errorf("Output should be: %v", test.doi)
+		}
+		if len(test.doi) == 0 && !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("Resolve(%v) = %v, should return not found error", test.citation, err)
+		}
+	}
+}
+
+func Test_LookupMany(t *testing.T) {
+	server := fakeCrossref(t)
+	defer server.Close()
+	defer func() { ServiceURL = DefaultURL }()
+
+	dois := []string{"10.1145/2854146"}
+	for i := 0; i < 60; i++ {
+		dois = append(dois, fmt.Sprintf("10.1000/missing%v", i))
+	}
+	works, err := LookupMany(dois)
+	if err != nil {
+		t.Fatalf("LookupMany() returned error: %v", err)
+	}
+	if len(works) != 1 || works[0].Doi != "10.1145/2854146" {
+		t.Errorf("LookupMany() = %+v", works)
+	}
+}
+
+func Test_Citing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/citations/10.1145%2F2854146" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"citing": "10.1000/old", "cited": "10.1145/2854146", "creation": "2017-03"},
+			{"citing": "omid:br/0612 doi:10.1000/new", "cited": "10.1145/2854146", "creation": "2021-11-02"},
+			{"citing": "", "cited": "10.1145/2854146", "creation": "2020"}
+		]`))
+	}))
+	defer server.Close()
+	CitationsURL = server.URL
+	defer func() { CitationsURL = DefaultCitationsURL }()
+
+	list, err := Citing("10.1145/2854146")
+	if err != nil {
+		t.Fatalf("Citing() returned error: %v", err)
+	}
+	expected := []Citation{{Doi: "10.1000/new", Created: "2021-11-02"}, {Doi: "10.1000/old", Created: "2017-03"}}
+	if fmt.Sprint(list) != fmt.Sprint(expected) {
+		t.Errorf("Citing() = %v", list)
+		t.Errorf("Output should be: %v", expected)
+	}
+
+	if _, err := Citing("10.1000/unknown"); !errors.Is(err, apperror.ErrUpstreamUnavailable) {
+		t.Errorf("Citing(unknown) = %v, should return upstream error", err)
+	}
+
+	CitationsURL = ""
+	if list, err := Citing("10.1145/2854146"); err != nil || len(list) != 0 {
+		t.Errorf("Citing() with disabled service = %v, %v", list, err)
+	}
+}
+
+func Test_Works(t *testing.T) {
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		w.Write([]byte(`{"message": {"items": [{"DOI": "10.1000/new", "title": ["New work"]}]}}`))
+	}))
+	defer server.Close()
+	ServiceURL = server.URL
+	defer func() { ServiceURL = DefaultURL }()
+
+	since := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query WorksQuery
+		url   string
+	}{
+		{
+			WorksQuery{ISSN: "0028-0836", Since: since, Rows: 20},
+			"/journals/0028-0836/works?filter=from-created-date%3A2020-05-01&order=desc&rows=20&sort=created",
+		},
+		{
+			WorksQuery{ORCID: "0000-0002-1825-0097", Since: since, Rows: 20},
+			"/works?filter=from-created-date%3A2020-05-01%2Corcid%3A0000-0002-1825-0097&order=desc&rows=20&sort=created",
+		},
+		{
+			WorksQuery{Text: "gravitational waves", Rows: 10},
+			"/works?query.bibliographic=gravitational+waves&rows=10",
+		},
+	}
+	for i, test := range tests {
+		works, err := Works(test.query)
+		if err != nil || len(works) != 1 || works[0].Doi != "10.1000/new" {
+			t.Errorf("Works(%+v) = %+v, %v", test.query, works, err)
+		}
+		if queries[i] != test.url {
+			t.Errorf("Works(%+v) requested %v", test.query, queries[i])
+			t.Errorf("Output should be: %v", test.url)
+		}
+	}
+}
+
+func Test_Cite(t *testing.T) {
+	tests := []struct {
+		work     Work
+		citation string
+	}{
+		{
+			Work{Doi: "10.1145/2854146", Title: "Why Google stores billions of lines of code in a single repository",
+				Authors: []string{"Rachel Potvin", "Josh Levenberg"}, Journal: "Communications of the ACM",
+				Year: 2016, Volume: "59", Issue: "7", Pages: "78-87"},
+			"Potvin, R., & Levenberg, J. (2016). Why Google stores billions of lines of code in a single repository. Communications of the ACM, 59(7), 78-87. https://doi.org/10.1145/2854146",
+		},
+		{
+			Work{Doi: "10.1000/a", Title: "Bees.", Authors: []string{"Ana Marija Novak", "B C", "D E", "F G"}, Year: 2020},
+			"Novak, A. M., C, B., E, D., et al. (2020). Bees. https://doi.org/10.1000/a",
+		},
+		{
+			Work{Title: "Report", Authors: []string{"LIGO"}, Journal: "Nature", Pages: "1-2"},
+			"LIGO (n.d.). Report. Nature, 1-2.",
+		},
+	}
+	for _, test := range tests {
+		if citation := test.work.Cite(); citation != test.citation {
+			t.Errorf("Cite(%+v) = %v", test.work, citation)
+			t.Errorf("Output should be: %v", test.citation)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package opds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/greatdanton/goScience/library"
+)
+
+// Content types of OPDS 1.2 catalog documents
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchType  = "application/opensearchdescription+xml"
+)
+
+// Link relations used by the catalog
+const (
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelSubsection  = "subsection"
+	RelSearch      = "search"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelNew         = "http://opds-spec.org/sort/new"
+)
+
+// Feed is Atom feed of OPDS catalog
+type Feed struct {
+	XMLName xml.Name  `xml:"feed"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	XmlnsDC string    `xml:"xmlns:dc,attr"`
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated time.Time `xml:"updated"`
+	Author  *Author   `xml:"author,omitempty"`
+	Links   []Link    `xml:"link"`
+	Entries []Entry   `xml:"entry"`
+}
+
+// Entry is navigation entry (link to other feed) or publication with
+// acquisition links
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    time.Time  `xml:"updated"`
+	Authors    []Author   `xml:"author"`
+	Identifier string     `xml:"dc:identifier,omitempty"`
+	Issued     string     `xml:"dc:issued,omitempty"`
+	Publisher  string     `xml:"dc:publisher,omitempty"`
+	Categories []Category `xml:"category"`
+	Summary    *Text      `xml:"summary,omitempty"`
+	Content    *Text      `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+// Author of feed or publication
+type Author struct {
+	Name string `xml:"name"`
+}
+
+// Category is publication tag
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// Text is Atom text construct
+type Text struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Link is Atom link
+type Link struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+// NewFeed creates feed with the self and start links set
+func NewFeed(id, title, self, kind string, updated time.Time) *Feed {
+	return &Feed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		XmlnsDC: "http://purl.org/dc/terms/",
+		ID:      id,
+		Title:   title,
+		Updated: updated.UTC(),
+		Author:  &Author{Name: "GoScience"},
+		Links: []Link{
+			{Rel: RelSelf, Href: self, Type: kind},
+			{Rel: RelStart, Href: Root, Type: NavigationType},
+		},
+	}
+}
+
+// Root is path of the catalog root
+const Root = "/opds"
+
+// Navigation adds navigation entry linking to another feed
+func (f *Feed) Navigation(id, title, summary, href, kind string) {
+	e := Entry{
+		ID:      id,
+		Title:   title,
+		Updated: f.Updated,
+		Links:   []Link{{Rel: RelSubsection, Href: href, Type: kind}},
+	}
+	if len(summary) > 0 {
+		e.Content = &Text{Type: "text", Body: summary}
+	}
+	f.Entries = append(f.Entries, e)
+}
+
+// Publication adds library article with acquisition link to the pdf
+func (f *Feed) Publication(item library.Item, href string) {
+	e := Entry{
+		ID:         "urn:goscience:" + item.ID,
+		Title:      item.Title,
+		Updated:    item.Added.UTC(),
+		Publisher:  item.Journal,
+		Links:      []Link{{Rel: RelAcquisition, Href: href, Type: "application/pdf"}},
+		Categories: []Category{},
+	}
+	if len(item.Doi) > 0 {
+		e.Identifier = "doi:" + item.Doi
+	}
+	if item.Year > 0 {
+		e.Issued = fmt.Sprint(item.Year)
+	}
+	for _, author := range item.Authors {
+		e.Authors = append(e.Authors, Author{Name: author})
+	}
+	for _, tag := range item.Tags {
+		e.Categories = append(e.Categories, Category{Term: tag, Label: tag})
+	}
+	if len(item.Abstract) > 0 {
+		e.Summary = &Text{Type: "text", Body: item.Abstract}
+	}
+	f.Entries = append(f.Entries, e)
+}
+
+// Write writes feed as xml document
+func (f *Feed) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(f)
+}
+
+// OpenSearch is OpenSearch description document, which tells the reader
+// how to build search urls
+type OpenSearch struct {
+	XMLName     xml.Name `xml:"OpenSearchDescription"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	ShortName   string   `xml:"ShortName"`
+	Description string   `xml:"Description"`
+	URL         struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+// NewOpenSearch creates description for search url template, ex.
+// "/opds/search?q={searchTerms}"
+func NewOpenSearch(template string) *OpenSearch {
+	s := &OpenSearch{
+		Xmlns:       "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:   "GoScience",
+		Description: "Search articles in the library",
+	}
+	s.URL.Type = AcquisitionType
+	s.URL.Template = template
+	return s
+}
+
+// Write writes description as xml document
+func (s *OpenSearch) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(s)
+}
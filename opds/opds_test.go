@@ -0,0 +1,62 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greatdanton/goScience/library"
+)
+
+func Test_Feed(t *testing.T) {
+	updated := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := NewFeed("urn:goscience:ana:recent", "Recently added", "/opds/recent", AcquisitionType, updated)
+	f.Navigation("urn:goscience:ana:tags", "Tags", "Articles by tag", "/opds/tags", NavigationType)
+	f.Publication(library.Item{
+		ID:       "4d718a0a89634e64",
+		Doi:      "10.1145/2854146",
+		Title:    "Why Google stores billions of lines of code <in a single repository>",
+		Authors:  []string{"Rachel Potvin", "Josh Levenberg"},
+		Journal:  "Communications of the ACM",
+		Year:     2016,
+		Tags:     []string{"engineering"},
+		Abstract: "Early Google employees & a shared codebase",
+		Added:    updated,
+	}, "/opds/download/4d718a0a89634e64/Potvin.pdf")
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, str := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/terms/">`,
+		`<link rel="self" href="/opds/recent" type="application/atom+xml;profile=opds-catalog;kind=acquisition"></link>`,
+		`<link rel="start" href="/opds" type="application/atom+xml;profile=opds-catalog;kind=navigation"></link>`,
+		`<link rel="subsection" href="/opds/tags" type="application/atom+xml;profile=opds-catalog;kind=navigation"></link>`,
+		`<title>Why Google stores billions of lines of code &lt;in a single repository&gt;</title>`,
+		`<dc:identifier>doi:10.1145/2854146</dc:identifier>`,
+		`<dc:issued>2016</dc:issued>`,
+		`<name>Josh Levenberg</name>`,
+		`<category term="engineering" label="engineering"></category>`,
+		`<summary type="text">Early Google employees &amp; a shared codebase</summary>`,
+		`<link rel="http://opds-spec.org/acquisition" href="/opds/download/4d718a0a89634e64/Potvin.pdf" type="application/pdf"></link>`,
+		`<updated>2020-05-01T12:00:00Z</updated>`,
+	} {
+		if !strings.Contains(out, str) {
+			t.Errorf("feed does not contain %v:\n%v", str, out)
+		}
+	}
+
+	// feed is well formed xml
+	parsed := struct {
+		Entries []struct {
+			Title string `xml:"title"`
+		} `xml:"entry"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil || len(parsed.Entries) != 2 {
+		t.Errorf("xml.Unmarshal() = %v, %+v", err, parsed)
+	}
+}
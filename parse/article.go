@@ -7,19 +7,18 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/greatdanton/goScience/apperror"
 	"github.com/greatdanton/goScience/global"
+	"github.com/greatdanton/goScience/metadata"
+	"github.com/greatdanton/goScience/pdf"
 )
 
 // ErrCaptchaPresent should be returned when the scihub servers return captcha
 // instead of desired pdf
-var ErrCaptchaPresent = errors.New("Scihub servers returned captcha, try again later")
-
-// ErrGeneric is used when reporting error is necessary, but you don't want
-// to expose app internals to the end user
-var ErrGeneric = errors.New("GoScience: Internal application error, try again later")
+var ErrCaptchaPresent = apperror.New(apperror.CaptchaRequired, "Scihub servers returned captcha")
 
 // ErrArticleDoesNotExist should be returned when the article does not exist
-var ErrArticleDoesNotExist = errors.New("Article with this doi does not exist")
+var ErrArticleDoesNotExist = apperror.New(apperror.NotFound, "Article with this doi does not exist")
 
 // Article struct represents pdf article that will be fetched
 // from scihub servers.
@@ -27,32 +26,68 @@ type Article struct {
 	URL       string
 	Doi       string
 	Name      string
+	Source    string // scihub mirror the article was fetched from
 	PdfStream []byte
-	Captcha   Captcha
+	SHA256    string     // hex encoded checksum of PdfStream
+	Integrity pdf.Report // results of pdf integrity validation
+	// active content removed from the pdf when sanitization is enabled
+	Sanitization pdf.SanitizeReport
+	ScanResult   string // antivirus scan result, empty when scanning is disabled
+	// bibliographic metadata, nil until it is looked up
+	Metadata         *metadata.Work
+	MetadataEmbedded bool // metadata was written into PdfStream
+	Captcha          Captcha
 }
 
 // GetPdf will fetch the article from the Scihub servers and report an error
-// if something goes wrong
+// if something goes wrong. Mirrors are tried in order as long as the errors
+// are retryable (server is not available, returned pdf is broken).
 func (a *Article) GetPdf(doi string) error {
 	err := a.parseDoiNumber(doi)
 	if err != nil {
-		fmt.Println(err)
-		return fmt.Errorf("Please check if doi string is correct")
+		return apperror.Wrap(apperror.InvalidInput, err, "Could not parse doi")
+	}
+
+	for _, source := range sources() {
+		err = a.fetchFrom(source)
+		recordSource(source, err)
+		if err == nil || !apperror.IsRetryable(err) {
+			return err
+		}
+		fmt.Printf("%v: %v, trying next source\n", source, err)
+	}
+	return err
+}
+
+// sources returns main scihub url followed by mirrors without duplicates
+func sources() []string {
+	list := []string{}
+	seen := map[string]bool{}
+	for _, source := range append([]string{global.ScihubURL}, global.ScihubMirrors...) {
+		if len(source) == 0 || seen[source] {
+			continue
+		}
+		seen[source] = true
+		list = append(list, source)
 	}
+	return list
+}
 
-	url := fmt.Sprintf("%v%s", global.ScihubURL, a.Doi)
+// fetchFrom fetches article page and article pdf from a single source
+func (a *Article) fetchFrom(source string) error {
+	a.Source = source
+	url := fmt.Sprintf("%v%s", source, a.Doi)
 	htmlString, err := getHTMLStr(url)
 	if err != nil {
-		fmt.Println(err)
-		return fmt.Errorf("Scihub servers are not available")
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not fetch article page")
 	}
 
 	err = a.parseArticleURL(htmlString)
 	if err != nil {
-		if err == ErrArticleDoesNotExist {
+		if errors.Is(err, ErrArticleDoesNotExist) {
 			return err
 		}
-		return fmt.Errorf("Scihub changed their website again, please inform developer to fix this issue")
+		return apperror.Wrap(apperror.UpstreamLayoutChanged, err, "Could not parse article page")
 	}
 
 	a.parseName()
@@ -96,40 +131,31 @@ func (a *Article) parseArticleURL(htmlString string) error {
 	// - special doi page
 	// - article not found string
 	// - main page
-	// Here we check whether or not the article with our desired DOI exist.
-	// This string checking is awful, but unfortunately their servers are returning
-	// http status code 200 no matter what, so we have to rely on string comparisons here
-	if len(htmlString) == 0 || strings.Index(htmlString, "article not found") > -1 || strings.Index(htmlString, "DOI Not Found") > -1 || strings.Index(htmlString, `id="input"`) > -1 {
+	// Their servers are returning http status code 200 no matter what, so we
+	// have to rely on NotFound rules from the rules file here
+	if len(strings.TrimSpace(htmlString)) == 0 {
 		return ErrArticleDoesNotExist
 	}
 
-	// In case the Scihub website changes again, the problem will be most likely
-	// in the starting tag
-	startingTag := "iframe"
-	htmlTagStart := strings.Index(htmlString, startingTag)
-	// if htmlTag with id does not exist return error.
-	// Currently this is true, but this part should be rewritten
-	// in case they decide to change their captcha implementation
-	if htmlTagStart == -1 {
-		return fmt.Errorf("'%v' does not exist in provided html string", startingTag)
+	doc, err := parseHTML(htmlString)
+	if err != nil {
+		return fmt.Errorf("Could not parse html: %v", err)
 	}
-	html := htmlString[htmlTagStart:]
-
-	// get index of link starting
-	startLink := strings.Index(html, "http")
-	if startLink == -1 {
-		return fmt.Errorf("`startLink` could not be found in provided html")
+	if _, found := find(doc, rules.NotFound); found {
+		return ErrArticleDoesNotExist
 	}
 
-	// get index of link ending (the link always ends with .pdf)
-	endLink := strings.Index(html[startLink:], `.pdf`) + len(".pdf")
-	if endLink == -1 {
-		return fmt.Errorf("`endLink` could not be found in provided html string")
+	// In case the Scihub website changes again, PdfLink rules in the rules
+	// file have to be updated
+	link, found := find(doc, rules.PdfLink)
+	if !found {
+		return fmt.Errorf("pdf link could not be found in provided html")
 	}
-
-	// htmlString stays the same all the time that's why we are parsing it via [start:start+end]
-	articleURL := html[startLink : startLink+endLink]
-	a.URL = articleURL
+	base := a.Source
+	if len(base) == 0 {
+		base = global.ScihubURL
+	}
+	a.URL = resolveURL(base, link)
 	return nil
 }
 
@@ -144,19 +170,20 @@ func (a *Article) parseName() {
 // fetchPdf creates a get request on scihub servers and fetches the pdf bytes
 // or returns an error if anything goes wrong (such as scihub displaying captcha)
 func (a *Article) fetchPdf() error {
-	pdfResp, err := http.Get(a.URL)
+	pdfResp, err := global.HTTPClient.Get(a.URL)
 	if err != nil {
-		fmt.Println(err)
-		return ErrGeneric
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not fetch pdf")
 	}
 	defer pdfResp.Body.Close()
 
-	// return http status code as error stream
+	// report http status code as an error
 	if pdfResp.StatusCode != http.StatusOK {
-		if pdfResp.StatusCode == http.StatusBadGateway {
-			return fmt.Errorf("Scihub servers are over capacity, try again later")
+		msg := fmt.Sprintf("Scihub server status code: %v", pdfResp.Status)
+		if pdfResp.StatusCode == http.StatusNotFound {
+			return apperror.New(apperror.NotFound, msg)
 		}
-		return fmt.Errorf("Scihub server status code: %v", pdfResp.Status)
+		// 502 means scihub servers are over capacity
+		return apperror.New(apperror.UpstreamUnavailable, msg)
 	}
 
 	// Captcha check: if captcha is present on scihub (Content-Type in headers
@@ -165,14 +192,13 @@ func (a *Article) fetchPdf() error {
 	if strings.Contains(content, "text/html") {
 		html, err := ioutil.ReadAll(pdfResp.Body)
 		if err != nil {
-			fmt.Println(err)
-			return ErrGeneric
+			return apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not read captcha page")
 		}
 		captcha := Captcha{ArticleDoi: a.Doi, ArticleURL: a.URL}
 		// download captcha details
 		err = captcha.Download(string(html))
 		if err != nil {
-			return err
+			return apperror.Wrap(apperror.UpstreamLayoutChanged, err, "Could not download captcha")
 		}
 		a.Captcha = captcha // embed captcha inside article struct
 		// return error about captcha being present so the outer layer can detect
@@ -180,19 +206,28 @@ func (a *Article) fetchPdf() error {
 		return ErrCaptchaPresent
 	}
 
-	// everything is allright, we got the pdf byte stream, return it
-	pdf, err := ioutil.ReadAll(pdfResp.Body)
+	// we got the pdf byte stream, make sure it is not broken before using it
+	pdf, err := readPdf(pdfResp.Body)
 	if err != nil {
-		fmt.Println(err)
-		return ErrGeneric
+		return err
 	}
 	a.PdfStream = pdf
+	if err := a.validatePdf(); err != nil {
+		return err
+	}
+	if err := a.sanitizePdf(); err != nil {
+		return err
+	}
+	if err := a.scanPdf(); err != nil {
+		return err
+	}
+	a.embedMetadata()
 	return nil
 }
 
 // getHTMLStr fetches url and returns html string of website
 func getHTMLStr(url string) (string, error) {
-	resp, err := http.Get(url)
+	resp, err := global.HTTPClient.Get(url)
 	if err != nil {
 		return "", err
 	}
@@ -1,6 +1,19 @@
 package parse
 
-import "testing"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/global"
+)
 
 // testing parseDoiNumber function for parsing doi numbers out of url string
 func Test_parseDoiNumber(t *testing.T) {
@@ -88,3 +101,87 @@ func Test_parsePdfName(t *testing.T) {
 		}
 	}
 }
+
+// Test_GetPdfMirrors checks that broken pdf and unavailable servers are
+// skipped in favor of the next mirror
+func Test_GetPdfMirrors(t *testing.T) {
+	article, err := ioutil.ReadFile("testdata/article.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mirror serving article page that links to the pdf served with body
+	mirror := func(body []byte) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".pdf") {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Write(body)
+				return
+			}
+			fmt.Fprint(w, `<html><body><iframe id="pdf" src="/files/jiang2010.pdf#view=FitH"></iframe></body></html>`)
+		}))
+	}
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	broken := mirror(article[:len(article)/2])
+	working := mirror(article)
+	defer down.Close()
+	defer broken.Close()
+	defer working.Close()
+
+	global.ScihubURL = down.URL + "/"
+	global.ScihubMirrors = []string{broken.URL + "/", working.URL + "/"}
+	defer func() { global.ScihubURL, global.ScihubMirrors = "", nil }()
+
+	a := Article{}
+	if err := a.GetPdf("10.1080/09500340.2010.500105"); err != nil {
+		t.Fatalf("GetPdf() returned error: %v", err)
+	}
+	sum := sha256.Sum256(article)
+	if a.Source != working.URL+"/" || a.Name != "jiang2010.pdf" || a.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("GetPdf() = source %v, name %v, sha256 %v", a.Source, a.Name, a.SHA256)
+	}
+
+	// all mirrors broken, the last error is reported
+	global.ScihubMirrors = []string{broken.URL + "/"}
+	a = Article{}
+	err = a.GetPdf("10.1080/09500340.2010.500105")
+	if !errors.Is(err, apperror.ErrUpstreamUnavailable) || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("GetPdf() = %v, should report broken pdf", err)
+	}
+}
+
+func Test_recordSource(t *testing.T) {
+	reported := []string{}
+	SourceUnhealthy = func(source string, failures int, err error) { reported = append(reported, source) }
+	defer func() { SourceUnhealthy = nil }()
+
+	down := apperror.New(apperror.UpstreamUnavailable, "down")
+	tests := []struct {
+		source   string
+		err      error
+		reported int
+	}{
+		{"a", down, 0},
+		{"a", down, 0},
+		{"a", ErrArticleDoesNotExist, 0}, // source responded, failures start over
+		{"a", down, 0},
+		{"a", down, 0},
+		{"b", down, 0},
+		{"a", down, 1},
+		{"a", down, 1}, // reported once until the source recovers
+		{"a", nil, 1},
+		{"a", ErrCaptchaPresent, 1},
+		{"a", down, 1},
+		{"a", down, 1},
+		{"a", down, 2},
+	}
+	for i, test := range tests {
+		recordSource(test.source, test.err)
+		if len(reported) != test.reported {
+			t.Errorf("recordSource(%v, %v) #%v reported %v", test.source, test.err, i, reported)
+			t.Errorf("Output should be: %v reports", test.reported)
+		}
+	}
+}
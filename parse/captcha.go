@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+
+	"github.com/greatdanton/goScience/global"
 )
 
 // Captcha struct holds captcha fields and provides convinient api for gathering
@@ -27,9 +30,11 @@ func (c *Captcha) Download(captchaHTML string) error {
 		return err
 	}
 
-	err = c.getCaptchaID()
-	if err != nil {
-		return err
+	if len(c.ID) == 0 {
+		err = c.getCaptchaID()
+		if err != nil {
+			return err
+		}
 	}
 
 	// fetch captcha image and turn it into base64 string
@@ -43,24 +48,24 @@ func (c *Captcha) Download(captchaHTML string) error {
 // getCaptchaURL creates captcha url from provided captcha html and
 // article url. Parsed captcha url is used to download captcha image
 func (c *Captcha) getCaptchaURL(captchaHTML string) error {
-	arr := strings.Split(c.ArticleURL, "/")
-	baseURL := fmt.Sprintf("%s%s//%s", arr[0], arr[1], arr[2])
+	doc, err := parseHTML(captchaHTML)
+	if err != nil {
+		return fmt.Errorf("Could not parse captcha html: %v", err)
+	}
 
-	html := captchaHTML
-	imgTagStart := strings.Index(html, "captcha")
-	if imgTagStart < 0 {
+	// captcha image url is usually relative "/img/captcha_number.jpg"
+	link, found := find(doc, rules.Captcha.Image)
+	if !found {
 		return fmt.Errorf("Could not parse captcha image from scihub server")
 	}
-	html = html[imgTagStart:]
+	// create full captcha url: "http://dacemirror.scihub.org/img/captcha_number.jpg"
+	c.URL = resolveURL(c.ArticleURL, link)
 
-	// parse captcha relative url "/img/captcha_number.jpg"
-	start := strings.Index(html, "src")
-	html = html[start+len(`src="`):] // "/img/number.jpg"+...some more html"
-	end := strings.Index(html, `"`)
-	captchaRelativeURL := html[:end] // "/img/number.jpg"
-	// create full captcha url
-	captchaURL := baseURL + captchaRelativeURL // "http://dacemirror.scihub.org/img/captcha_number.jpg"
-	c.URL = captchaURL
+	// captcha id is usually stored in hidden form field, otherwise it is
+	// parsed from captcha url in getCaptchaID
+	if id, found := find(doc, rules.Captcha.ID); found {
+		c.ID = id
+	}
 	return nil
 }
 
@@ -80,10 +85,19 @@ func (c *Captcha) getCaptchaID() error {
 	return nil
 }
 
+// Form returns form values with user answer that have to be posted back
+// to scihub servers, named according to the captcha rules
+func (c *Captcha) Form(answer string) url.Values {
+	return url.Values{
+		rules.Captcha.AnswerField: {answer},
+		rules.Captcha.IDField:     {c.ID},
+	}
+}
+
 // getImage fetches captcha image from Captcha.URL and turns it into
 // base64 string for embedding into html template
 func (c *Captcha) getImage() error {
-	resp, err := http.Get(c.URL)
+	resp, err := global.HTTPClient.Get(c.URL)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,43 @@
+package parse
+
+import (
+	"sync"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// unhealthyAfter is number of failures in a row after which the source is
+// reported unhealthy
+const unhealthyAfter = 3
+
+// SourceUnhealthy is called when scihub source fails unhealthyAfter times
+// in a row, it is called again only after the source recovers. Set in
+// the main function.
+var SourceUnhealthy func(source string, failures int, err error)
+
+var health = struct {
+	sync.Mutex
+	failures map[string]int
+}{failures: map[string]int{}}
+
+// recordSource counts failures of the source in a row. Missing articles
+// and captchas mean the source works, only unavailable servers and
+// changed layout count as failures.
+func recordSource(source string, err error) {
+	kind := apperror.KindOf(err)
+	failed := err != nil && (kind == apperror.UpstreamUnavailable || kind == apperror.UpstreamLayoutChanged)
+
+	health.Lock()
+	if !failed {
+		delete(health.failures, source)
+		health.Unlock()
+		return
+	}
+	health.failures[source]++
+	failures := health.failures[source]
+	health.Unlock()
+
+	if failures == unhealthyAfter && SourceUnhealthy != nil {
+		SourceUnhealthy(source, failures, err)
+	}
+}
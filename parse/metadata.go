@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/greatdanton/goScience/metadata"
+	"github.com/greatdanton/goScience/pdf"
+)
+
+// EmbedMetadata enables writing bibliographic metadata (title, authors,
+// doi, journal and year) into fetched pdf files, set in the main function
+var EmbedMetadata bool
+
+// LookupMetadata returns article metadata from the metadata service, the
+// result is kept in the article so it is looked up only once
+func (a *Article) LookupMetadata() (metadata.Work, error) {
+	if a.Metadata != nil {
+		return *a.Metadata, nil
+	}
+	work, err := metadata.Lookup(a.Doi)
+	if err != nil {
+		return metadata.Work{}, err
+	}
+	a.Metadata = &work
+	return work, nil
+}
+
+// embedMetadata writes article metadata into the pdf as incremental
+// update. Failures are only logged, the file is then served as it was
+// fetched.
+func (a *Article) embedMetadata() {
+	if !EmbedMetadata {
+		return
+	}
+	work, err := a.LookupMetadata()
+	if err != nil {
+		fmt.Printf("%v: metadata lookup failed: %v\n", a.Doi, err)
+		return
+	}
+
+	m := pdf.Metadata{
+		Title:   work.Title,
+		Authors: work.Authors,
+		Doi:     a.Doi,
+		Journal: work.Journal,
+		Year:    work.Year,
+	}
+	data, err := pdf.EmbedMetadata(a.PdfStream, m)
+	if err != nil {
+		fmt.Printf("%v: could not embed metadata: %v\n", a.Doi, err)
+		return
+	}
+	a.PdfStream = data
+	sum := sha256.Sum256(data)
+	a.SHA256 = hex.EncodeToString(sum[:])
+	a.MetadataEmbedded = true
+}
@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/greatdanton/goScience/metadata"
+)
+
+func Test_embedMetadata(t *testing.T) {
+	article, err := ioutil.ReadFile("testdata/article.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookups := 0
+	crossref := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if r.URL.EscapedPath() != "/works/10.1080%2F09500340.2010.500105" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","message":{"DOI":"10.1080/09500340.2010.500105","title":["Quantum optics"],
+			"container-title":["Journal of Modern Optics"],"author":[{"given":"Li","family":"Jiang"}],"issued":{"date-parts":[[2010]]}}}`)
+	}))
+	defer crossref.Close()
+	metadata.ServiceURL = crossref.URL
+	EmbedMetadata = true
+	defer func() { metadata.ServiceURL, EmbedMetadata = metadata.DefaultURL, false }()
+
+	tests := []struct {
+		doi      string
+		embedded bool
+	}{
+		{"10.1080/09500340.2010.500105", true},
+		// lookup failure keeps the original file
+		{"10.1000/missing", false},
+	}
+	for _, test := range tests {
+		a := Article{Doi: test.doi, PdfStream: article}
+		a.embedMetadata()
+		if a.MetadataEmbedded != test.embedded || bytes.Contains(a.PdfStream, []byte("Quantum optics")) != test.embedded {
+			t.Errorf("embedMetadata(%v) embedded = %v", test.doi, a.MetadataEmbedded)
+			t.Errorf("Output should be: %v", test.embedded)
+		}
+		if !bytes.HasPrefix(a.PdfStream, article) {
+			t.Errorf("embedMetadata(%v) modified original content", test.doi)
+		}
+
+		// metadata is reused by library saving
+		before := lookups
+		if _, err := a.LookupMetadata(); test.embedded && (err != nil || lookups != before) {
+			t.Errorf("LookupMetadata() = %v, looked up %v times", err, lookups-before)
+		}
+	}
+}
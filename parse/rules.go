@@ -0,0 +1,199 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Rule describes where on the page a value can be found. Rules are read
+// from the rules file, so the Scihub layout changes could be fixed by
+// editing configuration instead of the code.
+type Rule struct {
+	Selector string // css like selector, empty selector matches whole document
+	Attr     string // attribute holding the value, empty means element text
+	Contains string // optional string the value has to contain
+
+	compiled selector
+}
+
+// CaptchaRules describe captcha page and captcha form fields that have to
+// be sent back to scihub servers
+type CaptchaRules struct {
+	Image       []Rule // captcha image url
+	ID          []Rule // captcha id, when missing the id is parsed out of image name
+	IDField     string // name of form field holding captcha id
+	AnswerField string // name of form field holding user answer
+}
+
+// Rules contain all extraction rules used while scraping Scihub pages.
+// Within each list the rules are tried in order and the first match wins.
+type Rules struct {
+	NotFound []Rule // article does not exist if any of the rules matches
+	PdfLink  []Rule // link to the article pdf
+	Captcha  CaptchaRules
+}
+
+// DefaultRules are used when the rules file is not configured
+var DefaultRules = Rules{
+	NotFound: []Rule{
+		{Contains: "article not found"},
+		{Contains: "DOI Not Found"},
+		{Selector: "#input"},
+	},
+	PdfLink: []Rule{
+		{Selector: "iframe#pdf", Attr: "src"},
+		{Selector: "embed#pdf", Attr: "src"},
+		{Selector: "embed[type='application/pdf']", Attr: "src"},
+		{Selector: "iframe", Attr: "src", Contains: ".pdf"},
+		{Selector: "#content a", Attr: "href"},
+	},
+	Captcha: CaptchaRules{
+		Image:       []Rule{{Selector: "img#captcha", Attr: "src"}},
+		ID:          []Rule{{Selector: "input[name=id]", Attr: "value"}},
+		IDField:     "id",
+		AnswerField: "answer",
+	},
+}
+
+// rules currently used for scraping, replaced by LoadRules
+var rules = mustCompile(DefaultRules)
+
+// LoadRules reads extraction rules from json file and starts using them
+// or returns an error if any of the selectors is not valid
+func LoadRules(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Could not read rules file: %v", err)
+	}
+
+	r := Rules{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("Could not parse rules file: %v", err)
+	}
+	if err := r.compile(); err != nil {
+		return err
+	}
+	if len(r.PdfLink) == 0 {
+		return fmt.Errorf("Rules file %v does not contain any PdfLink rule", path)
+	}
+	if len(r.Captcha.IDField) == 0 {
+		r.Captcha.IDField = DefaultRules.Captcha.IDField
+	}
+	if len(r.Captcha.AnswerField) == 0 {
+		r.Captcha.AnswerField = DefaultRules.Captcha.AnswerField
+	}
+	rules = r
+	return nil
+}
+
+// compile compiles all selectors in place
+func (r *Rules) compile() error {
+	lists := [][]Rule{r.NotFound, r.PdfLink, r.Captcha.Image, r.Captcha.ID}
+	for _, list := range lists {
+		for i := range list {
+			if len(list[i].Selector) == 0 {
+				continue
+			}
+			sel, err := compileSelector(list[i].Selector)
+			if err != nil {
+				return err
+			}
+			list[i].compiled = sel
+		}
+	}
+	return nil
+}
+
+func mustCompile(r Rules) Rules {
+	// copy rule slices, so compiling does not touch DefaultRules
+	r.NotFound = append([]Rule{}, r.NotFound...)
+	r.PdfLink = append([]Rule{}, r.PdfLink...)
+	r.Captcha.Image = append([]Rule{}, r.Captcha.Image...)
+	r.Captcha.ID = append([]Rule{}, r.Captcha.ID...)
+	if err := r.compile(); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// find returns the first non empty value matched by any of the rules
+func find(doc *html.Node, list []Rule) (string, bool) {
+	for _, rule := range list {
+		if rule.compiled == nil && len(rule.Contains) == 0 {
+			continue // rule would match any page
+		}
+		nodes := []*html.Node{doc}
+		if rule.compiled != nil {
+			nodes = rule.compiled.findAll(doc)
+		}
+
+		for _, n := range nodes {
+			value := ""
+			if len(rule.Attr) > 0 {
+				value = attr(n, rule.Attr)
+			} else {
+				value = strings.TrimSpace(textContent(n))
+			}
+			if len(rule.Contains) > 0 && !strings.Contains(value, rule.Contains) {
+				continue
+			}
+			// rules without attribute are used as markers (ex. element
+			// exists on the page), so their text may be empty
+			if len(value) == 0 && len(rule.Attr) > 0 {
+				continue
+			}
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// parseHTML parses html string into node tree. Content of iframes is kept as
+// raw text by html parser, so it is parsed separately and attached as
+// iframe children in order to be reachable by selectors.
+func parseHTML(htmlString string) (*html.Node, error) {
+	doc, err := html.Parse(strings.NewReader(htmlString))
+	if err != nil {
+		return nil, err
+	}
+
+	iframes := selector{{{tag: "iframe"}}}.findAll(doc)
+	for _, iframe := range iframes {
+		raw := textContent(iframe)
+		if len(strings.TrimSpace(raw)) == 0 {
+			continue
+		}
+		children, err := html.ParseFragment(strings.NewReader(raw), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+		if err != nil {
+			continue
+		}
+		for iframe.FirstChild != nil {
+			iframe.RemoveChild(iframe.FirstChild)
+		}
+		for _, child := range children {
+			iframe.AppendChild(child)
+		}
+	}
+	return doc, nil
+}
+
+// resolveURL turns relative link found on the page into absolute url and
+// removes fragment (ex. #view=FitH) that is only meaningful to pdf viewers
+func resolveURL(base, link string) string {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	ref.Fragment = ""
+	baseURL, err := url.Parse(base)
+	if err != nil || len(base) == 0 {
+		return ref.String()
+	}
+	return baseURL.ResolveReference(ref).String()
+}
@@ -0,0 +1,124 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/greatdanton/goScience/global"
+)
+
+// expected results of parsing saved page, see testdata/pages/README.md
+type pageExpectation struct {
+	PdfLink      string
+	NotFound     bool
+	ArticleURL   string
+	CaptchaImage string
+	CaptchaID    string
+}
+
+// Test_savedPages parses every saved page with the rules file shipped with
+// GoScience and compares results with page expectations
+func Test_savedPages(t *testing.T) {
+	if err := LoadRules("../rules.json"); err != nil {
+		t.Fatalf("LoadRules() returned error: %v", err)
+	}
+	defer func() { rules = mustCompile(DefaultRules) }()
+	global.ScihubURL = "http://sci-hub.tw/"
+	defer func() { global.ScihubURL = "" }()
+
+	pages, err := filepath.Glob("testdata/pages/*.html")
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("saved pages could not be found: %v", err)
+	}
+
+	for _, page := range pages {
+		html, err := ioutil.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(strings.TrimSuffix(page, ".html") + ".json")
+		if err != nil {
+			t.Fatalf("%v: missing expectations file: %v", page, err)
+		}
+		expected := pageExpectation{}
+		if err := json.Unmarshal(data, &expected); err != nil {
+			t.Fatalf("%v: %v", page, err)
+		}
+
+		if len(expected.CaptchaImage) > 0 {
+			c := Captcha{ArticleURL: expected.ArticleURL}
+			if err := c.getCaptchaURL(string(html)); err != nil {
+				t.Errorf("%v: getCaptchaURL() returned error: %v", page, err)
+			}
+			if c.URL != expected.CaptchaImage || c.ID != expected.CaptchaID {
+				t.Errorf("%v: captcha = %v, %v", page, c.URL, c.ID)
+				t.Errorf("Output should be: %v, %v", expected.CaptchaImage, expected.CaptchaID)
+			}
+			continue
+		}
+
+		a := Article{}
+		err = a.parseArticleURL(string(html))
+		if expected.NotFound {
+			if !errors.Is(err, ErrArticleDoesNotExist) {
+				t.Errorf("%v: parseArticleURL() = %v, should report missing article", page, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: parseArticleURL() returned error: %v", page, err)
+		}
+		if a.URL != expected.PdfLink {
+			t.Errorf("%v: parseArticleURL() = %v", page, a.URL)
+			t.Errorf("Output should be: %v", expected.PdfLink)
+		}
+	}
+}
+
+func Test_compileSelector(t *testing.T) {
+	html := `<div class="menu"><a href="/menu.pdf">menu</a></div>
+	<div id="content" class="article main"><p><a href="/article.pdf">pdf</a></p><a href="/direct.html">direct</a></div>`
+
+	tests := []struct {
+		selector string
+		output   []string
+	}{
+		{"a", []string{"/menu.pdf", "/article.pdf", "/direct.html"}},
+		{"#content a", []string{"/article.pdf", "/direct.html"}},
+		{"#content > a", []string{"/direct.html"}},
+		{"div.article.main a[href$='.pdf']", []string{"/article.pdf"}},
+		{"a[href^=/menu], a[href*=direct]", []string{"/menu.pdf", "/direct.html"}},
+		{"div.missing a", []string{}},
+	}
+
+	doc, err := parseHTML(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		sel, err := compileSelector(test.selector)
+		if err != nil {
+			t.Errorf("compileSelector(%v) returned error: %v", test.selector, err)
+			continue
+		}
+		links := []string{}
+		for _, n := range sel.findAll(doc) {
+			links = append(links, attr(n, "href"))
+		}
+		if strings.Join(links, " ") != strings.Join(test.output, " ") {
+			t.Errorf("%v matched %v", test.selector, links)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+
+	invalid := []string{"", "> a", "a >", "a[href", "div#", "a, "}
+	for _, str := range invalid {
+		if _, err := compileSelector(str); err == nil {
+			t.Errorf("compileSelector(%q) should return an error", str)
+		}
+	}
+}
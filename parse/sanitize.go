@@ -0,0 +1,40 @@
+package parse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/pdf"
+)
+
+// Sanitize enables removal of active content (JavaScript, launch actions,
+// embedded files...) from fetched pdf files, set in the main function
+var Sanitize bool
+
+// sanitizePdf replaces article pdf with sanitized copy and records what
+// was removed. Files that could not be sanitized are not served.
+func (a *Article) sanitizePdf() error {
+	if !Sanitize {
+		return nil
+	}
+
+	cleaned, report, err := pdf.Sanitize(a.PdfStream)
+	if err != nil {
+		a.PdfStream = nil
+		e := apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not sanitize pdf")
+		e.Retryable = true
+		return e
+	}
+	a.Sanitization = report
+	if !report.Changed() {
+		return nil
+	}
+
+	fmt.Printf("%v: removed active content: %v\n", a.Doi, report.Removed)
+	a.PdfStream = cleaned
+	sum := sha256.Sum256(cleaned)
+	a.SHA256 = hex.EncodeToString(sum[:])
+	return nil
+}
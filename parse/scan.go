@@ -0,0 +1,34 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/scan"
+)
+
+// Scanner is antivirus scanner every pdf is streamed to before it is
+// served, nil disables scanning. Set in the main function.
+var Scanner *scan.Scanner
+
+// scanPdf scans article pdf and blocks infected files. Files are not
+// served when the scanner is not reachable.
+func (a *Article) scanPdf() error {
+	if Scanner == nil {
+		return nil
+	}
+
+	result, err := Scanner.Scan(bytes.NewReader(a.PdfStream))
+	if err != nil {
+		a.ScanResult = "error"
+		a.PdfStream = nil
+		return apperror.Wrap(apperror.Internal, err, "Could not scan pdf")
+	}
+	a.ScanResult = result.String()
+	if !result.Clean {
+		a.PdfStream = nil
+		return apperror.New(apperror.Infected, fmt.Sprintf("Antivirus scanner detected %v", result.Signature))
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a small subset of css selectors that is good enough for
+// describing where the interesting parts of Scihub pages are. Supported:
+//   - tag, #id, .class and * (any tag)
+//   - [attr], [attr=value], [attr*=value], [attr^=value], [attr$=value]
+//   - descendant (space) and child (>) combinators
+//   - selector lists separated with comma
+type selector [][]compound
+
+// compound represents one step of selector such as `iframe#pdf[src]`
+type compound struct {
+	tag        string
+	id         string
+	classes    []string
+	attrs      []attrMatch
+	combinator byte // relation to the previous step: ' ' descendant or '>' child
+}
+
+// attrMatch describes attribute condition inside square brackets
+type attrMatch struct {
+	name  string
+	op    string // "", "=", "*=", "^=", "$="
+	value string
+}
+
+// compileSelector parses selector string or returns an error if selector
+// is not written in supported syntax
+func compileSelector(str string) (selector, error) {
+	sel := selector{}
+	for _, part := range strings.Split(str, ",") {
+		steps, err := compileSteps(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %v", str, err)
+		}
+		sel = append(sel, steps)
+	}
+	return sel, nil
+}
+
+// compileSteps parses single selector (without commas) into compound steps
+func compileSteps(str string) ([]compound, error) {
+	if len(str) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	steps := []compound{}
+	combinator := byte(' ')
+	i := 0
+	for i < len(str) {
+		switch str[i] {
+		case ' ', '\t', '\n':
+			i++
+			continue
+		case '>':
+			if len(steps) == 0 {
+				return nil, fmt.Errorf("selector can not start with '>'")
+			}
+			combinator = '>'
+			i++
+			continue
+		}
+
+		step, n, err := compileCompound(str[i:])
+		if err != nil {
+			return nil, err
+		}
+		step.combinator = combinator
+		steps = append(steps, step)
+		combinator = ' '
+		i += n
+	}
+
+	if combinator == '>' {
+		return nil, fmt.Errorf("selector can not end with '>'")
+	}
+	return steps, nil
+}
+
+// compileCompound parses one compound step from the start of str and
+// returns number of consumed bytes
+func compileCompound(str string) (compound, int, error) {
+	c := compound{}
+	i := 0
+	for i < len(str) {
+		ch := str[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '>':
+			if i == 0 {
+				return c, 0, fmt.Errorf("unexpected %q", ch)
+			}
+			return c, i, nil
+		case ch == '*':
+			i++
+		case ch == '#':
+			name, n := readIdent(str[i+1:])
+			if n == 0 {
+				return c, 0, fmt.Errorf("missing id after '#'")
+			}
+			c.id = name
+			i += n + 1
+		case ch == '.':
+			name, n := readIdent(str[i+1:])
+			if n == 0 {
+				return c, 0, fmt.Errorf("missing class after '.'")
+			}
+			c.classes = append(c.classes, name)
+			i += n + 1
+		case ch == '[':
+			end := strings.IndexByte(str[i:], ']')
+			if end == -1 {
+				return c, 0, fmt.Errorf("missing ']'")
+			}
+			attr, err := compileAttr(str[i+1 : i+end])
+			if err != nil {
+				return c, 0, err
+			}
+			c.attrs = append(c.attrs, attr)
+			i += end + 1
+		default:
+			name, n := readIdent(str[i:])
+			if n == 0 || i != 0 {
+				return c, 0, fmt.Errorf("unexpected %q", ch)
+			}
+			c.tag = strings.ToLower(name)
+			i += n
+		}
+	}
+	return c, i, nil
+}
+
+// compileAttr parses content of square brackets, ex. `href$='.pdf'`
+func compileAttr(str string) (attrMatch, error) {
+	for _, op := range []string{"*=", "^=", "$=", "="} {
+		idx := strings.Index(str, op)
+		if idx == -1 {
+			continue
+		}
+		name := strings.TrimSpace(str[:idx])
+		value := strings.Trim(strings.TrimSpace(str[idx+len(op):]), `"'`)
+		if len(name) == 0 {
+			return attrMatch{}, fmt.Errorf("missing attribute name in [%v]", str)
+		}
+		return attrMatch{name: strings.ToLower(name), op: op, value: value}, nil
+	}
+
+	name := strings.TrimSpace(str)
+	if len(name) == 0 {
+		return attrMatch{}, fmt.Errorf("empty attribute selector")
+	}
+	return attrMatch{name: strings.ToLower(name)}, nil
+}
+
+// readIdent reads tag, id, class or attribute name from the start of str
+func readIdent(str string) (string, int) {
+	i := 0
+	for i < len(str) {
+		ch := str[i]
+		if ch == '-' || ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' {
+			i++
+			continue
+		}
+		break
+	}
+	return str[:i], i
+}
+
+// findAll returns all element nodes under root matching the selector in
+// document order
+func (s selector) findAll(root *html.Node) []*html.Node {
+	nodes := []*html.Node{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && s.match(n) {
+			nodes = append(nodes, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return nodes
+}
+
+// match reports whether node matches any of the selectors in the list
+func (s selector) match(n *html.Node) bool {
+	for _, steps := range s {
+		if matchSteps(n, steps) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSteps checks the last step against node and walks up the tree for
+// the remaining steps
+func matchSteps(n *html.Node, steps []compound) bool {
+	last := steps[len(steps)-1]
+	if !last.match(n) {
+		return false
+	}
+	if len(steps) == 1 {
+		return true
+	}
+
+	rest := steps[:len(steps)-1]
+	if last.combinator == '>' {
+		parent := n.Parent
+		return parent != nil && parent.Type == html.ElementNode && matchSteps(parent, rest)
+	}
+	for parent := n.Parent; parent != nil && parent.Type == html.ElementNode; parent = parent.Parent {
+		if matchSteps(parent, rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether element node satisfies compound step
+func (c compound) match(n *html.Node) bool {
+	if len(c.tag) > 0 && c.tag != n.Data {
+		return false
+	}
+	if len(c.id) > 0 && attr(n, "id") != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !hasClass(n, class) {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		value, ok := attrValue(n, a.name)
+		if !ok {
+			return false
+		}
+		switch a.op {
+		case "=":
+			ok = value == a.value
+		case "*=":
+			ok = strings.Contains(value, a.value)
+		case "^=":
+			ok = strings.HasPrefix(value, a.value)
+		case "$=":
+			ok = strings.HasSuffix(value, a.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// attr returns value of attribute or empty string if it does not exist
+func attr(n *html.Node, name string) string {
+	value, _ := attrValue(n, name)
+	return value
+}
+
+// attrValue returns trimmed value of attribute and reports whether the
+// attribute exists
+func attrValue(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val), true
+		}
+	}
+	return "", false
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent returns concatenated text of node and all its children
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		// text inside scripts and styles is never visible to the user
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return b.String()
+}
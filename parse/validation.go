@@ -0,0 +1,77 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/pdf"
+)
+
+// Validation modes
+const (
+	// ValidationReject rejects broken pdf files and tries other sources
+	ValidationReject = "reject"
+	// ValidationFlag serves broken pdf files, but records found problems
+	ValidationFlag = "flag"
+)
+
+// ValidationConfig describes how fetched pdf files are checked before they
+// are served. Sizes are in bytes, zero values fall back to pdf package
+// defaults.
+type ValidationConfig struct {
+	Mode    string
+	MinSize int
+	MaxSize int
+}
+
+// Validation is used for checking every fetched pdf, set in the main function
+var Validation = ValidationConfig{Mode: ValidationReject}
+
+// limits returns size limits with defaults applied
+func (v ValidationConfig) limits() pdf.Limits {
+	limits := pdf.Limits{MinSize: v.MinSize, MaxSize: v.MaxSize}
+	if limits.MinSize <= 0 {
+		limits.MinSize = pdf.DefaultMinSize
+	}
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = pdf.DefaultMaxSize
+	}
+	return limits
+}
+
+// readPdf reads pdf body, but stops as soon as the body exceeds maximal
+// allowed size
+func readPdf(body io.Reader) ([]byte, error) {
+	maxSize := Validation.limits().MaxSize
+	data, err := ioutil.ReadAll(io.LimitReader(body, int64(maxSize)+1))
+	if err != nil {
+		return nil, apperror.Wrap(apperror.UpstreamUnavailable, err, "Could not read pdf")
+	}
+	if len(data) > maxSize {
+		return nil, apperror.New(apperror.TooLarge, fmt.Sprintf("pdf is larger than %d bytes", maxSize))
+	}
+	return data, nil
+}
+
+// validatePdf checks integrity of fetched pdf and records the results with
+// the article. Broken files are reported as retryable error, so other
+// sources are tried, unless validation is in flag mode.
+func (a *Article) validatePdf() error {
+	report := pdf.Validate(a.PdfStream, Validation.limits())
+	a.SHA256 = report.SHA256
+	a.Integrity = report
+	if report.Valid() {
+		return nil
+	}
+
+	if Validation.Mode == ValidationFlag {
+		fmt.Printf("%v: serving pdf with problems: %v\n", a.Doi, report.Err())
+		return nil
+	}
+	a.PdfStream = nil
+	err := apperror.Wrap(apperror.UpstreamUnavailable, report.Err(), "Scihub returned broken pdf")
+	err.Retryable = true
+	return err
+}
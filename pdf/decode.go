@@ -0,0 +1,246 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+// maxDecodedSize protects against decompression bombs
+const maxDecodedSize = 256 << 20
+
+// Decode returns decoded stream content. FlateDecode (with png predictors
+// and tiff predictor for 8 bit components), ASCIIHexDecode and
+// ASCII85Decode filters are supported.
+func (f *File) Decode(s Stream) ([]byte, error) {
+	filters := []Name{}
+	params := []Dict{}
+	switch v := f.Resolve(s.Dict["Filter"]).(type) {
+	case Name:
+		filters = append(filters, v)
+		p, _ := f.Resolve(s.Dict["DecodeParms"]).(Dict)
+		params = append(params, p)
+	case Array:
+		parms, _ := f.Resolve(s.Dict["DecodeParms"]).(Array)
+		for i, item := range v {
+			name, _ := f.Resolve(item).(Name)
+			filters = append(filters, name)
+			var p Dict
+			if i < len(parms) {
+				p, _ = f.Resolve(parms[i]).(Dict)
+			}
+			params = append(params, p)
+		}
+	}
+
+	data := s.Data
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+			if err == nil {
+				data, err = unpredict(data, params[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = hexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", filter, err)
+		}
+	}
+	return data, nil
+}
+
+// Compress returns stream with flate compressed data
+func Compress(dict Dict, data []byte) Stream {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	d := Dict{}
+	for key, value := range dict {
+		d[key] = value
+	}
+	d["Filter"] = Name("FlateDecode")
+	delete(d, "DecodeParms")
+	return Stream{Dict: d, Data: buf.Bytes()}
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := ioutil.ReadAll(&limitedReader{r: r, left: maxDecodedSize})
+	// many pdf writers produce streams without proper checksum, data read
+	// until the error is still usable
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// limitedReader returns an error when more than left bytes are read
+type limitedReader struct {
+	r    interface{ Read([]byte) (int, error) }
+	left int
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		return 0, fmt.Errorf("decoded stream is larger than %d bytes", maxDecodedSize)
+	}
+	if len(p) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= n
+	return n, err
+}
+
+// unpredict reverses png predictors used mostly in xref streams and tiff
+// predictor 2
+func unpredict(data []byte, params Dict) ([]byte, error) {
+	if params == nil || len(data) == 0 {
+		return data, nil
+	}
+	predictor, _ := params.Int("Predictor")
+	if predictor < 10 && predictor != 2 {
+		return data, nil
+	}
+
+	columns, ok := params.Int("Columns")
+	if !ok {
+		columns = 1
+	}
+	colors, ok := params.Int("Colors")
+	if !ok {
+		colors = 1
+	}
+	bits, ok := params.Int("BitsPerComponent")
+	if !ok {
+		bits = 8
+	}
+	if colors < 1 || colors > 32 || (bits != 1 && bits != 2 && bits != 4 && bits != 8 && bits != 16) {
+		return nil, fmt.Errorf("invalid predictor colors or bits per component")
+	}
+	if columns < 1 || columns > int64(len(data))*8 {
+		return nil, fmt.Errorf("invalid predictor columns")
+	}
+	bpp := int((colors*bits + 7) / 8)
+	rowSize := int((columns*colors*bits + 7) / 8)
+	if rowSize > len(data) {
+		return nil, fmt.Errorf("predicted data is shorter than one row")
+	}
+	if predictor == 2 {
+		return untiff(data, rowSize, int(colors), int(bits))
+	}
+
+	out := []byte{}
+	prev := make([]byte, rowSize)
+	for pos := 0; pos+rowSize+1 <= len(data); pos += rowSize + 1 {
+		kind := data[pos]
+		row := append([]byte{}, data[pos+1:pos+1+rowSize]...)
+		for i := range row {
+			left, upLeft := byte(0), byte(0)
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("invalid png predictor %d", kind)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+// untiff reverses tiff predictor 2, each component is stored as
+// difference from the same component of the previous pixel in the row
+func untiff(data []byte, rowSize, colors, bits int) ([]byte, error) {
+	if bits != 8 {
+		return nil, fmt.Errorf("tiff predictor with %d bits per component is not supported", bits)
+	}
+	out := append([]byte{}, data...)
+	for pos := 0; pos < len(out); pos += rowSize {
+		row := out[pos:min(pos+rowSize, len(out))]
+		for i := colors; i < len(row); i++ {
+			row[i] += row[i-colors]
+		}
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func hexDecode(data []byte) ([]byte, error) {
+	clean := []byte{}
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isSpace(c) {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	out := make([]byte, len(clean)/2)
+	_, err := hex.Decode(out, clean)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx != -1 {
+		data = data[:idx]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
@@ -0,0 +1,491 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// File is parsed pdf file. Objects are read lazily from the underlying data
+// on Object call.
+type File struct {
+	Version string // pdf version from the header, ex. "1.7"
+	Trailer Dict   // merged trailer dictionary (the newest entries win)
+
+	data      []byte
+	xref      map[int]xrefEntry
+	startxref int64
+	cache     map[int]Object
+	resolving map[int]bool
+}
+
+// maxWidth is the largest xref stream field width, fields are read into
+// int64
+const maxWidth = 8
+
+// xrefEntry describes where the object is stored
+type xrefEntry struct {
+	offset int64 // offset of uncompressed object
+	gen    int
+	stream int // object stream number for compressed objects
+	index  int // index inside object stream
+	inUse  bool
+}
+
+// Parse reads header, cross reference sections and trailer of the pdf
+// file or returns an error if the file structure is broken
+func Parse(data []byte) (*File, error) {
+	f := &File{
+		data:      data,
+		xref:      map[int]xrefEntry{},
+		Trailer:   Dict{},
+		cache:     map[int]Object{},
+		resolving: map[int]bool{},
+	}
+
+	header := bytes.Index(data[:min(len(data), 1024)], []byte("%PDF-"))
+	if header == -1 {
+		return nil, fmt.Errorf("missing %%PDF- header")
+	}
+	l := lexer{data: data, pos: header + len("%PDF-")}
+	f.Version = l.readWord()
+
+	startxref, err := findStartxref(data)
+	if err != nil {
+		return nil, err
+	}
+	f.startxref = startxref
+
+	// follow /Prev chain from the newest section towards the oldest one
+	seen := map[int64]bool{}
+	offset := startxref
+	for {
+		if seen[offset] {
+			return nil, fmt.Errorf("xref sections form a loop")
+		}
+		seen[offset] = true
+
+		trailer, err := f.readXrefSection(offset)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range trailer {
+			if _, ok := f.Trailer[key]; !ok {
+				f.Trailer[key] = value
+			}
+		}
+
+		// hybrid files keep compressed objects in additional xref stream
+		if stm, ok := trailer.Int("XRefStm"); ok && !seen[stm] {
+			seen[stm] = true
+			if _, err := f.readXrefSection(stm); err != nil {
+				return nil, err
+			}
+		}
+
+		prev, ok := trailer.Int("Prev")
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+
+	delete(f.Trailer, "Prev")
+	delete(f.Trailer, "XRefStm")
+	return f, nil
+}
+
+// findStartxref returns offset written after the last startxref keyword
+func findStartxref(data []byte) (int64, error) {
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	if idx == -1 {
+		return 0, fmt.Errorf("missing startxref")
+	}
+	l := lexer{data: data, pos: idx + len("startxref")}
+	offset, err := l.readInt()
+	if err != nil {
+		return 0, fmt.Errorf("invalid startxref offset")
+	}
+	if offset <= 0 || offset >= int64(len(data)) {
+		return 0, fmt.Errorf("startxref offset %d is out of file bounds", offset)
+	}
+	return offset, nil
+}
+
+// readXrefSection reads xref table or xref stream at offset and returns
+// its trailer dictionary. Entries that are already known are not
+// overwritten, since newer sections are read first.
+func (f *File) readXrefSection(offset int64) (Dict, error) {
+	if offset < 0 || offset >= int64(len(f.data)) {
+		return nil, fmt.Errorf("xref offset %d is out of file bounds", offset)
+	}
+	l := &lexer{data: f.data, pos: int(offset)}
+	if l.readKeyword("xref") {
+		return f.readXrefTable(l)
+	}
+	return f.readXrefStream(offset)
+}
+
+// readXrefTable reads classic xref table, the lexer is positioned after
+// the xref keyword
+func (f *File) readXrefTable(l *lexer) (Dict, error) {
+	for {
+		if l.readKeyword("trailer") {
+			obj, err := l.readObject()
+			if err != nil {
+				return nil, fmt.Errorf("invalid trailer: %v", err)
+			}
+			trailer, ok := obj.(Dict)
+			if !ok {
+				return nil, fmt.Errorf("trailer is not a dictionary")
+			}
+			return trailer, nil
+		}
+
+		start, err := l.readInt()
+		if err != nil {
+			return nil, fmt.Errorf("invalid xref table: %v", err)
+		}
+		count, err := l.readInt()
+		if err != nil {
+			return nil, fmt.Errorf("invalid xref table: %v", err)
+		}
+		for i := int64(0); i < count; i++ {
+			offset, err := l.readInt()
+			if err != nil {
+				return nil, fmt.Errorf("invalid xref entry: %v", err)
+			}
+			gen, err := l.readInt()
+			if err != nil {
+				return nil, fmt.Errorf("invalid xref entry: %v", err)
+			}
+			l.skipSpace()
+			kind := l.readWord()
+			if kind != "n" && kind != "f" {
+				return nil, fmt.Errorf("invalid xref entry type %q", kind)
+			}
+			if kind == "n" && (offset < 0 || offset >= int64(len(f.data))) {
+				return nil, fmt.Errorf("xref entry offset %d is out of file bounds", offset)
+			}
+			num := int(start + i)
+			if _, ok := f.xref[num]; ok {
+				continue
+			}
+			f.xref[num] = xrefEntry{offset: offset, gen: int(gen), inUse: kind == "n"}
+		}
+	}
+}
+
+// readXrefStream reads cross reference stream (pdf 1.5+)
+func (f *File) readXrefStream(offset int64) (Dict, error) {
+	_, obj, err := f.readIndirect(offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xref stream: %v", err)
+	}
+	stream, ok := obj.(Stream)
+	if !ok || stream.Dict.Name("Type") != "XRef" {
+		return nil, fmt.Errorf("xref offset does not point to xref table or stream")
+	}
+	data, err := f.Decode(stream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xref stream: %v", err)
+	}
+
+	widths := []int{}
+	if w, ok := stream.Dict["W"].(Array); ok {
+		for _, item := range w {
+			n, ok := item.(int64)
+			if !ok || n < 0 || n > maxWidth {
+				return nil, fmt.Errorf("invalid xref stream /W entry")
+			}
+			widths = append(widths, int(n))
+		}
+	}
+	if len(widths) != 3 {
+		return nil, fmt.Errorf("invalid xref stream /W entry")
+	}
+	rowSize := widths[0] + widths[1] + widths[2]
+	if rowSize == 0 {
+		return nil, fmt.Errorf("invalid xref stream /W entry")
+	}
+
+	size, _ := stream.Dict.Int("Size")
+	index := []int64{0, size}
+	if arr, ok := stream.Dict["Index"].(Array); ok {
+		index = index[:0]
+		for _, item := range arr {
+			n, _ := item.(int64)
+			index = append(index, n)
+		}
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		for j := int64(0); j < index[i+1]; j++ {
+			if pos+rowSize > len(data) {
+				return nil, fmt.Errorf("xref stream is shorter than declared")
+			}
+			row := data[pos : pos+rowSize]
+			pos += rowSize
+
+			kind := int64(1) // type defaults to 1 when its width is zero
+			if widths[0] > 0 {
+				kind = readField(row[:widths[0]])
+			}
+			field2 := readField(row[widths[0] : widths[0]+widths[1]])
+			field3 := readField(row[widths[0]+widths[1]:])
+
+			num := int(index[i] + j)
+			if _, ok := f.xref[num]; ok {
+				continue
+			}
+			switch kind {
+			case 0:
+				f.xref[num] = xrefEntry{}
+			case 1:
+				if field2 < 0 || field2 >= int64(len(f.data)) {
+					return nil, fmt.Errorf("xref entry offset %d is out of file bounds", field2)
+				}
+				f.xref[num] = xrefEntry{offset: field2, gen: int(field3), inUse: true}
+			case 2:
+				if field2 <= 0 || field3 < 0 || field2 > math.MaxInt32 || field3 > math.MaxInt32 {
+					return nil, fmt.Errorf("invalid compressed xref entry for object %d", num)
+				}
+				f.xref[num] = xrefEntry{stream: int(field2), index: int(field3), inUse: true}
+			}
+		}
+	}
+	return stream.Dict, nil
+}
+
+// readField reads big endian number from xref stream row
+func readField(b []byte) int64 {
+	n := int64(0)
+	for _, c := range b {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+// readIndirect reads "num gen obj ... endobj" at offset
+func (f *File) readIndirect(offset int64) (int, Object, error) {
+	if offset < 0 || offset >= int64(len(f.data)) {
+		return 0, nil, fmt.Errorf("object offset %d is out of file bounds", offset)
+	}
+	l := &lexer{data: f.data, pos: int(offset)}
+	num, err := l.readInt()
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := l.readInt(); err != nil {
+		return 0, nil, err
+	}
+	if !l.readKeyword("obj") {
+		return 0, nil, fmt.Errorf("missing obj keyword at offset %d", offset)
+	}
+	obj, err := l.readObject()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dict, ok := obj.(Dict)
+	if !ok || !l.readKeyword("stream") {
+		return int(num), obj, nil
+	}
+
+	// stream data starts after end of line following the stream keyword
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	length := int64(-1)
+	switch v := dict["Length"].(type) {
+	case int64:
+		length = v
+	case Ref:
+		if n, ok := f.resolveWithoutStreams(v).(int64); ok {
+			length = n
+		}
+	}
+	end := int64(start) + length
+	if length < 0 || length > int64(len(f.data)) || end > int64(len(f.data)) || !bytes.HasPrefix(bytes.TrimLeft(f.data[end:], "\r\n "), []byte("endstream")) {
+		// declared length is wrong, fall back to searching for endstream
+		idx := bytes.Index(f.data[start:], []byte("endstream"))
+		if idx == -1 {
+			return 0, nil, fmt.Errorf("missing endstream for object %d", num)
+		}
+		end = int64(start + idx)
+		// end of line before endstream is not part of the data
+		if end > int64(start) && f.data[end-1] == '\n' {
+			end--
+		}
+		if end > int64(start) && f.data[end-1] == '\r' {
+			end--
+		}
+	}
+	return int(num), Stream{Dict: dict, Data: f.data[start:end]}, nil
+}
+
+// resolveWithoutStreams resolves reference to simple object such as
+// stream length
+func (f *File) resolveWithoutStreams(ref Ref) Object {
+	entry, ok := f.xref[ref.Num]
+	if !ok || !entry.inUse || entry.stream != 0 {
+		obj, _ := f.Object(ref.Num)
+		return obj
+	}
+	if entry.offset < 0 || entry.offset >= int64(len(f.data)) {
+		return nil
+	}
+	l := &lexer{data: f.data, pos: int(entry.offset)}
+	if _, err := l.readInt(); err != nil {
+		return nil
+	}
+	if _, err := l.readInt(); err != nil {
+		return nil
+	}
+	if !l.readKeyword("obj") {
+		return nil
+	}
+	obj, _ := l.readObject()
+	return obj
+}
+
+// Object returns object with provided number or an error if the object
+// could not be read. Free and missing objects are returned as nil (null).
+func (f *File) Object(num int) (Object, error) {
+	if obj, ok := f.cache[num]; ok {
+		return obj, nil
+	}
+	entry, ok := f.xref[num]
+	if !ok || !entry.inUse {
+		return nil, nil
+	}
+	if f.resolving[num] {
+		return nil, fmt.Errorf("object %d references itself", num)
+	}
+	if len(f.resolving) >= maxDepth {
+		return nil, fmt.Errorf("object %d is nested too deeply", num)
+	}
+	f.resolving[num] = true
+	defer delete(f.resolving, num)
+
+	var obj Object
+	var err error
+	if entry.stream != 0 {
+		obj, err = f.readCompressed(entry.stream, entry.index)
+	} else {
+		var n int
+		n, obj, err = f.readIndirect(entry.offset)
+		if err == nil && n != num {
+			err = fmt.Errorf("xref entry for object %d points to object %d", num, n)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object %d: %v", num, err)
+	}
+	f.cache[num] = obj
+	return obj, nil
+}
+
+// readCompressed reads object stored inside object stream
+func (f *File) readCompressed(streamNum, index int) (Object, error) {
+	// object streams can not be stored in other object streams
+	if entry := f.xref[streamNum]; entry.stream != 0 {
+		return nil, fmt.Errorf("object stream %d is compressed", streamNum)
+	}
+	obj, err := f.Object(streamNum)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(Stream)
+	if !ok || stream.Dict.Name("Type") != "ObjStm" {
+		return nil, fmt.Errorf("object %d is not an object stream", streamNum)
+	}
+	data, err := f.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := stream.Dict.Int("N")
+	first, _ := stream.Dict.Int("First")
+	if index >= int(n) || first < 0 || first > int64(len(data)) {
+		return nil, fmt.Errorf("object stream %d is too short", streamNum)
+	}
+
+	// header contains pairs of object number and offset relative to First
+	l := &lexer{data: data}
+	offset := int64(-1)
+	for i := 0; i <= index; i++ {
+		if _, err := l.readInt(); err != nil {
+			return nil, err
+		}
+		if offset, err = l.readInt(); err != nil {
+			return nil, err
+		}
+	}
+	if offset < 0 || offset >= int64(len(data)) || first+offset >= int64(len(data)) {
+		return nil, fmt.Errorf("object stream %d offset out of bounds", streamNum)
+	}
+	l.pos = int(first + offset)
+	return l.readObject()
+}
+
+// Resolve returns referenced object for references and obj itself for
+// direct objects. Errors are ignored and reported as null object.
+func (f *File) Resolve(obj Object) Object {
+	ref, ok := obj.(Ref)
+	if !ok {
+		return obj
+	}
+	resolved, err := f.Object(ref.Num)
+	if err != nil {
+		return nil
+	}
+	return resolved
+}
+
+// Objects returns numbers of all objects in use
+func (f *File) Objects() []int {
+	nums := []int{}
+	for num, entry := range f.xref {
+		if entry.inUse {
+			nums = append(nums, num)
+		}
+	}
+	return nums
+}
+
+// Size returns the next free object number
+func (f *File) Size() int {
+	size, _ := f.Trailer.Int("Size")
+	for num := range f.xref {
+		if int64(num) >= size {
+			size = int64(num) + 1
+		}
+	}
+	return int(size)
+}
+
+// Catalog returns document catalog (/Root of the trailer)
+func (f *File) Catalog() (Dict, error) {
+	root, ok := f.Resolve(f.Trailer["Root"]).(Dict)
+	if !ok {
+		return nil, fmt.Errorf("trailer does not reference document catalog")
+	}
+	return root, nil
+}
+
+// Data returns raw bytes of the parsed file
+func (f *File) Data() []byte {
+	return f.data
+}
+
+// StartXref returns offset of the newest xref section
+func (f *File) StartXref() int64 {
+	return f.startxref
+}
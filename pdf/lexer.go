@@ -0,0 +1,307 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// maxDepth limits nesting of arrays and dictionaries, and chains of
+// objects resolved through each other, so broken files can not exhaust
+// the stack
+const maxDepth = 256
+
+// lexer reads pdf objects from byte slice
+type lexer struct {
+	data  []byte
+	pos   int
+	depth int // nesting of arrays and dictionaries being read
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips white space and comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// readWord reads regular characters until white space or delimiter
+func (l *lexer) readWord() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// readKeyword reads next word and reports whether it equals keyword
+func (l *lexer) readKeyword(keyword string) bool {
+	l.skipSpace()
+	start := l.pos
+	if l.readWord() == keyword {
+		return true
+	}
+	l.pos = start
+	return false
+}
+
+// readInt reads non negative integer, used while reading xref tables
+func (l *lexer) readInt() (int64, error) {
+	l.skipSpace()
+	start := l.pos
+	word := l.readWord()
+	n, err := strconv.ParseInt(word, 10, 64)
+	if err != nil {
+		l.pos = start
+		return 0, fmt.Errorf("expected integer at offset %d", start)
+	}
+	return n, nil
+}
+
+// readObject reads next direct object. Indirect references (12 0 R) are
+// returned as Ref. Stream objects are handled by the caller, since stream
+// length may be an indirect object.
+func (l *lexer) readObject() (Object, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+
+	c := l.data[l.pos]
+	switch c {
+	case '/':
+		l.pos++
+		return l.readName(), nil
+	case '(':
+		l.pos++
+		return l.readLiteralString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.readDict()
+		}
+		l.pos++
+		return l.readHexString()
+	case '[':
+		l.pos++
+		return l.readArray()
+	case ']', '>', ')', '{', '}':
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, l.pos)
+	}
+
+	start := l.pos
+	word := l.readWord()
+	switch word {
+	case "":
+		l.pos++
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, start)
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		// integer could be the start of indirect reference "num gen R"
+		save := l.pos
+		if gen, err := l.readInt(); err == nil && l.readKeyword("R") {
+			return Ref{Num: int(n), Gen: int(gen)}, nil
+		}
+		l.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return Keyword(word), nil
+}
+
+// readName reads name after the leading slash and decodes #xx escapes
+func (l *lexer) readName() Name {
+	word := l.readWord()
+	if !bytes.ContainsRune([]byte(word), '#') {
+		return Name(word)
+	}
+	out := []byte{}
+	for i := 0; i < len(word); i++ {
+		if word[i] == '#' && i+2 < len(word) {
+			if b, err := strconv.ParseUint(word[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, word[i])
+	}
+	return Name(out)
+}
+
+// readLiteralString reads string in parentheses, nested parentheses are
+// allowed as long as they are balanced
+func (l *lexer) readLiteralString() (Object, error) {
+	out := []byte{}
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(out), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					// up to three octal digits
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, fmt.Errorf("unterminated string")
+}
+
+func (l *lexer) readHexString() (Object, error) {
+	out := []byte{}
+	digits := []byte{}
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			for i := 0; i < len(digits); i += 2 {
+				b, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+				out = append(out, byte(b))
+			}
+			return String(out), nil
+		}
+		if isSpace(c) {
+			continue
+		}
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return nil, fmt.Errorf("invalid hex string character %q", c)
+		}
+		digits = append(digits, c)
+	}
+	return nil, fmt.Errorf("unterminated hex string")
+}
+
+func (l *lexer) readArray() (Object, error) {
+	if l.depth >= maxDepth {
+		return nil, fmt.Errorf("array at offset %d is nested too deeply", l.pos)
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+	arr := Array{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, nil
+		}
+		obj, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *lexer) readDict() (Object, error) {
+	if l.depth >= maxDepth {
+		return nil, fmt.Errorf("dictionary at offset %d is nested too deeply", l.pos)
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+	dict := Dict{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, fmt.Errorf("unterminated dictionary")
+		}
+		if l.data[l.pos] == '>' {
+			if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+				l.pos += 2
+				return dict, nil
+			}
+			return nil, fmt.Errorf("unexpected '>' at offset %d", l.pos)
+		}
+
+		key, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(Name)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key is not a name at offset %d", l.pos)
+		}
+		value, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		dict[name] = value
+	}
+}
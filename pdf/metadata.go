@@ -0,0 +1,167 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Metadata is bibliographic information written into the document
+type Metadata struct {
+	Title   string
+	Authors []string
+	Doi     string
+	Journal string
+	Year    int
+}
+
+// EmbedMetadata writes metadata into document Info dictionary and XMP
+// metadata packet. Changes are appended as incremental update, so the
+// original content stays untouched. Existing Info entries that are not
+// part of metadata are kept, existing XMP packet is replaced.
+func EmbedMetadata(data []byte, m Metadata) ([]byte, error) {
+	f, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	rootRef, ok := f.Trailer["Root"].(Ref)
+	if !ok {
+		return nil, fmt.Errorf("trailer does not reference document catalog")
+	}
+	catalog, err := f.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	// Info dictionary and XMP packet keep their object numbers when they
+	// already exist, otherwise new objects are added
+	next := f.Size()
+	objectNum := func(obj Object) int {
+		if ref, ok := obj.(Ref); ok {
+			return ref.Num
+		}
+		next++
+		return next - 1
+	}
+	infoNum := objectNum(f.Trailer["Info"])
+	xmpNum := objectNum(catalog["Metadata"])
+	now := time.Now()
+
+	info := Dict{}
+	if old, ok := f.Resolve(f.Trailer["Info"]).(Dict); ok {
+		for key, value := range old {
+			info[key] = value
+		}
+	}
+	setText(info, "Title", m.Title)
+	setText(info, "Author", strings.Join(m.Authors, "; "))
+	setText(info, "Subject", subject(m))
+	setText(info, "doi", m.Doi)
+	info["ModDate"] = String(now.UTC().Format("D:20060102150405Z"))
+
+	xmp := Stream{
+		Dict: Dict{"Type": Name("Metadata"), "Subtype": Name("XML")},
+		Data: xmpPacket(m, now),
+	}
+
+	newCatalog := Dict{}
+	for key, value := range catalog {
+		newCatalog[key] = value
+	}
+	newCatalog["Metadata"] = Ref{Num: xmpNum, Gen: f.gen(xmpNum)}
+
+	objects := map[int]Object{
+		rootRef.Num: newCatalog,
+		infoNum:     info,
+		xmpNum:      xmp,
+	}
+	trailer := Dict{"Info": Ref{Num: infoNum, Gen: f.gen(infoNum)}}
+	return f.appendUpdate(objects, trailer), nil
+}
+
+// subject describes where the article was published, ex. "Nature, 2016"
+func subject(m Metadata) string {
+	parts := []string{}
+	if len(m.Journal) > 0 {
+		parts = append(parts, m.Journal)
+	}
+	if m.Year > 0 {
+		parts = append(parts, fmt.Sprint(m.Year))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// setText sets Info entry, empty values do not overwrite existing entries
+func setText(d Dict, key Name, value string) {
+	if len(value) == 0 {
+		return
+	}
+	d[key] = textString(value)
+}
+
+// textString encodes pdf text string, text outside of ASCII is written as
+// UTF-16BE with byte order mark
+func textString(s string) String {
+	ascii := true
+	for _, r := range s {
+		if r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	out := []byte{0xfe, 0xff}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(unit>>8), byte(unit))
+	}
+	return String(out)
+}
+
+// xmpPacket returns XMP metadata with Dublin Core and PRISM properties
+func xmpPacket(m Metadata, now time.Time) []byte {
+	var buf bytes.Buffer
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	buf.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:prism="http://prismstandard.org/namespaces/basic/2.0/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+`)
+	if len(m.Title) > 0 {
+		fmt.Fprintf(&buf, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", esc(m.Title))
+	}
+	if len(m.Authors) > 0 {
+		buf.WriteString("<dc:creator><rdf:Seq>")
+		for _, author := range m.Authors {
+			fmt.Fprintf(&buf, "<rdf:li>%s</rdf:li>", esc(author))
+		}
+		buf.WriteString("</rdf:Seq></dc:creator>\n")
+	}
+	if len(m.Doi) > 0 {
+		fmt.Fprintf(&buf, "<dc:identifier>doi:%s</dc:identifier>\n", esc(m.Doi))
+		fmt.Fprintf(&buf, "<prism:doi>%s</prism:doi>\n", esc(m.Doi))
+		fmt.Fprintf(&buf, "<prism:url>https://doi.org/%s</prism:url>\n", esc(m.Doi))
+	}
+	if len(m.Journal) > 0 {
+		fmt.Fprintf(&buf, "<prism:publicationName>%s</prism:publicationName>\n", esc(m.Journal))
+	}
+	if m.Year > 0 {
+		fmt.Fprintf(&buf, "<dc:date><rdf:Seq><rdf:li>%d</rdf:li></rdf:Seq></dc:date>\n", m.Year)
+		fmt.Fprintf(&buf, "<prism:coverDate>%d</prism:coverDate>\n", m.Year)
+	}
+	fmt.Fprintf(&buf, "<xmp:MetadataDate>%s</xmp:MetadataDate>\n", now.UTC().Format(time.RFC3339))
+	buf.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	// padding allows in place editing by other tools
+	buf.WriteString(strings.Repeat(strings.Repeat(" ", 99)+"\n", 20))
+	buf.WriteString("<?xpacket end=\"w\"?>")
+	return buf.Bytes()
+}
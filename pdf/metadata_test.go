@@ -0,0 +1,75 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_EmbedMetadata(t *testing.T) {
+	withInfo := append(append([]string{}, testObjects...), "<< /Producer (LaTeX) /Title (Old title) >>")
+	infoPDF := bytes.Replace(buildPDF(withInfo), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Info 5 0 R"), 1)
+	m := Metadata{
+		Title:   "Observation of Gravitational Waves",
+		Authors: []string{"B. P. Abbott", "Jürgen Müller"},
+		Doi:     "10.1103/PhysRevLett.116.061102",
+		Journal: "Physical Review Letters",
+		Year:    2016,
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		producer string // existing Info entries are kept
+		text     string // page content is still readable
+	}{
+		{"xref table", buildPDF(testObjects), "", "Hello World"},
+		{"xref stream", buildXrefStreamPDF(testObjects[:3]), "", ""},
+		{"existing info", infoPDF, "LaTeX", "Hello World"},
+	}
+
+	for _, test := range tests {
+		out, err := EmbedMetadata(test.data, m)
+		if err != nil {
+			t.Errorf("%v: EmbedMetadata() returned error: %v", test.name, err)
+			continue
+		}
+		if !bytes.HasPrefix(out, test.data) {
+			t.Errorf("%v: original content was modified", test.name)
+		}
+		if report := Validate(out, Limits{MinSize: 100}); !report.Valid() {
+			t.Errorf("%v: Validate() problems = %v", test.name, report.Problems)
+		}
+
+		f, err := Parse(out)
+		if err != nil {
+			t.Errorf("%v: Parse() returned error: %v", test.name, err)
+			continue
+		}
+		info, _ := f.Resolve(f.Trailer["Info"]).(Dict)
+		if info["Title"] != String(m.Title) || info["doi"] != String(m.Doi) || info["Subject"] != String("Physical Review Letters, 2016") {
+			t.Errorf("%v: Info = %v", test.name, info)
+		}
+		if author, _ := info["Author"].(String); !strings.HasPrefix(string(author), "\xfe\xff") {
+			t.Errorf("%v: non ASCII author should be written as UTF-16: %q", test.name, author)
+		}
+		if producer, _ := info["Producer"].(String); string(producer) != test.producer {
+			t.Errorf("%v: Producer = %q, should be %q", test.name, producer, test.producer)
+		}
+
+		catalog, _ := f.Catalog()
+		xmp, ok := f.Resolve(catalog["Metadata"]).(Stream)
+		if !ok {
+			t.Errorf("%v: catalog does not reference XMP packet: %v", test.name, catalog)
+			continue
+		}
+		for _, str := range []string{"<prism:doi>10.1103/PhysRevLett.116.061102</prism:doi>", "<rdf:li>Jürgen Müller</rdf:li>", "<prism:coverDate>2016</prism:coverDate>"} {
+			if !bytes.Contains(xmp.Data, []byte(str)) {
+				t.Errorf("%v: XMP packet does not contain %v", test.name, str)
+			}
+		}
+		if text, _ := Text(out); text != test.text {
+			t.Errorf("%v: Text() = %q", test.name, text)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Object is any pdf object: nil (null), bool, int64, float64, String,
+// Name, Array, Dict, Stream, Ref or Keyword
+type Object interface{}
+
+// Name is pdf name object without the leading slash, ex. Name("Type")
+type Name string
+
+// String holds raw bytes of literal or hexadecimal pdf string
+type String string
+
+// Keyword is a bare word that is not true, false or null, such as content
+// stream operators
+type Keyword string
+
+// Array is pdf array object
+type Array []Object
+
+// Dict is pdf dictionary object
+type Dict map[Name]Object
+
+// Ref is indirect reference to another object, ex. 12 0 R
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Stream is pdf stream object. Data contains raw (still encoded) stream
+// bytes, use File.Decode to obtain decoded content.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Name returns value of name entry or empty string if the entry is
+// missing or is not a name
+func (d Dict) Name(key Name) Name {
+	n, _ := d[key].(Name)
+	return n
+}
+
+// Int returns value of integer entry, reals are truncated
+func (d Dict) Int(key Name) (int64, bool) {
+	switch v := d[key].(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Write writes object in pdf syntax. Streams are written with their
+// Length updated to the length of Data.
+func Write(buf *bytes.Buffer, obj Object) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		writeName(buf, v)
+	case String:
+		writeString(buf, v)
+	case Keyword:
+		buf.WriteString(string(v))
+	case Ref:
+		fmt.Fprintf(buf, "%d %d R", v.Num, v.Gen)
+	case Array:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			Write(buf, item)
+		}
+		buf.WriteByte(']')
+	case Dict:
+		writeDict(buf, v)
+	case Stream:
+		dict := Dict{}
+		for key, value := range v.Dict {
+			dict[key] = value
+		}
+		dict["Length"] = int64(len(v.Data))
+		writeDict(buf, dict)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.Data)
+		buf.WriteString("\nendstream")
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// writeDict writes dictionary with sorted keys, so the output is stable
+func writeDict(buf *bytes.Buffer, d Dict) {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+
+	buf.WriteString("<<")
+	for _, key := range keys {
+		writeName(buf, Name(key))
+		buf.WriteByte(' ')
+		Write(buf, d[Name(key)])
+	}
+	buf.WriteString(">>")
+}
+
+func writeName(buf *bytes.Buffer, n Name) {
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c <= ' ' || c > '~' || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s String) {
+	buf.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+}
@@ -0,0 +1,266 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// article objects used by test files: catalog, page tree, one page and its
+// content stream
+var testObjects = []string{
+	"<< /Type /Catalog /Pages 2 0 R >>",
+	"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+	"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+	"<< /Length 44 >>\nstream\nBT /F1 12 Tf 72 712 Td (Hello World) Tj ET\nendstream",
+}
+
+// buildPDF creates pdf file with classic xref table from object bodies,
+// object numbers start with 1
+func buildPDF(objects []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := []int{}
+	for i, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// buildXrefStreamPDF stores all objects except the first one inside
+// compressed object stream and references them with flate compressed xref
+// stream that uses png up predictor
+func buildXrefStreamPDF(objects []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+
+	// object stream contains objects 2..n (streams can not be compressed,
+	// so only dictionaries are stored there)
+	var header, body bytes.Buffer
+	compressed := objects[1:]
+	for i, obj := range compressed {
+		fmt.Fprintf(&header, "%d %d ", i+2, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	objStm := deflate(append(header.Bytes(), body.Bytes()...))
+	stmNum := len(objects) + 1
+
+	catalog := buf.Len()
+	fmt.Fprintf(&buf, "1 0 obj\n%s\nendobj\n", objects[0])
+	stmOffset := buf.Len()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n", stmNum, len(compressed), header.Len(), len(objStm))
+	buf.Write(objStm)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	// rows: type (1 byte), offset or stream number (2 bytes), gen or index (1 byte)
+	rows := [][]byte{{0, 0, 0, 255}, {1, byte(catalog >> 8), byte(catalog), 0}}
+	for i := range compressed {
+		rows = append(rows, []byte{2, byte(stmNum >> 8), byte(stmNum), byte(i)})
+	}
+	rows = append(rows, []byte{1, byte(stmOffset >> 8), byte(stmOffset), 0})
+	xrefOffset := buf.Len()
+	rows = append(rows, []byte{1, byte(xrefOffset >> 8), byte(xrefOffset), 0})
+
+	predicted := []byte{}
+	prev := make([]byte, 4)
+	for _, row := range rows {
+		predicted = append(predicted, 2)
+		for i := range row {
+			predicted = append(predicted, row[i]-prev[i])
+		}
+		prev = row
+	}
+	xref := deflate(predicted)
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", stmNum+1, stmNum+2, len(xref))
+	buf.Write(xref)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func Test_Validate(t *testing.T) {
+	valid := buildPDF(testObjects)
+	noPages := buildPDF(append([]string{}, "<< /Type /Catalog >>"))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		valid   bool
+		problem string
+	}{
+		{"xref table", valid, true, ""},
+		{"xref stream", buildXrefStreamPDF(testObjects[:3]), true, ""},
+		{"empty", []byte{}, false, "file is empty"},
+		{"html page", []byte("<!DOCTYPE html><html><body>" + strings.Repeat("captcha ", 20) + "</body></html>"), false, "html"},
+		{"truncated", valid[:len(valid)-30], false, "truncated"},
+		{"broken xref", bytes.Replace(valid, []byte("xref\n0"), []byte("xref\nX"), 1), false, "broken file structure"},
+		{"no pages", noPages, false, "page tree"},
+	}
+
+	for _, test := range tests {
+		report := Validate(test.data, Limits{MinSize: 100})
+		if report.Valid() != test.valid {
+			t.Errorf("%v: Validate() problems = %v", test.name, report.Problems)
+			continue
+		}
+		if !test.valid && !strings.Contains(strings.Join(report.Problems, " "), test.problem) {
+			t.Errorf("%v: Validate() problems = %v", test.name, report.Problems)
+			t.Errorf("Problems should mention: %v", test.problem)
+		}
+		if test.valid && (report.Pages != 1 || len(report.SHA256) != 64) {
+			t.Errorf("%v: Validate() = %+v", test.name, report)
+		}
+	}
+
+	// files with plausible structure are still rejected when they are too small
+	if report := Validate(valid, Limits{}); report.Valid() {
+		t.Errorf("Validate() should reject %d bytes large file with default limits", len(valid))
+	}
+}
+
+func Test_Object(t *testing.T) {
+	for _, data := range [][]byte{buildPDF(testObjects), buildXrefStreamPDF(testObjects[:3])} {
+		f, err := Parse(data)
+		if err != nil {
+			t.Fatalf("Parse() returned error: %v", err)
+		}
+		page, ok := f.Resolve(Ref{Num: 3}).(Dict)
+		if !ok {
+			t.Fatalf("object 3 is not a dictionary: %v", f.Resolve(Ref{Num: 3}))
+		}
+		box, _ := page["MediaBox"].(Array)
+		if page.Name("Type") != "Page" || len(box) != 4 || box[2] != int64(612) {
+			t.Errorf("object 3 = %v", page)
+		}
+		if parent, _ := page["Parent"].(Ref); parent.Num != 2 {
+			t.Errorf("page parent = %v", page["Parent"])
+		}
+	}
+}
+
+func Test_readObject(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string // object written back with Write
+	}{
+		{"<< /Title (Quantum \\(optics\\)\\n) /Count 3 /Kids [1 0 R 2 0 R] >>", "<</Count 3/Kids [1 0 R 2 0 R]/Title (Quantum \\(optics\\)\\n)>>"},
+		{"<48656C6C6F>", "(Hello)"},
+		{"/A#20B", "/A#20B"},
+		{"[1 -2.5 true null /N]", "[1 -2.5 true null /N]"},
+		{"(\\101\\102C)", "(ABC)"},
+	}
+
+	for _, test := range tests {
+		l := lexer{data: []byte(test.input)}
+		obj, err := l.readObject()
+		if err != nil {
+			t.Errorf("readObject(%v) returned error: %v", test.input, err)
+			continue
+		}
+		var buf bytes.Buffer
+		Write(&buf, obj)
+		if buf.String() != test.output {
+			t.Errorf("readObject(%v) = %v", test.input, buf.String())
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
+
+// malformedPDFs are broken files which used to make the parser panic
+func malformedPDFs() map[string][]byte {
+	valid := buildPDF(testObjects)
+	stream := buildXrefStreamPDF(testObjects[:3])
+	offset := bytes.Index(valid, []byte(" 00000 n")) - 10
+	farOffset := append(append(append([]byte{}, valid[:offset]...), "9999999999"...), valid[offset+10:]...)
+	nested := append([]string{}, testObjects...)
+	nested[0] = "<< /Type /Catalog /Pages 2 0 R /Deep " + strings.Repeat("[", 100000) + " >>"
+
+	return map[string][]byte{
+		"negative width":         bytes.Replace(stream, []byte("/W [1 2 1]"), []byte("/W [5 -2 1]"), 1),
+		"too wide field":         bytes.Replace(stream, []byte("/W [1 2 1]"), []byte("/W [9 2 1]"), 1),
+		"offset out of bounds":   farOffset,
+		"negative first":         bytes.Replace(stream, []byte("/First "), []byte("/First -"), 1),
+		"deeply nested catalog":  buildPDF(nested),
+		"deeply nested trailer":  bytes.Replace(valid, []byte("trailer\n<<"), []byte("trailer\n"+strings.Repeat("<< /A ", 100000)), 1),
+		"negative stream length": bytes.Replace(valid, []byte("/Length 44"), []byte("/Length -9223372036854775807"), 1),
+	}
+}
+
+func Test_malformed(t *testing.T) {
+	for name, data := range malformedPDFs() {
+		if report := Validate(data, Limits{MinSize: 100}); report.Valid() {
+			t.Errorf("%v: Validate() = %+v", name, report)
+			t.Errorf("Output should be: invalid file")
+		}
+		// other users of the parser should return errors as well
+		Sanitize(data)
+		Text(data)
+		EmbedMetadata(data, Metadata{Title: "Title"})
+	}
+}
+
+func Test_readObject_depth(t *testing.T) {
+	l := lexer{data: []byte(strings.Repeat("[", maxDepth) + strings.Repeat("]", maxDepth))}
+	if _, err := l.readObject(); err != nil {
+		t.Errorf("readObject() of %d nested arrays returned error: %v", maxDepth, err)
+	}
+	l = lexer{data: []byte(strings.Repeat("[", maxDepth+1) + strings.Repeat("]", maxDepth+1))}
+	if _, err := l.readObject(); err == nil {
+		t.Errorf("readObject() of %d nested arrays should return error", maxDepth+1)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(buildPDF(testObjects))
+	f.Add(buildXrefStreamPDF(testObjects[:3]))
+	for _, data := range malformedPDFs() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Validate(data, Limits{MinSize: 1})
+		Sanitize(data)
+		Text(data)
+		EmbedMetadata(data, Metadata{Title: "Title"})
+	})
+}
+
+func Test_unpredict(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		params Dict
+		output []byte
+		valid  bool
+	}{
+		{[]byte{1, 2, 3}, Dict{"Predictor": int64(1)}, []byte{1, 2, 3}, true},
+		// tiff: two rgb pixels per row, components are differences from the previous pixel
+		{[]byte{10, 20, 30, 1, 2, 3, 5, 5, 5, 255, 0, 1}, Dict{"Predictor": int64(2), "Colors": int64(3), "Columns": int64(2)}, []byte{10, 20, 30, 11, 22, 33, 5, 5, 5, 4, 5, 6}, true},
+		{[]byte{1, 2, 3, 4}, Dict{"Predictor": int64(2), "BitsPerComponent": int64(4), "Columns": int64(8)}, nil, false},
+		// png up: each row adds bytes of the previous row
+		{[]byte{2, 1, 2, 2, 1, 1}, Dict{"Predictor": int64(12), "Columns": int64(2)}, []byte{1, 2, 2, 3}, true},
+		{[]byte{2, 1, 2}, Dict{"Predictor": int64(12), "Columns": int64(-5)}, nil, false},
+		{[]byte{2, 1, 2}, Dict{"Predictor": int64(12), "Colors": int64(-3)}, nil, false},
+	}
+	for _, test := range tests {
+		output, err := unpredict(test.data, test.params)
+		if !bytes.Equal(output, test.output) || (err == nil) != test.valid {
+			t.Errorf("unpredict(%v, %v) = %v, %v", test.data, test.params, output, err)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package pdf
+
+import (
+	"fmt"
+	"sort"
+)
+
+// dangerousActions are action types that run code, open other files or
+// external resources when the document is opened or clicked
+var dangerousActions = map[Name]string{
+	"JavaScript": "JavaScript action",
+	"Launch":     "launch action",
+	"URI":        "external URI action",
+	"GoToR":      "remote go-to action",
+	"GoToE":      "embedded go-to action",
+	"SubmitForm": "submit form action",
+	"ImportData": "import data action",
+	"Rendition":  "rendition action",
+}
+
+// removedKeys are dictionary entries that are always removed
+var removedKeys = map[Name]string{
+	"JS":            "JavaScript code",
+	"JavaScript":    "document JavaScript",
+	"AA":            "additional actions",
+	"EmbeddedFiles": "embedded files",
+	"EF":            "embedded file",
+	"XFA":           "XFA form",
+}
+
+// SanitizeReport lists active content that was removed from the pdf
+type SanitizeReport struct {
+	Removed []string
+}
+
+// Changed reports whether anything was removed
+func (r SanitizeReport) Changed() bool {
+	return len(r.Removed) > 0
+}
+
+// sanitizer walks all objects and removes active content
+type sanitizer struct {
+	f       *File
+	removed map[string]bool
+}
+
+// Sanitize rewrites the pdf without JavaScript, open and additional
+// actions, launch and external URI actions and embedded files. When
+// nothing has to be removed, the original data is returned.
+func Sanitize(data []byte) ([]byte, SanitizeReport, error) {
+	f, err := Parse(data)
+	if err != nil {
+		return nil, SanitizeReport{}, err
+	}
+
+	s := sanitizer{f: f, removed: map[string]bool{}}
+	objects := map[int]Object{}
+	gens := map[int]int{}
+	for _, num := range f.Objects() {
+		obj, err := f.Object(num)
+		if err != nil {
+			return nil, SanitizeReport{}, err
+		}
+		// object and xref streams are not needed, since every object is
+		// written uncompressed with new xref table
+		if stream, ok := obj.(Stream); ok {
+			if t := stream.Dict.Name("Type"); t == "ObjStm" || t == "XRef" {
+				continue
+			}
+		}
+		if reason, bad := s.dangerous(obj); bad {
+			s.remove(num, "", reason)
+			continue
+		}
+		objects[num] = s.clean(num, obj)
+		gens[num] = f.gen(num)
+	}
+
+	report := SanitizeReport{}
+	for item := range s.removed {
+		report.Removed = append(report.Removed, item)
+	}
+	sort.Strings(report.Removed)
+	if !report.Changed() {
+		return data, report, nil
+	}
+
+	trailer := Dict{}
+	for _, key := range []Name{"Root", "Info", "ID", "Encrypt"} {
+		if value, ok := f.Trailer[key]; ok {
+			trailer[key] = value
+		}
+	}
+	return writeFile(f.Version, objects, gens, trailer), report, nil
+}
+
+// dangerous reports whether object (or referenced object) is an active
+// content that has to be removed as a whole
+func (s *sanitizer) dangerous(obj Object) (string, bool) {
+	var dict Dict
+	switch v := s.f.Resolve(obj).(type) {
+	case Dict:
+		dict = v
+	case Stream:
+		dict = v.Dict
+	default:
+		return "", false
+	}
+
+	if reason, ok := dangerousActions[dict.Name("S")]; ok {
+		return reason, true
+	}
+	if dict.Name("Type") == "EmbeddedFile" {
+		return "embedded file", true
+	}
+	if dict.Name("Subtype") == "FileAttachment" {
+		return "file attachment annotation", true
+	}
+	return "", false
+}
+
+// clean returns copy of the object without dangerous entries
+func (s *sanitizer) clean(num int, obj Object) Object {
+	switch v := obj.(type) {
+	case Dict:
+		out := Dict{}
+		for key, value := range v {
+			if reason, ok := removedKeys[key]; ok {
+				s.remove(num, key, reason)
+				continue
+			}
+			if reason, bad := s.dangerous(value); bad {
+				s.remove(num, key, reason)
+				continue
+			}
+			out[key] = s.clean(num, value)
+		}
+		return out
+	case Array:
+		out := Array{}
+		for _, item := range v {
+			if reason, bad := s.dangerous(item); bad {
+				s.remove(num, "", reason)
+				continue
+			}
+			out = append(out, s.clean(num, item))
+		}
+		return out
+	case Stream:
+		return Stream{Dict: s.clean(num, v.Dict).(Dict), Data: v.Data}
+	}
+	return obj
+}
+
+// remove records removed item
+func (s *sanitizer) remove(num int, key Name, reason string) {
+	if len(key) > 0 {
+		s.removed[fmt.Sprintf("object %d: /%s (%s)", num, key, reason)] = true
+		return
+	}
+	s.removed[fmt.Sprintf("object %d: %s", num, reason)] = true
+}
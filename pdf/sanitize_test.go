@@ -0,0 +1,65 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Sanitize(t *testing.T) {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /OpenAction 5 0 R /Names << /JavaScript 6 0 R /EmbeddedFiles 7 0 R >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Annots [8 0 R 9 0 R 10 0 R] /AA << /O 5 0 R >> >>",
+		"<< /Length 44 >>\nstream\nBT /F1 12 Tf 72 712 Td (Hello World) Tj ET\nendstream",
+		"<< /S /JavaScript /JS (app.alert\\('pwned'\\)) >>",
+		"<< /Names [(init) 5 0 R] >>",
+		"<< /Names [(payload.exe) 11 0 R] >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /URI /URI (http://evil.example) >> >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /GoTo /D [3 0 R /Fit] >> >>",
+		"<< /Type /Annot /Subtype /FileAttachment /Rect [0 0 10 10] /FS 11 0 R >>",
+		"<< /Type /Filespec /F (payload.exe) /EF << /F 12 0 R >> >>",
+		"<< /Type /EmbeddedFile /Length 2 >>\nstream\nMZ\nendstream",
+	}
+
+	cleaned, report, err := Sanitize(buildPDF(objects))
+	if err != nil {
+		t.Fatalf("Sanitize() returned error: %v", err)
+	}
+	for _, str := range []string{"JavaScript", "app.alert", "evil.example", "EmbeddedFile", "FileAttachment", "/AA"} {
+		if bytes.Contains(cleaned, []byte(str)) {
+			t.Errorf("sanitized pdf still contains %v", str)
+		}
+	}
+
+	removed := strings.Join(report.Removed, "\n")
+	for _, str := range []string{"/OpenAction (JavaScript action)", "/JavaScript (document JavaScript)", "/AA (additional actions)", "/A (external URI action)", "file attachment annotation", "embedded file"} {
+		if !strings.Contains(removed, str) {
+			t.Errorf("report does not mention %v:\n%v", str, removed)
+		}
+	}
+
+	if r := Validate(cleaned, Limits{MinSize: 100}); !r.Valid() {
+		t.Errorf("sanitized pdf is not valid: %v", r.Problems)
+	}
+	f, err := Parse(cleaned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := f.Resolve(Ref{Num: 3}).(Dict)
+	annots, _ := page["Annots"].(Array)
+	if len(annots) != 2 {
+		t.Errorf("page annotations = %v, internal link should be kept", annots)
+	}
+	goTo, _ := f.Resolve(Ref{Num: 9}).(Dict)
+	if _, ok := goTo["A"]; !ok {
+		t.Errorf("internal go-to action should not be removed: %v", goTo)
+	}
+
+	// clean files are returned untouched
+	clean := buildPDF(testObjects)
+	out, report, err := Sanitize(clean)
+	if err != nil || report.Changed() || !bytes.Equal(out, clean) {
+		t.Errorf("Sanitize() changed clean pdf: %v, %v", report.Removed, err)
+	}
+}
@@ -0,0 +1,428 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxFormDepth limits nesting of form xobjects, which could reference
+// each other
+const maxFormDepth = 8
+
+// Pages returns page dictionaries in document order. Resources inherited
+// from the page tree are copied into the page dictionaries.
+func (f *File) Pages() ([]Dict, error) {
+	catalog, err := f.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	root, ok := f.Resolve(catalog["Pages"]).(Dict)
+	if !ok {
+		return nil, fmt.Errorf("document does not have page tree")
+	}
+
+	pages := []Dict{}
+	visited := map[Ref]bool{}
+	var walk func(node Dict, resources Object, depth int)
+	walk = func(node Dict, resources Object, depth int) {
+		if r, ok := node["Resources"]; ok {
+			resources = r
+		}
+		if node.Name("Type") == "Page" || node["Kids"] == nil {
+			page := Dict{}
+			for k, v := range node {
+				page[k] = v
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+			return
+		}
+		if depth > 64 {
+			return
+		}
+		kids, _ := f.Resolve(node["Kids"]).(Array)
+		for _, kid := range kids {
+			if ref, ok := kid.(Ref); ok {
+				if visited[ref] {
+					continue
+				}
+				visited[ref] = true
+			}
+			if dict, ok := f.Resolve(kid).(Dict); ok {
+				walk(dict, resources, depth+1)
+			}
+		}
+	}
+	walk(root, nil, 0)
+	return pages, nil
+}
+
+// Text extracts text of all pages, pages are separated by form feed.
+// Text is decoded with font ToUnicode maps, simple fonts without them are
+// decoded as Latin-1. Layout is only approximated: text moved to a new
+// line starts a new line, other text positioning produces a space.
+func Text(data []byte) (string, error) {
+	f, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+	pages, err := f.Pages()
+	if err != nil {
+		return "", err
+	}
+
+	texts := []string{}
+	fonts := map[Ref]*font{}
+	for _, page := range pages {
+		e := &textExtractor{f: f, fonts: fonts}
+		e.contents(page["Contents"], page["Resources"], 0)
+		texts = append(texts, strings.TrimSpace(e.out.String()))
+	}
+	return strings.Join(texts, "\f"), nil
+}
+
+// textExtractor collects text shown by content streams of a single page,
+// fonts are shared by all pages so they are decoded once
+type textExtractor struct {
+	f     *File
+	fonts map[Ref]*font
+	out   strings.Builder
+}
+
+// contents extracts text from page contents, which is a stream or an
+// array of streams that are concatenated
+func (e *textExtractor) contents(obj Object, resources Object, depth int) {
+	data := []byte{}
+	switch v := e.f.Resolve(obj).(type) {
+	case Stream:
+		data, _ = e.f.Decode(v)
+	case Array:
+		for _, item := range v {
+			if s, ok := e.f.Resolve(item).(Stream); ok {
+				if d, err := e.f.Decode(s); err == nil {
+					data = append(append(data, d...), '\n')
+				}
+			}
+		}
+	}
+	res, _ := e.f.Resolve(resources).(Dict)
+	e.run(data, res, depth)
+}
+
+// run interprets text operators of content stream
+func (e *textExtractor) run(data []byte, resources Dict, depth int) {
+	l := &lexer{data: data}
+	operands := []Object{}
+	var current *font
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return
+		}
+		obj, err := l.readObject()
+		if err != nil {
+			// skip unexpected byte and continue with the next token
+			l.pos++
+			operands = operands[:0]
+			continue
+		}
+		op, ok := obj.(Keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(Name); ok {
+					current = e.font(resources, name)
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				e.show(current, operands[0])
+			}
+		case "'", "\"":
+			e.out.WriteByte('\n')
+			if len(operands) >= 1 {
+				e.show(current, operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[0].(Array)
+				for _, item := range arr {
+					switch v := item.(type) {
+					case String:
+						e.show(current, v)
+					case int64, float64:
+						// large negative adjustment is a word gap
+						if number(v) < -200 {
+							e.out.WriteByte(' ')
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if number(operands[1]) != 0 {
+					e.out.WriteByte('\n')
+				} else {
+					e.out.WriteByte(' ')
+				}
+			}
+		case "T*", "ET":
+			e.out.WriteByte('\n')
+		case "Tm":
+			e.out.WriteByte(' ')
+		case "BI":
+			// inline image data is binary, skip to the end of the image
+			end := strings.Index(string(l.data[l.pos:]), "EI")
+			if end < 0 {
+				return
+			}
+			l.pos += end + 2
+		case "Do":
+			if len(operands) >= 1 && depth < maxFormDepth {
+				if name, ok := operands[0].(Name); ok {
+					e.form(resources, name, depth)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// form extracts text from form xobject
+func (e *textExtractor) form(resources Dict, name Name, depth int) {
+	xobjects, _ := e.f.Resolve(resources["XObject"]).(Dict)
+	stream, ok := e.f.Resolve(xobjects[name]).(Stream)
+	if !ok || stream.Dict.Name("Subtype") != "Form" {
+		return
+	}
+	res := stream.Dict["Resources"]
+	if res == nil {
+		res = resources
+	}
+	e.contents(stream, res, depth+1)
+}
+
+// show writes decoded string to the output
+func (e *textExtractor) show(f *font, obj Object) {
+	s, ok := obj.(String)
+	if !ok {
+		return
+	}
+	if f == nil {
+		f = &font{}
+	}
+	e.out.WriteString(f.decode([]byte(s)))
+}
+
+// font returns decoder of the named font from resources
+func (e *textExtractor) font(resources Dict, name Name) *font {
+	fonts, _ := e.f.Resolve(resources["Font"]).(Dict)
+	ref, isRef := fonts[name].(Ref)
+	if isRef {
+		if f, ok := e.fonts[ref]; ok {
+			return f
+		}
+	}
+	dict, _ := e.f.Resolve(fonts[name]).(Dict)
+	f := &font{composite: dict.Name("Subtype") == "Type0"}
+	if s, ok := e.f.Resolve(dict["ToUnicode"]).(Stream); ok {
+		if data, err := e.f.Decode(s); err == nil {
+			f.cmap = parseCMap(data)
+		}
+	}
+	if isRef {
+		e.fonts[ref] = f
+	}
+	return f
+}
+
+// font decodes character codes of shown strings into text
+type font struct {
+	composite bool
+	cmap      *cmap
+}
+
+func (f *font) decode(s []byte) string {
+	if f.cmap != nil {
+		return f.cmap.decode(s)
+	}
+	if f.composite {
+		// codes of composite fonts are glyph ids, text can not be
+		// recovered without ToUnicode map
+		return ""
+	}
+	// simple font without map, standard encodings match Latin-1 for
+	// printable ASCII and most accented letters
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// cmap maps character codes to unicode text, codes may be one to four
+// bytes long
+type cmap struct {
+	codes   map[string]string
+	lengths []int // code lengths present in the map, longest first
+}
+
+// parseCMap reads bfchar and bfrange sections of ToUnicode cmap
+func parseCMap(data []byte) *cmap {
+	m := &cmap{codes: map[string]string{}}
+	l := &lexer{data: data}
+	operands := []Object{}
+	section := ""
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			break
+		}
+		obj, err := l.readObject()
+		if err != nil {
+			l.pos++
+			continue
+		}
+		op, ok := obj.(Keyword)
+		if !ok {
+			if section != "" {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+		switch op {
+		case "beginbfchar", "beginbfrange":
+			section = string(op)
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := operands[i].(String)
+				dst, _ := operands[i+1].(String)
+				m.add(string(src), utf16Text(dst))
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _ := operands[i].(String)
+				hi, _ := operands[i+1].(String)
+				m.addRange([]byte(lo), []byte(hi), operands[i+2])
+			}
+			section = ""
+		}
+		operands = operands[:0]
+	}
+	return m
+}
+
+func (m *cmap) add(code string, text string) {
+	if len(code) == 0 || len(code) > 4 {
+		return
+	}
+	m.codes[code] = text
+	for _, n := range m.lengths {
+		if n == len(code) {
+			return
+		}
+	}
+	m.lengths = append(m.lengths, len(code))
+	for i := len(m.lengths) - 1; i > 0 && m.lengths[i] > m.lengths[i-1]; i-- {
+		m.lengths[i], m.lengths[i-1] = m.lengths[i-1], m.lengths[i]
+	}
+}
+
+// addRange adds codes lo..hi, destination is either the first unicode
+// value which is incremented or an array of values
+func (m *cmap) addRange(lo, hi []byte, dst Object) {
+	if len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+		return
+	}
+	start, end := codeValue(lo), codeValue(hi)
+	if end < start || end-start > 0xffff {
+		return
+	}
+	for code := start; code <= end; code++ {
+		key := codeBytes(code, len(lo))
+		switch v := dst.(type) {
+		case String:
+			if len(v) < 2 {
+				continue
+			}
+			// increment the last utf-16 code unit
+			units := utf16Units(v)
+			units[len(units)-1] += uint16(code - start)
+			m.add(key, string(utf16.Decode(units)))
+		case Array:
+			if i := int(code - start); i < len(v) {
+				s, _ := v[i].(String)
+				m.add(key, utf16Text(s))
+			}
+		}
+	}
+}
+
+// decode maps codes to text, the longest matching code wins
+func (m *cmap) decode(s []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, n := range m.lengths {
+			if i+n <= len(s) {
+				if text, ok := m.codes[string(s[i:i+n])]; ok {
+					out.WriteString(text)
+					i += n
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			i++
+		}
+	}
+	return out.String()
+}
+
+// number returns value of integer or real operand
+func number(obj Object) float64 {
+	switch v := obj.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func codeValue(b []byte) uint32 {
+	v := uint32(0)
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+func utf16Units(s String) []uint16 {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return units
+}
+
+func utf16Text(s String) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
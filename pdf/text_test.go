@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"fmt"
+	"testing"
+)
+
+// streamObject returns stream object with content and optional extra
+// dictionary entries
+func streamObject(dict, content string) string {
+	return fmt.Sprintf("<< %v /Length %d >>\nstream\n%v\nendstream", dict, len(content), content)
+}
+
+// textPDF builds one page document with page content and fonts
+func textPDF(content string, fonts string, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << " + fonts + " >> /XObject << /X1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		streamObject("", content),
+		streamObject("/Type /XObject /Subtype /Form", "BT (form text) Tj ET"),
+	}
+	return buildPDF(append(objects, extra...))
+}
+
+var toUnicode = streamObject("", `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar
+<0001> <0051>
+<0002> <FB01>
+endbfchar
+1 beginbfrange
+<0010> <0012> <0061>
+endbfrange
+1 beginbfrange
+<0020> <0021> [<00E9> <017E>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`)
+
+func Test_Text(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		output string
+	}{
+		{"simple", buildPDF(testObjects), "Hello World"},
+		{"positioning", textPDF("BT /F1 12 Tf 72 712 Td (Quantum) Tj 40 0 Td (optics) Tj 0 -14 Td [(gra) 20 (vity) -300 (waves)] TJ T* (caf\\351) Tj ET", "/F1 6 0 R", "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"),
+			"Quantum optics\ngravity waves\ncafé"},
+		{"to unicode", textPDF("BT /F2 10 Tf <0001001000110012000200200021> Tj ET", "/F2 6 0 R", "<< /Type /Font /Subtype /Type0 /ToUnicode 7 0 R >>", toUnicode),
+			"Qabcﬁéž"},
+		{"composite without map", textPDF("BT /F2 10 Tf <00010002> Tj ET", "/F2 6 0 R", "<< /Type /Font /Subtype /Type0 >>"), ""},
+		{"form xobject", textPDF("q /X1 Do Q BI /W 1 /H 1 ID \x00\xff EI BT (after image) Tj ET", "/F1 6 0 R", "<< /Type /Font /Subtype /Type1 >>"),
+			"form text\nafter image"},
+	}
+
+	for _, test := range tests {
+		text, err := Text(test.data)
+		if err != nil {
+			t.Errorf("%v: Text() returned error: %v", test.name, err)
+			continue
+		}
+		if text != test.output {
+			t.Errorf("%v: Text() = %q", test.name, text)
+			t.Errorf("Output should be: %q", test.output)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DefaultMinSize is the smallest plausible size of a real article, smaller
+// files are usually error pages or empty responses
+const DefaultMinSize = 1024
+
+// DefaultMaxSize is the largest size of accepted pdf file
+const DefaultMaxSize = 100 << 20
+
+// Limits describe plausible pdf size in bytes, zero values fall back to
+// DefaultMinSize and DefaultMaxSize
+type Limits struct {
+	MinSize int
+	MaxSize int
+}
+
+// Report contains results of pdf integrity validation
+type Report struct {
+	Size     int
+	SHA256   string // hex encoded checksum of the whole file
+	Version  string
+	Objects  int // number of objects in use
+	Pages    int
+	Problems []string // empty when the file is valid
+}
+
+// Valid reports whether no problems were found
+func (r Report) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns error describing all problems or nil if the file is valid
+func (r Report) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return fmt.Errorf("invalid pdf: %v", strings.Join(r.Problems, "; "))
+}
+
+// Validate checks pdf header, end of file marker, cross reference sections,
+// trailer and document catalog of the file. All problems are collected in
+// the report instead of stopping at the first one.
+func Validate(data []byte, limits Limits) Report {
+	sum := sha256.Sum256(data)
+	report := Report{Size: len(data), SHA256: hex.EncodeToString(sum[:])}
+	problem := func(format string, args ...interface{}) {
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+
+	minSize, maxSize := limits.MinSize, limits.MaxSize
+	if minSize <= 0 {
+		minSize = DefaultMinSize
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	switch {
+	case len(data) == 0:
+		problem("file is empty")
+		return report
+	case len(data) < minSize:
+		problem("file is only %d bytes large", len(data))
+	case len(data) > maxSize:
+		problem("file is larger than %d bytes", maxSize)
+	}
+
+	head := bytes.TrimSpace(data[:min(len(data), 1024)])
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		if bytes.HasPrefix(head, []byte("<")) {
+			problem("file is html or xml document instead of pdf")
+		} else {
+			problem("missing %%PDF- header")
+		}
+		return report
+	}
+
+	tail := data[max(0, len(data)-1024):]
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		problem("missing %%%%EOF marker, file is probably truncated")
+	}
+
+	f, err := Parse(data)
+	if err != nil {
+		problem("broken file structure: %v", err)
+		return report
+	}
+	report.Version = f.Version
+	report.Objects = len(f.Objects())
+
+	catalog, err := f.Catalog()
+	if err != nil {
+		problem("%v", err)
+		return report
+	}
+	if catalog.Name("Type") != "Catalog" {
+		problem("document catalog has wrong type %q", catalog.Name("Type"))
+	}
+	pages, ok := f.Resolve(catalog["Pages"]).(Dict)
+	if !ok {
+		problem("document does not have page tree")
+		return report
+	}
+	count, _ := f.Resolve(pages["Count"]).(int64)
+	if count <= 0 {
+		problem("document does not have any pages")
+	}
+	report.Pages = int(count)
+	return report
+}
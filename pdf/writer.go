@@ -0,0 +1,176 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// writeFile writes complete pdf file with classic cross reference table.
+// Objects missing in the map are written as free entries.
+func writeFile(version string, objects map[int]Object, gens map[int]int, trailer Dict) []byte {
+	var buf bytes.Buffer
+	if len(version) == 0 {
+		version = "1.4"
+	}
+	// binary comment tells transfer programs that the file is not text
+	fmt.Fprintf(&buf, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+
+	nums := make([]int, 0, len(objects))
+	size := 1
+	for num := range objects {
+		nums = append(nums, num)
+		if num+1 > size {
+			size = num + 1
+		}
+	}
+	sort.Ints(nums)
+
+	offsets := map[int]int{}
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", num, gens[num])
+		Write(&buf, objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n", size)
+	for num := 0; num < size; num++ {
+		offset, ok := offsets[num]
+		if !ok {
+			buf.WriteString("0000000000 65535 f\r\n")
+			continue
+		}
+		fmt.Fprintf(&buf, "%010d %05d n\r\n", offset, gens[num])
+	}
+
+	t := Dict{}
+	for key, value := range trailer {
+		t[key] = value
+	}
+	t["Size"] = int64(size)
+	buf.WriteString("trailer\n")
+	Write(&buf, t)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+// gen returns generation number of object
+func (f *File) gen(num int) int {
+	return f.xref[num].gen
+}
+
+// xrefStreamKeys are trailer entries that only belong to cross reference
+// streams and are not copied into the trailer of an incremental update
+var xrefStreamKeys = []Name{"Type", "W", "Index", "Filter", "DecodeParms", "Length", "Prev", "XRefStm"}
+
+// appendUpdate appends incremental update with new versions of objects to
+// the original file, which stays byte for byte the same. The new cross
+// reference section is a table or a stream, matching the newest section of
+// the original file.
+func (f *File) appendUpdate(objects map[int]Object, trailer Dict) []byte {
+	var buf bytes.Buffer
+	buf.Write(f.data)
+	if len(f.data) > 0 && f.data[len(f.data)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(objects))
+	for num := range objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	offsets := map[int]int{}
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", num, f.gen(num))
+		Write(&buf, objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	t := Dict{}
+	for key, value := range f.Trailer {
+		t[key] = value
+	}
+	for key, value := range trailer {
+		t[key] = value
+	}
+	for _, key := range xrefStreamKeys {
+		delete(t, key)
+	}
+	t["Prev"] = f.startxref
+	size := f.Size()
+	for _, num := range nums {
+		if num+1 > size {
+			size = num + 1
+		}
+	}
+
+	l := &lexer{data: f.data, pos: int(f.startxref)}
+	if !l.readKeyword("xref") {
+		// the xref stream describes itself, so it gets the next number
+		xrefNum := size
+		offsets[xrefNum] = buf.Len()
+		nums = append(nums, xrefNum)
+		t["Size"] = int64(xrefNum + 1)
+		writeXrefStream(&buf, xrefNum, nums, offsets, f, t)
+		return buf.Bytes()
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for _, run := range runs(nums) {
+		fmt.Fprintf(&buf, "%d %d\n", run[0], len(run))
+		for _, num := range run {
+			fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[num], f.gen(num))
+		}
+	}
+	t["Size"] = int64(size)
+	buf.WriteString("trailer\n")
+	Write(&buf, t)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+// writeXrefStream writes uncompressed cross reference stream object
+func writeXrefStream(buf *bytes.Buffer, xrefNum int, nums []int, offsets map[int]int, f *File, trailer Dict) {
+	index := Array{}
+	var rows bytes.Buffer
+	for _, run := range runs(nums) {
+		index = append(index, int64(run[0]), int64(len(run)))
+		for _, num := range run {
+			// type 1 entry: offset in 4 bytes, generation in 2 bytes
+			offset, gen := offsets[num], f.gen(num)
+			rows.Write([]byte{1, byte(offset >> 24), byte(offset >> 16), byte(offset >> 8), byte(offset), byte(gen >> 8), byte(gen)})
+		}
+	}
+
+	dict := Dict{}
+	for key, value := range trailer {
+		dict[key] = value
+	}
+	dict["Type"] = Name("XRef")
+	dict["W"] = Array{int64(1), int64(4), int64(2)}
+	dict["Index"] = index
+
+	start := offsets[xrefNum]
+	fmt.Fprintf(buf, "%d 0 obj\n", xrefNum)
+	Write(buf, Stream{Dict: dict, Data: rows.Bytes()})
+	fmt.Fprintf(buf, "\nendobj\nstartxref\n%d\n%%%%EOF\n", start)
+}
+
+// runs splits sorted object numbers into runs of consecutive numbers, one
+// per cross reference subsection
+func runs(nums []int) [][]int {
+	out := [][]int{}
+	for i, num := range nums {
+		if i > 0 && num == nums[i-1]+1 {
+			out[len(out)-1] = append(out[len(out)-1], num)
+			continue
+		}
+		out = append(out, []int{num})
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package references
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/doi"
+	"github.com/greatdanton/goScience/metadata"
+)
+
+// maxReferences limits number of extracted references, longer lists are
+// most likely caused by wrongly detected end of the reference list
+const maxReferences = 500
+
+// Doi sources
+const (
+	SourceText     = "text"     // doi is printed in the citation
+	SourceMetadata = "metadata" // doi was found by metadata service
+)
+
+// Reference is single entry of article reference list
+type Reference struct {
+	Number int    `json:"number,omitempty"` // number in numbered citation styles
+	Text   string `json:"text"`             // citation as printed in the article
+	Doi    string `json:"doi,omitempty"`
+	Source string `json:"source,omitempty"` // one of Source* constants, empty when doi is unknown
+	Title  string `json:"title,omitempty"`  // title of the work found by metadata service
+}
+
+var (
+	heading    = regexp.MustCompile(`(?i)^(?:[0-9ivx]+\.?\s*)?(?:references|bibliography|literature cited|works cited|references and notes|cited literature)\s*:?$`)
+	endHeading = regexp.MustCompile(`(?i)^(?:[0-9a-z]\.?\s+)?(?:appendix|appendices|supplementary|supporting information|acknowledge?ments?|author contributions|competing interests)\b`)
+	bracket    = regexp.MustCompile(`^\[(\d{1,3})\]\s*`)
+	dotted     = regexp.MustCompile(`^(\d{1,3})\.\s+`)
+	author     = regexp.MustCompile(`^\p{Lu}[\pL'’-]+(?:,\s|\s+\p{Lu}{1,3}[,.\s])`)
+	urlStart   = regexp.MustCompile(`(?:10\.\d{4,9}/|https?://)\S*$`)
+)
+
+// Extract finds reference list in article text and splits it into
+// citations. Numbered styles ([1] or 1.) are split on consecutive
+// numbers, other styles on lines starting with author name after line
+// that ends with period or doi. Text without references heading returns nil.
+func Extract(text string) []Reference {
+	lines := strings.Split(strings.Replace(text, "\f", "\n", -1), "\n")
+	start := -1
+	for i, line := range lines {
+		if heading.MatchString(strings.TrimSpace(line)) {
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	body := []string{}
+	for _, line := range lines[start:] {
+		line = strings.TrimSpace(line)
+		if len(line) < 40 && endHeading.MatchString(line) {
+			break
+		}
+		if len(line) > 0 {
+			body = append(body, line)
+		}
+	}
+
+	marker := style(body)
+	entries := [][]string{}
+	expected := 0
+	for i, line := range body {
+		newEntry := false
+		if marker != nil {
+			if m := marker.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				if expected == 0 || n == expected {
+					newEntry = true
+					expected = n + 1
+				}
+			}
+		} else {
+			prev := ""
+			if i > 0 {
+				prev = body[i-1]
+			}
+			newEntry = (strings.HasSuffix(prev, ".") || urlStart.MatchString(prev)) && author.MatchString(line)
+		}
+		if newEntry || len(entries) == 0 {
+			entries = append(entries, []string{line})
+			continue
+		}
+		entries[len(entries)-1] = append(entries[len(entries)-1], line)
+	}
+
+	refs := []Reference{}
+	for _, entry := range entries {
+		ref := Reference{Text: join(entry)}
+		if marker != nil {
+			if m := marker.FindStringSubmatch(ref.Text); m != nil {
+				ref.Number, _ = strconv.Atoi(m[1])
+				ref.Text = ref.Text[len(m[0]):]
+			}
+		}
+		if len(ref.Text) < 15 {
+			continue
+		}
+		if found, ok := doi.Find(ref.Text); ok {
+			ref.Doi = found
+			ref.Source = SourceText
+		}
+		refs = append(refs, ref)
+		if len(refs) == maxReferences {
+			break
+		}
+	}
+	return refs
+}
+
+// style returns numbering marker of the reference list, nil for author
+// year styles
+func style(lines []string) *regexp.Regexp {
+	for _, marker := range []*regexp.Regexp{bracket, dotted} {
+		count := 0
+		for _, line := range lines {
+			if marker.MatchString(line) {
+				count++
+			}
+		}
+		if count >= 2 {
+			return marker
+		}
+	}
+	return nil
+}
+
+// join joins lines of single citation. Words hyphenated at the end of
+// line are joined back, dois and urls broken over lines are joined
+// without space.
+func join(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			next, _ := utf8.DecodeRuneInString(line)
+			switch {
+			case urlStart.MatchString(prev) && !strings.HasSuffix(prev, "."):
+			case strings.HasSuffix(prev, "-") && unicode.IsLower(next):
+				s := b.String()
+				b.Reset()
+				b.WriteString(s[:len(s)-1])
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Resolve looks up dois of citations that do not contain them with
+// metadata service, workers limits number of concurrent requests. Error
+// is returned when the metadata service is not available (remaining
+// citations are skipped), citations that do not match any work are left
+// without doi.
+func Resolve(refs []Reference, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var mu sync.Mutex
+	var firstErr error
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				mu.Lock()
+				unavailable := firstErr != nil
+				mu.Unlock()
+				if unavailable {
+					continue
+				}
+				work, err := metadata.Resolve(refs[i].Text)
+				if err != nil {
+					if !errors.Is(err, apperror.ErrNotFound) {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+					}
+					continue
+				}
+				refs[i].Doi = work.Doi
+				refs[i].Title = work.Title
+				refs[i].Source = SourceMetadata
+			}
+		}()
+	}
+	for i := range refs {
+		if len(refs[i].Doi) == 0 {
+			queue <- i
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
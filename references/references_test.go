@@ -0,0 +1,140 @@
+package references
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/greatdanton/goScience/metadata"
+)
+
+const numbered = `Conclusion
+Monolithic repositories work at scale [1, 2].
+References
+[1] R. Potvin, J. Levenberg, Why Google stores billions of lines of code in a single
+repository, Commun. ACM 59 (2016) 78-87. https://doi.org/10.1145/
+2854146.
+[2] A. Vaswani et al., Attention is all you need, arXiv:1706.03762 (2017).
+12
+[3] J. Smith, Version control of large code-
+bases, Proc. ICSE (2018) 1-10.
+Appendix A
+[4] Not a reference, appendix text continues here with numbers.`
+
+const dottedList = `1 Introduction
+Text of the article.
+7 References
+1. Potvin R, Levenberg J. Why Google stores billions of lines of code in a single repository. Commun ACM. 2016;59:78-87.
+2. Smith J. Version control of large codebases. Proc ICSE. 2018:1-10. doi:10.1000/icse.2018.1.
+Acknowledgements
+We thank everyone.`
+
+const authorYear = "Bibliography\n" +
+	"Potvin, R., & Levenberg, J. (2016). Why Google stores billions of lines of code\n" +
+	"in a single repository. Communications of the ACM, 59(7), 78-87.\n" +
+	"Smith, J. (2018). Version control of large codebases. In Proceedings of ICSE\n" +
+	"(pp. 1-10). https://doi.org/10.1000/icse.2018.1\f" +
+	"Vaswani, A., Shazeer, N., et al. (2017). Attention is all you need.\n"
+
+func Test_Extract(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		texts []string
+		dois  []string
+	}{
+		{
+			"numbered",
+			numbered,
+			[]string{
+				"R. Potvin, J. Levenberg, Why Google stores billions of lines of code in a single repository, Commun. ACM 59 (2016) 78-87. https://doi.org/10.1145/2854146.",
+				"A. Vaswani et al., Attention is all you need, arXiv:1706.03762 (2017). 12",
+				"J. Smith, Version control of large codebases, Proc. ICSE (2018) 1-10.",
+			},
+			[]string{"10.1145/2854146", "10.48550/arXiv.1706.03762", ""},
+		},
+		{
+			"dotted",
+			dottedList,
+			[]string{
+				"Potvin R, Levenberg J. Why Google stores billions of lines of code in a single repository. Commun ACM. 2016;59:78-87.",
+				"Smith J. Version control of large codebases. Proc ICSE. 2018:1-10. doi:10.1000/icse.2018.1.",
+			},
+			[]string{"", "10.1000/icse.2018.1"},
+		},
+		{
+			"author year",
+			authorYear,
+			[]string{
+				"Potvin, R., & Levenberg, J. (2016). Why Google stores billions of lines of code in a single repository. Communications of the ACM, 59(7), 78-87.",
+				"Smith, J. (2018). Version control of large codebases. In Proceedings of ICSE (pp. 1-10). https://doi.org/10.1000/icse.2018.1",
+				"Vaswani, A., Shazeer, N., et al. (2017). Attention is all you need.",
+			},
+			[]string{"", "10.1000/icse.2018.1", ""},
+		},
+		{"no heading", "Introduction\n[1] Something that looks like a reference.", nil, nil},
+	}
+
+	for _, test := range tests {
+		refs := Extract(test.text)
+		texts, dois := []string{}, []string{}
+		for _, ref := range refs {
+			texts = append(texts, ref.Text)
+			dois = append(dois, ref.Doi)
+		}
+		if strings.Join(texts, "\n") != strings.Join(test.texts, "\n") {
+			t.Errorf("%v: Extract() = %v", test.name, strings.Join(texts, "\n"))
+			t.Errorf("Output should be: %v", strings.Join(test.texts, "\n"))
+		}
+		if strings.Join(dois, ",") != strings.Join(test.dois, ",") {
+			t.Errorf("%v: Extract() dois = %v", test.name, dois)
+			t.Errorf("Output should be: %v", test.dois)
+		}
+	}
+}
+
+func Test_ExtractNumbers(t *testing.T) {
+	refs := Extract(numbered)
+	for i, ref := range refs {
+		if ref.Number != i+1 {
+			t.Errorf("Extract() reference %v has number %v", i, ref.Number)
+		}
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		citation := r.URL.Query().Get("query.bibliographic")
+		if strings.Contains(citation, "Potvin") {
+			w.Write([]byte(`{"message": {"items": [{"DOI": "10.1145/2854146", "title": ["Why Google stores billions of lines of code in a single repository"]}]}}`))
+			return
+		}
+		w.Write([]byte(`{"message": {"items": [{"DOI": "10.1000/unrelated", "title": ["Unrelated work"]}]}}`))
+	}))
+	defer server.Close()
+	metadata.ServiceURL = server.URL
+	defer func() { metadata.ServiceURL = metadata.DefaultURL }()
+
+	refs := Extract(dottedList)
+	if err := Resolve(refs, 2); err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+	expected := []Reference{
+		{Doi: "10.1145/2854146", Source: SourceMetadata},
+		{Doi: "10.1000/icse.2018.1", Source: SourceText},
+	}
+	for i, ref := range refs {
+		if ref.Doi != expected[i].Doi || ref.Source != expected[i].Source {
+			t.Errorf("Resolve() = %v, %v", ref.Doi, ref.Source)
+			t.Errorf("Output should be: %v, %v", expected[i].Doi, expected[i].Source)
+		}
+	}
+
+	// unavailable service is reported
+	server.Close()
+	refs = Extract(dottedList)
+	if err := Resolve(refs, 2); err == nil || len(refs[0].Doi) > 0 {
+		t.Errorf("Resolve() with unavailable service = %v, %v", err, refs[0].Doi)
+	}
+}
@@ -0,0 +1,125 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+var erasedBucket = []byte("erased")
+
+// erased is record of deleted account
+type erased struct {
+	User string
+	Time time.Time
+}
+
+// Store keeps names of users whose accounts were deleted together with
+// their data. Accounts come from the configuration, so erased users stay
+// locked out until they are removed from it. When keys are set, records
+// are encrypted and stored under keyed hashes of user names.
+type Store struct {
+	db   *bolt.DB
+	keys *encrypt.Keyring
+}
+
+// Open creates erased accounts bucket in the database. Nil keys leave
+// records unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(erasedBucket)
+		if err != nil {
+			return err
+		}
+		if !encrypt.BucketSealed(tx, string(erasedBucket)) {
+			if err := upgradeErased(b); err != nil {
+				return err
+			}
+		}
+		return keys.SealBucket(tx, string(erasedBucket), func(path string, key []byte) bool {
+			return true
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create erased accounts bucket: %v", err)
+	}
+	return &Store{db: db, keys: keys}, nil
+}
+
+// upgradeErased keeps user name in records that stored only the time, so
+// the name is not lost when the record is renamed
+func upgradeErased(b *bolt.Bucket) error {
+	// bucket can not be changed while iterating over it
+	records := []erased{}
+	b.ForEach(func(k, v []byte) error {
+		if len(v) > 0 && v[0] == '{' {
+			return nil
+		}
+		e := erased{User: string(k)}
+		e.Time.UnmarshalText(v)
+		records = append(records, e)
+		return nil
+	})
+	for _, e := range records {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(e.User), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// erasedLabel returns label the record stored under the key is sealed with
+func erasedLabel(key string) string {
+	return string(erasedBucket) + "/" + key
+}
+
+// MarkErased records that the account of the user was deleted
+func (s *Store) MarkErased(user string) error {
+	key, err := s.keys.Name(user)
+	if err != nil {
+		return err
+	}
+	data, err := s.keys.Marshal(erased{User: user, Time: time.Now()}, erasedLabel(key))
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(erasedBucket).Put([]byte(key), data)
+	})
+}
+
+// Erased returns deleted accounts with the time they were deleted
+func (s *Store) Erased() (map[string]time.Time, error) {
+	list := map[string]time.Time{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(erasedBucket).ForEach(func(k, v []byte) error {
+			e := erased{}
+			if err := s.keys.Unmarshal(v, erasedLabel(string(k)), &e); err != nil {
+				return err
+			}
+			list[e.User] = e.Time
+			return nil
+		})
+	})
+	return list, err
+}
+
+// Forget removes the record of deleted account, so a new account with the
+// same name could be configured
+func (s *Store) Forget(user string) error {
+	key, err := s.keys.Name(user)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(erasedBucket).Delete([]byte(key))
+	})
+}
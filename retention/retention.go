@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Config is retention section of the configuration. It sets how many days
+// records are kept, records are kept forever when the value is 0.
+type Config struct {
+	DownloadLog       int // download log entries
+	Jobs              int // finished batch jobs
+	WebhookDeliveries int // webhook delivery logs
+	Watch             int // works found by watches
+	ShareLinks        int // share links after they expired
+	Interval          int // hours between purges, defaults to 24
+}
+
+// PurgeFunc removes records created before the time and returns their
+// number
+type PurgeFunc func(before time.Time) (int, error)
+
+// task is kind of records with its retention period
+type task struct {
+	name  string
+	keep  time.Duration
+	purge PurgeFunc
+}
+
+// Purger periodically removes records older than their retention period
+type Purger struct {
+	Interval time.Duration
+	tasks    []task
+	now      func() time.Time
+}
+
+// NewPurger creates purger running every interval from the configuration
+func NewPurger(config Config) *Purger {
+	interval := time.Duration(config.Interval) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &Purger{Interval: interval, now: time.Now}
+}
+
+// Add registers records kept for days, name describes them in the log,
+// ex. "download log entries". Records kept forever are not registered.
+func (p *Purger) Add(name string, days int, purge PurgeFunc) {
+	if days <= 0 {
+		return
+	}
+	p.tasks = append(p.tasks, task{name: name, keep: time.Duration(days) * 24 * time.Hour, purge: purge})
+}
+
+// Empty reports whether no records have retention period
+func (p *Purger) Empty() bool {
+	return len(p.tasks) == 0
+}
+
+// Run purges records every interval, it never returns
+func (p *Purger) Run() {
+	for {
+		p.Purge()
+		time.Sleep(p.Interval)
+	}
+}
+
+// Purge removes expired records of all kinds and returns number of
+// removed records by their name. Failed kinds are logged and skipped.
+func (p *Purger) Purge() map[string]int {
+	removed := map[string]int{}
+	now := p.now()
+	for _, t := range p.tasks {
+		n, err := t.purge(now.Add(-t.keep))
+		if err != nil {
+			fmt.Printf("Could not purge %v: %v\n", t.name, err)
+			continue
+		}
+		removed[t.name] = n
+		if n > 0 {
+			log.Printf("Purged %v %v older than %v days", n, t.name, int(t.keep.Hours()/24))
+		}
+	}
+	return removed
+}
@@ -0,0 +1,103 @@
+package retention
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+func Test_Purger(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	cutoffs := map[string]time.Time{}
+	purge := func(name string, n int, err error) PurgeFunc {
+		return func(before time.Time) (int, error) {
+			cutoffs[name] = before
+			return n, err
+		}
+	}
+
+	p := NewPurger(Config{})
+	p.now = func() time.Time { return now }
+	if p.Interval != 24*time.Hour || !p.Empty() {
+		t.Errorf("NewPurger() = %v interval, empty %v", p.Interval, p.Empty())
+	}
+	p.Add("download log entries", 30, purge("log", 3, nil))
+	p.Add("batch jobs", 0, purge("jobs", 1, nil)) // kept forever
+	p.Add("found works", 7, purge("found", 0, errors.New("broken")))
+
+	removed := p.Purge()
+	if len(removed) != 1 || removed["download log entries"] != 3 {
+		t.Errorf("Purge() = %v", removed)
+	}
+	tests := []struct {
+		name   string
+		before time.Time
+	}{
+		{"log", now.Add(-30 * 24 * time.Hour)},
+		{"jobs", time.Time{}},
+		{"found", now.Add(-7 * 24 * time.Hour)},
+	}
+	for _, test := range tests {
+		if !cutoffs[test.name].Equal(test.before) {
+			t.Errorf("Purge() of %v before %v", test.name, cutoffs[test.name])
+			t.Errorf("Output should be: %v", test.before)
+		}
+	}
+}
+
+func Test_Store(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// record written when only the time was stored
+	db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket(erasedBucket)
+		data, _ := time.Now().MarshalText()
+		return b.Put([]byte("cid"), data)
+	})
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.MarkErased("ana")
+	s.MarkErased("bob")
+	if err := s.Forget("bob"); err != nil {
+		t.Fatal(err)
+	}
+	erased, err := s.Erased()
+	if err != nil || len(erased) != 2 || time.Since(erased["ana"]) > time.Minute || time.Since(erased["cid"]) > time.Minute {
+		t.Errorf("Erased() = %v, %v", erased, err)
+	}
+
+	// names are hashed when encryption is enabled
+	keyFile := filepath.Join(t.TempDir(), "key")
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600)
+	keys, _ := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	if s, err = Open(db, keys); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Forget("cid"); err != nil {
+		t.Fatal(err)
+	}
+	ana, _ := keys.Name("ana")
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(erasedBucket)
+		if b.Get([]byte("ana")) != nil || !encrypt.Sealed(b.Get([]byte(ana))) {
+			t.Errorf("erased accounts were not encrypted")
+		}
+		return nil
+	})
+	if erased, err := s.Erased(); err != nil || len(erased) != 1 || erased["ana"].IsZero() {
+		t.Errorf("Erased() of encrypted records = %v, %v", erased, err)
+	}
+}
@@ -0,0 +1,144 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// chunkSize is the size of chunks streamed to clamd, it has to be smaller
+// than clamd StreamMaxLength
+const chunkSize = 64 << 10
+
+// Config holds address of clamd compatible daemon
+type Config struct {
+	Address string // tcp://host:3310 or unix:///var/run/clamav/clamd.ctl
+	Timeout int    // seconds, defaults to 60
+}
+
+// Result of a single scan
+type Result struct {
+	Clean     bool
+	Signature string // name of detected threat, ex. Eicar-Test-Signature
+}
+
+func (r Result) String() string {
+	if r.Clean {
+		return "clean"
+	}
+	return "infected: " + r.Signature
+}
+
+// Scanner streams files to clamd daemon with INSTREAM command
+type Scanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New creates scanner from configuration or returns an error if the
+// address is not valid
+func New(conf Config) (*Scanner, error) {
+	u, err := url.Parse(conf.Address)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse clamd address: %v", err)
+	}
+
+	s := &Scanner{network: u.Scheme, timeout: 60 * time.Second}
+	switch u.Scheme {
+	case "tcp":
+		s.address = u.Host
+	case "unix":
+		s.address = u.Path
+	default:
+		return nil, fmt.Errorf("Unsupported clamd address %v, use tcp:// or unix://", conf.Address)
+	}
+	if len(s.address) == 0 {
+		return nil, fmt.Errorf("clamd address %v is missing host or socket path", conf.Address)
+	}
+	if conf.Timeout > 0 {
+		s.timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	return s, nil
+}
+
+// Ping checks whether the daemon is reachable
+func (s *Scanner) Ping() error {
+	reply, err := s.command("zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply: %v", reply)
+	}
+	return nil
+}
+
+// Scan streams data to the daemon and returns scan result. An error is
+// returned when the file could not be scanned.
+func (s *Scanner) Scan(data io.Reader) (Result, error) {
+	reply, err := s.command("zINSTREAM\x00", data)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// replies: "stream: OK", "stream: Eicar-Test-Signature FOUND",
+	// "INSTREAM size limit exceeded. ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamd: %v", reply)
+}
+
+// command sends null terminated command to the daemon, streams data in
+// chunks (when data is not nil) and reads the reply
+func (s *Scanner) command(cmd string, data io.Reader) (string, error) {
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		return "", fmt.Errorf("Could not connect to clamd: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	w := bufio.NewWriter(conn)
+	w.WriteString(cmd)
+	if data != nil {
+		buf := make([]byte, chunkSize)
+		size := make([]byte, 4)
+		for {
+			n, err := data.Read(buf)
+			if n > 0 {
+				binary.BigEndian.PutUint32(size, uint32(n))
+				w.Write(size)
+				w.Write(buf[:n])
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		// zero length chunk ends the stream
+		w.Write([]byte{0, 0, 0, 0})
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("Could not send data to clamd: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return "", fmt.Errorf("Could not read clamd reply: %v", err)
+	}
+	return string(bytes.TrimSpace(bytes.TrimRight(reply, "\x00"))), nil
+}
@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd implements PING and INSTREAM commands of clamd protocol and
+// detects eicar test file
+func fakeClamd(t *testing.T, network, address string) net.Listener {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, _ := r.ReadString(0)
+				switch cmd {
+				case "zPING\x00":
+					conn.Write([]byte("PONG\x00"))
+				case "zINSTREAM\x00":
+					var data bytes.Buffer
+					size := make([]byte, 4)
+					for {
+						if _, err := io.ReadFull(r, size); err != nil {
+							return
+						}
+						n := binary.BigEndian.Uint32(size)
+						if n == 0 {
+							break
+						}
+						io.CopyN(&data, r, int64(n))
+					}
+					if strings.Contains(data.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+						conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+						return
+					}
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}(conn)
+		}
+	}()
+	return l
+}
+
+func Test_Scan(t *testing.T) {
+	tcp := fakeClamd(t, "tcp", "127.0.0.1:0")
+	defer tcp.Close()
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	unix := fakeClamd(t, "unix", socket)
+	defer unix.Close()
+
+	// larger than one chunk, so the file is streamed in multiple chunks
+	infected := strings.Repeat("%PDF-1.4 ", 10000) + eicar
+
+	for _, address := range []string{"tcp://" + tcp.Addr().String(), "unix://" + socket} {
+		s, err := New(Config{Address: address})
+		if err != nil {
+			t.Fatalf("New(%v) returned error: %v", address, err)
+		}
+		if err := s.Ping(); err != nil {
+			t.Errorf("%v: Ping() returned error: %v", address, err)
+		}
+
+		tests := []struct {
+			data   string
+			output Result
+		}{
+			{"%PDF-1.4 clean article", Result{Clean: true}},
+			{infected, Result{Signature: "Eicar-Test-Signature"}},
+		}
+		for _, test := range tests {
+			result, err := s.Scan(strings.NewReader(test.data))
+			if err != nil {
+				t.Errorf("%v: Scan() returned error: %v", address, err)
+			}
+			if result != test.output {
+				t.Errorf("%v: Scan() = %v", address, result)
+				t.Errorf("Output should be: %v", test.output)
+			}
+		}
+	}
+}
+
+func Test_New(t *testing.T) {
+	invalid := []string{"", "127.0.0.1:3310", "http://127.0.0.1:3310", "tcp://", "unix://"}
+	for _, address := range invalid {
+		if _, err := New(Config{Address: address}); err == nil {
+			t.Errorf("New(%v) should return an error", address)
+		}
+	}
+}
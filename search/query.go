@@ -0,0 +1,277 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// snippetBefore and snippetAfter are numbers of tokens displayed around
+// the first match in result snippet
+const (
+	snippetBefore = 8
+	snippetAfter  = 24
+)
+
+// Token is a single indexed word, Start and End are byte offsets in text
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into lower case words made of letters and digits
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			tokens = append(tokens, Token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// Query is parsed search query. Every phrase has to appear in the title or
+// text, single words are phrases with one term.
+type Query struct {
+	Phrases [][]string
+	Title   string // title has to contain all words
+	Author  string // case insensitive substring of any author
+	Tag     string
+	Year    int
+}
+
+// ParseQuery parses user query. Words and "quoted phrases" are matched in
+// title and text, title:, author:, year: and tag: prefixes filter
+// documents by their fields, ex. `"gravitational waves" author:abbott year:2016`.
+func ParseQuery(str string) Query {
+	q := Query{}
+	for _, part := range splitQuery(str) {
+		field, value := "", part
+		if i := strings.Index(part, ":"); i > 0 && !strings.HasPrefix(part, "\"") {
+			field, value = strings.ToLower(part[:i]), part[i+1:]
+		}
+		value = strings.Trim(value, "\"")
+
+		switch field {
+		case "title":
+			q.Title = strings.TrimSpace(q.Title + " " + value)
+		case "author":
+			q.Author = value
+		case "tag":
+			q.Tag = value
+		case "year":
+			q.Year, _ = strconv.Atoi(value)
+		default:
+			// unknown prefixes (ex. urls) are searched as text
+			if terms := termsOf(part); len(terms) > 0 {
+				q.Phrases = append(q.Phrases, terms)
+			}
+		}
+	}
+	return q
+}
+
+// splitQuery splits query on white space, quoted parts are kept together
+func splitQuery(str string) []string {
+	parts := []string{}
+	var current strings.Builder
+	quoted := false
+	for _, r := range str {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// match reports whether document satisfies field filters
+func (q Query) match(doc Document) bool {
+	if q.Year > 0 && doc.Year != q.Year {
+		return false
+	}
+	if len(q.Tag) > 0 {
+		found := false
+		for _, tag := range doc.Tags {
+			found = found || strings.EqualFold(tag, q.Tag)
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Author) > 0 {
+		found := false
+		for _, author := range doc.Authors {
+			found = found || strings.Contains(strings.ToLower(author), strings.ToLower(q.Author))
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Title) > 0 {
+		title := map[string]bool{}
+		for _, token := range Tokenize(doc.Title) {
+			title[token.Term] = true
+		}
+		for _, token := range Tokenize(q.Title) {
+			if !title[token.Term] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// titleBonus ranks documents with searched words in the title higher
+func (q Query) titleBonus(doc Document) int {
+	title := " " + strings.Join(termsOf(doc.Title), " ") + " "
+	bonus := 0
+	for _, phrase := range q.Phrases {
+		if strings.Contains(title, " "+strings.Join(phrase, " ")+" ") {
+			bonus += 10
+		}
+	}
+	return bonus
+}
+
+func termsOf(text string) []string {
+	terms := []string{}
+	for _, token := range Tokenize(text) {
+		terms = append(terms, token.Term)
+	}
+	return terms
+}
+
+// Result is a single search result
+type Result struct {
+	ID      string     `json:"id"`
+	Title   string     `json:"title"`
+	Authors []string   `json:"authors"`
+	Year    int        `json:"year,omitempty"`
+	Tags    []string   `json:"tags"`
+	Score   int        `json:"score"`
+	Snippet []Fragment `json:"snippet"`
+}
+
+// Fragment is part of result snippet, matched words are highlighted
+type Fragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// snippet returns part of the text around the first phrase match with
+// matched words highlighted. Beginning of the text is returned when
+// nothing matches.
+func snippet(text string, phrases [][]string) []Fragment {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return []Fragment{}
+	}
+
+	// mark tokens that are part of any phrase occurrence
+	matched := make([]bool, len(tokens))
+	first := -1
+	for _, phrase := range phrases {
+		for i := 0; i+len(phrase) <= len(tokens); i++ {
+			found := true
+			for j, term := range phrase {
+				if tokens[i+j].Term != term {
+					found = false
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+			for j := range phrase {
+				matched[i+j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	from := first - snippetBefore
+	if from < 0 {
+		from = 0
+	}
+	to := first + snippetAfter
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	fragments := []Fragment{}
+	add := func(str string, match bool) {
+		if len(str) == 0 {
+			return
+		}
+		str = collapseSpace(str)
+		n := len(fragments)
+		if n > 0 && fragments[n-1].Match == match {
+			fragments[n-1].Text += str
+			return
+		}
+		fragments = append(fragments, Fragment{Text: str, Match: match})
+	}
+
+	if from > 0 {
+		add("… ", false)
+	}
+	pos := tokens[from].Start
+	for i := from; i < to; i++ {
+		add(text[pos:tokens[i].Start], false)
+		add(text[tokens[i].Start:tokens[i].End], matched[i])
+		pos = tokens[i].End
+	}
+	if to < len(tokens) {
+		add(" …", false)
+	}
+	return fragments
+}
+
+// collapseSpace replaces white space runs with a single space, extracted
+// text contains line and page breaks
+func collapseSpace(str string) string {
+	var out strings.Builder
+	space := false
+	for _, r := range str {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			out.WriteByte(' ')
+			space = false
+		}
+		out.WriteRune(r)
+	}
+	if space {
+		out.WriteByte(' ')
+	}
+	return out.String()
+}
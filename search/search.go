@@ -0,0 +1,417 @@
+package search
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+var searchBucket = []byte("search")
+
+var (
+	docsBucket     = []byte("docs")
+	postingsBucket = []byte("postings")
+)
+
+// Document is indexed article. Title and Text are searched, other fields
+// are used by field filters.
+type Document struct {
+	ID      string
+	Title   string
+	Authors []string
+	Year    int
+	Tags    []string
+	Text    string
+}
+
+// Index is inverted index stored in bbolt database. Every user has their
+// own index, postings are keyed by "term\x00document id" and contain
+// token positions, so phrases could be matched. When keys are set, users,
+// terms and document ids are replaced with their keyed hashes, and
+// documents and positions are encrypted.
+type Index struct {
+	db   *bolt.DB
+	keys *encrypt.Keyring
+}
+
+// Open creates index buckets in the database. Nil keys leave the index
+// unencrypted. Unencrypted index is removed when keys are set, documents
+// have to be indexed again.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Index, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if keys != nil && !encrypt.BucketSealed(tx, string(searchBucket)) && tx.Bucket(searchBucket) != nil {
+			if err := tx.DeleteBucket(searchBucket); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucketIfNotExists(searchBucket); err != nil {
+			return err
+		}
+		return keys.SealBucket(tx, string(searchBucket), nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create search index: %v", err)
+	}
+	return &Index{db: db, keys: keys}, nil
+}
+
+// Add indexes document, previous version of the document is replaced
+func (idx *Index) Add(user string, doc Document) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		u, err := idx.userBuckets(tx, user, true)
+		if err != nil {
+			return err
+		}
+		if err := idx.removeDoc(u, doc.ID); err != nil {
+			return err
+		}
+
+		positions := map[string][]int{}
+		for i, token := range Tokenize(indexedText(doc)) {
+			positions[token.Term] = append(positions[token.Term], i)
+		}
+		for term, pos := range positions {
+			key, err := idx.postingKey(term, doc.ID)
+			if err != nil {
+				return err
+			}
+			data, err := idx.keys.Seal(encodePositions(pos), u.label(postingsBucket, key))
+			if err != nil {
+				return err
+			}
+			if err := u.postings.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return idx.putDoc(u, doc)
+	})
+}
+
+// SetTags replaces tags of indexed document, used when tags are edited
+// without changing the article
+func (idx *Index) SetTags(user, id string, tags []string) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		u, err := idx.userBuckets(tx, user, false)
+		if err != nil || u.docs == nil {
+			return err
+		}
+		doc, ok := idx.getDoc(u, id)
+		if !ok {
+			return nil
+		}
+		doc.Tags = tags
+		return idx.putDoc(u, doc)
+	})
+}
+
+// Remove removes document from the index
+func (idx *Index) Remove(user, id string) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		u, err := idx.userBuckets(tx, user, false)
+		if err != nil || u.docs == nil {
+			return err
+		}
+		return idx.removeDoc(u, id)
+	})
+}
+
+// RemoveUser removes all documents of the user from the index
+func (idx *Index) RemoveUser(user string) error {
+	key, err := idx.keys.Name(user)
+	if err != nil {
+		return err
+	}
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(searchBucket).DeleteBucket([]byte(key))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// Has reports whether document is indexed
+func (idx *Index) Has(user, id string) bool {
+	found := false
+	idx.db.View(func(tx *bolt.Tx) error {
+		u, err := idx.userBuckets(tx, user, false)
+		if err != nil || u.docs == nil {
+			return nil
+		}
+		if key, err := idx.docKey(id); err == nil {
+			found = u.docs.Get(key) != nil
+		}
+		return nil
+	})
+	return found
+}
+
+// Search returns documents matching the query, best matches first. At
+// most limit results are returned, limit <= 0 returns all results.
+func (idx *Index) Search(user, query string, limit int) ([]Result, error) {
+	q := ParseQuery(query)
+	results := []Result{}
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		u, err := idx.userBuckets(tx, user, false)
+		if err != nil || u.docs == nil {
+			return err
+		}
+
+		// documents containing all terms and phrases with their scores,
+		// nil means that query does not contain any text to match
+		var scores map[string]int
+		for _, phrase := range q.Phrases {
+			matches, err := idx.phraseMatches(u, phrase)
+			if err != nil {
+				return err
+			}
+			if scores == nil {
+				scores = matches
+				continue
+			}
+			for id := range scores {
+				if n, ok := matches[id]; ok {
+					scores[id] += n
+				} else {
+					delete(scores, id)
+				}
+			}
+		}
+
+		return u.docs.ForEach(func(k, v []byte) error {
+			score, ok := scores[string(k)]
+			if scores != nil && !ok {
+				return nil
+			}
+			doc := Document{}
+			if err := idx.keys.Unmarshal(v, u.label(docsBucket, k), &doc); err != nil {
+				return err
+			}
+			if !q.match(doc) {
+				return nil
+			}
+			results = append(results, Result{
+				ID:      doc.ID,
+				Title:   doc.Title,
+				Authors: doc.Authors,
+				Year:    doc.Year,
+				Tags:    doc.Tags,
+				Score:   score + q.titleBonus(doc),
+				Snippet: snippet(doc.Text, q.Phrases),
+			})
+			return nil
+		})
+	})
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return strings.ToLower(results[i].Title) < strings.ToLower(results[j].Title)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, err
+}
+
+// phraseMatches returns number of phrase occurrences per document key
+func (idx *Index) phraseMatches(u userIndex, phrase []string) (map[string]int, error) {
+	// positions of the first term, narrowed down by every next term
+	var matches map[string][]int
+	for i, term := range phrase {
+		positions, err := idx.termPositions(u, term)
+		if err != nil {
+			return nil, err
+		}
+		if matches == nil {
+			matches = positions
+			continue
+		}
+		for id, starts := range matches {
+			next := map[int]bool{}
+			for _, p := range positions[id] {
+				next[p] = true
+			}
+			kept := []int{}
+			for _, start := range starts {
+				if next[start+i] {
+					kept = append(kept, start)
+				}
+			}
+			if len(kept) == 0 {
+				delete(matches, id)
+			} else {
+				matches[id] = kept
+			}
+		}
+	}
+
+	counts := map[string]int{}
+	for key, starts := range matches {
+		counts[key] = len(starts)
+	}
+	return counts, nil
+}
+
+// termPositions returns positions of the term per document key
+func (idx *Index) termPositions(u userIndex, term string) (map[string][]int, error) {
+	positions := map[string][]int{}
+	name, err := idx.keys.Name(term)
+	if err != nil {
+		return nil, err
+	}
+	prefix := []byte(name + "\x00")
+	c := u.postings.Cursor()
+	for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+		data, err := idx.keys.Open(v, u.label(postingsBucket, k))
+		if err != nil {
+			return nil, err
+		}
+		positions[string(k[len(prefix):])] = decodePositions(data)
+	}
+	return positions, nil
+}
+
+// removeDoc deletes document and its postings
+func (idx *Index) removeDoc(u userIndex, id string) error {
+	doc, ok := idx.getDoc(u, id)
+	if !ok {
+		return nil
+	}
+	for _, token := range Tokenize(indexedText(doc)) {
+		key, err := idx.postingKey(token.Term, id)
+		if err != nil {
+			return err
+		}
+		if err := u.postings.Delete(key); err != nil {
+			return err
+		}
+	}
+	key, err := idx.docKey(id)
+	if err != nil {
+		return err
+	}
+	return u.docs.Delete(key)
+}
+
+// indexedText returns text searched by full-text queries
+func indexedText(doc Document) string {
+	return doc.Title + "\n" + doc.Text
+}
+
+// userIndex is documents and postings buckets of one user
+type userIndex struct {
+	key      string // key of the user bucket
+	docs     *bolt.Bucket
+	postings *bolt.Bucket
+}
+
+// label returns path of the value in the index of the user, values are
+// sealed with it, ex. "search/<user>/docs/<id>"
+func (u userIndex) label(name, key []byte) string {
+	return string(searchBucket) + "/" + u.key + "/" + string(name) + "/" + string(key)
+}
+
+// userBuckets returns documents and postings buckets of the user, buckets
+// are nil when user does not have an index and create is false
+func (idx *Index) userBuckets(tx *bolt.Tx, user string, create bool) (userIndex, error) {
+	if len(user) == 0 {
+		return userIndex{}, fmt.Errorf("search user is not set")
+	}
+	key, err := idx.keys.Name(user)
+	if err != nil {
+		return userIndex{}, err
+	}
+	root := tx.Bucket(searchBucket)
+	if !create {
+		u := root.Bucket([]byte(key))
+		if u == nil {
+			return userIndex{}, nil
+		}
+		return userIndex{key, u.Bucket(docsBucket), u.Bucket(postingsBucket)}, nil
+	}
+
+	u, err := root.CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return userIndex{}, err
+	}
+	docs, err := u.CreateBucketIfNotExists(docsBucket)
+	if err != nil {
+		return userIndex{}, err
+	}
+	postings, err := u.CreateBucketIfNotExists(postingsBucket)
+	return userIndex{key, docs, postings}, err
+}
+
+func (idx *Index) getDoc(u userIndex, id string) (Document, bool) {
+	doc := Document{}
+	key, err := idx.docKey(id)
+	if err != nil {
+		return doc, false
+	}
+	data := u.docs.Get(key)
+	if data == nil || idx.keys.Unmarshal(data, u.label(docsBucket, key), &doc) != nil {
+		return doc, false
+	}
+	return doc, true
+}
+
+func (idx *Index) putDoc(u userIndex, doc Document) error {
+	key, err := idx.docKey(doc.ID)
+	if err != nil {
+		return err
+	}
+	data, err := idx.keys.Marshal(doc, u.label(docsBucket, key))
+	if err != nil {
+		return err
+	}
+	return u.docs.Put(key, data)
+}
+
+// docKey returns database key of the document with the id
+func (idx *Index) docKey(id string) ([]byte, error) {
+	key, err := idx.keys.Name(id)
+	return []byte(key), err
+}
+
+// postingKey returns database key of positions of the term in the document
+func (idx *Index) postingKey(term, id string) ([]byte, error) {
+	name, err := idx.keys.Name(term)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := idx.keys.Name(id)
+	return []byte(name + "\x00" + doc), err
+}
+
+// encodePositions stores sorted positions as varint deltas
+func encodePositions(positions []int) []byte {
+	buf := make([]byte, len(positions)*binary.MaxVarintLen32)
+	n, prev := 0, 0
+	for _, p := range positions {
+		n += binary.PutUvarint(buf[n:], uint64(p-prev))
+		prev = p
+	}
+	return buf[:n]
+}
+
+func decodePositions(data []byte) []int {
+	positions := []int{}
+	prev := 0
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		if n <= 0 {
+			break
+		}
+		prev += int(delta)
+		positions = append(positions, prev)
+		data = data[n:]
+	}
+	return positions
+}
@@ -0,0 +1,194 @@
+package search
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+func openTestIndex(t *testing.T) *Index {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "search.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	idx, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+var testDocs = []Document{
+	{ID: "waves", Title: "Observation of Gravitational Waves from a Binary Black Hole Merger", Authors: []string{"B. P. Abbott"}, Year: 2016, Tags: []string{"physics"},
+		Text: "On September 14, 2015 at 09:50:45 UTC the two detectors of the Laser Interferometer\nGravitational-Wave Observatory simultaneously observed a transient gravitational-wave signal."},
+	{ID: "optics", Title: "Quantum optics", Authors: []string{"Li Jiang"}, Year: 2010,
+		Text: "Waves of light behave as particles. Gravitational effects are ignored, the waves are gravitational only in theory."},
+	{ID: "google", Title: "Why Google stores billions of lines of code in a single repository", Authors: []string{"Rachel Potvin", "Josh Levenberg"}, Year: 2016, Tags: []string{"Engineering"},
+		Text: "Early Google employees decided to work with a shared codebase managed through a centralized source control system."},
+}
+
+func Test_ParseQuery(t *testing.T) {
+	tests := []struct {
+		input  string
+		output Query
+	}{
+		{"Gravitational waves", Query{Phrases: [][]string{{"gravitational"}, {"waves"}}}},
+		{`"gravitational waves" author:abbott year:2016`, Query{Phrases: [][]string{{"gravitational", "waves"}}, Author: "abbott", Year: 2016}},
+		{`title:"black hole" tag:physics gravitational-wave`, Query{Phrases: [][]string{{"gravitational", "wave"}}, Title: "black hole", Tag: "physics"}},
+		{"http://example.org", Query{Phrases: [][]string{{"http", "example", "org"}}}},
+	}
+	for _, test := range tests {
+		q := ParseQuery(test.input)
+		if !reflect.DeepEqual(q, test.output) {
+			t.Errorf("ParseQuery(%v) = %+v", test.input, q)
+			t.Errorf("Output should be: %+v", test.output)
+		}
+	}
+}
+
+func Test_Search(t *testing.T) {
+	idx := openTestIndex(t)
+	for _, doc := range testDocs {
+		if err := idx.Add("ana", doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query  string
+		output []string // document ids
+	}{
+		{"gravitational", []string{"waves", "optics"}},
+		{"WAVES", []string{"waves", "optics"}},
+		{`"gravitational waves"`, []string{"waves"}},
+		{`"waves gravitational"`, []string{}},
+		{"gravitational author:jiang", []string{"optics"}},
+		{"year:2016", []string{"waves", "google"}},
+		{"tag:engineering", []string{"google"}},
+		{`title:"black hole"`, []string{"waves"}},
+		{"codebase light", []string{}},
+		{"missing", []string{}},
+	}
+	for _, test := range tests {
+		results, err := idx.Search("ana", test.query, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		if strings.Join(ids, " ") != strings.Join(test.output, " ") {
+			t.Errorf("Search(%v) = %v", test.query, ids)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+
+	// indexes are per user
+	if results, _ := idx.Search("bob", "gravitational", 0); len(results) != 0 {
+		t.Errorf("Search() of other user = %v", results)
+	}
+
+	// documents are updated and removed incrementally
+	idx.Add("ana", Document{ID: "optics", Title: "Quantum optics", Text: "Light only"})
+	idx.SetTags("ana", "google", []string{"read"})
+	idx.Remove("ana", "waves")
+	for query, want := range map[string]int{"gravitational": 0, "light": 1, "tag:read": 1, "tag:engineering": 0} {
+		if results, _ := idx.Search("ana", query, 0); len(results) != want {
+			t.Errorf("Search(%v) after update = %v results, should be %v", query, len(results), want)
+		}
+	}
+	if err := idx.RemoveUser("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := idx.Search("ana", "light", 0); len(results) != 0 || idx.Has("ana", "optics") {
+		t.Errorf("Search() after RemoveUser() = %v", results)
+	}
+	if err := idx.RemoveUser("ana"); err != nil {
+		t.Errorf("RemoveUser() of user without index = %v", err)
+	}
+}
+
+func Test_Encrypted(t *testing.T) {
+	idx := openTestIndex(t)
+	idx.Add("ana", testDocs[0])
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600)
+	keys, _ := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	encrypted, err := Open(idx.db, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Has("ana", testDocs[0].ID) {
+		t.Errorf("unencrypted index was kept")
+	}
+	for _, doc := range testDocs {
+		if err := encrypted.Add("ana", doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := encrypted.Search("ana", `"gravitational waves" year:2016`, 0)
+	if err != nil || len(results) != 1 || results[0].ID != "waves" || len(results[0].Snippet) == 0 {
+		t.Errorf("Search() of encrypted index = %+v, %v", results, err)
+	}
+	encrypted.Remove("ana", "optics")
+	if results, _ := encrypted.Search("ana", "light", 0); len(results) != 0 {
+		t.Errorf("Search() after Remove() = %+v", results)
+	}
+
+	idx.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(searchBucket).ForEach(func(user, v []byte) error {
+			if string(user) == "ana" {
+				t.Errorf("user bucket was not renamed")
+			}
+			u := tx.Bucket(searchBucket).Bucket(user)
+			for _, name := range [][]byte{docsBucket, postingsBucket} {
+				u.Bucket(name).ForEach(func(k, v []byte) error {
+					if bytes.Contains(k, []byte("gravitational")) || bytes.Contains(k, []byte("waves")) || !encrypt.Sealed(v) {
+						t.Errorf("%s entry %q was stored unencrypted", name, k)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	})
+	if _, err := Open(idx.db, nil); err == nil {
+		t.Errorf("Open() of encrypted index without key should fail")
+	}
+}
+
+func Test_snippet(t *testing.T) {
+	text := "one two three four five six seven eight nine ten Gravitational\nwaves eleven twelve"
+	tests := []struct {
+		phrases [][]string
+		output  string // matches are marked with []
+	}{
+		{[][]string{{"gravitational", "waves"}}, "… three four five six seven eight nine ten [Gravitational] [waves] eleven twelve"},
+		{[][]string{{"two"}}, "one [two] three four five six seven eight nine ten Gravitational waves eleven twelve"},
+		{nil, "one two three four five six seven eight nine ten Gravitational waves eleven twelve"},
+	}
+	for _, test := range tests {
+		out := ""
+		for _, f := range snippet(text, test.phrases) {
+			if f.Match {
+				out += "[" + f.Text + "]"
+			} else {
+				out += f.Text
+			}
+		}
+		if out != test.output {
+			t.Errorf("snippet(%v) = %v", test.phrases, out)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
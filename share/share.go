@@ -0,0 +1,319 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// MaxValidity is the longest time share link could work
+const MaxValidity = 30 * 24 * time.Hour
+
+// keepExpired is how long expired and revoked links stay in the list
+const keepExpired = 30 * 24 * time.Hour
+
+var (
+	shareBucket = []byte("share")
+	linksBucket = []byte("links")
+	secretKey   = []byte("secret")
+)
+
+var (
+	// ErrNotFound is returned for unknown links and links with wrong
+	// signature
+	ErrNotFound = apperror.New(apperror.NotFound, "Share link does not exist")
+	// ErrExpired is returned for links used after they expired
+	ErrExpired = apperror.New(apperror.NotFound, "Share link has expired")
+	// ErrRevoked is returned for links revoked by their owner
+	ErrRevoked = apperror.New(apperror.NotFound, "Share link was revoked")
+	// ErrUsed is returned for single use links that were already used
+	ErrUsed = apperror.New(apperror.NotFound, "Share link was already used")
+)
+
+// Link is download link to article in the library of the user, which
+// works without logging in
+type Link struct {
+	ID        string
+	User      string
+	ItemID    string
+	Title     string
+	Created   time.Time
+	Expires   time.Time
+	SingleUse bool
+	Uses      int
+	LastUsed  time.Time
+	Revoked   bool
+}
+
+// Active reports whether the link still works
+func (l Link) Active() bool {
+	return l.check(time.Now()) == nil
+}
+
+// check returns reason the link does not work at time now
+func (l Link) check(now time.Time) error {
+	switch {
+	case l.Revoked:
+		return ErrRevoked
+	case now.After(l.Expires):
+		return ErrExpired
+	case l.SingleUse && l.Uses > 0:
+		return ErrUsed
+	}
+	return nil
+}
+
+// Store keeps share links and the key signing them in bbolt database,
+// both are encrypted when keys are set
+type Store struct {
+	db     *bolt.DB
+	keys   *encrypt.Keyring
+	secret []byte
+	now    func() time.Time
+}
+
+// Open creates share bucket in the database, signing key is generated on
+// the first start. Nil keys leave links unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	s := &Store{db: db, keys: keys, now: time.Now}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(shareBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := b.CreateBucketIfNotExists(linksBucket); err != nil {
+			return err
+		}
+		if err := keys.SealBucket(tx, string(shareBucket), nil); err != nil {
+			return err
+		}
+		label := string(shareBucket) + "/" + string(secretKey)
+		if secret := b.Get(secretKey); secret != nil {
+			s.secret, err = keys.Open(append([]byte{}, secret...), label)
+			return err
+		}
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return err
+		}
+		sealed, err := keys.Seal(s.secret, label)
+		if err != nil {
+			return err
+		}
+		return b.Put(secretKey, sealed)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create share bucket: %v", err)
+	}
+	return s, nil
+}
+
+func links(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket(shareBucket).Bucket(linksBucket)
+}
+
+// Create creates link to library item of the user valid for validity.
+// Links that expired long ago are removed.
+func (s *Store) Create(user, itemID, title string, validity time.Duration, singleUse bool) (Link, error) {
+	if validity <= 0 || validity > MaxValidity {
+		return Link{}, apperror.New(apperror.InvalidInput, fmt.Sprintf("Share link could be valid for at most %v days", int(MaxValidity.Hours()/24)))
+	}
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		return Link{}, err
+	}
+	now := s.now()
+	l := Link{
+		ID:        hex.EncodeToString(b),
+		User:      user,
+		ItemID:    itemID,
+		Title:     title,
+		Created:   now,
+		Expires:   now.Add(validity),
+		SingleUse: singleUse,
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := s.remove(tx, func(old Link) bool {
+			return old.check(now) != nil && now.Sub(old.Expires) > keepExpired
+		}); err != nil {
+			return err
+		}
+		return s.put(tx, l)
+	})
+	return l, err
+}
+
+// Purge removes links that expired before the time, it returns number of
+// removed links
+func (s *Store) Purge(before time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = s.remove(tx, func(l Link) bool { return l.Expires.Before(before) })
+		return err
+	})
+	return removed, err
+}
+
+// RemoveUser removes all links of the user
+func (s *Store) RemoveUser(user string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		_, err := s.remove(tx, func(l Link) bool { return l.User == user })
+		return err
+	})
+}
+
+// remove deletes links matching drop and returns their number
+func (s *Store) remove(tx *bolt.Tx, drop func(l Link) bool) (int, error) {
+	// bucket can not be changed while iterating over it
+	keys := [][]byte{}
+	links(tx).ForEach(func(k, v []byte) error {
+		l := Link{}
+		if s.keys.Unmarshal(v, linkLabel(k), &l) == nil && drop(l) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	for _, k := range keys {
+		if err := links(tx).Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// linkLabel returns label the link stored under the key is sealed with
+func linkLabel(key []byte) string {
+	return string(shareBucket) + "/" + string(linksBucket) + "/" + string(key)
+}
+
+func (s *Store) put(tx *bolt.Tx, l Link) error {
+	data, err := s.keys.Marshal(l, linkLabel([]byte(l.ID)))
+	if err != nil {
+		return err
+	}
+	return links(tx).Put([]byte(l.ID), data)
+}
+
+func (s *Store) get(tx *bolt.Tx, id string) (Link, error) {
+	l := Link{}
+	data := links(tx).Get([]byte(id))
+	if data == nil {
+		return l, ErrNotFound
+	}
+	return l, s.keys.Unmarshal(data, linkLabel([]byte(id)), &l)
+}
+
+// Sign returns signature of the link, it covers the article and expiry,
+// so they could not be changed in the url
+func (s *Store) Sign(l Link) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%v\n%v\n%v\n%v", l.ID, l.User, l.ItemID, l.Expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Counted reports whether serving the file uses the link. Range requests
+// (pdf viewers read files in parts) are not counted, so single use links
+// have to ignore the range and send the whole file with their only use.
+func (l Link) Counted(rangeRequest bool) bool {
+	return l.SingleUse || !rangeRequest
+}
+
+// Check verifies the link without counting its use, so the file could be
+// read before the use is counted. The link is returned with the error
+// too, so failed attempts could be recorded with the owner.
+func (s *Store) Check(id, signature string) (Link, error) {
+	l := Link{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		l, err = s.verify(tx, id, signature)
+		return err
+	})
+	return l, err
+}
+
+// Use verifies the link and counts its use. The link is returned with
+// the error too, so failed attempts could be recorded with the owner.
+func (s *Store) Use(id, signature string) (Link, error) {
+	l := Link{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if l, err = s.verify(tx, id, signature); err != nil {
+			return err
+		}
+		l.Uses++
+		l.LastUsed = s.now()
+		return s.put(tx, l)
+	})
+	return l, err
+}
+
+// verify returns the link when its signature is valid and it still works
+func (s *Store) verify(tx *bolt.Tx, id, signature string) (Link, error) {
+	l, err := s.get(tx, id)
+	if err != nil {
+		return l, err
+	}
+	if !hmac.Equal([]byte(s.Sign(l)), []byte(signature)) {
+		return Link{}, ErrNotFound
+	}
+	return l, l.check(s.now())
+}
+
+// Get returns link of the user
+func (s *Store) Get(user, id string) (Link, error) {
+	l := Link{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		l, err = s.get(tx, id)
+		if err == nil && l.User != user {
+			return ErrNotFound
+		}
+		return err
+	})
+	return l, err
+}
+
+// Revoke stops the link of the user from working
+func (s *Store) Revoke(user, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		l, err := s.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if l.User != user {
+			return ErrNotFound
+		}
+		l.Revoked = true
+		return s.put(tx, l)
+	})
+}
+
+// List returns links of the user, the newest first. Non empty itemID
+// returns only links to that article.
+func (s *Store) List(user, itemID string) ([]Link, error) {
+	list := []Link{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return links(tx).ForEach(func(k, v []byte) error {
+			l := Link{}
+			if err := s.keys.Unmarshal(v, linkLabel(k), &l); err != nil {
+				return err
+			}
+			if l.User == user && (len(itemID) == 0 || l.ItemID == itemID) {
+				list = append(list, l)
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	return list, err
+}
@@ -0,0 +1,231 @@
+package share
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+func openStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_Create(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	tests := []struct {
+		validity time.Duration
+		valid    bool
+	}{
+		{time.Hour, true},
+		{MaxValidity, true},
+		{MaxValidity + time.Hour, false},
+		{0, false},
+	}
+	for _, test := range tests {
+		_, err := s.Create("ana", "item", "Bees", test.validity, false)
+		if (err == nil) != test.valid {
+			t.Errorf("Create(%v) = %v", test.validity, err)
+			t.Errorf("Output should be valid: %v", test.valid)
+		}
+	}
+
+	list, _ := s.List("ana", "")
+	if len(list) != 2 {
+		t.Fatalf("List() = %+v", list)
+	}
+	if other, _ := s.List("ana", "other"); len(other) != 0 {
+		t.Errorf("List() of other item = %+v", other)
+	}
+	if err := s.Revoke("bob", list[0].ID); err != ErrNotFound {
+		t.Errorf("Revoke() revoked link of another user")
+	}
+	if _, err := s.Get("bob", list[0].ID); err != ErrNotFound {
+		t.Errorf("Get() returned link of another user")
+	}
+
+	// links expired long ago are removed
+	now := time.Now()
+	s.now = func() time.Time { return now.Add(MaxValidity + keepExpired + time.Hour) }
+	s.Create("ana", "item", "Bees", time.Hour, false)
+	if list, _ := s.List("ana", ""); len(list) != 1 {
+		t.Errorf("List() = %+v, expired links should be removed", list)
+	}
+}
+
+func Test_Use(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	link, _ := s.Create("ana", "item", "Bees", time.Hour, false)
+	once, _ := s.Create("ana", "item", "Bees", time.Hour, true)
+	revoked, _ := s.Create("ana", "item", "Bees", time.Hour, false)
+	s.Revoke("ana", revoked.ID)
+
+	tests := []struct {
+		id        string
+		signature string
+		err       error
+	}{
+		{link.ID, s.Sign(link), nil},
+		{link.ID, s.Sign(link), nil},
+		{link.ID, s.Sign(once), ErrNotFound},
+		{"unknown", s.Sign(link), ErrNotFound},
+		{once.ID, s.Sign(once), nil},
+		{once.ID, s.Sign(once), ErrUsed},
+		{revoked.ID, s.Sign(revoked), ErrRevoked},
+	}
+	for _, test := range tests {
+		l, err := s.Use(test.id, test.signature)
+		if err != test.err {
+			t.Errorf("Use(%v, %v) = %v", test.id, test.signature, err)
+			t.Errorf("Output should be: %v", test.err)
+		}
+		// owner is known for audit of failed attempts with valid signature
+		if err != ErrNotFound && l.User != "ana" {
+			t.Errorf("Use(%v) = %+v", test.id, l)
+		}
+	}
+	if l, _ := s.Get("ana", link.ID); l.Uses != 2 || !l.LastUsed.Equal(now) {
+		t.Errorf("Get() = %+v, link should be used twice", l)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := s.Use(link.ID, s.Sign(link)); err != ErrExpired {
+		t.Errorf("Use() of expired link = %v", err)
+	}
+
+	// signing key survives restart
+	reopened, err := Open(s.db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Sign(link) != s.Sign(link) {
+		t.Errorf("signature changed after reopening the store")
+	}
+
+	// links and signing key are encrypted when encryption is enabled
+	keyFile := filepath.Join(t.TempDir(), "key")
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600)
+	keys, _ := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	encrypted, err := Open(s.db, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Sign(link) != s.Sign(link) {
+		t.Errorf("signature changed after encryption was enabled")
+	}
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(shareBucket)
+		if !encrypt.Sealed(b.Get(secretKey)) || !encrypt.Sealed(b.Bucket(linksBucket).Get([]byte(link.ID))) {
+			t.Errorf("share bucket was not encrypted")
+		}
+		return nil
+	})
+	if l, err := encrypted.Get("ana", link.ID); err != nil || l.Uses != 2 {
+		t.Errorf("Get() of encrypted link = %+v, %v", l, err)
+	}
+}
+
+func Test_Check(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+	once, _ := s.Create("ana", "item", "Bees", time.Hour, true)
+
+	// checking the link before the file is read does not use it
+	for i := 0; i < 2; i++ {
+		if l, err := s.Check(once.ID, s.Sign(once)); err != nil || l.User != "ana" {
+			t.Errorf("Check() = %+v, %v", l, err)
+		}
+	}
+	if _, err := s.Check(once.ID, s.Sign(Link{ID: once.ID})); err != ErrNotFound {
+		t.Errorf("Check() with wrong signature = %v", err)
+	}
+	if l, _ := s.Get("ana", once.ID); l.Uses != 0 {
+		t.Errorf("Check() counted use: %+v", l)
+	}
+	if _, err := s.Use(once.ID, s.Sign(once)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Check(once.ID, s.Sign(once)); err != ErrUsed {
+		t.Errorf("Check() of used link = %v", err)
+		t.Errorf("Output should be: %v", ErrUsed)
+	}
+}
+
+func Test_Counted(t *testing.T) {
+	tests := []struct {
+		singleUse    bool
+		rangeRequest bool
+		counted      bool
+	}{
+		{false, false, true},
+		{false, true, false},
+		{true, false, true},
+		{true, true, true},
+	}
+	for _, test := range tests {
+		l := Link{SingleUse: test.singleUse}
+		if counted := l.Counted(test.rangeRequest); counted != test.counted {
+			t.Errorf("Counted(%v) of single use %v = %v", test.rangeRequest, test.singleUse, counted)
+			t.Errorf("Output should be: %v", test.counted)
+		}
+	}
+}
+
+func Test_Purge(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	now := time.Now()
+	short, _ := s.Create("ana", "item1", "Short", time.Hour, false)
+	long, _ := s.Create("ana", "item2", "Long", 10*24*time.Hour, false)
+	bob, _ := s.Create("bob", "item3", "Bob", 10*24*time.Hour, false)
+
+	removed, err := s.Purge(now.Add(2 * time.Hour))
+	if err != nil || removed != 1 {
+		t.Errorf("Purge() = %v, %v", removed, err)
+		t.Errorf("Output should be: %v, %v", 1, nil)
+	}
+	if _, err := s.Get("ana", short.ID); err != ErrNotFound {
+		t.Errorf("Get() of purged link = %v", err)
+	}
+	if _, err := s.Get("ana", long.ID); err != nil {
+		t.Errorf("Get() of link that still works = %v", err)
+	}
+
+	if err := s.RemoveUser("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.List("ana", ""); len(list) != 0 {
+		t.Errorf("List(ana) = %+v after RemoveUser()", list)
+	}
+	if _, err := s.Get("bob", bob.ID); err != nil {
+		t.Errorf("Get() of other user link = %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// maxAge is how old slash command request could be, older requests could
+// be replayed
+const maxAge = 5 * time.Minute
+
+// Response types, ephemeral responses are visible only to the user who
+// sent the command
+const (
+	Ephemeral = "ephemeral"
+	InChannel = "in_channel"
+)
+
+var (
+	// ErrSignature is returned for requests without valid signature
+	ErrSignature = errors.New("Invalid slash command signature")
+	// ErrExpired is returned for requests with too old timestamp
+	ErrExpired = errors.New("Slash command request has expired")
+)
+
+// Config is chat section of the configuration
+type Config struct {
+	SigningSecret string // signing secret of the app, commands are disabled when empty
+	User          string // library the articles are saved to, defaults to the shared password user
+	WebhookURL    string // incoming webhook used when the command has no response url
+	BaseURL       string // public url of GoScience used in download links
+	LinkValidity  int    // days download links work, defaults to 7
+}
+
+// Command is slash command sent by the chat server
+type Command struct {
+	Command     string // ex. "/paper"
+	Text        string
+	UserID      string
+	UserName    string
+	ChannelID   string
+	TeamID      string
+	ResponseURL string
+}
+
+// Message is message posted to the chat
+type Message struct {
+	ResponseType string `json:"response_type,omitempty"`
+	Text         string `json:"text"`
+}
+
+// App verifies slash commands and posts responses to the chat server
+type App struct {
+	Config Config
+	Client *http.Client
+	now    func() time.Time
+}
+
+// New creates app from the configuration, nil client uses client with
+// 10 second timeout
+func New(config Config, client *http.Client) *App {
+	if config.LinkValidity <= 0 {
+		config.LinkValidity = 7
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &App{Config: config, Client: client, now: time.Now}
+}
+
+// Sign returns signature of the request body sent at timestamp, as
+// computed by the chat server: "v0=" + hex hmac-sha256 of
+// "v0:timestamp:body"
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%v:", timestamp)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks signature and age of the slash command request and
+// parses its form body
+func (a *App) Verify(header http.Header, body []byte) (Command, error) {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Command{}, ErrSignature
+	}
+	if age := a.now().Sub(time.Unix(sent, 0)); age > maxAge || age < -maxAge {
+		return Command{}, ErrExpired
+	}
+	expected := Sign(a.Config.SigningSecret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return Command{}, ErrSignature
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return Command{}, apperror.Wrap(apperror.InvalidInput, err, "Could not parse slash command")
+	}
+	return Command{
+		Command:     form.Get("command"),
+		Text:        strings.TrimSpace(form.Get("text")),
+		UserID:      form.Get("user_id"),
+		UserName:    form.Get("user_name"),
+		ChannelID:   form.Get("channel_id"),
+		TeamID:      form.Get("team_id"),
+		ResponseURL: form.Get("response_url"),
+	}, nil
+}
+
+// Post sends delayed response to the command, the configured incoming
+// webhook is used when the command has no response url
+func (a *App) Post(cmd Command, msg Message) error {
+	target := cmd.ResponseURL
+	if len(target) == 0 {
+		target = a.Config.WebhookURL
+	}
+	if len(target) == 0 {
+		return errors.New("Command has no response url and incoming webhook is not set")
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := a.Client.Post(target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return apperror.Wrap(apperror.UpstreamUnavailable, err, "Chat server is not available")
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return apperror.New(apperror.UpstreamUnavailable, "Chat server status code: "+resp.Status)
+	}
+	return nil
+}
+
+// SignLink returns signature of download link to article in the library
+// of the user. The key is derived from the signing secret, so links stop
+// working when the secret is rotated.
+func (a *App) SignLink(user, id string, expires time.Time) string {
+	return a.linkSignature(user, id, expires.Unix())
+}
+
+// VerifyLink reports whether download link signature is valid and the
+// link has not expired
+func (a *App) VerifyLink(user, id string, expires int64, sig string) bool {
+	if a.now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(a.linkSignature(user, id, expires)), []byte(sig))
+}
+
+// LinkExpires returns expiry of link created now
+func (a *App) LinkExpires() time.Time {
+	return a.now().Add(time.Duration(a.Config.LinkValidity) * 24 * time.Hour)
+}
+
+func (a *App) linkSignature(user, id string, expires int64) string {
+	key := hmac.New(sha256.New, []byte(a.Config.SigningSecret))
+	key.Write([]byte("download link"))
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	fmt.Fprintf(mac, "%v\n%v\n%v", user, id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,110 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_Verify(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	a := New(Config{SigningSecret: "secret"}, nil)
+	a.now = func() time.Time { return now }
+
+	body := []byte("command=%2Fpaper&text=10.1000%2Fxyz123+&user_name=ana&response_url=http%3A%2F%2Fchat%2Fresponse")
+	current := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	tests := []struct {
+		timestamp string
+		signature string
+		body      []byte
+		err       error
+	}{
+		{current, Sign("secret", current, body), body, nil},
+		{current, Sign("other", current, body), body, ErrSignature},
+		{current, Sign("secret", current, body), []byte("command=%2Fpaper&text=10.1000%2Fother"), ErrSignature},
+		{old, Sign("secret", old, body), body, ErrExpired},
+		{"", Sign("secret", "", body), body, ErrSignature},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		header.Set("X-Slack-Request-Timestamp", test.timestamp)
+		header.Set("X-Slack-Signature", test.signature)
+		_, err := a.Verify(header, test.body)
+		if err != test.err {
+			t.Errorf("Verify(%v, %v) = %v", test.timestamp, test.signature, err)
+			t.Errorf("Output should be: %v", test.err)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", current)
+	header.Set("X-Slack-Signature", Sign("secret", current, body))
+	cmd, _ := a.Verify(header, body)
+	expected := Command{Command: "/paper", Text: "10.1000/xyz123", UserName: "ana", ResponseURL: "http://chat/response"}
+	if cmd != expected {
+		t.Errorf("Verify() = %+v", cmd)
+		t.Errorf("Output should be: %+v", expected)
+	}
+}
+
+func Test_Post(t *testing.T) {
+	received := map[string]Message{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := Message{}
+		json.NewDecoder(r.Body).Decode(&msg)
+		received[r.URL.Path] = msg
+	}))
+	defer server.Close()
+
+	a := New(Config{SigningSecret: "secret", WebhookURL: server.URL + "/webhook"}, server.Client())
+	msg := Message{ResponseType: InChannel, Text: "article"}
+	if err := a.Post(Command{ResponseURL: server.URL + "/response"}, msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Post(Command{}, msg); err != nil {
+		t.Fatal(err)
+	}
+	if received["/response"] != msg || received["/webhook"] != msg {
+		t.Errorf("received messages = %+v", received)
+	}
+
+	a.Config.WebhookURL = ""
+	if err := a.Post(Command{}, msg); err == nil {
+		t.Errorf("Post() without response url returned no error")
+	}
+}
+
+func Test_VerifyLink(t *testing.T) {
+	a := New(Config{SigningSecret: "secret"}, nil)
+	expires := a.LinkExpires()
+	sig := a.SignLink("ana", "item", expires)
+	tests := []struct {
+		user    string
+		id      string
+		expires int64
+		valid   bool
+	}{
+		{"ana", "item", expires.Unix(), true},
+		{"bob", "item", expires.Unix(), false},
+		{"ana", "other", expires.Unix(), false},
+		{"ana", "item", expires.Unix() + 1, false},
+	}
+	for _, test := range tests {
+		if valid := a.VerifyLink(test.user, test.id, test.expires, sig); valid != test.valid {
+			t.Errorf("VerifyLink(%v, %v, %v) = %v", test.user, test.id, test.expires, valid)
+			t.Errorf("Output should be: %v", test.valid)
+		}
+	}
+	expired := time.Now().Add(-time.Minute)
+	if a.VerifyLink("ana", "item", expired.Unix(), a.SignLink("ana", "item", expired)) {
+		t.Errorf("VerifyLink() accepted expired link")
+	}
+	rotated := New(Config{SigningSecret: "rotated"}, nil)
+	if rotated.VerifyLink("ana", "item", expires.Unix(), sig) {
+		t.Errorf("VerifyLink() accepted link signed with old secret")
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// Encrypted seals files before they are written to the storage and opens
+// them when they are read. Files are sealed with their key as label, so
+// they could not be swapped. Files written before encryption was enabled
+// are read as they are.
+type Encrypted struct {
+	Storage
+	keys *encrypt.Keyring
+}
+
+// NewEncrypted wraps the storage
+func NewEncrypted(s Storage, keys *encrypt.Keyring) *Encrypted {
+	return &Encrypted{Storage: s, keys: keys}
+}
+
+// Put seals and writes the file
+func (e *Encrypted) Put(key string, data []byte) error {
+	sealed, err := e.keys.Seal(data, key)
+	if err != nil {
+		return err
+	}
+	return e.Storage.Put(key, sealed)
+}
+
+// Get reads and opens the file
+func (e *Encrypted) Get(key string) ([]byte, error) {
+	data, err := e.Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.keys.Open(data, key)
+}
+
+// Reseal seals files written before encryption was enabled and encrypts
+// data keys of files sealed with rotated keys again, it returns number of
+// changed files. Missing files are skipped.
+func (e *Encrypted) Reseal(keys []string) (int, error) {
+	changed := 0
+	for _, key := range keys {
+		data, err := e.Storage.Get(key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		data, ok, err := e.keys.Reseal(data, key)
+		if err != nil {
+			return changed, err
+		}
+		if !ok {
+			continue
+		}
+		if err := e.Storage.Put(key, data); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config holds settings of S3 compatible object storage (AWS S3, MinIO,
+// Ceph...)
+type S3Config struct {
+	Endpoint  string // ex. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string // defaults to us-east-1
+	Bucket    string
+	Prefix    string // prepended to keys, ex. "goscience/"
+	AccessKey string
+	SecretKey string
+	PathStyle bool // bucket in the path instead of the host name, needed by MinIO
+	Timeout   int  // seconds, defaults to 60
+}
+
+// S3 keeps files as objects of S3 bucket, requests are signed with AWS
+// signature version 4
+type S3 struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 creates S3 storage or returns an error if the configuration is
+// not complete. Requests are sent through transport of the base client,
+// so its proxy and CA bundle are used, nil base uses the default
+// transport.
+func NewS3(conf S3Config, base *http.Client) (*S3, error) {
+	if len(conf.Region) == 0 {
+		conf.Region = "us-east-1"
+	}
+	if len(conf.Endpoint) == 0 {
+		conf.Endpoint = "https://s3." + conf.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(conf.Endpoint, "/"))
+	if err != nil || len(endpoint.Host) == 0 {
+		return nil, fmt.Errorf("Could not parse S3 endpoint: %v", conf.Endpoint)
+	}
+	if len(conf.Bucket) == 0 || len(conf.AccessKey) == 0 || len(conf.SecretKey) == 0 {
+		return nil, fmt.Errorf("S3 storage needs bucket, access key and secret key")
+	}
+	timeout := 60 * time.Second
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	if base != nil {
+		client.Transport = base.Transport
+	}
+	return &S3{conf: conf, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+// objectURL returns url of the object with the key
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	p := "/" + s.conf.Prefix + key
+	if s.conf.PathStyle {
+		p = "/" + s.conf.Bucket + p
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+	}
+	u.Path = u.Path + p
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+// s3Error is error response of S3 api
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends signed request for the object and returns response body
+func (s *S3) do(method, key string, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if method == "PUT" {
+		kind := mime.TypeByExtension(path.Ext(key))
+		if len(kind) == 0 {
+			kind = "application/octet-stream"
+		}
+		req.Header.Set("Content-Type", kind)
+	}
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	sign(req, s.conf.AccessKey, s.conf.SecretKey, s.conf.Region, payload, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("S3 %v %v: %v", method, key, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, fmt.Errorf("S3 %v %v: %v", method, key, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return resp, nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		e := s3Error{}
+		xml.Unmarshal(data, &e)
+		return resp, nil, fmt.Errorf("S3 %v %v: %v %v %v", method, key, resp.Status, e.Code, e.Message)
+	}
+	return resp, data, nil
+}
+
+// Put uploads the object, uploads are atomic
+func (s *S3) Put(key string, data []byte) error {
+	_, _, err := s.do("PUT", key, data)
+	return err
+}
+
+// Get downloads the object
+func (s *S3) Get(key string) ([]byte, error) {
+	_, data, err := s.do("GET", key, nil)
+	return data, err
+}
+
+// Exists reports whether the object exists
+func (s *S3) Exists(key string) (bool, error) {
+	_, _, err := s.do("HEAD", key, nil)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the object, S3 does not report missing objects
+func (s *S3) Delete(key string) error {
+	_, _, err := s.do("DELETE", key, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// sign adds AWS signature version 4 to the request. Host and all headers
+// set on the request are signed, payload is sha256 hash of the body.
+func sign(req *http.Request, accessKey, secretKey, region, payload string, now time.Time) {
+	date := now.UTC().Format("20060102T150405Z")
+	day := date[:8]
+	req.Header.Set("X-Amz-Date", date)
+
+	host := req.Host
+	if len(host) == 0 {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := []string{}
+		for _, value := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent encodes everything except unreserved characters as
+// required by the signature, slashes are kept in paths
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+// ErrNotFound is returned when the stored file does not exist
+var ErrNotFound = apperror.New(apperror.NotFound, "Stored file does not exist")
+
+// Storage keeps files under keys, ex. library pdfs under their checksum.
+// Keys are relative paths with forward slashes.
+type Storage interface {
+	// Put writes the file, readers never see partially written files
+	Put(key string, data []byte) error
+	// Get returns the file or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Exists reports whether the file is stored
+	Exists(key string) (bool, error)
+	// Delete removes the file, missing files are not an error
+	Delete(key string) error
+}
+
+// Config selects where files are stored
+type Config struct {
+	Type string // "local" (default) or "s3"
+	S3   S3Config
+	// Shared is set when multiple instances use the same storage, files
+	// are then never deleted since other instances may still use them
+	Shared bool
+}
+
+// New creates storage from configuration, local storage keeps files in
+// the directory. Object storage is reached through transport of the
+// client.
+func New(conf Config, dir string, client *http.Client) (Storage, error) {
+	var s Storage
+	switch conf.Type {
+	case "", "local":
+		local, err := NewLocal(dir)
+		if err != nil {
+			return nil, err
+		}
+		s = local
+	case "s3":
+		s3, err := NewS3(conf.S3, client)
+		if err != nil {
+			return nil, err
+		}
+		s = s3
+	default:
+		return nil, fmt.Errorf("Unknown storage type %v, use local or s3", conf.Type)
+	}
+	if conf.Shared {
+		s = keepFiles{s}
+	}
+	return s, nil
+}
+
+// keepFiles ignores deletes of shared storage
+type keepFiles struct {
+	Storage
+}
+
+func (k keepFiles) Delete(key string) error {
+	return nil
+}
+
+// Copy copies files missing in one storage from another storage, it
+// returns number of copied files. Files missing in both are skipped.
+func Copy(from, to Storage, keys []string) (int, error) {
+	copied := 0
+	for _, key := range keys {
+		ok, err := to.Exists(key)
+		if err != nil {
+			return copied, err
+		}
+		if ok {
+			continue
+		}
+		data, err := from.Get(key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return copied, err
+		}
+		if err := to.Put(key, data); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
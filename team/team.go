@@ -0,0 +1,277 @@
+package team
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// Member roles, viewers read team articles and editors also add, remove
+// and organize them. Owner of the team is editor who manages members.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var teamsBucket = []byte("teams")
+
+var (
+	// ErrNotFound is returned when the team does not exist or the user is
+	// not its member
+	ErrNotFound = apperror.New(apperror.NotFound, "Team does not exist")
+	// ErrForbidden is returned when the role of the user does not allow
+	// the change
+	ErrForbidden = apperror.New(apperror.Forbidden, "Your role in the team does not allow this change")
+)
+
+// Team is group of users sharing a library
+type Team struct {
+	ID      string
+	Name    string
+	Owner   string
+	Members map[string]string // user name to role, the owner included
+	Created time.Time
+}
+
+// Role returns role of the user in the team, empty for non members
+func (t Team) Role(user string) string {
+	return t.Members[user]
+}
+
+// CanEdit reports whether the user could change team articles
+func (t Team) CanEdit(user string) bool {
+	role := t.Role(user)
+	return role == RoleEditor || role == RoleOwner
+}
+
+// MemberNames returns sorted names of team members
+func (t Team) MemberNames() []string {
+	names := []string{}
+	for name := range t.Members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Library returns name under which team articles are kept in the library
+func (t Team) Library() string {
+	return Library(t.ID)
+}
+
+// Library returns library name of team with id, team libraries are kept
+// next to user libraries under "team:" prefix
+func Library(id string) string {
+	return "team:" + id
+}
+
+// Store keeps teams in bbolt database, teams are encrypted when keys are
+// set
+type Store struct {
+	db   *bolt.DB
+	keys *encrypt.Keyring
+}
+
+// Open creates teams bucket in the database. Nil keys leave teams
+// unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(teamsBucket); err != nil {
+			return err
+		}
+		return keys.SealBucket(tx, string(teamsBucket), nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create teams bucket: %v", err)
+	}
+	return &Store{db: db, keys: keys}, nil
+}
+
+// Create creates team owned by the user
+func (s *Store) Create(owner, name string) (Team, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return Team{}, apperror.New(apperror.InvalidInput, "Team name is empty")
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return Team{}, err
+	}
+	t := Team{
+		ID:      hex.EncodeToString(b),
+		Name:    name,
+		Owner:   owner,
+		Members: map[string]string{owner: RoleOwner},
+		Created: time.Now(),
+	}
+	return t, s.db.Update(func(tx *bolt.Tx) error {
+		return s.put(tx, t)
+	})
+}
+
+// teamLabel returns label the team stored under the key is sealed with
+func teamLabel(key []byte) string {
+	return string(teamsBucket) + "/" + string(key)
+}
+
+func (s *Store) put(tx *bolt.Tx, t Team) error {
+	data, err := s.keys.Marshal(t, teamLabel([]byte(t.ID)))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(teamsBucket).Put([]byte(t.ID), data)
+}
+
+func (s *Store) get(tx *bolt.Tx, id string) (Team, error) {
+	t := Team{}
+	data := tx.Bucket(teamsBucket).Get([]byte(id))
+	if data == nil {
+		return t, ErrNotFound
+	}
+	return t, s.keys.Unmarshal(data, teamLabel([]byte(id)), &t)
+}
+
+// Get returns team the user is member of
+func (s *Store) Get(user, id string) (Team, error) {
+	t := Team{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = s.get(tx, id)
+		if err == nil && len(t.Role(user)) == 0 {
+			return ErrNotFound
+		}
+		return err
+	})
+	return t, err
+}
+
+// List returns teams the user is member of, sorted by name
+func (s *Store) List(user string) ([]Team, error) {
+	list := []Team{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(teamsBucket).ForEach(func(k, v []byte) error {
+			t := Team{}
+			if err := s.keys.Unmarshal(v, teamLabel(k), &t); err != nil {
+				return err
+			}
+			if len(t.Role(user)) > 0 {
+				list = append(list, t)
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list, err
+}
+
+// SetMember adds member to the team or changes their role, empty role
+// removes the member. Only the owner manages members and the owner can
+// not be removed.
+func (s *Store) SetMember(owner, id, user, role string) error {
+	if role != "" && role != RoleViewer && role != RoleEditor {
+		return apperror.New(apperror.InvalidInput, "Unknown team role: "+role)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		t, err := s.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if len(t.Role(owner)) == 0 {
+			return ErrNotFound
+		}
+		if t.Owner != owner || user == t.Owner {
+			return ErrForbidden
+		}
+		if len(role) == 0 {
+			delete(t.Members, user)
+		} else {
+			t.Members[user] = role
+		}
+		return s.put(tx, t)
+	})
+}
+
+// Delete removes team of the owner, its articles have to be removed from
+// the library separately
+func (s *Store) Delete(owner, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		t, err := s.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if len(t.Role(owner)) == 0 {
+			return ErrNotFound
+		}
+		if t.Owner != owner {
+			return ErrForbidden
+		}
+		return tx.Bucket(teamsBucket).Delete([]byte(id))
+	})
+}
+
+// RemoveUser removes the user from teams. Teams owned by the user are
+// handed over to the editor with the first name, teams without other
+// members are deleted. When other members of an owned team are only
+// viewers, nothing is changed and error is returned. It returns ids of
+// deleted teams, their articles have to be removed from the library
+// separately.
+func (s *Store) RemoveUser(user string) ([]string, error) {
+	deleted := []string{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		// bucket can not be changed while iterating over it
+		teams := []Team{}
+		err := tx.Bucket(teamsBucket).ForEach(func(k, v []byte) error {
+			t := Team{}
+			if err := s.keys.Unmarshal(v, teamLabel(k), &t); err != nil {
+				return err
+			}
+			if len(t.Role(user)) > 0 {
+				teams = append(teams, t)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range teams {
+			delete(t.Members, user)
+			if t.Owner != user {
+				err = s.put(tx, t)
+			} else if len(t.Members) == 0 {
+				deleted = append(deleted, t.ID)
+				err = tx.Bucket(teamsBucket).Delete([]byte(t.ID))
+			} else {
+				err = s.transfer(tx, t)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// transfer makes the editor with the first name owner of the team
+func (s *Store) transfer(tx *bolt.Tx, t Team) error {
+	for _, name := range t.MemberNames() {
+		if t.Members[name] == RoleEditor {
+			t.Owner = name
+			t.Members[name] = RoleOwner
+			return s.put(tx, t)
+		}
+	}
+	return apperror.New(apperror.InvalidInput, fmt.Sprintf("None of the members of team %v is an editor who could become its owner, make a member editor or remove the members first", t.Name))
+}
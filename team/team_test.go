@@ -0,0 +1,166 @@
+package team
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+func openStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_Members(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	if _, err := s.Create("ana", " "); err == nil {
+		t.Errorf("Create() accepted empty name")
+	}
+	lab, err := s.Create("ana", "Bee lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Create("eve", "Other lab")
+
+	tests := []struct {
+		actor string
+		user  string
+		role  string
+		err   error
+	}{
+		{"ana", "bob", RoleEditor, nil},
+		{"ana", "cid", RoleViewer, nil},
+		{"ana", "dan", RoleOwner, nil}, // owner role can not be given
+		{"bob", "eve", RoleEditor, ErrForbidden},
+		{"eve", "eve", RoleEditor, ErrNotFound},
+		{"ana", "ana", "", ErrForbidden},
+		{"ana", "cid", "", nil},
+	}
+	for _, test := range tests {
+		err := s.SetMember(test.actor, lab.ID, test.user, test.role)
+		if test.role == RoleOwner {
+			if err == nil {
+				t.Errorf("SetMember(%v, %v) accepted owner role", test.user, test.role)
+			}
+			continue
+		}
+		if err != test.err {
+			t.Errorf("SetMember(%v, %v, %v) = %v", test.actor, test.user, test.role, err)
+			t.Errorf("Output should be: %v", test.err)
+		}
+	}
+
+	lab, _ = s.Get("bob", lab.ID)
+	roles := []struct {
+		user    string
+		role    string
+		canEdit bool
+	}{
+		{"ana", RoleOwner, true},
+		{"bob", RoleEditor, true},
+		{"cid", "", false},
+	}
+	for _, test := range roles {
+		if lab.Role(test.user) != test.role || lab.CanEdit(test.user) != test.canEdit {
+			t.Errorf("Role(%v) = %v, %v", test.user, lab.Role(test.user), lab.CanEdit(test.user))
+			t.Errorf("Output should be: %v, %v", test.role, test.canEdit)
+		}
+	}
+	if _, err := s.Get("cid", lab.ID); err != ErrNotFound {
+		t.Errorf("Get() returned team to removed member")
+	}
+	if list, _ := s.List("bob"); len(list) != 1 || list[0].ID != lab.ID {
+		t.Errorf("List(bob) = %+v", list)
+	}
+
+	if err := s.Delete("bob", lab.ID); err != ErrForbidden {
+		t.Errorf("Delete() by editor = %v", err)
+	}
+	if err := s.Delete("ana", lab.ID); err != nil {
+		t.Errorf("Delete() = %v", err)
+	}
+	if list, _ := s.List("bob"); len(list) != 0 {
+		t.Errorf("List(bob) = %+v, team was deleted", list)
+	}
+}
+
+func Test_RemoveUser(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	own, _ := s.Create("ana", "Bee lab")
+	alone, _ := s.Create("ana", "Notes")
+	viewed, _ := s.Create("ana", "Wasp lab")
+	other, _ := s.Create("bob", "Ant lab")
+	s.SetMember("ana", own.ID, "dan", RoleViewer)
+	s.SetMember("ana", own.ID, "cid", RoleEditor)
+	s.SetMember("ana", own.ID, "bob", RoleEditor)
+	s.SetMember("ana", viewed.ID, "bob", RoleViewer)
+	s.SetMember("bob", other.ID, "ana", RoleViewer)
+	s.SetMember("bob", other.ID, "cid", RoleViewer)
+
+	// team with only viewers left would have no owner
+	if _, err := s.RemoveUser("ana"); !errors.Is(err, apperror.ErrInvalidInput) {
+		t.Errorf("RemoveUser() of owner of team with viewers = %v", err)
+	}
+	if team, _ := s.Get("bob", other.ID); len(team.Role("ana")) == 0 {
+		t.Errorf("RemoveUser() changed teams after the error")
+	}
+	s.SetMember("ana", viewed.ID, "bob", "")
+
+	deleted, err := s.RemoveUser("ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("RemoveUser(ana) = %v", deleted)
+		t.Errorf("Output should be: %v", []string{alone.ID, viewed.ID})
+	}
+	for _, id := range deleted {
+		if id != alone.ID && id != viewed.ID {
+			t.Errorf("RemoveUser() deleted team %v with other members", id)
+		}
+	}
+
+	// team with members is handed over to the first editor
+	own, err = s.Get("bob", own.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if own.Owner != "bob" || own.Role("bob") != RoleOwner || own.Role("cid") != RoleEditor || len(own.Role("ana")) > 0 {
+		t.Errorf("team after removing the owner = %+v", own)
+	}
+	if err := s.SetMember("bob", own.ID, "dan", RoleEditor); err != nil {
+		t.Errorf("new owner could not manage members: %v", err)
+	}
+
+	other, err = s.Get("bob", other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Role("ana")) > 0 || other.Role("cid") != RoleViewer {
+		t.Errorf("Members = %v, only ana should be removed", other.Members)
+	}
+}
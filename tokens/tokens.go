@@ -0,0 +1,169 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// prefix makes tokens recognizable in configuration files and logs
+const prefix = "gs_"
+
+var tokensBucket = []byte("tokens")
+
+// ErrNotFound is returned when the token does not exist
+var ErrNotFound = apperror.New(apperror.NotFound, "Token does not exist")
+
+// Token is api token used by applications that can not use the login
+// form, such as e-readers and webdav clients. Only the hash of the token
+// is stored.
+type Token struct {
+	ID       string // first characters of the hash, used for revoking
+	User     string
+	Name     string // description entered by the user, ex. "Tablet"
+	Created  time.Time
+	LastUsed time.Time
+}
+
+// Store keeps tokens in bbolt database, tokens are encrypted when keys
+// are set
+type Store struct {
+	db   *bolt.DB
+	keys *encrypt.Keyring
+}
+
+// Open creates tokens bucket in the database. Nil keys leave tokens
+// unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tokensBucket); err != nil {
+			return err
+		}
+		return keys.SealBucket(tx, string(tokensBucket), nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create tokens bucket: %v", err)
+	}
+	return &Store{db: db, keys: keys}, nil
+}
+
+// Create creates new token of the user. The token value is returned only
+// once, it can not be recovered later.
+func (s *Store) Create(user, name string) (string, Token, error) {
+	if len(user) == 0 {
+		return "", Token{}, apperror.New(apperror.Internal, "token user is not set")
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", Token{}, err
+	}
+	value := prefix + hex.EncodeToString(b)
+	hash := hashToken(value)
+	t := Token{ID: hash[:12], User: user, Name: strings.TrimSpace(name), Created: time.Now()}
+	if len(t.Name) == 0 {
+		t.Name = "Token " + t.ID[:6]
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.putToken(tx.Bucket(tokensBucket), hash, t)
+	})
+	return value, t, err
+}
+
+// Verify returns user of the token and reports whether the token exists
+func (s *Store) Verify(value string) (string, bool) {
+	if !strings.HasPrefix(value, prefix) {
+		return "", false
+	}
+	hash := hashToken(value)
+	user := ""
+	s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tokensBucket)
+		t, ok := s.getToken(b, hash)
+		if !ok {
+			return nil
+		}
+		user = t.User
+		// last use is recorded with minute precision to avoid writing on
+		// every request
+		if time.Since(t.LastUsed) > time.Minute {
+			t.LastUsed = time.Now()
+			return s.putToken(b, hash, t)
+		}
+		return nil
+	})
+	return user, len(user) > 0
+}
+
+// List returns tokens of the user, the newest first
+func (s *Store) List(user string) ([]Token, error) {
+	list := []Token{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).ForEach(func(k, v []byte) error {
+			t := Token{}
+			if err := s.keys.Unmarshal(v, tokenLabel(k), &t); err != nil {
+				return err
+			}
+			if t.User == user {
+				list = append(list, t)
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	return list, err
+}
+
+// Revoke deletes token of the user
+func (s *Store) Revoke(user, id string) error {
+	if len(id) == 0 {
+		return ErrNotFound
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tokensBucket)
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(id)); k != nil && strings.HasPrefix(string(k), id); k, v = c.Next() {
+			t := Token{}
+			if err := s.keys.Unmarshal(v, tokenLabel(k), &t); err == nil && t.User == user {
+				return b.Delete(k)
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenLabel returns label the token stored under the key is sealed with
+func tokenLabel(key []byte) string {
+	return string(tokensBucket) + "/" + string(key)
+}
+
+func (s *Store) getToken(b *bolt.Bucket, hash string) (Token, bool) {
+	t := Token{}
+	data := b.Get([]byte(hash))
+	if data == nil || s.keys.Unmarshal(data, tokenLabel([]byte(hash)), &t) != nil {
+		return t, false
+	}
+	return t, true
+}
+
+func (s *Store) putToken(b *bolt.Bucket, hash string, t Token) error {
+	data, err := s.keys.Marshal(t, tokenLabel([]byte(hash)))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(hash), data)
+}
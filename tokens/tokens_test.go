@@ -0,0 +1,71 @@
+package tokens
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+)
+
+func openTestStore(t *testing.T) *Store {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "tokens.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func Test_Store(t *testing.T) {
+	s := openTestStore(t)
+	value, token, err := s.Create("ana", "Tablet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, "gs_") || token.User != "ana" || token.Name != "Tablet" {
+		t.Errorf("Create() = %v, %+v", value, token)
+	}
+	s.Create("bob", "")
+
+	tests := []struct {
+		value string
+		user  string
+		ok    bool
+	}{
+		{value, "ana", true},
+		{value + "0", "", false},
+		{"", "", false},
+		{strings.TrimPrefix(value, "gs_"), "", false},
+	}
+	for _, test := range tests {
+		user, ok := s.Verify(test.value)
+		if user != test.user || ok != test.ok {
+			t.Errorf("Verify(%v) = %v, %v", test.value, user, ok)
+			t.Errorf("Output should be: %v, %v", test.user, test.ok)
+		}
+	}
+
+	list, _ := s.List("ana")
+	if len(list) != 1 || list[0].ID != token.ID || list[0].LastUsed.IsZero() {
+		t.Errorf("List() = %+v", list)
+	}
+
+	// tokens could only be revoked by their owner
+	if err := s.Revoke("bob", token.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("Revoke() by other user = %v", err)
+	}
+	if err := s.Revoke("ana", token.ID); err != nil {
+		t.Errorf("Revoke() = %v", err)
+	}
+	if _, ok := s.Verify(value); ok {
+		t.Errorf("Verify() should fail after token is revoked")
+	}
+}
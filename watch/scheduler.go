@@ -0,0 +1,98 @@
+package watch
+
+import (
+	"fmt"
+	"time"
+)
+
+// lookback is how far back the first poll of a new watch looks, so the
+// user sees recent works right away
+const lookback = 7 * 24 * time.Hour
+
+// Config is watchlist section of the configuration
+type Config struct {
+	Interval int // hours between polls of a watch, defaults to 24
+}
+
+// Scheduler periodically polls metadata service for new works of all
+// watches
+type Scheduler struct {
+	Store    *Store
+	Interval time.Duration
+	// Poll returns works of the watch registered since the date
+	Poll func(w Watch, since time.Time) ([]Found, error)
+	// AutoFetch is called with new works of watches with AutoFetch set
+	AutoFetch func(w Watch, dois []string)
+	// Notify is called with new works of every watch, ex. to mail the user
+	Notify func(w Watch, found []Found)
+}
+
+// NewScheduler creates scheduler asking poll for new works
+func NewScheduler(store *Store, config Config, poll func(w Watch, since time.Time) ([]Found, error)) *Scheduler {
+	interval := time.Duration(config.Interval) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &Scheduler{Store: store, Interval: interval, Poll: poll}
+}
+
+// Run checks due watches every tick, it never returns
+func (s *Scheduler) Run(tick time.Duration) {
+	for {
+		s.CheckDue()
+		time.Sleep(tick)
+	}
+}
+
+// CheckDue polls watches that were not checked for the interval
+func (s *Scheduler) CheckDue() {
+	watches, err := s.Store.All()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, w := range watches {
+		if time.Since(w.LastChecked) >= s.Interval {
+			s.Check(w)
+		}
+	}
+}
+
+// Check polls single watch and stores new works
+func (s *Scheduler) Check(w Watch) ([]Found, error) {
+	since := w.LastChecked
+	if since.IsZero() {
+		since = w.Created.Add(-lookback)
+	}
+	checked := time.Now()
+
+	found, err := s.Poll(w, since)
+	w.LastChecked = checked
+	w.LastError = ""
+	if err != nil {
+		w.LastError = err.Error()
+		if err := s.Store.Update(w); err != nil {
+			fmt.Println(err)
+		}
+		return nil, err
+	}
+
+	added, err := s.Store.AddFound(w, found)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.Update(w); err != nil {
+		return added, err
+	}
+	if s.Notify != nil && len(added) > 0 {
+		s.Notify(w, added)
+	}
+	if w.AutoFetch && s.AutoFetch != nil && len(added) > 0 {
+		dois := []string{}
+		for _, f := range added {
+			dois = append(dois, f.Doi)
+		}
+		s.AutoFetch(w, dois)
+	}
+	return added, nil
+}
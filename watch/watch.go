@@ -0,0 +1,417 @@
+package watch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// Watch kinds
+const (
+	KindISSN  = "issn"  // journal
+	KindORCID = "orcid" // author
+	KindQuery = "query" // search query
+)
+
+// keepSeen is how long works marked as seen are kept
+const keepSeen = 90 * 24 * time.Hour
+
+var (
+	watchBucket   = []byte("watch")
+	watchesBucket = []byte("watches")
+	foundBucket   = []byte("found")
+)
+
+// ErrNotFound is returned when the watch does not exist
+var ErrNotFound = apperror.New(apperror.NotFound, "Watch does not exist")
+
+var (
+	issnPattern  = regexp.MustCompile(`^(\d{4})-?(\d{3}[\dX])$`)
+	orcidPattern = regexp.MustCompile(`(\d{4}-\d{4}-\d{4}-\d{3}[\dX])$`)
+)
+
+// Watch is subscription of the user to new works of a journal, an author
+// or matching a search query
+type Watch struct {
+	ID          string
+	User        string
+	Kind        string // one of Kind* constants
+	Value       string // issn, orcid or query
+	Name        string // description displayed to the user
+	AutoFetch   bool   // new works are fetched into the library
+	Created     time.Time
+	LastChecked time.Time
+	LastError   string
+}
+
+// Found is new work found by a watch
+type Found struct {
+	Doi     string
+	Title   string
+	Authors []string
+	Journal string
+	Year    int
+	WatchID string
+	Watch   string    // name of the watch
+	Added   time.Time // when the watch found the work
+	Seen    bool
+}
+
+// Store keeps watches and found works in bbolt database. When keys are
+// set, they are encrypted and stored under keyed hashes of user names and
+// dois.
+type Store struct {
+	db   *bolt.DB
+	keys *encrypt.Keyring
+}
+
+// Open creates watch bucket in the database. Nil keys leave watches
+// unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(watchBucket); err != nil {
+			return err
+		}
+		return keys.SealBucket(tx, string(watchBucket), func(path string, key []byte) bool {
+			return path == string(watchBucket) || strings.HasSuffix(path, "/"+string(foundBucket))
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create watch bucket: %v", err)
+	}
+	return &Store{db: db, keys: keys}, nil
+}
+
+// Normalize validates watch value, issn is written with hyphen and orcid
+// url is reduced to orcid
+func Normalize(kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case KindISSN:
+		m := issnPattern.FindStringSubmatch(strings.ToUpper(value))
+		if m == nil {
+			return "", apperror.New(apperror.InvalidInput, "Invalid issn: "+value)
+		}
+		return m[1] + "-" + m[2], nil
+	case KindORCID:
+		m := orcidPattern.FindStringSubmatch(strings.ToUpper(strings.TrimRight(value, "/")))
+		if m == nil {
+			return "", apperror.New(apperror.InvalidInput, "Invalid orcid: "+value)
+		}
+		return m[1], nil
+	case KindQuery:
+		if len(value) == 0 {
+			return "", apperror.New(apperror.InvalidInput, "Search query is empty")
+		}
+		return value, nil
+	}
+	return "", apperror.New(apperror.InvalidInput, "Unknown watch kind: "+kind)
+}
+
+// Add creates watch of the user
+func (s *Store) Add(w Watch) (Watch, error) {
+	value, err := Normalize(w.Kind, w.Value)
+	if err != nil {
+		return w, err
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return w, err
+	}
+	w.ID = hex.EncodeToString(b)
+	w.Value = value
+	w.Name = strings.TrimSpace(w.Name)
+	if len(w.Name) == 0 {
+		w.Name = w.Value
+	}
+	w.Created = time.Now()
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, w.User, true)
+		if err != nil {
+			return err
+		}
+		return s.put(ub.watches, w.ID, ub.label(watchesBucket, w.ID), w)
+	})
+	return w, err
+}
+
+// Update stores existing watch, watches deleted in the meantime are not
+// created again
+func (s *Store) Update(w Watch) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, w.User, false)
+		if err != nil || ub.watches.Get([]byte(w.ID)) == nil {
+			return ErrNotFound
+		}
+		return s.put(ub.watches, w.ID, ub.label(watchesBucket, w.ID), w)
+	})
+}
+
+// Delete removes watch of the user, works it found are kept
+func (s *Store) Delete(user, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, user, false)
+		if err != nil || ub.watches.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return ub.watches.Delete([]byte(id))
+	})
+}
+
+// List returns watches of the user sorted by name
+func (s *Store) List(user string) ([]Watch, error) {
+	list := []Watch{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, user, false)
+		if err != nil {
+			return nil
+		}
+		list, err = s.watches(ub)
+		return err
+	})
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list, err
+}
+
+// All returns watches of all users
+func (s *Store) All() ([]Watch, error) {
+	list := []Watch{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(watchBucket)
+		return root.ForEach(func(k, v []byte) error {
+			watches, err := s.watches(bucketsOf(root, k))
+			list = append(list, watches...)
+			return err
+		})
+	})
+	return list, err
+}
+
+// watches returns watches stored in the buckets of one user
+func (s *Store) watches(ub buckets) ([]Watch, error) {
+	list := []Watch{}
+	err := ub.watches.ForEach(func(k, v []byte) error {
+		w := Watch{}
+		if err := s.keys.Unmarshal(v, ub.label(watchesBucket, string(k)), &w); err != nil {
+			return err
+		}
+		list = append(list, w)
+		return nil
+	})
+	return list, err
+}
+
+// AddFound stores works found by the watch and returns works that were
+// not found before. Seen works older than keepSeen are removed.
+func (s *Store) AddFound(w Watch, works []Found) ([]Found, error) {
+	added := []Found{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, w.User, true)
+		if err != nil {
+			return err
+		}
+		for _, f := range works {
+			if len(f.Doi) == 0 {
+				continue
+			}
+			key, err := s.keys.Name(strings.ToLower(f.Doi))
+			if err != nil {
+				return err
+			}
+			if ub.found.Get([]byte(key)) != nil {
+				continue
+			}
+			f.WatchID, f.Watch, f.Added = w.ID, w.Name, time.Now()
+			if err := s.put(ub.found, key, ub.label(foundBucket, key), f); err != nil {
+				return err
+			}
+			added = append(added, f)
+		}
+
+		_, err = s.removeFound(ub, func(f Found) bool {
+			return f.Seen && time.Since(f.Added) > keepSeen
+		})
+		return err
+	})
+	return added, err
+}
+
+// PurgeFound removes works found before the time from lists of all users,
+// it returns number of removed works
+func (s *Store) PurgeFound(before time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(watchBucket)
+		keys := [][]byte{}
+		root.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			return nil
+		})
+		for _, k := range keys {
+			n, err := s.removeFound(bucketsOf(root, k), func(f Found) bool { return f.Added.Before(before) })
+			if err != nil {
+				return err
+			}
+			removed += n
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// RemoveUser removes watches of the user together with works they found
+func (s *Store) RemoveUser(user string) error {
+	key, err := s.keys.Name(user)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(watchBucket).DeleteBucket([]byte(key))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// removeFound deletes found works matching drop and returns their number
+func (s *Store) removeFound(ub buckets, drop func(f Found) bool) (int, error) {
+	// bucket must not be changed while iterating over it
+	keys := [][]byte{}
+	ub.found.ForEach(func(k, v []byte) error {
+		f := Found{}
+		if s.keys.Unmarshal(v, ub.label(foundBucket, string(k)), &f) == nil && drop(f) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	for _, k := range keys {
+		if err := ub.found.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// Found returns works found for the user, the newest first
+func (s *Store) Found(user string) ([]Found, error) {
+	list := []Found{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, user, false)
+		if err != nil {
+			return nil
+		}
+		return ub.found.ForEach(func(k, v []byte) error {
+			f := Found{}
+			if err := s.keys.Unmarshal(v, ub.label(foundBucket, string(k)), &f); err != nil {
+				return err
+			}
+			list = append(list, f)
+			return nil
+		})
+	})
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Added.After(list[j].Added) })
+	return list, err
+}
+
+// Unseen returns number of found works the user has not seen yet
+func (s *Store) Unseen(user string) int {
+	list, _ := s.Found(user)
+	n := 0
+	for _, f := range list {
+		if !f.Seen {
+			n++
+		}
+	}
+	return n
+}
+
+// MarkSeen marks all found works of the user as seen
+func (s *Store) MarkSeen(user string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		ub, err := s.userBuckets(tx, user, false)
+		if err != nil {
+			return nil
+		}
+		// bucket must not be changed while iterating over it
+		unseen := map[string]Found{}
+		ub.found.ForEach(func(k, v []byte) error {
+			f := Found{}
+			if s.keys.Unmarshal(v, ub.label(foundBucket, string(k)), &f) == nil && !f.Seen {
+				f.Seen = true
+				unseen[string(k)] = f
+			}
+			return nil
+		})
+		for key, f := range unseen {
+			if err := s.put(ub.found, key, ub.label(foundBucket, key), f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// buckets are watches and found buckets of one user
+type buckets struct {
+	key     string // key of the user bucket
+	watches *bolt.Bucket
+	found   *bolt.Bucket
+}
+
+// label returns path of the value in the bucket of the user, values are
+// sealed with it, ex. "watch/<user>/found/<doi>"
+func (ub buckets) label(name []byte, key string) string {
+	return string(watchBucket) + "/" + ub.key + "/" + string(name) + "/" + key
+}
+
+// bucketsOf returns buckets of the user stored under the key
+func bucketsOf(root *bolt.Bucket, key []byte) buckets {
+	ub := root.Bucket(key)
+	return buckets{string(key), ub.Bucket(watchesBucket), ub.Bucket(foundBucket)}
+}
+
+// userBuckets returns watches and found buckets of the user
+func (s *Store) userBuckets(tx *bolt.Tx, user string, create bool) (buckets, error) {
+	root := tx.Bucket(watchBucket)
+	name, err := s.keys.Name(user)
+	if err != nil {
+		return buckets{}, err
+	}
+	key := []byte(name)
+	if !create {
+		if root.Bucket(key) == nil {
+			return buckets{}, ErrNotFound
+		}
+		return bucketsOf(root, key), nil
+	}
+	ub, err := root.CreateBucketIfNotExists(key)
+	if err != nil {
+		return buckets{}, err
+	}
+	if _, err := ub.CreateBucketIfNotExists(watchesBucket); err != nil {
+		return buckets{}, err
+	}
+	if _, err := ub.CreateBucketIfNotExists(foundBucket); err != nil {
+		return buckets{}, err
+	}
+	return bucketsOf(root, key), nil
+}
+
+// put seals the value with the label and stores it under the key
+func (s *Store) put(b *bolt.Bucket, key, label string, value interface{}) error {
+	data, err := s.keys.Marshal(value, label)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
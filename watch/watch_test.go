@@ -0,0 +1,226 @@
+package watch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+func openStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_Normalize(t *testing.T) {
+	tests := []struct {
+		kind   string
+		input  string
+		output string
+		valid  bool
+	}{
+		{KindISSN, "0028-0836", "0028-0836", true},
+		{KindISSN, " 1476468x ", "1476-468X", true},
+		{KindISSN, "1476-46", "", false},
+		{KindORCID, "https://orcid.org/0000-0002-1825-0097/", "0000-0002-1825-0097", true},
+		{KindORCID, "0000-0002-1694-233x", "0000-0002-1694-233X", true},
+		{KindORCID, "0000-0002", "", false},
+		{KindQuery, " gravitational waves ", "gravitational waves", true},
+		{KindQuery, " ", "", false},
+		{"doi", "10.1000/x", "", false},
+	}
+	for _, test := range tests {
+		output, err := Normalize(test.kind, test.input)
+		if output != test.output || (err == nil) != test.valid {
+			t.Errorf("Normalize(%v, %v) = %v, %v", test.kind, test.input, output, err)
+			t.Errorf("Output should be: %v", test.output)
+		}
+	}
+}
+
+func Test_Store(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	w, err := s.Add(Watch{User: "ana", Kind: KindISSN, Value: "00280836", Name: "Nature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Watch{User: "ana", Kind: KindORCID, Value: "0000-0002-1825-0097"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Watch{User: "bob", Kind: KindQuery, Value: "monorepo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := s.List("ana")
+	if len(list) != 2 || list[0].Name != "0000-0002-1825-0097" || list[1].Value != "0028-0836" {
+		t.Errorf("List() = %+v", list)
+	}
+	if all, _ := s.All(); len(all) != 3 {
+		t.Errorf("All() = %v watches, should be 3", len(all))
+	}
+
+	added, err := s.AddFound(w, []Found{{Doi: "10.1000/A"}, {Doi: "10.1000/b"}, {Doi: ""}})
+	if err != nil || len(added) != 2 || added[0].Watch != "Nature" {
+		t.Errorf("AddFound() = %+v, %v", added, err)
+	}
+	added, _ = s.AddFound(w, []Found{{Doi: "10.1000/a"}, {Doi: "10.1000/c"}})
+	if len(added) != 1 || added[0].Doi != "10.1000/c" {
+		t.Errorf("AddFound() returned known work: %+v", added)
+	}
+	if n := s.Unseen("ana"); n != 3 {
+		t.Errorf("Unseen() = %v, should be 3", n)
+	}
+	if err := s.MarkSeen("ana"); err != nil || s.Unseen("ana") != 0 {
+		t.Errorf("MarkSeen() = %v, unseen %v", err, s.Unseen("ana"))
+	}
+	if n := s.Unseen("bob"); n != 0 {
+		t.Errorf("Unseen(bob) = %v", n)
+	}
+
+	if err := s.Delete("bob", w.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() of another user watch = %v", err)
+	}
+	if err := s.Delete("ana", w.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(w); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() of deleted watch = %v", err)
+	}
+	if found, _ := s.Found("ana"); len(found) != 3 {
+		t.Errorf("found works should be kept after watch is deleted: %v", found)
+	}
+
+	if n, err := s.PurgeFound(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PurgeFound() of recent works = %v, %v", n, err)
+	}
+	if n, err := s.PurgeFound(time.Now().Add(time.Second)); err != nil || n != 3 {
+		t.Errorf("PurgeFound() = %v, %v", n, err)
+		t.Errorf("Output should be: %v, %v", 3, nil)
+	}
+	if err := s.RemoveUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.List("bob"); len(list) != 0 {
+		t.Errorf("List(bob) = %+v after RemoveUser()", list)
+	}
+	if err := s.RemoveUser("bob"); err != nil {
+		t.Errorf("RemoveUser() of user without watches = %v", err)
+	}
+}
+
+func Test_Encrypted(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+	w, _ := s.Add(Watch{User: "ana", Kind: KindISSN, Value: "0028-0836", Name: "Nature"})
+	s.AddFound(w, []Found{{Doi: "10.1000/a", Title: "Bees"}})
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600)
+	keys, _ := encrypt.New(encrypt.Config{KeyFile: keyFile})
+	encrypted, err := Open(s.db, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := encrypted.List("ana"); len(list) != 1 || list[0].Name != "Nature" {
+		t.Errorf("List() of encrypted watches = %+v", list)
+	}
+	if added, _ := encrypted.AddFound(w, []Found{{Doi: "10.1000/A"}, {Doi: "10.1000/b"}}); len(added) != 1 {
+		t.Errorf("AddFound() of encrypted store returned known work: %+v", added)
+	}
+	if all, _ := encrypted.All(); len(all) != 1 || all[0].User != "ana" {
+		t.Errorf("All() of encrypted watches = %+v", all)
+	}
+	ana, _ := keys.Name("ana")
+	s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(watchBucket)
+		if root.Bucket([]byte("ana")) != nil {
+			t.Errorf("user bucket was not renamed")
+		}
+		return root.Bucket([]byte(ana)).Bucket(foundBucket).ForEach(func(k, v []byte) error {
+			if strings.Contains(string(k), "10.1000") || !encrypt.Sealed(v) {
+				t.Errorf("found work %q was stored unencrypted", k)
+			}
+			return nil
+		})
+	})
+	if n, err := encrypted.PurgeFound(time.Now().Add(time.Second)); n != 2 || err != nil {
+		t.Errorf("PurgeFound() of encrypted works = %v, %v", n, err)
+	}
+}
+
+func Test_Scheduler(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+	w, _ := s.Add(Watch{User: "ana", Kind: KindQuery, Value: "monorepo", AutoFetch: true})
+	manual, _ := s.Add(Watch{User: "ana", Kind: KindISSN, Value: "0028-0836"})
+
+	since := map[string]time.Time{}
+	sched := NewScheduler(s, Config{}, func(w Watch, from time.Time) ([]Found, error) {
+		since[w.ID] = from
+		if w.Kind == KindISSN {
+			return nil, errors.New("service is down")
+		}
+		return []Found{{Doi: "10.1000/new", Title: "New"}}, nil
+	})
+	fetched := []string{}
+	sched.AutoFetch = func(w Watch, dois []string) { fetched = append(fetched, dois...) }
+	notified := 0
+	sched.Notify = func(w Watch, found []Found) { notified += len(found) }
+
+	sched.CheckDue()
+	if since[w.ID].After(w.Created.Add(-lookback).Add(time.Second)) {
+		t.Errorf("first poll should look back, polled since %v", since[w.ID])
+	}
+	if len(fetched) != 1 || fetched[0] != "10.1000/new" {
+		t.Errorf("AutoFetch() called with %v", fetched)
+	}
+	list, _ := s.List("ana")
+	for _, item := range list {
+		if item.LastChecked.IsZero() {
+			t.Errorf("watch %v was not checked", item.Name)
+		}
+		if item.ID == manual.ID && item.LastError != "service is down" {
+			t.Errorf("watch error = %v", item.LastError)
+		}
+	}
+
+	// watches are not due until the interval passes
+	delete(since, w.ID)
+	sched.CheckDue()
+	if _, ok := since[w.ID]; ok {
+		t.Errorf("watch was polled again before the interval")
+	}
+
+	// known works are not fetched again
+	sched.Interval = 0
+	sched.CheckDue()
+	if len(fetched) != 1 {
+		t.Errorf("AutoFetch() called again with %v", fetched)
+	}
+	if notified != 1 {
+		t.Errorf("Notify() called with %v works", notified)
+	}
+}
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries hex encoded HMAC-SHA256 of the request body
+// keyed with the subscription secret, ex. "sha256=5d5b..."
+const SignatureHeader = "X-GoScience-Signature"
+
+// retries are pauses before repeated deliveries of failed events, the
+// event is dropped after the last retry
+var retries = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour}
+
+// Dispatcher posts events to subscriptions. Events are queued in the
+// database, so deliveries are retried after restart.
+type Dispatcher struct {
+	Store  *Store
+	Client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+// timeout limits duration of single delivery
+const timeout = 10 * time.Second
+
+// NewDispatcher creates dispatcher posting events with the client, nil
+// client is replaced with client using timeout
+func NewDispatcher(store *Store, client *http.Client) *Dispatcher {
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+	return &Dispatcher{Store: store, Client: client, wake: make(chan struct{}, 1), now: time.Now}
+}
+
+// Emit queues event for subscriptions of the user subscribed to the event
+// type. Events with empty user go to subscriptions of all users.
+func (d *Dispatcher) Emit(user, event string, data interface{}) error {
+	subs, err := d.Store.List(user)
+	if err != nil {
+		return err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(Event{ID: id, Type: event, Created: d.now(), User: user, Data: data})
+	if err != nil {
+		return err
+	}
+	list := []pending{}
+	for _, sub := range subs {
+		if sub.Subscribed(event) {
+			list = append(list, pending{ID: id, SubscriptionID: sub.ID, Event: event, Payload: payload, Created: d.now(), NextAttempt: d.now()})
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if err := d.Store.enqueue(list); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued events as soon as they are emitted and retries
+// failed deliveries every tick, it never returns
+func (d *Dispatcher) Run(tick time.Duration) {
+	for {
+		d.DeliverDue()
+		select {
+		case <-d.wake:
+		case <-time.After(tick):
+		}
+	}
+}
+
+// DeliverDue delivers queued events whose retry time has come
+func (d *Dispatcher) DeliverDue() {
+	list, err := d.Store.due(d.now())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, p := range list {
+		sub, err := d.Store.subscription(p.SubscriptionID)
+		if err != nil {
+			continue
+		}
+		d.deliver(sub, p, true)
+	}
+}
+
+// Test posts test event to the subscription of the user right away and
+// returns the delivery, failed test deliveries are not retried
+func (d *Dispatcher) Test(user, id string) (Delivery, error) {
+	sub, err := d.Store.Get(user, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	eventID, err := randomHex(8)
+	if err != nil {
+		return Delivery{}, err
+	}
+	data := map[string]string{"message": "Test delivery from GoScience"}
+	payload, err := json.Marshal(Event{ID: eventID, Type: Test, Created: d.now(), User: user, Data: data})
+	if err != nil {
+		return Delivery{}, err
+	}
+	p := pending{ID: eventID, SubscriptionID: sub.ID, Event: Test, Payload: payload, Created: d.now()}
+	return d.deliver(sub, p, false), nil
+}
+
+// deliver posts event and records the attempt, failed event is queued
+// again when retry is set
+func (d *Dispatcher) deliver(sub Subscription, p pending, retry bool) Delivery {
+	p.Attempts++
+	delivery := Delivery{ID: p.ID, SubscriptionID: sub.ID, Event: p.Event, Attempt: p.Attempts, Time: d.now()}
+	delivery.Status, delivery.Error = d.post(sub, p)
+	delivery.Delivered = len(delivery.Error) == 0
+	if !delivery.Delivered {
+		if !retry || p.Attempts > len(retries) {
+			delivery.Final = true
+		} else {
+			p.NextAttempt = d.now().Add(retries[p.Attempts-1])
+		}
+	}
+	if err := d.Store.record(p, delivery); err != nil {
+		fmt.Println(err)
+	}
+	return delivery
+}
+
+// post sends signed payload, responses other than 2xx are failures
+func (d *Dispatcher) post(sub Subscription, p pending) (int, string) {
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(p.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GoScience-Event", p.Event)
+	req.Header.Set("X-GoScience-Delivery", p.ID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(sub.Secret, p.Payload))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// Sign returns hex encoded HMAC-SHA256 of the payload, receivers compare
+// it with the signature header
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
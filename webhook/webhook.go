@@ -0,0 +1,398 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/greatdanton/goScience/apperror"
+	"github.com/greatdanton/goScience/encrypt"
+)
+
+// Event types
+const (
+	ArticleDownloaded = "article.downloaded"
+	JobCompleted      = "job.completed"
+	JobFailed         = "job.failed"
+	CaptchaRequired   = "captcha.required"
+	SourceUnhealthy   = "source.unhealthy" // sent to subscriptions of all users
+	Test              = "webhook.test"
+)
+
+// Events lists event types users could subscribe to
+var Events = []string{ArticleDownloaded, JobCompleted, JobFailed, CaptchaRequired, SourceUnhealthy}
+
+// keepDeliveries is number of deliveries kept in the log of subscription
+const keepDeliveries = 100
+
+var (
+	webhookBucket       = []byte("webhook")
+	subscriptionsBucket = []byte("subscriptions")
+	queueBucket         = []byte("queue")
+	logBucket           = []byte("log")
+)
+
+// ErrNotFound is returned when the subscription does not exist
+var ErrNotFound = apperror.New(apperror.NotFound, "Webhook does not exist")
+
+// Subscription posts events of the user to the url
+type Subscription struct {
+	ID      string
+	User    string
+	URL     string
+	Events  []string
+	Secret  string // key of payload signature
+	Created time.Time
+}
+
+// Subscribed reports whether subscription receives the event type, test
+// events are sent to every subscription
+func (s Subscription) Subscribed(event string) bool {
+	if event == Test {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is payload posted to subscriptions
+type Event struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Created time.Time   `json:"created"`
+	User    string      `json:"user,omitempty"`
+	Data    interface{} `json:"data"`
+}
+
+// Delivery is attempt to post event to subscription
+type Delivery struct {
+	ID             string // event id, shared by retries of the same event
+	SubscriptionID string
+	Event          string
+	Attempt        int
+	Status         int // http status code, 0 when the request failed
+	Error          string
+	Delivered      bool
+	Final          bool // delivery will not be retried
+	Time           time.Time
+}
+
+// pending is event waiting in the retry queue
+type pending struct {
+	ID             string
+	SubscriptionID string
+	Event          string
+	Payload        []byte
+	Created        time.Time
+	Attempts       int
+	NextAttempt    time.Time
+}
+
+// key sorts queued events by creation time, so they are delivered in
+// order
+func (p pending) key() []byte {
+	return []byte(fmt.Sprintf("%020d-%v-%v", p.Created.UnixNano(), p.ID, p.SubscriptionID))
+}
+
+// Store keeps subscriptions, the retry queue and the delivery log, they
+// are encrypted when keys are set
+type Store struct {
+	db   *bolt.DB
+	keys *encrypt.Keyring
+}
+
+// Open creates webhook buckets in the database. Nil keys leave webhook
+// data unencrypted.
+func Open(db *bolt.DB, keys *encrypt.Keyring) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(webhookBucket)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{subscriptionsBucket, queueBucket, logBucket} {
+			if _, err := root.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return keys.SealBucket(tx, string(webhookBucket), nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not create webhook bucket: %v", err)
+	}
+	return &Store{db: db, keys: keys}, nil
+}
+
+// Subscribe creates subscription of the user, only http and https urls
+// are accepted
+func (s *Store) Subscribe(user, rawurl string, events []string) (Subscription, error) {
+	sub := Subscription{User: user, URL: strings.TrimSpace(rawurl), Created: time.Now()}
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return sub, apperror.New(apperror.InvalidInput, "Invalid webhook url: "+sub.URL)
+	}
+	for _, e := range events {
+		for _, known := range Events {
+			if e == known {
+				sub.Events = append(sub.Events, e)
+			}
+		}
+	}
+	if len(sub.Events) == 0 {
+		return sub, apperror.New(apperror.InvalidInput, "No webhook events selected")
+	}
+	if sub.ID, err = randomHex(6); err != nil {
+		return sub, err
+	}
+	if sub.Secret, err = randomHex(24); err != nil {
+		return sub, err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return s.put(bucket(tx, subscriptionsBucket), sub.ID, label(subscriptionsBucket, sub.ID), sub)
+	})
+	return sub, err
+}
+
+// Get returns subscription of the user
+func (s *Store) Get(user, id string) (Subscription, error) {
+	sub, err := s.subscription(id)
+	if err == nil && sub.User != user {
+		return Subscription{}, ErrNotFound
+	}
+	return sub, err
+}
+
+// subscription returns subscription of any user
+func (s *Store) subscription(id string) (Subscription, error) {
+	sub := Subscription{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := bucket(tx, subscriptionsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return s.keys.Unmarshal(data, label(subscriptionsBucket, id), &sub)
+	})
+	return sub, err
+}
+
+// Delete removes subscription of the user with its log and queued events
+func (s *Store) Delete(user, id string) error {
+	if _, err := s.Get(user, id); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := bucket(tx, subscriptionsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := bucket(tx, logBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		queue := bucket(tx, queueBucket)
+		keys := [][]byte{}
+		queue.ForEach(func(k, v []byte) error {
+			p := pending{}
+			if s.keys.Unmarshal(v, label(queueBucket, string(k)), &p) == nil && p.SubscriptionID == id {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := queue.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns subscriptions of the user, empty user returns
+// subscriptions of all users
+func (s *Store) List(user string) ([]Subscription, error) {
+	list := []Subscription{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return bucket(tx, subscriptionsBucket).ForEach(func(k, v []byte) error {
+			sub := Subscription{}
+			if err := s.keys.Unmarshal(v, label(subscriptionsBucket, string(k)), &sub); err != nil {
+				return err
+			}
+			if len(user) == 0 || sub.User == user {
+				list = append(list, sub)
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, err
+}
+
+// Deliveries returns delivery log of the subscription, the newest first
+func (s *Store) Deliveries(user, id string) ([]Delivery, error) {
+	list := []Delivery{}
+	if _, err := s.Get(user, id); err != nil {
+		return list, err
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, logBucket).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			d := Delivery{}
+			if err := s.keys.Unmarshal(v, label(logBucket, id, string(k)), &d); err != nil {
+				return err
+			}
+			list = append(list, d)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// PurgeDeliveries removes deliveries attempted before the time from logs of
+// all subscriptions, it returns number of removed deliveries
+func (s *Store) PurgeDeliveries(before time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		logs := bucket(tx, logBucket)
+		ids := [][]byte{}
+		logs.ForEach(func(k, v []byte) error {
+			ids = append(ids, append([]byte{}, k...))
+			return nil
+		})
+		for _, id := range ids {
+			log := logs.Bucket(id)
+			keys := [][]byte{}
+			log.ForEach(func(k, v []byte) error {
+				d := Delivery{}
+				if s.keys.Unmarshal(v, label(logBucket, string(id), string(k)), &d) == nil && d.Time.Before(before) {
+					keys = append(keys, append([]byte{}, k...))
+				}
+				return nil
+			})
+			for _, k := range keys {
+				if err := log.Delete(k); err != nil {
+					return err
+				}
+			}
+			removed += len(keys)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// enqueue adds events to the retry queue
+func (s *Store) enqueue(list []pending) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, p := range list {
+			if err := s.put(bucket(tx, queueBucket), string(p.key()), label(queueBucket, string(p.key())), p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// due returns queued events that should be delivered now
+func (s *Store) due(now time.Time) ([]pending, error) {
+	list := []pending{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return bucket(tx, queueBucket).ForEach(func(k, v []byte) error {
+			p := pending{}
+			if err := s.keys.Unmarshal(v, label(queueBucket, string(k)), &p); err != nil {
+				return err
+			}
+			if !p.NextAttempt.After(now) {
+				list = append(list, p)
+			}
+			return nil
+		})
+	})
+	return list, err
+}
+
+// record logs delivery attempt. Delivered and final events are removed
+// from the queue, others are queued again.
+func (s *Store) record(p pending, d Delivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		queue := bucket(tx, queueBucket)
+		key := p.key()
+		if d.Delivered || d.Final {
+			if err := queue.Delete(key); err != nil {
+				return err
+			}
+		} else if queue.Get(key) != nil {
+			// subscription deleted in the meantime has no queued events
+			if err := s.put(queue, string(key), label(queueBucket, string(key)), p); err != nil {
+				return err
+			}
+		}
+
+		if bucket(tx, subscriptionsBucket).Get([]byte(p.SubscriptionID)) == nil {
+			return nil
+		}
+		log, err := bucket(tx, logBucket).CreateBucketIfNotExists([]byte(p.SubscriptionID))
+		if err != nil {
+			return err
+		}
+		// keys sort by insertion, so the oldest deliveries are removed first
+		seq, err := log.NextSequence()
+		if err != nil {
+			return err
+		}
+		k := fmt.Sprintf("%020d", seq)
+		if err := s.put(log, k, label(logBucket, p.SubscriptionID, k), d); err != nil {
+			return err
+		}
+		keys := [][]byte{}
+		log.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			return nil
+		})
+		for len(keys) > keepDeliveries {
+			k := keys[0]
+			keys = keys[1:]
+			if err := log.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func bucket(tx *bolt.Tx, name []byte) *bolt.Bucket {
+	return tx.Bucket(webhookBucket).Bucket(name)
+}
+
+// label returns path of the value in the webhook bucket, values are
+// sealed with it, ex. "webhook/log/<subscription>/<key>"
+func label(name []byte, path ...string) string {
+	return strings.Join(append([]string{string(webhookBucket), string(name)}, path...), "/")
+}
+
+// put seals the value with the label and stores it under the key
+func (s *Store) put(b *bolt.Bucket, key, label string, value interface{}) error {
+	data, err := s.keys.Marshal(value, label)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
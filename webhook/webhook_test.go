@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// receiver records events posted to it and fails while failing is set
+type receiver struct {
+	mu      sync.Mutex
+	events  []Event
+	failing bool
+	secrets map[string]string // subscription secret by url path
+	invalid int               // requests with wrong signature
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if r.Header.Get(SignatureHeader) != "sha256="+Sign(rc.secrets[r.URL.Path], body) {
+		rc.invalid++
+	}
+	if rc.failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	e := Event{}
+	json.Unmarshal(body, &e)
+	rc.events = append(rc.events, e)
+}
+
+func Test_Subscribe(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	tests := []struct {
+		url    string
+		events []string
+		valid  bool
+	}{
+		{"https://lab.example.org/hook", []string{JobCompleted}, true},
+		{"ftp://lab.example.org/hook", []string{JobCompleted}, false},
+		{"lab.example.org/hook", []string{JobCompleted}, false},
+		{"https://lab.example.org/hook", []string{"unknown.event"}, false},
+		{"https://lab.example.org/hook", nil, false},
+	}
+	for _, test := range tests {
+		_, err := s.Subscribe("ana", test.url, test.events)
+		if (err == nil) != test.valid {
+			t.Errorf("Subscribe(%v, %v) = %v", test.url, test.events, err)
+			t.Errorf("Output should be valid: %v", test.valid)
+		}
+	}
+
+	list, _ := s.List("ana")
+	if len(list) != 1 || len(list[0].Secret) == 0 {
+		t.Fatalf("List() = %v", list)
+	}
+	if _, err := s.Get("bob", list[0].ID); err != ErrNotFound {
+		t.Errorf("Get() returned subscription of another user")
+	}
+	if err := s.Delete("bob", list[0].ID); err != ErrNotFound {
+		t.Errorf("Delete() removed subscription of another user")
+	}
+	if err := s.Delete("ana", list[0].ID); err != nil {
+		t.Errorf("Delete() = %v", err)
+	}
+}
+
+func Test_Dispatcher(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+	rc := &receiver{secrets: map[string]string{}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	ana, _ := s.Subscribe("ana", server.URL+"/ana", []string{ArticleDownloaded, SourceUnhealthy})
+	bob, _ := s.Subscribe("bob", server.URL+"/bob", []string{JobCompleted, SourceUnhealthy})
+	rc.secrets["/ana"], rc.secrets["/bob"] = ana.Secret, bob.Secret
+
+	now := time.Now()
+	d := NewDispatcher(s, server.Client())
+	d.now = func() time.Time { return now }
+
+	d.Emit("ana", ArticleDownloaded, map[string]string{"doi": "10.1000/a"})
+	d.Emit("ana", JobCompleted, nil)      // ana is not subscribed
+	d.Emit("", SourceUnhealthy, nil)      // system event goes to everyone
+	d.Emit("bob", ArticleDownloaded, nil) // bob is not subscribed
+	d.DeliverDue()
+	if len(rc.events) != 3 || rc.invalid != 0 {
+		t.Fatalf("delivered events = %+v, invalid signatures: %v", rc.events, rc.invalid)
+	}
+	downloaded := 0
+	for _, e := range rc.events {
+		if e.Type == ArticleDownloaded && e.User == "ana" {
+			downloaded++
+		}
+	}
+	if downloaded != 1 {
+		t.Errorf("delivered events = %+v", rc.events)
+	}
+
+	// failed deliveries are retried after a pause
+	rc.failing = true
+	d.Emit("bob", JobCompleted, nil)
+	d.DeliverDue()
+	d.DeliverDue()
+	log, _ := s.Deliveries("bob", bob.ID)
+	if len(log) != 2 || log[0].Delivered || log[0].Attempt != 1 {
+		t.Fatalf("Deliveries() = %+v", log)
+	}
+	rc.failing = false
+	now = now.Add(retries[0])
+	d.DeliverDue()
+	log, _ = s.Deliveries("bob", bob.ID)
+	if !log[0].Delivered || log[0].Attempt != 2 || log[0].ID != log[1].ID {
+		t.Errorf("retried delivery = %+v", log[0])
+	}
+
+	// events are dropped after the last retry
+	rc.failing = true
+	d.Emit("bob", JobCompleted, nil)
+	for i := 0; i <= len(retries); i++ {
+		d.DeliverDue()
+		now = now.Add(retries[len(retries)-1])
+	}
+	log, _ = s.Deliveries("bob", bob.ID)
+	if !log[0].Final || log[0].Attempt != len(retries)+1 {
+		t.Errorf("last delivery = %+v", log[0])
+	}
+	if due, _ := s.due(now.Add(24 * time.Hour)); len(due) != 0 {
+		t.Errorf("queue = %+v, failed event should be dropped", due)
+	}
+
+	// test deliveries are sent right away and not retried
+	delivery, err := d.Test("ana", ana.ID)
+	if err != nil || delivery.Delivered || !delivery.Final || delivery.Status != http.StatusServiceUnavailable {
+		t.Errorf("Test() = %+v, %v", delivery, err)
+	}
+	if _, err := d.Test("bob", ana.ID); err != ErrNotFound {
+		t.Errorf("Test() delivered to subscription of another user")
+	}
+}
+
+func Test_PurgeDeliveries(t *testing.T) {
+	s, done := openStore(t)
+	defer done()
+
+	sub, _ := s.Subscribe("ana", "https://lab.example.org/hook", []string{JobCompleted})
+	now := time.Now()
+	for i, age := range []time.Duration{48 * time.Hour, 36 * time.Hour, time.Hour} {
+		p := pending{ID: fmt.Sprint(i), SubscriptionID: sub.ID, Event: JobCompleted, Created: now.Add(-age)}
+		if err := s.record(p, Delivery{ID: p.ID, SubscriptionID: sub.ID, Delivered: true, Time: now.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := s.PurgeDeliveries(now.Add(-24 * time.Hour))
+	if err != nil || removed != 2 {
+		t.Errorf("PurgeDeliveries() = %v, %v", removed, err)
+		t.Errorf("Output should be: %v, %v", 2, nil)
+	}
+	if log, _ := s.Deliveries("ana", sub.ID); len(log) != 1 || log[0].ID != "2" {
+		t.Errorf("Deliveries() = %+v, only the recent delivery should be kept", log)
+	}
+}